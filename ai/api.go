@@ -0,0 +1,82 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/qiniu/api.v7/auth/qbox"
+	"github.com/qiniu/api.v7/storage"
+)
+
+// 智能多媒体服务域名
+var (
+	AiHost = "https://ai.qiniuapi.com"
+)
+
+// Manager 提供了智能多媒体服务相关的功能
+type Manager struct {
+	Client storage.Client
+
+	// 可选。服务地址，比如 "https://ai.qiniuapi.com"，不设定则为 AiHost
+	Host string
+}
+
+// NewManager 用来构建一个新的 Manager
+func NewManager(mac *qbox.Mac) *Manager {
+	return NewManagerEx(mac, nil)
+}
+
+// NewManagerEx 用来构建一个新的 Manager，tr 为实际发送请求的 http.RoundTripper，可以为 nil
+func NewManagerEx(mac *qbox.Mac, tr http.RoundTripper) *Manager {
+	return &Manager{
+		Client: storage.Client{Client: &http.Client{Transport: qbox.NewTransport(mac, qbox.AuthQiniu, tr)}},
+	}
+}
+
+func (m *Manager) reqURL(path string) string {
+	host := m.Host
+	if host == "" {
+		host = AiHost
+	}
+	return strings.TrimRight(host, "/") + path
+}
+
+// 异步任务的状态
+const (
+	JobWaiting     = "WAITING"
+	JobDoing       = "DOING"
+	JobRescheduled = "RESCHEDULED"
+	JobFailed      = "FAILED"
+	JobFinished    = "FINISHED"
+)
+
+// jobDone 返回异步任务是否已经结束
+func jobDone(status string) bool {
+	return status == JobFailed || status == JobFinished
+}
+
+// 查询异步任务状态的最长间隔
+const maxJobWaitInterval = 30 * time.Second
+
+// waitJob 调用 query 查询异步任务的状态直到任务结束或者 ctx 被取消，查询的间隔从 interval 开始每次加倍
+func waitJob(ctx context.Context, interval time.Duration, query func() (done bool, err error)) (err error) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	for {
+		var done bool
+		if done, err = query(); err != nil || done {
+			return
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if interval *= 2; interval > maxJobWaitInterval {
+			interval = maxJobWaitInterval
+		}
+	}
+}
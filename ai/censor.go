@@ -0,0 +1,204 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 内容审核的场景
+const (
+	ScenePulp       = "pulp"       // 涉黄
+	SceneTerror     = "terror"     // 暴恐
+	ScenePolitician = "politician" // 敏感人物
+)
+
+// DefaultCensorScenes 为不指定场景的时候使用的全部场景
+var DefaultCensorScenes = []string{ScenePulp, SceneTerror, ScenePolitician}
+
+// 审核的建议
+const (
+	SuggestionPass   = "pass"   // 通过
+	SuggestionReview = "review" // 需要人工复审
+	SuggestionBlock  = "block"  // 违规
+)
+
+// ErrNoURI 表示没有指定需要处理的资源的链接
+var ErrNoURI = errors.New("ai: uri is required")
+
+// CensorDetail 为一个场景中的一项识别结果
+type CensorDetail struct {
+	Suggestion string  `json:"suggestion"`
+	Label      string  `json:"label"`
+	Score      float64 `json:"score"`
+	Group      string  `json:"group,omitempty"`
+	Pts        [][]int `json:"pts,omitempty"` // 识别出的区域的坐标
+}
+
+// CensorSceneResult 为一个场景的审核结果
+type CensorSceneResult struct {
+	Suggestion string         `json:"suggestion"`
+	Details    []CensorDetail `json:"details,omitempty"`
+}
+
+// ImageCensorResult 为图片审核的结果，Suggestion 为综合各个场景的建议
+type ImageCensorResult struct {
+	Suggestion string                       `json:"suggestion"`
+	Scenes     map[string]CensorSceneResult `json:"scenes"`
+}
+
+type censorData struct {
+	URI string `json:"uri"`
+	ID  string `json:"id,omitempty"`
+}
+
+type imageCensorReq struct {
+	Data   censorData `json:"data"`
+	Params struct {
+		Scenes []string `json:"scenes"`
+	} `json:"params"`
+}
+
+type imageCensorRet struct {
+	Code    int               `json:"code"`
+	Message string            `json:"message"`
+	Result  ImageCensorResult `json:"result"`
+}
+
+func scenesOrDefault(scenes []string) []string {
+	if len(scenes) == 0 {
+		return DefaultCensorScenes
+	}
+	return scenes
+}
+
+// ImageCensor 同步审核图片，uri 为图片的链接，私有空间的图片需要使用签名的链接，scenes 为空的时候审核全部场景
+func (m *Manager) ImageCensor(ctx context.Context, uri string, scenes []string) (ret ImageCensorResult, err error) {
+	if uri == "" {
+		err = ErrNoURI
+		return
+	}
+	var req imageCensorReq
+	req.Data.URI = uri
+	req.Params.Scenes = scenesOrDefault(scenes)
+
+	var resp imageCensorRet
+	if err = m.Client.CallWithJson(ctx, &resp, "POST", m.reqURL("/v3/image/censor"), nil, &req); err != nil {
+		return
+	}
+	if resp.Code != 200 {
+		err = fmt.Errorf("image censor: %d %s", resp.Code, resp.Message)
+		return
+	}
+	ret = resp.Result
+	return
+}
+
+// VideoCensorParams 为视频审核的参数
+type VideoCensorParams struct {
+	Scenes []string // 可选。审核的场景，不设定则为全部场景
+
+	// 可选。截帧的间隔，单位为毫秒，不设定则使用服务端的默认值
+	IntervalMsecs int
+
+	// 可选。审核结束之后通知的地址，通知的内容和 VideoCensorJob 相同
+	HookURL string
+}
+
+type cutParam struct {
+	IntervalMsecs int `json:"interval_msecs"`
+}
+
+type videoCensorReq struct {
+	Data   censorData `json:"data"`
+	Params struct {
+		Scenes   []string  `json:"scenes"`
+		CutParam *cutParam `json:"cut_param,omitempty"`
+		HookURL  string    `json:"hook_url,omitempty"`
+	} `json:"params"`
+}
+
+// VideoCut 为一个截帧的审核结果，Offset 为截帧在视频中的时间，单位为毫秒
+type VideoCut struct {
+	Suggestion string         `json:"suggestion"`
+	Offset     int64          `json:"offset"`
+	URI        string         `json:"uri,omitempty"`
+	Details    []CensorDetail `json:"details,omitempty"`
+}
+
+// VideoSceneResult 为视频一个场景的审核结果
+type VideoSceneResult struct {
+	Suggestion string     `json:"suggestion"`
+	Cuts       []VideoCut `json:"cuts,omitempty"`
+}
+
+// VideoCensorResult 为视频审核的结果
+type VideoCensorResult struct {
+	Suggestion string                      `json:"suggestion"`
+	Scenes     map[string]VideoSceneResult `json:"scenes"`
+}
+
+// VideoCensorJob 为视频审核任务的状态，Status 为 JobFinished 的时候 Result 有效
+type VideoCensorJob struct {
+	ID      string `json:"id"`
+	Vid     string `json:"vid,omitempty"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	Result  struct {
+		Code    int               `json:"code"`
+		Message string            `json:"message"`
+		Result  VideoCensorResult `json:"result"`
+	} `json:"result"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Done 返回任务是否已经结束
+func (j *VideoCensorJob) Done() bool {
+	return jobDone(j.Status)
+}
+
+// VideoCensor 提交异步的视频审核任务，uri 为视频的链接，vid 为可选的业务侧的视频 ID，params 可以为 nil。
+// 返回的 jobID 用于 GetVideoCensorJob 和 WaitVideoCensor
+func (m *Manager) VideoCensor(ctx context.Context, uri, vid string, params *VideoCensorParams) (jobID string, err error) {
+	if uri == "" {
+		err = ErrNoURI
+		return
+	}
+	if params == nil {
+		params = &VideoCensorParams{}
+	}
+	var req videoCensorReq
+	req.Data = censorData{URI: uri, ID: vid}
+	req.Params.Scenes = scenesOrDefault(params.Scenes)
+	req.Params.HookURL = params.HookURL
+	if params.IntervalMsecs > 0 {
+		req.Params.CutParam = &cutParam{IntervalMsecs: params.IntervalMsecs}
+	}
+
+	var ret struct {
+		Job string `json:"job"`
+	}
+	if err = m.Client.CallWithJson(ctx, &ret, "POST", m.reqURL("/v3/video/censor"), nil, &req); err != nil {
+		return
+	}
+	jobID = ret.Job
+	return
+}
+
+// GetVideoCensorJob 查询视频审核任务的状态
+func (m *Manager) GetVideoCensorJob(ctx context.Context, jobID string) (job VideoCensorJob, err error) {
+	err = m.Client.Call(ctx, &job, "GET", m.reqURL("/v3/jobs/video/"+jobID), nil)
+	return
+}
+
+// WaitVideoCensor 查询视频审核任务的状态，直到任务结束或者 ctx 被取消，
+// 查询的间隔从 interval 开始（不设定则为 1 秒），每次加倍，最长为 30 秒
+func (m *Manager) WaitVideoCensor(ctx context.Context, jobID string, interval time.Duration) (job VideoCensorJob, err error) {
+	err = waitJob(ctx, interval, func() (done bool, err error) {
+		job, err = m.GetVideoCensorJob(ctx, jobID)
+		return job.Done(), err
+	})
+	return
+}
@@ -0,0 +1,100 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qiniu/api.v7/auth/qbox"
+)
+
+func newTestManager(handler http.HandlerFunc) (*Manager, *httptest.Server) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.Header.Get("Authorization"), "Qiniu ak:") {
+			http.Error(w, `{"error":"bad token"}`, http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		handler(w, req)
+	}))
+	m := NewManager(qbox.NewMac("ak", "sk"))
+	m.Host = server.URL
+	return m, server
+}
+
+func TestImageCensor(t *testing.T) {
+	var body map[string]interface{}
+	m, server := newTestManager(func(w http.ResponseWriter, req *http.Request) {
+		json.NewDecoder(req.Body).Decode(&body)
+		w.Write([]byte(`{"code":200,"message":"OK","result":{"suggestion":"block","scenes":{` +
+			`"pulp":{"suggestion":"block","details":[{"suggestion":"block","label":"pulp","score":0.99}]},` +
+			`"terror":{"suggestion":"pass","details":[{"suggestion":"pass","label":"normal","score":0.9}]}}}}`))
+	})
+	defer server.Close()
+
+	ret, err := m.ImageCensor(context.Background(), "https://a.com/1.jpg", []string{ScenePulp, SceneTerror})
+	if err != nil || ret.Suggestion != SuggestionBlock {
+		t.Fatalf("ImageCensor() error, %v, %+v", err, ret)
+	}
+	pulp := ret.Scenes[ScenePulp]
+	if pulp.Suggestion != SuggestionBlock || len(pulp.Details) != 1 || pulp.Details[0].Score != 0.99 {
+		t.Fatalf("ImageCensor() wrong pulp result, %+v", pulp)
+	}
+	if body["data"].(map[string]interface{})["uri"] != "https://a.com/1.jpg" ||
+		len(body["params"].(map[string]interface{})["scenes"].([]interface{})) != 2 {
+		t.Fatalf("ImageCensor() wrong request body, %v", body)
+	}
+	if _, err = m.ImageCensor(context.Background(), "", nil); err != ErrNoURI {
+		t.Fatalf("ImageCensor() should fail without uri, %v", err)
+	}
+}
+
+func TestVideoCensor(t *testing.T) {
+	var body videoCensorReq
+	queries := 0
+	m, server := newTestManager(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v3/video/censor":
+			json.NewDecoder(req.Body).Decode(&body)
+			w.Write([]byte(`{"job":"job1"}`))
+		case "/v3/jobs/video/job1":
+			if queries++; queries < 3 {
+				w.Write([]byte(`{"id":"job1","vid":"v1","status":"DOING"}`))
+				return
+			}
+			w.Write([]byte(`{"id":"job1","vid":"v1","status":"FINISHED","result":{"code":200,"message":"OK",` +
+				`"result":{"suggestion":"review","scenes":{"politician":{"suggestion":"review",` +
+				`"cuts":[{"suggestion":"review","offset":5000,"details":[{"suggestion":"review","label":"x","score":0.6}]}]}}}},` +
+				`"created_at":"2020-01-02T15:04:05Z","updated_at":"2020-01-02T15:05:05Z"}`))
+		default:
+			http.NotFound(w, req)
+		}
+	})
+	defer server.Close()
+
+	jobID, err := m.VideoCensor(context.Background(), "https://a.com/1.mp4", "v1",
+		&VideoCensorParams{IntervalMsecs: 5000, HookURL: "https://b.com/hook"})
+	if err != nil || jobID != "job1" {
+		t.Fatalf("VideoCensor() error, %v, %s", err, jobID)
+	}
+	if body.Data.ID != "v1" || len(body.Params.Scenes) != 3 || body.Params.CutParam == nil ||
+		body.Params.CutParam.IntervalMsecs != 5000 || body.Params.HookURL != "https://b.com/hook" {
+		t.Fatalf("VideoCensor() wrong request body, %+v", body)
+	}
+
+	job, err := m.WaitVideoCensor(context.Background(), jobID, time.Millisecond)
+	if err != nil || !job.Done() || queries != 3 {
+		t.Fatalf("WaitVideoCensor() error, %v, %+v", err, job)
+	}
+	cuts := job.Result.Result.Scenes[ScenePolitician].Cuts
+	if job.Result.Result.Suggestion != SuggestionReview || len(cuts) != 1 || cuts[0].Offset != 5000 {
+		t.Fatalf("WaitVideoCensor() wrong result, %+v", job.Result)
+	}
+	if job.UpdatedAt.Sub(job.CreatedAt) != time.Minute {
+		t.Fatalf("WaitVideoCensor() wrong time, %v, %v", job.CreatedAt, job.UpdatedAt)
+	}
+}
@@ -0,0 +1,3 @@
+// ai 包提供了七牛智能多媒体服务的常见功能，相关功能的文档参考：https://developer.qiniu.com/censor。
+// 目前提供了图片和视频的内容审核，身份证和通用文字识别，图片分类等功能，请求使用 "Qiniu" 方式的管理凭证签名。
+package ai
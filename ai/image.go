@@ -0,0 +1,104 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// v1Ret 为 /v1 接口的响应内容，Code 为 0 表示成功
+type v1Ret struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Result  json.RawMessage `json:"result"`
+}
+
+// callV1 使用图片链接调用 /v1 接口，解析 result 到 ret
+func (m *Manager) callV1(ctx context.Context, path, uri string, params interface{}, ret interface{}) (err error) {
+	if uri == "" {
+		return ErrNoURI
+	}
+	req := struct {
+		Data   censorData  `json:"data"`
+		Params interface{} `json:"params,omitempty"`
+	}{Data: censorData{URI: uri}, Params: params}
+
+	var resp v1Ret
+	if err = m.Client.CallWithJson(ctx, &resp, "POST", m.reqURL(path), nil, &req); err != nil {
+		return
+	}
+	if resp.Code != 0 {
+		return fmt.Errorf("%s: %d %s", path, resp.Code, resp.Message)
+	}
+	if len(resp.Result) > 0 {
+		err = json.Unmarshal(resp.Result, ret)
+	}
+	return
+}
+
+// 身份证的正反面
+const (
+	IDCardFront = 0 // 人像面
+	IDCardBack  = 1 // 国徽面
+)
+
+// IDCardInfo 为身份证的识别结果，Side 为 IDCardFront 的时候人像面的字段有效，否则国徽面的字段有效
+type IDCardInfo struct {
+	Side   int     `json:"type"`
+	Bboxes [][]int `json:"bboxes,omitempty"` // 各个字段在图片中的位置
+	Res    struct {
+		Name      string `json:"name,omitempty"`
+		Gender    string `json:"sex,omitempty"`
+		Nation    string `json:"nation,omitempty"`
+		Birthday  string `json:"birth,omitempty"`
+		Address   string `json:"address,omitempty"`
+		IDNumber  string `json:"id_number,omitempty"`
+		IssuedBy  string `json:"issued_by,omitempty"`
+		ValidThru string `json:"validthru,omitempty"`
+	} `json:"res"`
+}
+
+// IDCardOCR 识别 uri 指向的身份证图片，私有空间的图片需要使用签名的链接，
+// 比如上传之后使用 storage.MakePrivateURL 生成的链接
+func (m *Manager) IDCardOCR(ctx context.Context, uri string) (ret IDCardInfo, err error) {
+	err = m.callV1(ctx, "/v1/ocr/idcard", uri, nil, &ret)
+	return
+}
+
+// TextLine 为识别出的一行文字，Box 为四个顶点的坐标
+type TextLine struct {
+	Text  string   `json:"text"`
+	Box   [][2]int `json:"bbox"`
+	Score float64  `json:"score"`
+}
+
+// TextOCR 识别 uri 指向的图片中的文字，按照从上到下的顺序返回每一行
+func (m *Manager) TextOCR(ctx context.Context, uri string) (lines []TextLine, err error) {
+	var ret struct {
+		Lines []TextLine `json:"lines"`
+	}
+	err = m.callV1(ctx, "/v1/ocr/text", uri, nil, &ret)
+	lines = ret.Lines
+	return
+}
+
+// ImageLabel 为图片分类的一个结果
+type ImageLabel struct {
+	Class   string  `json:"class"`
+	ClassCN string  `json:"label_cn,omitempty"`
+	Score   float64 `json:"score"`
+}
+
+// ImageLabels 对 uri 指向的图片进行分类，返回按照置信度从高到低排列的结果，limit 大于 0 的时候最多返回 limit 个
+func (m *Manager) ImageLabels(ctx context.Context, uri string, limit int) (labels []ImageLabel, err error) {
+	var params interface{}
+	if limit > 0 {
+		params = map[string]int{"limit": limit}
+	}
+	var ret struct {
+		Labels []ImageLabel `json:"labels"`
+	}
+	err = m.callV1(ctx, "/v1/image/label", uri, params, &ret)
+	labels = ret.Labels
+	return
+}
@@ -0,0 +1,59 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestImageRecognition(t *testing.T) {
+	var params map[string]interface{}
+	m, server := newTestManager(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Data   censorData             `json:"data"`
+			Params map[string]interface{} `json:"params"`
+		}
+		json.NewDecoder(req.Body).Decode(&body)
+		params = body.Params
+		if body.Data.URI == "https://a.com/bad.jpg" {
+			w.Write([]byte(`{"code":4000201,"message":"image is not an id card"}`))
+			return
+		}
+		switch req.URL.Path {
+		case "/v1/ocr/idcard":
+			w.Write([]byte(`{"code":0,"result":{"type":0,"res":{"name":"张三","sex":"男","id_number":"110101199001011234"}}}`))
+		case "/v1/ocr/text":
+			w.Write([]byte(`{"code":0,"result":{"lines":[{"text":"七牛云","bbox":[[0,0],[10,0],[10,5],[0,5]],"score":0.98}]}}`))
+		case "/v1/image/label":
+			w.Write([]byte(`{"code":0,"result":{"labels":[{"class":"dog","label_cn":"狗","score":0.93}]}}`))
+		default:
+			http.NotFound(w, req)
+		}
+	})
+	defer server.Close()
+
+	card, err := m.IDCardOCR(context.Background(), "https://a.com/card.jpg")
+	if err != nil || card.Side != IDCardFront || card.Res.Name != "张三" || card.Res.IDNumber != "110101199001011234" {
+		t.Fatalf("IDCardOCR() error, %v, %+v", err, card)
+	}
+	if _, err = m.IDCardOCR(context.Background(), "https://a.com/bad.jpg"); err == nil {
+		t.Fatal("IDCardOCR() should fail when code is not 0")
+	}
+
+	lines, err := m.TextOCR(context.Background(), "https://a.com/text.jpg")
+	if err != nil || len(lines) != 1 || lines[0].Text != "七牛云" || lines[0].Box[2] != [2]int{10, 5} {
+		t.Fatalf("TextOCR() error, %v, %+v", err, lines)
+	}
+
+	labels, err := m.ImageLabels(context.Background(), "https://a.com/dog.jpg", 3)
+	if err != nil || len(labels) != 1 || labels[0].Class != "dog" || labels[0].ClassCN != "狗" {
+		t.Fatalf("ImageLabels() error, %v, %+v", err, labels)
+	}
+	if params["limit"] != float64(3) {
+		t.Fatalf("ImageLabels() wrong params, %v", params)
+	}
+	if _, err = m.ImageLabels(context.Background(), "", 0); err != ErrNoURI {
+		t.Fatalf("ImageLabels() should fail without uri, %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package qbox
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"sync/atomic"
+)
+
+// Credentials 用来提供签名使用的 AK/SK，实现者可以在运行时更换密钥，使用它的管理对象不需要重新构建。
+// *Mac 本身也实现了 Credentials，总是返回自己。
+type Credentials interface {
+	// Get 返回当前使用的密钥，返回的 Mac 不应该被修改
+	Get() *Mac
+}
+
+// Get 返回 mac 本身，使 *Mac 可以作为 Credentials 使用
+func (mac *Mac) Get() *Mac {
+	return mac
+}
+
+// RotatingCredentials 是可以在运行时更换密钥的 Credentials，可以被多个 Goroutine 同时使用
+type RotatingCredentials struct {
+	mac  atomic.Value // *Mac
+	path string
+}
+
+// NewRotatingCredentials 用来构建一个初始密钥为 mac 的 RotatingCredentials
+func NewRotatingCredentials(mac *Mac) *RotatingCredentials {
+	c := &RotatingCredentials{}
+	c.mac.Store(mac)
+	return c
+}
+
+// NewFileCredentials 用来构建一个从文件中读取密钥的 RotatingCredentials，
+// 文件的内容为 {"access_key": "<AccessKey>", "secret_key": "<SecretKey>"}。
+// 更新文件之后调用 Reload 重新读取密钥。
+func NewFileCredentials(path string) (c *RotatingCredentials, err error) {
+	mac, err := loadCredentialsFile(path)
+	if err != nil {
+		return
+	}
+	c = NewRotatingCredentials(mac)
+	c.path = path
+	return
+}
+
+// Get 返回当前使用的密钥
+func (c *RotatingCredentials) Get() *Mac {
+	return c.mac.Load().(*Mac)
+}
+
+// Set 更换密钥，之后的请求使用新的密钥签名
+func (c *RotatingCredentials) Set(mac *Mac) {
+	c.mac.Store(mac)
+}
+
+// Reload 重新从文件中读取密钥，读取失败的时候继续使用原来的密钥。
+// 只能用于 NewFileCredentials 构建的 RotatingCredentials。
+func (c *RotatingCredentials) Reload() (err error) {
+	if c.path == "" {
+		return errors.New("credentials are not loaded from a file")
+	}
+	mac, err := loadCredentialsFile(c.path)
+	if err != nil {
+		return
+	}
+	c.Set(mac)
+	return
+}
+
+func loadCredentialsFile(path string) (mac *Mac, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	var keys struct {
+		AccessKey string `json:"access_key"`
+		SecretKey string `json:"secret_key"`
+	}
+	if err = json.Unmarshal(data, &keys); err != nil {
+		return
+	}
+	if keys.AccessKey == "" || keys.SecretKey == "" {
+		err = errors.New("access_key and secret_key are required in the credentials file")
+		return
+	}
+	mac = NewMac(keys.AccessKey, keys.SecretKey)
+	return
+}
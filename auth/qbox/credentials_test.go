@@ -0,0 +1,47 @@
+package qbox
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFileCredentials(t *testing.T) {
+	f, err := ioutil.TempFile("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"access_key":"ak1","secret_key":"sk1"}`)
+	f.Close()
+
+	c, err := NewFileCredentials(f.Name())
+	if err != nil {
+		t.Fatalf("NewFileCredentials() error, %s", err)
+	}
+	if mac := c.Get(); mac.AccessKey != "ak1" || string(mac.SecretKey) != "sk1" {
+		t.Fatalf("RotatingCredentials#Get() error, unexpected mac %+v", mac)
+	}
+
+	ioutil.WriteFile(f.Name(), []byte(`{"access_key":"ak2","secret_key":"sk2"}`), 0600)
+	if err = c.Reload(); err != nil {
+		t.Fatalf("RotatingCredentials#Reload() error, %s", err)
+	}
+	if mac := c.Get(); mac.AccessKey != "ak2" || string(mac.SecretKey) != "sk2" {
+		t.Fatalf("RotatingCredentials#Reload() error, unexpected mac %+v", mac)
+	}
+
+	// 读取失败的时候继续使用原来的密钥
+	ioutil.WriteFile(f.Name(), []byte(`{"access_key":"ak3"}`), 0600)
+	if err = c.Reload(); err == nil {
+		t.Fatalf("RotatingCredentials#Reload() should fail without secret_key")
+	}
+	if mac := c.Get(); mac.AccessKey != "ak2" {
+		t.Fatalf("RotatingCredentials#Reload() error, unexpected mac %+v", mac)
+	}
+
+	var creds Credentials = NewMac("ak", "sk")
+	if creds.Get().AccessKey != "ak" {
+		t.Fatalf("Mac#Get() error")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 
 	"github.com/qiniu/api.v7/conf"
@@ -106,17 +107,65 @@ func (mac *Mac) SignRequestV2(req *http.Request) (token string, err error) {
 	return
 }
 
+// AuthType 表示管理凭证的签名方式
+type AuthType int
+
+const (
+	// AuthQBox 为 "QBox <AccessKey>:<Sign>" 的签名方式，签名包括请求的路径、查询参数以及表单格式的 body
+	AuthQBox AuthType = iota
+
+	// AuthQiniu 为 "Qiniu <AccessKey>:<Sign>" 的签名方式，签名包括请求的方法、路径、查询参数、Host、
+	// Content-Type 以及表单或者 JSON 格式的 body，新的 API 一般要求使用这种签名方式
+	AuthQiniu
+
+	// AuthAuto 在请求的 body 为 JSON 格式的时候使用 AuthQiniu，因为 AuthQBox 的签名不包括 JSON 格式的 body，否则使用 AuthQBox
+	AuthAuto
+)
+
+// Authorization 按照 authType 指定的签名方式生成请求的 Authorization 头部
+func (mac *Mac) Authorization(req *http.Request, authType AuthType) (auth string, err error) {
+	if authType == AuthAuto {
+		authType = AuthQBox
+		if mediaType(req) == conf.CONTENT_TYPE_JSON {
+			authType = AuthQiniu
+		}
+	}
+
+	switch authType {
+	case AuthQiniu:
+		token, sErr := mac.SignRequestV2(req)
+		if sErr != nil {
+			return "", sErr
+		}
+		auth = "Qiniu " + token
+	default:
+		token, sErr := mac.SignRequest(req)
+		if sErr != nil {
+			return "", sErr
+		}
+		auth = "QBox " + token
+	}
+	return
+}
+
+// mediaType 返回请求 Content-Type 中的媒体类型，不包括 charset 等参数
+func mediaType(req *http.Request) string {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return mediaType
+}
+
 // 管理凭证生成时，是否同时对request body进行签名
 func incBody(req *http.Request) bool {
-	return req.Body != nil && req.Header.Get("Content-Type") == conf.CONTENT_TYPE_FORM
+	return req.Body != nil && mediaType(req) == conf.CONTENT_TYPE_FORM
 }
 
 func incBodyV2(req *http.Request) bool {
-	contentType := req.Header.Get("Content-Type")
+	contentType := mediaType(req)
 	return req.Body != nil && (contentType == conf.CONTENT_TYPE_FORM || contentType == conf.CONTENT_TYPE_JSON)
 }
 
-// VerifyCallback 验证上传回调请求是否来自七牛
+// VerifyCallback 验证上传回调请求是否来自七牛，签名只包括表单格式的 body，
+// JSON 格式的回调请求请使用 storage.VerifyCallback 检查包括 body 在内的签名
 func (mac *Mac) VerifyCallback(req *http.Request) (bool, error) {
 	auth := req.Header.Get("Authorization")
 	if auth == "" {
@@ -0,0 +1,70 @@
+package qbox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/qiniu/api.v7/conf"
+)
+
+// Transport 是对每个请求进行签名的 http.RoundTripper，可以用来访问 SDK 中还没有封装的 API
+type Transport struct {
+	// 用来签名的密钥，可以是 *Mac 或者 RotatingCredentials
+	Credentials Credentials
+
+	// 签名方式，默认为 AuthQBox
+	AuthType AuthType
+
+	// 实际发送请求的 http.RoundTripper，不设定则为 http.DefaultTransport
+	Transport http.RoundTripper
+}
+
+// NewTransport 用来构建一个使用 creds 按照 authType 指定的方式对请求签名的 Transport，tr 可以为 nil
+func NewTransport(creds Credentials, authType AuthType, tr http.RoundTripper) *Transport {
+	return &Transport{Credentials: creds, AuthType: authType, Transport: tr}
+}
+
+// RoundTrip 对请求签名之后发送请求，不修改传入的请求的头部。
+// 请求没有设置 Content-Type 的时候，如果 body 为 JSON 格式则自动设置为 application/json，使签名包括 body。
+func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	req2 := new(http.Request)
+	*req2 = *req
+	req2.Header = make(http.Header, len(req.Header)+2)
+	for k, v := range req.Header {
+		req2.Header[k] = v
+	}
+	if req2.Body != nil && req2.Header.Get("Content-Type") == "" {
+		if err = detectJSONBody(req2); err != nil {
+			return
+		}
+	}
+
+	auth, err := t.Credentials.Get().Authorization(req2, t.AuthType)
+	if err != nil {
+		return
+	}
+	req2.Header.Set("Authorization", auth)
+
+	tr := t.Transport
+	if tr == nil {
+		tr = http.DefaultTransport
+	}
+	return tr.RoundTrip(req2)
+}
+
+// detectJSONBody 读取请求的 body，body 以 '{' 或者 '[' 开头的时候设置 Content-Type 为 application/json
+func detectJSONBody(req *http.Request) (err error) {
+	data, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		req.Header.Set("Content-Type", conf.CONTENT_TYPE_JSON)
+	}
+	return
+}
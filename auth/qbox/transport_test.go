@@ -0,0 +1,102 @@
+package qbox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTransport(t *testing.T) {
+	mac := NewMac("ak", "sk")
+	var auth, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		expected, err := mac.Authorization(req, AuthQiniu)
+		if err != nil {
+			t.Errorf("Mac#Authorization() error, %s", err)
+		}
+		auth = req.Header.Get("Authorization")
+		if auth != expected {
+			t.Errorf("Transport#RoundTrip() error, authorization %s, expected %s", auth, expected)
+		}
+		buf := make([]byte, 16)
+		n, _ := req.Body.Read(buf)
+		body = string(buf[:n])
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewTransport(mac, AuthQiniu, nil)}
+	req, _ := http.NewRequest("POST", server.URL+"/v2/api?a=b", strings.NewReader(`{"a":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Transport#RoundTrip() error, %s", err)
+	}
+	resp.Body.Close()
+
+	if !strings.HasPrefix(auth, "Qiniu ak:") || body != `{"a":1}` {
+		t.Fatalf("Transport#RoundTrip() error, authorization %s, body %s", auth, body)
+	}
+	if req.Header.Get("Authorization") != "" {
+		t.Fatalf("Transport#RoundTrip() error, the original request should not be modified")
+	}
+}
+
+func TestTransportAuthAuto(t *testing.T) {
+	mac := NewMac("ak", "sk")
+	auths := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		expected, err := mac.Authorization(req, AuthAuto)
+		if err != nil {
+			t.Errorf("Mac#Authorization() error, %s", err)
+		}
+		if auth := req.Header.Get("Authorization"); auth != expected {
+			t.Errorf("Transport#RoundTrip() error, authorization %s, expected %s", auth, expected)
+		}
+		auths[req.URL.Path] = req.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewTransport(mac, AuthAuto, nil)}
+	for path, body := range map[string]string{"/json": ` {"a":1}`, "/form": "a=1"} {
+		req, _ := http.NewRequest("POST", server.URL+path, strings.NewReader(body))
+		if path == "/form" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Transport#RoundTrip() error, %s", err)
+		}
+		resp.Body.Close()
+	}
+
+	if !strings.HasPrefix(auths["/json"], "Qiniu ") || !strings.HasPrefix(auths["/form"], "QBox ") {
+		t.Fatalf("Transport#RoundTrip() error, unexpected authorizations %v", auths)
+	}
+}
+
+func TestAuthorizationWithCharset(t *testing.T) {
+	mac := NewMac("ak", "sk")
+	sign := func(contentType, body string, authType AuthType) string {
+		req, _ := http.NewRequest("POST", "http://api.qiniu.com/v2/api", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		auth, err := mac.Authorization(req, authType)
+		if err != nil {
+			t.Fatalf("Mac#Authorization() error, %s", err)
+		}
+		return auth
+	}
+
+	// 带有 charset 参数的 Content-Type 也要对 body 签名
+	for _, authType := range []AuthType{AuthAuto, AuthQiniu} {
+		auth1 := sign("application/json; charset=utf-8", `{"a":1}`, authType)
+		auth2 := sign("application/json; charset=utf-8", `{"a":2}`, authType)
+		if !strings.HasPrefix(auth1, "Qiniu ") || auth1 == auth2 {
+			t.Fatalf("Mac#Authorization(%d) should include the json body, got %s and %s", authType, auth1, auth2)
+		}
+	}
+	form := "application/x-www-form-urlencoded; charset=utf-8"
+	if sign(form, "a=1", AuthQBox) == sign(form, "a=2", AuthQBox) {
+		t.Fatal("Mac#Authorization() should include the form body")
+	}
+}
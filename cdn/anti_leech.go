@@ -10,13 +10,20 @@ import (
 // CreateTimestampAntileechURL 用来构建七牛CDN时间戳防盗链的访问链接
 func CreateTimestampAntileechURL(urlStr string, encryptKey string,
 	durationInSeconds int64) (antileechURL string, err error) {
-	u, err := url.Parse(urlStr)
+	expires := time.Now().Add(time.Second * time.Duration(durationInSeconds))
+	return SignTimestampURL(encryptKey, urlStr, expires)
+}
+
+// SignTimestampURL 用来构建七牛CDN时间戳防盗链的访问链接，key 为域名配置的防盗链密钥，链接在 expires 之后失效。
+// 签名为 md5(key + 转义之后的路径 + 十六进制的过期时间)，通过查询参数 sign 和 t 传递，rawURL 原有的查询参数保持不变
+func SignTimestampURL(key string, rawURL string, expires time.Time) (signedURL string, err error) {
+	u, err := url.Parse(rawURL)
 	if err != nil {
 		return
 	}
 
-	expireTime := time.Now().Add(time.Second * time.Duration(durationInSeconds)).Unix()
-	toSignStr := fmt.Sprintf("%s%s%x", encryptKey, u.EscapedPath(), expireTime)
+	expireTime := expires.Unix()
+	toSignStr := fmt.Sprintf("%s%s%x", key, u.EscapedPath(), expireTime)
 	signedStr := fmt.Sprintf("%x", md5.Sum([]byte(toSignStr)))
 
 	q := url.Values{}
@@ -24,9 +31,9 @@ func CreateTimestampAntileechURL(urlStr string, encryptKey string,
 	q.Add("t", fmt.Sprintf("%x", expireTime))
 
 	if u.RawQuery == "" {
-		antileechURL = u.String() + "?" + q.Encode()
+		signedURL = u.String() + "?" + q.Encode()
 	} else {
-		antileechURL = u.String() + "&" + q.Encode()
+		signedURL = u.String() + "&" + q.Encode()
 	}
 
 	return
@@ -1,7 +1,10 @@
 package cdn
 
 import (
+	"crypto/md5"
+	"fmt"
 	"testing"
+	"time"
 )
 
 func TestCreateTimestampAntiLeech(t *testing.T) {
@@ -36,3 +39,20 @@ func TestCreateTimestampAntiLeech(t *testing.T) {
 		})
 	}
 }
+
+func TestSignTimestampURL(t *testing.T) {
+	expires := time.Unix(0x5e0dc000, 0)
+	signedURL, err := SignTimestampURL("abc123", "http://www.example.com/图片/a b.jpg?imageView2/1/w/100", expires)
+	if err != nil {
+		t.Fatalf("SignTimestampURL() error, %s", err)
+	}
+	path := "/%E5%9B%BE%E7%89%87/a%20b.jpg"
+	sign := fmt.Sprintf("%x", md5.Sum([]byte("abc123"+path+"5e0dc000")))
+	want := "http://www.example.com" + path + "?imageView2/1/w/100&sign=" + sign + "&t=5e0dc000"
+	if signedURL != want {
+		t.Fatalf("SignTimestampURL() = %s, want %s", signedURL, want)
+	}
+	if _, err = SignTimestampURL("abc123", "http://[::1", expires); err == nil {
+		t.Fatal("SignTimestampURL() should fail with invalid url")
+	}
+}
@@ -14,12 +14,15 @@ import (
 
 // Fusion CDN服务域名
 var (
-	FusionHost = "http://fusion.qiniuapi.com"
+	FusionHost = "https://fusion.qiniuapi.com"
 )
 
 // CdnManager 提供了文件和目录刷新，文件预取，获取域名带宽和流量数据，获取域名日志列表等功能
 type CdnManager struct {
 	mac *qbox.Mac
+
+	// 可选。发送请求的客户端，用于设置代理、TLS 和连接池等参数，不设定则使用 http.DefaultClient
+	Client *http.Client
 }
 
 // NewCdnManager 用来构建一个新的 CdnManager
@@ -27,6 +30,18 @@ func NewCdnManager(mac *qbox.Mac) *CdnManager {
 	return &CdnManager{mac: mac}
 }
 
+// NewCdnManagerEx 用来构建一个通过 client 发送请求的 CdnManager，client 为 nil 的时候使用 http.DefaultClient
+func NewCdnManagerEx(mac *qbox.Mac, client *http.Client) *CdnManager {
+	return &CdnManager{mac: mac, Client: client}
+}
+
+func (m *CdnManager) httpClient() *http.Client {
+	if m.Client == nil {
+		return http.DefaultClient
+	}
+	return m.Client
+}
+
 // TrafficReq 为批量查询带宽/流量的API请求内容
 //	StartDate 	开始日期，格式例如：2016-07-01
 //	EndDate 	结束日期，格式例如：2016-07-03
@@ -68,7 +83,7 @@ func (m *CdnManager) GetBandwidthData(startDate, endDate, granularity string,
 		Domains:     domains,
 	}
 
-	resData, reqErr := postRequest(m.mac, "/v2/tune/bandwidth", reqBody)
+	resData, reqErr := postRequest(m.httpClient(), m.mac, "/v2/tune/bandwidth", reqBody)
 	if reqErr != nil {
 		err = reqErr
 		return
@@ -96,7 +111,7 @@ func (m *CdnManager) GetFluxData(startDate, endDate, granularity string,
 		Domains:     domains,
 	}
 
-	resData, reqErr := postRequest(m.mac, "/v2/tune/flux", reqBody)
+	resData, reqErr := postRequest(m.httpClient(), m.mac, "/v2/tune/flux", reqBody)
 	if reqErr != nil {
 		err = reqErr
 		return
@@ -150,14 +165,14 @@ func (m *CdnManager) RefreshUrlsAndDirs(urls, dirs []string) (result RefreshResp
 		Dirs: dirs,
 	}
 
-	resData, reqErr := postRequest(m.mac, "/v2/tune/refresh", reqBody)
+	resData, reqErr := postRequest(m.httpClient(), m.mac, "/v2/tune/refresh", reqBody)
 	if reqErr != nil {
 		err = reqErr
 		return
 	}
 	umErr := json.Unmarshal(resData, &result)
 	if umErr != nil {
-		err = reqErr
+		err = umErr
 		return
 	}
 
@@ -200,7 +215,7 @@ func (m *CdnManager) PrefetchUrls(urls []string) (result PrefetchResp, err error
 		Urls: urls,
 	}
 
-	resData, reqErr := postRequest(m.mac, "/v2/tune/prefetch", reqBody)
+	resData, reqErr := postRequest(m.httpClient(), m.mac, "/v2/tune/prefetch", reqBody)
 	if reqErr != nil {
 		err = reqErr
 		return
@@ -245,7 +260,7 @@ func (m *CdnManager) GetCdnLogList(day string, domains []string) (
 		Domains: strings.Join(domains, ";"),
 	}
 
-	resData, reqErr := postRequest(m.mac, "/v2/tune/log/list", logReq)
+	resData, reqErr := postRequest(m.httpClient(), m.mac, "/v2/tune/log/list", logReq)
 	if reqErr != nil {
 		err = fmt.Errorf("get response error, %s", reqErr)
 		return
@@ -265,7 +280,7 @@ func (m *CdnManager) GetCdnLogList(day string, domains []string) (
 }
 
 // RequestWithBody 带body对api发出请求并且返回response body
-func postRequest(mac *qbox.Mac, path string, body interface{}) (resData []byte,
+func postRequest(client *http.Client, mac *qbox.Mac, path string, body interface{}) (resData []byte,
 	err error) {
 	urlStr := fmt.Sprintf("%s%s", FusionHost, path)
 	reqData, _ := json.Marshal(body)
@@ -284,7 +299,7 @@ func postRequest(mac *qbox.Mac, path string, body interface{}) (resData []byte,
 	req.Header.Add("Authorization", "QBox "+accessToken)
 	req.Header.Add("Content-Type", "application/json")
 
-	resp, respErr := http.DefaultClient.Do(req)
+	resp, respErr := client.Do(req)
 	if respErr != nil {
 		err = respErr
 		return
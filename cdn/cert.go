@@ -0,0 +1,113 @@
+package cdn
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// CertInfo 为证书的信息，NotBefore 和 NotAfter 为 Unix 时间戳
+type CertInfo struct {
+	CertID     string   `json:"certid"`
+	Name       string   `json:"name"`
+	CommonName string   `json:"common_name"`
+	DNSNames   []string `json:"dnsnames"`
+	NotBefore  int64    `json:"not_before"`
+	NotAfter   int64    `json:"not_after"`
+	CreateTime int64    `json:"create_time"`
+}
+
+// Expired 返回证书在 t 的时候是否已经过期
+func (c *CertInfo) Expired(t time.Time) bool {
+	return t.Unix() > c.NotAfter
+}
+
+type uploadCertReq struct {
+	Name       string `json:"name"`
+	CommonName string `json:"common_name"`
+	Pri        string `json:"pri"`
+	CA         string `json:"ca"`
+}
+
+// UploadCert 上传 PEM 格式的证书和私钥，certPEM 可以包含中间证书，name 为证书的备注名。
+// 上传之前检查证书和私钥是否匹配，返回的证书 ID 用于 BindCert 或者 HTTPSConf.CertID
+func (m *CdnManager) UploadCert(name string, certPEM, keyPEM []byte) (certID string, err error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		err = fmt.Errorf("invalid certificate or private key, %s", err)
+		return
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return
+	}
+	req := uploadCertReq{
+		Name:       name,
+		CommonName: leaf.Subject.CommonName,
+		Pri:        string(keyPEM),
+		CA:         string(certPEM),
+	}
+	var ret struct {
+		CertID string `json:"certID"`
+	}
+	if err = callAPI(m.httpClient(), m.mac, "POST", "/sslcert", &req, &ret); err != nil {
+		return
+	}
+	certID = ret.CertID
+	return
+}
+
+// ListCerts 列举证书，marker 为上一次返回的 nextMarker，第一次为空，nextMarker 为空表示已经列举完成
+func (m *CdnManager) ListCerts(marker string, limit int) (certs []CertInfo, nextMarker string, err error) {
+	query := url.Values{}
+	if marker != "" {
+		query.Set("marker", marker)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	path := "/sslcert"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var ret struct {
+		Marker string     `json:"marker"`
+		Certs  []CertInfo `json:"certs"`
+	}
+	if err = callAPI(m.httpClient(), m.mac, "GET", path, nil, &ret); err != nil {
+		return
+	}
+	return ret.Certs, ret.Marker, nil
+}
+
+// GetCert 获取证书的信息
+func (m *CdnManager) GetCert(certID string) (cert CertInfo, err error) {
+	var ret struct {
+		Cert CertInfo `json:"cert"`
+	}
+	err = callAPI(m.httpClient(), m.mac, "GET", "/sslcert/"+certID, nil, &ret)
+	cert = ret.Cert
+	return
+}
+
+// DeleteCert 删除证书，正在被域名使用的证书不能删除
+func (m *CdnManager) DeleteCert(certID string) error {
+	return callAPI(m.httpClient(), m.mac, "DELETE", "/sslcert/"+certID, nil, nil)
+}
+
+// BindCert 将证书绑定到域名。HTTP 域名会被升级为 HTTPS，HTTPS 域名只更换证书，保留强制 HTTPS 和 HTTP/2 的配置
+func (m *CdnManager) BindCert(domain, certID string) (err error) {
+	info, err := m.GetDomain(domain)
+	if err != nil {
+		return
+	}
+	if info.Protocol != "https" {
+		return m.EnableHTTPS(domain, HTTPSConf{CertID: certID})
+	}
+	conf := info.HTTPS
+	conf.CertID = certID
+	return m.UpdateHTTPSConf(domain, conf)
+}
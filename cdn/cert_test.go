@@ -0,0 +1,89 @@
+package cdn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCert(t *testing.T, commonName string) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return
+}
+
+func TestCerts(t *testing.T) {
+	var reqs []fakeAPIRequest
+	defer func(host string) { DomainHost = host }(DomainHost)
+	server := newFakeAPIServer(&reqs, map[string]string{
+		"POST /sslcert":                   `{"certID":"c1"}`,
+		"GET /sslcert":                    `{"marker":"m2","certs":[{"certid":"c1","name":"a","common_name":"cdn.a.com","not_after":1577836800}]}`,
+		"GET /sslcert/c1":                 `{"cert":{"certid":"c1","common_name":"cdn.a.com","dnsnames":["cdn.a.com"]}}`,
+		"DELETE /sslcert/c1":              `{}`,
+		"GET /domain/cdn.a.com":           `{"name":"cdn.a.com","protocol":"https","https":{"certId":"c0","forceHttps":true,"http2Enable":true}}`,
+		"GET /domain/cdn.b.com":           `{"name":"cdn.b.com","protocol":"http"}`,
+		"PUT /domain/cdn.a.com/httpsconf": `{}`,
+		"PUT /domain/cdn.b.com/sslize":    `{}`,
+	})
+	defer server.Close()
+
+	m := NewCdnManager(mac)
+	certPEM, keyPEM := newTestCert(t, "cdn.a.com")
+	certID, err := m.UploadCert("a", certPEM, keyPEM)
+	if err != nil || certID != "c1" || reqs[0].Body["common_name"] != "cdn.a.com" ||
+		!strings.Contains(reqs[0].Body["ca"].(string), "BEGIN CERTIFICATE") {
+		t.Fatalf("UploadCert() error, %v, %v", err, reqs)
+	}
+	_, otherKey := newTestCert(t, "other")
+	if _, err = m.UploadCert("a", certPEM, otherKey); err == nil || len(reqs) != 1 {
+		t.Fatalf("UploadCert() should reject mismatched key, %v", err)
+	}
+
+	certs, marker, err := m.ListCerts("", 10)
+	if err != nil || marker != "m2" || len(certs) != 1 || !certs[0].Expired(time.Unix(1577836801, 0)) {
+		t.Fatalf("ListCerts() error, %v, %v", err, certs)
+	}
+	cert, err := m.GetCert("c1")
+	if err != nil || cert.CommonName != "cdn.a.com" || len(cert.DNSNames) != 1 {
+		t.Fatalf("GetCert() error, %v, %+v", err, cert)
+	}
+	if err = m.DeleteCert("c1"); err != nil {
+		t.Fatalf("DeleteCert() error, %v", err)
+	}
+
+	reqs = nil
+	if err = m.BindCert("cdn.a.com", "c1"); err != nil || reqs[1].Path != "/domain/cdn.a.com/httpsconf" ||
+		reqs[1].Body["certId"] != "c1" || reqs[1].Body["http2Enable"] != true || reqs[1].Body["forceHttps"] != true {
+		t.Fatalf("BindCert() should update https conf, %v, %v", err, reqs)
+	}
+	reqs = nil
+	if err = m.BindCert("cdn.b.com", "c1"); err != nil || reqs[1].Path != "/domain/cdn.b.com/sslize" {
+		t.Fatalf("BindCert() should sslize http domain, %v, %v", err, reqs)
+	}
+}
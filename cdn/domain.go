@@ -0,0 +1,227 @@
+package cdn
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/qiniu/api.v7/auth/qbox"
+)
+
+// 域名管理服务域名
+var (
+	DomainHost = "https://api.qiniu.com"
+)
+
+// APIError 为域名管理和证书管理接口返回的错误
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Code       int    `json:"code"`
+	Message    string `json:"error"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("cdn api error, %d %d %s", e.StatusCode, e.Code, e.Message)
+}
+
+// callAPI 对 DomainHost 发出请求，body 不为 nil 的时候以 JSON 格式发送，2xx 之外的响应返回 *APIError
+func callAPI(client *http.Client, mac *qbox.Mac, method, path string, body, ret interface{}) (err error) {
+	var reqBody []byte
+	if body != nil {
+		if reqBody, err = json.Marshal(body); err != nil {
+			return
+		}
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(DomainHost, "/")+path, bytes.NewReader(reqBody))
+	if err != nil {
+		return
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	accessToken, err := mac.SignRequest(req)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "QBox "+accessToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	resData, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode/100 != 2 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		if json.Unmarshal(resData, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(resData))
+		}
+		return apiErr
+	}
+	if ret != nil && len(resData) > 0 {
+		err = json.Unmarshal(resData, ret)
+	}
+	return
+}
+
+// 回源的类型
+const (
+	SourceTypeQiniuBucket = "qiniuBucket" // 七牛空间
+	SourceTypeDomain      = "domain"      // 源站域名
+	SourceTypeIP          = "ip"          // 源站 IP
+)
+
+// DomainSource 为域名的回源配置，按照 SourceType 设置对应的字段
+type DomainSource struct {
+	SourceType        string   `json:"sourceType"`
+	SourceHost        string   `json:"sourceHost,omitempty"` // 回源的 Host，不设定则为域名本身
+	SourceIPs         []string `json:"sourceIPs,omitempty"`
+	SourceDomain      string   `json:"sourceDomain,omitempty"`
+	SourceQiniuBucket string   `json:"sourceQiniuBucket,omitempty"`
+	SourceURLScheme   string   `json:"sourceURLScheme,omitempty"` // 回源协议，http 或者 https，不设定则和访问的协议相同
+}
+
+// 缓存规则的类型
+const (
+	CacheTypeAll    = "all"    // 全部文件
+	CacheTypePath   = "path"   // 路径前缀，Rule 为以 ";" 分隔的路径，比如 "/img;/css"
+	CacheTypeSuffix = "suffix" // 文件后缀，Rule 为以 ";" 分隔的后缀，比如 ".jpg;.png"
+	CacheTypeFollow = "follow" // 遵循源站的 Cache-Control
+)
+
+// 缓存时间的单位
+const (
+	CacheTimeUnitSecond = iota
+	CacheTimeUnitMinute
+	CacheTimeUnitHour
+	CacheTimeUnitDay
+	CacheTimeUnitWeek
+	CacheTimeUnitMonth
+	CacheTimeUnitYear
+)
+
+// CacheControl 为一条缓存规则，Time 为 0 表示不缓存
+type CacheControl struct {
+	Time     int    `json:"time"`
+	TimeUnit int    `json:"timeunit"`
+	Type     string `json:"type"`
+	Rule     string `json:"rule"`
+}
+
+// DomainCache 为域名的缓存配置，多条规则按照顺序匹配
+type DomainCache struct {
+	CacheControls []CacheControl `json:"cacheControls"`
+	IgnoreParam   bool           `json:"ignoreParam"` // 缓存的时候忽略查询参数
+}
+
+// HTTPSConf 为域名的 HTTPS 配置，CertID 为 UploadCert 返回的证书 ID
+type HTTPSConf struct {
+	CertID      string `json:"certId"`
+	ForceHTTPS  bool   `json:"forceHttps"`
+	HTTP2Enable bool   `json:"http2Enable"`
+}
+
+// CreateDomainReq 为创建域名的参数
+//	Type		域名类型，normal 或者 wildcard（泛域名），不设定则为 normal
+//	Platform	使用场景，web，download 或者 vod，不设定则为 web
+//	GeoCover	覆盖范围，china，foreign 或者 global，不设定则为 china
+//	Protocol	访问协议，http 或者 https，为 https 的时候需要设置 HTTPS
+type CreateDomainReq struct {
+	Type     string       `json:"type"`
+	Platform string       `json:"platform"`
+	GeoCover string       `json:"geoCover"`
+	Protocol string       `json:"protocol"`
+	Source   DomainSource `json:"source"`
+	Cache    *DomainCache `json:"cache,omitempty"`
+	HTTPS    *HTTPSConf   `json:"https,omitempty"`
+}
+
+// DomainInfo 为域名的配置和状态
+type DomainInfo struct {
+	Name           string       `json:"name"`
+	Type           string       `json:"type"`
+	CName          string       `json:"cname"`
+	Platform       string       `json:"platform"`
+	GeoCover       string       `json:"geoCover"`
+	Protocol       string       `json:"protocol"`
+	OperatingState string       `json:"operatingState"` // 比如 processing，success，failed，frozen，offlined
+	Source         DomainSource `json:"source"`
+	Cache          DomainCache  `json:"cache"`
+	HTTPS          HTTPSConf    `json:"https"`
+	CreateAt       string       `json:"createAt"`
+	ModifyAt       string       `json:"modifyAt"`
+}
+
+// ErrNoDomainSource 表示创建域名的时候没有指定回源配置
+var ErrNoDomainSource = errors.New("domain source type is required")
+
+// CreateDomain 创建加速域名，创建之后需要将域名 CNAME 到 GetDomain 返回的 CName
+func (m *CdnManager) CreateDomain(name string, req CreateDomainReq) (err error) {
+	if req.Source.SourceType == "" {
+		return ErrNoDomainSource
+	}
+	if req.Type == "" {
+		req.Type = "normal"
+	}
+	if req.Platform == "" {
+		req.Platform = "web"
+	}
+	if req.GeoCover == "" {
+		req.GeoCover = "china"
+	}
+	if req.Protocol == "" {
+		req.Protocol = "http"
+	}
+	return callAPI(m.httpClient(), m.mac, "POST", "/domain/"+name, &req, nil)
+}
+
+// GetDomain 获取域名的配置和状态
+func (m *CdnManager) GetDomain(name string) (info DomainInfo, err error) {
+	err = callAPI(m.httpClient(), m.mac, "GET", "/domain/"+name, nil, &info)
+	return
+}
+
+// OnlineDomain 启用域名
+func (m *CdnManager) OnlineDomain(name string) error {
+	return callAPI(m.httpClient(), m.mac, "POST", "/domain/"+name+"/online", nil, nil)
+}
+
+// OfflineDomain 停用域名，停用之后才可以删除
+func (m *CdnManager) OfflineDomain(name string) error {
+	return callAPI(m.httpClient(), m.mac, "POST", "/domain/"+name+"/offline", nil, nil)
+}
+
+// DeleteDomain 删除域名
+func (m *CdnManager) DeleteDomain(name string) error {
+	return callAPI(m.httpClient(), m.mac, "DELETE", "/domain/"+name, nil, nil)
+}
+
+// EnableHTTPS 将 HTTP 域名升级为 HTTPS，已经是 HTTPS 的域名使用 UpdateHTTPSConf 修改配置
+func (m *CdnManager) EnableHTTPS(name string, conf HTTPSConf) error {
+	return callAPI(m.httpClient(), m.mac, "PUT", "/domain/"+name+"/sslize", &conf, nil)
+}
+
+// UpdateHTTPSConf 修改 HTTPS 域名的证书，强制 HTTPS 和 HTTP/2 配置
+func (m *CdnManager) UpdateHTTPSConf(name string, conf HTTPSConf) error {
+	return callAPI(m.httpClient(), m.mac, "PUT", "/domain/"+name+"/httpsconf", &conf, nil)
+}
+
+// DisableHTTPS 将 HTTPS 域名降级为 HTTP
+func (m *CdnManager) DisableHTTPS(name string) error {
+	return callAPI(m.httpClient(), m.mac, "PUT", "/domain/"+name+"/unsslize", nil, nil)
+}
+
+// SetCacheRules 设置域名的缓存规则，会覆盖原有的全部规则
+func (m *CdnManager) SetCacheRules(name string, cache DomainCache) error {
+	if cache.CacheControls == nil {
+		cache.CacheControls = []CacheControl{}
+	}
+	return callAPI(m.httpClient(), m.mac, "PUT", "/domain/"+name+"/cache", &cache, nil)
+}
@@ -0,0 +1,127 @@
+package cdn
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeAPIRequest struct {
+	Method string
+	Path   string
+	Body   map[string]interface{}
+}
+
+// newFakeAPIServer 将 DomainHost 指向返回 responses 的服务，调用方需要恢复 DomainHost
+func newFakeAPIServer(reqs *[]fakeAPIRequest, responses map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.Header.Get("Authorization"), "QBox ") {
+			http.Error(w, `{"code":401,"error":"bad token"}`, http.StatusUnauthorized)
+			return
+		}
+		r := fakeAPIRequest{Method: req.Method, Path: req.URL.Path}
+		if data, _ := ioutil.ReadAll(req.Body); len(data) > 0 {
+			json.Unmarshal(data, &r.Body)
+		}
+		*reqs = append(*reqs, r)
+		resp, ok := responses[req.Method+" "+req.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":404001,"error":"domain not found"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(resp))
+	}))
+	DomainHost = server.URL
+	return server
+}
+
+func TestDomainManagement(t *testing.T) {
+	var reqs []fakeAPIRequest
+	defer func(host string) { DomainHost = host }(DomainHost)
+	server := newFakeAPIServer(&reqs, map[string]string{
+		"POST /domain/cdn.a.com":          `{}`,
+		"GET /domain/cdn.a.com":           `{"name":"cdn.a.com","cname":"cdn.a.com.qiniudns.com","protocol":"https","https":{"certId":"c1","http2Enable":true},"source":{"sourceType":"qiniuBucket","sourceQiniuBucket":"b"}}`,
+		"PUT /domain/cdn.a.com/sslize":    `{}`,
+		"PUT /domain/cdn.a.com/httpsconf": `{}`,
+		"PUT /domain/cdn.a.com/cache":     `{}`,
+		"POST /domain/cdn.a.com/offline":  `{}`,
+		"DELETE /domain/cdn.a.com":        `{}`,
+		"PUT /domain/cdn.a.com/unsslize":  `{}`,
+		"POST /domain/cdn.a.com/online":   `{}`,
+	})
+	defer server.Close()
+
+	m := NewCdnManager(mac)
+	if err := m.CreateDomain("cdn.a.com", CreateDomainReq{}); err != ErrNoDomainSource {
+		t.Fatalf("CreateDomain() should fail without source, %v", err)
+	}
+	err := m.CreateDomain("cdn.a.com", CreateDomainReq{
+		Source: DomainSource{SourceType: SourceTypeQiniuBucket, SourceQiniuBucket: "b"},
+	})
+	if err != nil || reqs[0].Body["platform"] != "web" || reqs[0].Body["geoCover"] != "china" ||
+		reqs[0].Body["source"].(map[string]interface{})["sourceQiniuBucket"] != "b" {
+		t.Fatalf("CreateDomain() error, %v, %v", err, reqs)
+	}
+
+	info, err := m.GetDomain("cdn.a.com")
+	if err != nil || info.CName != "cdn.a.com.qiniudns.com" || info.HTTPS.CertID != "c1" || !info.HTTPS.HTTP2Enable {
+		t.Fatalf("GetDomain() error, %v, %+v", err, info)
+	}
+
+	if err = m.EnableHTTPS("cdn.a.com", HTTPSConf{CertID: "c1", ForceHTTPS: true}); err != nil ||
+		reqs[2].Body["certId"] != "c1" || reqs[2].Body["forceHttps"] != true {
+		t.Fatalf("EnableHTTPS() error, %v, %v", err, reqs[2])
+	}
+	if err = m.UpdateHTTPSConf("cdn.a.com", HTTPSConf{CertID: "c2", HTTP2Enable: true}); err != nil {
+		t.Fatalf("UpdateHTTPSConf() error, %v", err)
+	}
+	err = m.SetCacheRules("cdn.a.com", DomainCache{CacheControls: []CacheControl{
+		{Time: 30, TimeUnit: CacheTimeUnitDay, Type: CacheTypeSuffix, Rule: ".jpg;.png"},
+	}, IgnoreParam: true})
+	if err != nil || reqs[4].Body["ignoreParam"] != true || len(reqs[4].Body["cacheControls"].([]interface{})) != 1 {
+		t.Fatalf("SetCacheRules() error, %v, %v", err, reqs[4])
+	}
+	for _, f := range []func(string) error{m.DisableHTTPS, m.OfflineDomain, m.OnlineDomain, m.DeleteDomain} {
+		if err = f("cdn.a.com"); err != nil {
+			t.Fatalf("domain operation error, %v", err)
+		}
+	}
+
+	_, err = m.GetDomain("missing.a.com")
+	if e, ok := err.(*APIError); !ok || e.StatusCode != http.StatusNotFound || e.Code != 404001 {
+		t.Fatalf("GetDomain() should fail with APIError, %v", err)
+	}
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestCdnManagerClient(t *testing.T) {
+	var reqs []fakeAPIRequest
+	defer func(host string) { DomainHost = host }(DomainHost)
+	server := newFakeAPIServer(&reqs, map[string]string{
+		"GET /domain/cdn.a.com": `{"name":"cdn.a.com"}`,
+	})
+	defer server.Close()
+
+	var proxied []string
+	client := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		proxied = append(proxied, req.URL.Path)
+		return http.DefaultTransport.RoundTrip(req)
+	})}
+	m := NewCdnManagerEx(mac, client)
+	if info, err := m.GetDomain("cdn.a.com"); err != nil || info.Name != "cdn.a.com" {
+		t.Fatalf("GetDomain() = %v, %v", info, err)
+	}
+	if len(proxied) != 1 || proxied[0] != "/domain/cdn.a.com" {
+		t.Fatalf("CdnManager should send requests through Client, got %v", proxied)
+	}
+}
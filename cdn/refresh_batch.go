@@ -0,0 +1,105 @@
+package cdn
+
+import (
+	"fmt"
+)
+
+// 单次请求可以提交的最多的链接数量
+const (
+	RefreshUrlsLimit  = 100
+	RefreshDirsLimit  = 10
+	PrefetchUrlsLimit = 100
+)
+
+// BatchRefreshResult 为分批刷新的结果
+type BatchRefreshResult struct {
+	RequestIDs  []string // 每一批请求的 requestId，可以用来查询刷新进度
+	InvalidUrls []string // 服务端拒绝的链接，比如不属于当前账号的域名
+	InvalidDirs []string
+
+	// 最后一次请求返回的每日额度和剩余额度
+	URLQuotaDay   int
+	URLSurplusDay int
+	DirQuotaDay   int
+	DirSurplusDay int
+}
+
+// BatchPrefetchResult 为分批预取的结果
+type BatchPrefetchResult struct {
+	RequestIDs  []string
+	InvalidUrls []string
+	QuotaDay    int
+	SurplusDay  int
+}
+
+// splitBatches 将 items 按照每批最多 size 个分组
+func splitBatches(items []string, size int) (batches [][]string) {
+	for len(items) > size {
+		batches = append(batches, items[:size])
+		items = items[size:]
+	}
+	if len(items) > 0 {
+		batches = append(batches, items)
+	}
+	return
+}
+
+// BatchRefreshUrls 刷新文件，urls 超过 RefreshUrlsLimit 的时候分批提交。
+// 部分链接无效的时候继续提交其他批次，无效的链接记录在 InvalidUrls 中；
+// 其他错误（比如额度不足）的时候停止，返回已经提交的批次的结果和错误
+func (m *CdnManager) BatchRefreshUrls(urls []string) (result BatchRefreshResult, err error) {
+	for _, batch := range splitBatches(urls, RefreshUrlsLimit) {
+		if err = m.refreshBatch(&result, batch, nil); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// BatchRefreshDirs 刷新目录，dirs 超过 RefreshDirsLimit 的时候分批提交，其他和 BatchRefreshUrls 相同
+func (m *CdnManager) BatchRefreshDirs(dirs []string) (result BatchRefreshResult, err error) {
+	for _, batch := range splitBatches(dirs, RefreshDirsLimit) {
+		if err = m.refreshBatch(&result, nil, batch); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (m *CdnManager) refreshBatch(result *BatchRefreshResult, urls, dirs []string) (err error) {
+	resp, err := m.RefreshUrlsAndDirs(urls, dirs)
+	if err != nil {
+		return
+	}
+	if resp.RequestID != "" {
+		result.RequestIDs = append(result.RequestIDs, resp.RequestID)
+	}
+	result.InvalidUrls = append(result.InvalidUrls, resp.InvalidUrls...)
+	result.InvalidDirs = append(result.InvalidDirs, resp.InvalidDirs...)
+	result.URLQuotaDay, result.URLSurplusDay = resp.URLQuotaDay, resp.URLSurplusDay
+	result.DirQuotaDay, result.DirSurplusDay = resp.DirQuotaDay, resp.DirSurplusDay
+	if resp.Code != 200 && len(resp.InvalidUrls)+len(resp.InvalidDirs) == 0 {
+		err = fmt.Errorf("refresh error, %d %s", resp.Code, resp.Error)
+	}
+	return
+}
+
+// BatchPrefetchUrls 预取文件，urls 超过 PrefetchUrlsLimit 的时候分批提交，错误的处理和 BatchRefreshUrls 相同
+func (m *CdnManager) BatchPrefetchUrls(urls []string) (result BatchPrefetchResult, err error) {
+	for _, batch := range splitBatches(urls, PrefetchUrlsLimit) {
+		var resp PrefetchResp
+		if resp, err = m.PrefetchUrls(batch); err != nil {
+			return
+		}
+		if resp.RequestID != "" {
+			result.RequestIDs = append(result.RequestIDs, resp.RequestID)
+		}
+		result.InvalidUrls = append(result.InvalidUrls, resp.InvalidUrls...)
+		result.QuotaDay, result.SurplusDay = resp.QuotaDay, resp.SurplusDay
+		if resp.Code != 200 && len(resp.InvalidUrls) == 0 {
+			err = fmt.Errorf("prefetch error, %d %s", resp.Code, resp.Error)
+			return
+		}
+	}
+	return
+}
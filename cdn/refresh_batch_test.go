@@ -0,0 +1,71 @@
+package cdn
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBatchRefreshAndPrefetch(t *testing.T) {
+	var batches [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.Header.Get("Authorization"), "QBox ") {
+			http.Error(w, "bad token", http.StatusUnauthorized)
+			return
+		}
+		var body RefreshReq
+		json.NewDecoder(req.Body).Decode(&body)
+		items := append(body.Urls, body.Dirs...)
+		batches = append(batches, items)
+		id := fmt.Sprintf("req%d", len(batches))
+		switch {
+		case strings.Contains(strings.Join(items, ""), "quota"):
+			w.Write([]byte(`{"code":400034,"error":"refresh url limit error"}`))
+		case strings.Contains(strings.Join(items, ""), "other.com"):
+			w.Write([]byte(`{"code":400031,"error":"invalid url","requestId":"` + id +
+				`","invalidUrls":["http://other.com/1"],"quotaDay":100,"surplusDay":10}`))
+		case req.URL.Path == "/v2/tune/prefetch":
+			w.Write([]byte(`{"code":200,"requestId":"` + id + `","quotaDay":100,"surplusDay":` + fmt.Sprint(100-len(batches)) + `}`))
+		default:
+			w.Write([]byte(`{"code":200,"requestId":"` + id + `","urlQuotaDay":1000,"urlSurplusDay":800,"dirQuotaDay":10,"dirSurplusDay":5}`))
+		}
+	}))
+	defer server.Close()
+	defer func(host string) { FusionHost = host }(FusionHost)
+	FusionHost = server.URL
+
+	m := NewCdnManager(mac)
+	urls := make([]string, 250)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("http://a.com/%d", i)
+	}
+	result, err := m.BatchRefreshUrls(urls)
+	if err != nil || len(batches) != 3 || len(batches[2]) != 50 || len(result.RequestIDs) != 3 || result.URLSurplusDay != 800 {
+		t.Fatalf("BatchRefreshUrls() error, %v, %+v", err, result)
+	}
+
+	batches = nil
+	dirs := make([]string, 15)
+	for i := range dirs {
+		dirs[i] = fmt.Sprintf("http://a.com/%d/", i)
+	}
+	if result, err = m.BatchRefreshDirs(dirs); err != nil || len(batches) != 2 || result.DirSurplusDay != 5 {
+		t.Fatalf("BatchRefreshDirs() error, %v, %+v", err, result)
+	}
+
+	batches = nil
+	urls[150] = "http://other.com/1"
+	prefetch, err := m.BatchPrefetchUrls(urls)
+	if err != nil || len(prefetch.RequestIDs) != 3 || len(prefetch.InvalidUrls) != 1 || prefetch.SurplusDay != 97 {
+		t.Fatalf("BatchPrefetchUrls() error, %v, %+v", err, prefetch)
+	}
+
+	batches = nil
+	urls[0] = "http://a.com/quota"
+	if result, err = m.BatchRefreshUrls(urls); err == nil || len(batches) != 1 || len(result.RequestIDs) != 0 {
+		t.Fatalf("BatchRefreshUrls() should stop on error, %v, %d", err, len(batches))
+	}
+}
@@ -0,0 +1,118 @@
+package cdn
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 带宽和流量数据的取值粒度
+const (
+	Granularity5Min = "5min"
+	GranularityHour = "hour"
+	GranularityDay  = "day"
+)
+
+// cdnTimeLocation 为带宽和流量数据中的时间所在的时区
+var cdnTimeLocation = time.FixedZone("CST", 8*3600)
+
+// TrafficPoint 为时间序列中的一个点，带宽的单位为 bps，流量的单位为字节
+type TrafficPoint struct {
+	Time    time.Time
+	China   int64
+	Oversea int64
+}
+
+// Total 返回国内和海外的总和
+func (p TrafficPoint) Total() int64 {
+	return p.China + p.Oversea
+}
+
+// Err 在查询失败的时候返回错误
+func (r *TrafficResp) Err() error {
+	if r.Code != 200 {
+		return fmt.Errorf("get traffic data error, %d %s", r.Code, r.Error)
+	}
+	return nil
+}
+
+// Series 返回 domain 的时间序列，Time 中的时间为东八区的时间。domain 没有数据的时候返回 nil
+func (r *TrafficResp) Series(domain string) (points []TrafficPoint, err error) {
+	data, ok := r.Data[domain]
+	if !ok {
+		return
+	}
+	points = make([]TrafficPoint, len(r.Time))
+	for i, s := range r.Time {
+		if points[i].Time, err = time.ParseInLocation("2006-01-02 15:04:05", s, cdnTimeLocation); err != nil {
+			return nil, err
+		}
+		if i < len(data.DomainChina) {
+			points[i].China = int64(data.DomainChina[i])
+		}
+		if i < len(data.DomainOversea) {
+			points[i].Oversea = int64(data.DomainOversea[i])
+		}
+	}
+	return
+}
+
+// GetBandwidthSeries 获取 domains 从 start 到 end 的带宽数据，返回每个域名的时间序列，日期按照东八区的时间计算
+func (m *CdnManager) GetBandwidthSeries(start, end time.Time, granularity string,
+	domains []string) (series map[string][]TrafficPoint, err error) {
+	resp, err := m.GetBandwidthData(formatDate(start), formatDate(end), granularity, domains)
+	if err != nil {
+		return
+	}
+	return trafficSeries(&resp, domains)
+}
+
+// GetFluxSeries 获取 domains 从 start 到 end 的流量数据，和 GetBandwidthSeries 相同
+func (m *CdnManager) GetFluxSeries(start, end time.Time, granularity string,
+	domains []string) (series map[string][]TrafficPoint, err error) {
+	resp, err := m.GetFluxData(formatDate(start), formatDate(end), granularity, domains)
+	if err != nil {
+		return
+	}
+	return trafficSeries(&resp, domains)
+}
+
+func formatDate(t time.Time) string {
+	return t.In(cdnTimeLocation).Format("2006-01-02")
+}
+
+func trafficSeries(resp *TrafficResp, domains []string) (series map[string][]TrafficPoint, err error) {
+	if err = resp.Err(); err != nil {
+		return
+	}
+	series = make(map[string][]TrafficPoint, len(domains))
+	for _, domain := range domains {
+		if series[domain], err = resp.Series(domain); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// ModTime 返回日志文件的修改时间
+func (info *LogDomainInfo) ModTime() time.Time {
+	return time.Unix(info.ModifiedTime, 0)
+}
+
+// ErrNoLogDomains 表示查询日志的时候没有指定域名
+var ErrNoLogDomains = errors.New("domains are required")
+
+// GetLogList 获取 day 这一天 domains 的访问日志，返回每个域名的日志文件，日期按照东八区的时间计算。
+// 日志文件的下载链接有时效，需要在获取之后尽快下载
+func (m *CdnManager) GetLogList(day time.Time, domains []string) (logs map[string][]LogDomainInfo, err error) {
+	if len(domains) == 0 {
+		err = ErrNoLogDomains
+		return
+	}
+	ret, err := m.GetCdnLogList(formatDate(day), domains)
+	if err != nil {
+		return
+	}
+	logs = ret.Data
+	return
+}
@@ -0,0 +1,61 @@
+package cdn
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTrafficSeriesAndLogList(t *testing.T) {
+	var reqs []TrafficReq
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v2/tune/bandwidth", "/v2/tune/flux":
+			var body TrafficReq
+			json.NewDecoder(req.Body).Decode(&body)
+			reqs = append(reqs, body)
+			if body.Granularity == "minute" {
+				w.Write([]byte(`{"code":400001,"error":"invalid granularity"}`))
+				return
+			}
+			w.Write([]byte(`{"code":200,"time":["2020-01-02 00:00:00","2020-01-02 00:05:00"],` +
+				`"data":{"a.com":{"china":[100,200],"oversea":[1,2]}}}`))
+		case "/v2/tune/log/list":
+			w.Write([]byte(`{"code":200,"data":{"a.com":[{"name":"a.com_2020-01-02-00_part-00000.gz",` +
+				`"size":1024,"mtime":1577894400,"url":"http://log.a.com/1.gz"}]}}`))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+	defer func(host string) { FusionHost = host }(FusionHost)
+	FusionHost = server.URL
+
+	m := NewCdnManager(mac)
+	start := time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)
+	series, err := m.GetBandwidthSeries(start, start.Add(time.Hour), Granularity5Min, []string{"a.com", "b.com"})
+	if err != nil || len(series["a.com"]) != 2 || series["b.com"] != nil {
+		t.Fatalf("GetBandwidthSeries() error, %v, %v", err, series)
+	}
+	if reqs[0].StartDate != "2020-01-02" || reqs[0].Domains != "a.com;b.com" {
+		t.Fatalf("GetBandwidthSeries() wrong request, %+v", reqs[0])
+	}
+	p := series["a.com"][1]
+	if p.China != 200 || p.Oversea != 2 || p.Total() != 202 || !p.Time.Equal(time.Date(2020, 1, 1, 16, 5, 0, 0, time.UTC)) {
+		t.Fatalf("GetBandwidthSeries() wrong point, %+v", p)
+	}
+	if _, err = m.GetFluxSeries(start, start, "minute", []string{"a.com"}); err == nil {
+		t.Fatal("GetFluxSeries() should fail when code is not 200")
+	}
+
+	logs, err := m.GetLogList(start, []string{"a.com"})
+	if err != nil || len(logs["a.com"]) != 1 || logs["a.com"][0].URL != "http://log.a.com/1.gz" ||
+		logs["a.com"][0].ModTime().Unix() != 1577894400 {
+		t.Fatalf("GetLogList() error, %v, %v", err, logs)
+	}
+	if _, err = m.GetLogList(start, nil); err != ErrNoLogDomains {
+		t.Fatalf("GetLogList() should fail without domains, %v", err)
+	}
+}
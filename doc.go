@@ -6,12 +6,13 @@
 
 Go SDK 中主要包含几个包：
 
-auth 包提供鉴权相关方法，conf 包提供配置相关方法，cdn包提供CDN相关的功能，storage包提供存储相关的功能。
+auth 包提供鉴权相关方法，conf 包提供配置相关方法，cdn包提供CDN相关的功能，storage包提供存储相关的功能，ai包提供内容审核等智能多媒体相关的功能。
 
 */
 package api
 
 import (
+	_ "github.com/qiniu/api.v7/ai"
 	_ "github.com/qiniu/api.v7/auth/qbox"
 	_ "github.com/qiniu/api.v7/cdn"
 	_ "github.com/qiniu/api.v7/conf"
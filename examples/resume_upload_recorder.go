@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/qiniu/api.v7/auth/qbox"
+	"github.com/qiniu/api.v7/storage"
+)
+
+var (
+	accessKey = os.Getenv("QINIU_ACCESS_KEY")
+	secretKey = os.Getenv("QINIU_SECRET_KEY")
+	bucket    = os.Getenv("QINIU_TEST_BUCKET")
+)
+
+func main() {
+
+	localFile := "your local file path"
+	key := "your file save key"
+
+	putPolicy := storage.PutPolicy{
+		Scope: bucket,
+	}
+	mac := qbox.NewMac(accessKey, secretKey)
+	upToken := putPolicy.UploadToken(mac)
+
+	cfg := storage.Config{}
+	// 空间对应的机房
+	cfg.Zone = &storage.ZoneHuadong
+	// 是否使用https域名
+	cfg.UseHTTPS = false
+	// 上传是否使用CDN上传加速
+	cfg.UseCdnDomains = false
+
+	// 指定的进度文件保存目录，实际情况下，请确保该目录只用于记录进度文件
+	recorder, err := storage.NewFileProgressRecorder("/tmp/qiniu/progress")
+	if err != nil {
+		fmt.Println("create progress recorder error,", err)
+		return
+	}
+
+	resumeUploader := storage.NewResumeUploader(&cfg)
+	ret := storage.PutRet{}
+	putExtra := storage.RputExtra{
+		// 上传中断之后再次执行，会从记录的进度继续上传，上传成功之后进度记录会被自动删除
+		Recorder: recorder,
+	}
+	err = resumeUploader.PutFile(context.Background(), &ret, upToken, key, localFile, &putExtra)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(ret.Key, ret.Hash)
+}
@@ -98,6 +98,14 @@ func NewManager(mac *qbox.Mac) *Manager {
 	return &Manager{mac: mac, httpClient: httpClient}
 }
 
+// NewManagerEx 用来构建一个通过 httpClient 发送请求的 Manager，用于设置代理、TLS 和连接池等参数，httpClient 为 nil 的时候使用 http.DefaultClient
+func NewManagerEx(mac *qbox.Mac, httpClient *http.Client) *Manager {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Manager{mac: mac, httpClient: httpClient}
+}
+
 // CreateApp 新建实时音视频云
 func (r *Manager) CreateApp(appReq AppInitConf) (App, error) {
 	url := buildURL("/v3/apps")
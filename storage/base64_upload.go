@@ -113,7 +113,7 @@ func (p *Base64Uploader) put(
 	//add key
 	if hasKey {
 		postPath.WriteString("/key/")
-		postPath.WriteString(base64.URLEncoding.EncodeToString([]byte(key)))
+		postPath.WriteString(EncodeKey(key))
 	}
 	//add mimeType
 	if extra.MimeType != "" {
@@ -146,28 +146,5 @@ func (p *Base64Uploader) put(
 }
 
 func (p *Base64Uploader) upHost(ak, bucket string) (upHost string, err error) {
-	var zone *Zone
-	if p.cfg.Zone != nil {
-		zone = p.cfg.Zone
-	} else {
-		if v, zoneErr := GetZone(ak, bucket); zoneErr != nil {
-			err = zoneErr
-			return
-		} else {
-			zone = v
-		}
-	}
-
-	scheme := "http://"
-	if p.cfg.UseHTTPS {
-		scheme = "https://"
-	}
-
-	host := zone.SrcUpHosts[0]
-	if p.cfg.UseCdnDomains {
-		host = zone.CdnUpHosts[0]
-	}
-
-	upHost = fmt.Sprintf("%s%s", scheme, host)
-	return
+	return getUpHost(p.cfg, p.client, ak, bucket)
 }
@@ -6,8 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/qiniu/api.v7/auth/qbox"
 	"github.com/qiniu/api.v7/conf"
@@ -91,6 +93,14 @@ func (l *ListItem) String() string {
 	return str
 }
 
+// 文件的存储类型
+const (
+	FileTypeStandard    = 0 // 普通存储
+	FileTypeIA          = 1 // 低频存储
+	FileTypeArchive     = 2 // 归档存储，需要解冻（RestoreAr）之后才能下载
+	FileTypeDeepArchive = 3 // 深度归档存储，需要解冻（RestoreAr）之后才能下载
+)
+
 // BatchOpRet 为批量执行操作的返回值
 // 批量操作支持 stat，copy，delete，move，chgm，chtype，deleteAfterDays几个操作
 // 其中 stat 为获取文件的基本信息，如果文件存在则返回基本信息，如果文件不存在返回 error 。
@@ -107,11 +117,48 @@ type BatchOpRet struct {
 	} `json:"data,omitempty"`
 }
 
+// Failed 返回该操作是否失败
+func (r *BatchOpRet) Failed() bool {
+	return r.Code/100 != 2
+}
+
+// Retryable 返回该操作失败的原因是否为服务端的临时错误（5xx），可以重试。612 等 6xx 的错误重试也不会成功
+func (r *BatchOpRet) Retryable() bool {
+	return r.Code/100 == 5
+}
+
+// FailedBatchOps 找出批量操作中失败的操作，retryableOnly 为 true 的时候只返回可以重试的操作。
+// operations 和 rets 为传给 Batch 的操作列表和 Batch 的返回值，两者按照位置一一对应
+func FailedBatchOps(operations []string, rets []BatchOpRet, retryableOnly bool) (failed []string) {
+	for i := range rets {
+		if i >= len(operations) {
+			break
+		}
+		if rets[i].Failed() && (!retryableOnly || rets[i].Retryable()) {
+			failed = append(failed, operations[i])
+		}
+	}
+	return
+}
+
 // BucketManager 提供了对资源进行管理的操作
 type BucketManager struct {
 	Client *Client
 	Mac    *qbox.Mac
 	Cfg    *Config
+
+	// 可选。设置之后使用 Credentials 当前的密钥对请求签名，忽略 Mac，用来在运行时更换密钥
+	Credentials qbox.Credentials
+
+	// 可选。管理凭证的签名方式，默认为 qbox.AuthQBox，调用 JSON 格式 body 的 API 的时候可以使用 qbox.AuthAuto
+	AuthType qbox.AuthType
+
+	// 可选。Buckets、Stat 和 ListFiles 等查询类的请求失败之后的重试策略，不设定则使用 DefaultRetryPolicy。
+	// 修改类的请求重试可能重复执行，不会自动重试
+	RetryPolicy RetryPolicy
+
+	// 可选。为每个请求创建 span 的对象，不设定则不创建。只有 BucketsContext 等接收 ctx 的方法会从调用方的 span 派生
+	Tracer Tracer
 }
 
 // NewBucketManager 用来构建一个新的资源管理对象
@@ -150,22 +197,55 @@ func NewBucketManagerEx(mac *qbox.Mac, cfg *Config, client *Client) *BucketManag
 	}
 }
 
+// mac 返回当前用来签名的密钥
+func (m *BucketManager) mac() *qbox.Mac {
+	if m.Credentials != nil {
+		return m.Credentials.Get()
+	}
+	return m.Mac
+}
+
+// withMac 在 ctx 中设置签名使用的密钥、签名方式和 Tracer
+func (m *BucketManager) withMac(ctx context.Context) context.Context {
+	return withTrace(withMac(ctx, m.mac(), m.AuthType), m.Tracer)
+}
+
+// query 发送查询类的请求，失败的时候按照 RetryPolicy 重试，最多尝试 3 次
+func (m *BucketManager) query(ctx context.Context, ret interface{}, reqURL string) (err error) {
+	policy := retryPolicyOrDefault(m.RetryPolicy)
+	for attempt := 1; ; attempt++ {
+		headers := http.Header{}
+		headers.Add("Content-Type", conf.CONTENT_TYPE_FORM)
+		err = m.Client.Call(ctx, ret, "POST", reqURL, headers)
+		if err == nil || ctx.Err() != nil || attempt >= defaultTryTimes {
+			return
+		}
+		retry, delay := policy.Retry(attempt, err)
+		if !retry || sleepContext(ctx, delay) != nil {
+			return
+		}
+	}
+}
+
 // Buckets 用来获取空间列表，如果指定了 shared 参数为 true，那么一同列表被授权访问的空间
 func (m *BucketManager) Buckets(shared bool) (buckets []string, err error) {
-	ctx := context.WithValue(context.TODO(), "mac", m.Mac)
+	return m.BucketsContext(context.TODO(), shared)
+}
+
+// BucketsContext 和 Buckets 相同，可以通过 ctx 取消请求
+func (m *BucketManager) BucketsContext(ctx context.Context, shared bool) (buckets []string, err error) {
+	ctx = m.withMac(ctx)
 	var reqHost string
 
 	reqHost = m.Cfg.RsReqHost()
 	reqURL := fmt.Sprintf("%s/buckets?shared=%v", reqHost, shared)
-	headers := http.Header{}
-	headers.Add("Content-Type", conf.CONTENT_TYPE_FORM)
-	err = m.Client.Call(ctx, &buckets, "POST", reqURL, headers)
+	err = m.query(ctx, &buckets, reqURL)
 	return
 }
 
 // Stat 用来获取一个文件的基本信息
 func (m *BucketManager) Stat(bucket, key string) (info FileInfo, err error) {
-	ctx := context.WithValue(context.TODO(), "mac", m.Mac)
+	ctx := m.withMac(context.TODO())
 	reqHost, reqErr := m.RsReqHost(bucket)
 	if reqErr != nil {
 		err = reqErr
@@ -173,15 +253,13 @@ func (m *BucketManager) Stat(bucket, key string) (info FileInfo, err error) {
 	}
 
 	reqURL := fmt.Sprintf("%s%s", reqHost, URIStat(bucket, key))
-	headers := http.Header{}
-	headers.Add("Content-Type", conf.CONTENT_TYPE_FORM)
-	err = m.Client.Call(ctx, &info, "POST", reqURL, headers)
+	err = m.query(ctx, &info, reqURL)
 	return
 }
 
 // Delete 用来删除空间中的一个文件
 func (m *BucketManager) Delete(bucket, key string) (err error) {
-	ctx := context.WithValue(context.TODO(), "mac", m.Mac)
+	ctx := m.withMac(context.TODO())
 	reqHost, reqErr := m.RsReqHost(bucket)
 	if reqErr != nil {
 		err = reqErr
@@ -196,7 +274,7 @@ func (m *BucketManager) Delete(bucket, key string) (err error) {
 
 // Copy 用来创建已有空间中的文件的一个新的副本
 func (m *BucketManager) Copy(srcBucket, srcKey, destBucket, destKey string, force bool) (err error) {
-	ctx := context.WithValue(context.TODO(), "mac", m.Mac)
+	ctx := m.withMac(context.TODO())
 	reqHost, reqErr := m.RsReqHost(srcBucket)
 	if reqErr != nil {
 		err = reqErr
@@ -212,7 +290,7 @@ func (m *BucketManager) Copy(srcBucket, srcKey, destBucket, destKey string, forc
 
 // Move 用来将空间中的一个文件移动到新的空间或者重命名
 func (m *BucketManager) Move(srcBucket, srcKey, destBucket, destKey string, force bool) (err error) {
-	ctx := context.WithValue(context.TODO(), "mac", m.Mac)
+	ctx := m.withMac(context.TODO())
 	reqHost, reqErr := m.RsReqHost(srcBucket)
 	if reqErr != nil {
 		err = reqErr
@@ -228,7 +306,7 @@ func (m *BucketManager) Move(srcBucket, srcKey, destBucket, destKey string, forc
 
 // ChangeMime 用来更新文件的MimeType
 func (m *BucketManager) ChangeMime(bucket, key, newMime string) (err error) {
-	ctx := context.WithValue(context.TODO(), "mac", m.Mac)
+	ctx := m.withMac(context.TODO())
 	reqHost, reqErr := m.RsReqHost(bucket)
 	if reqErr != nil {
 		err = reqErr
@@ -241,9 +319,29 @@ func (m *BucketManager) ChangeMime(bucket, key, newMime string) (err error) {
 	return
 }
 
-// ChangeType 用来更新文件的存储类型，0表示普通存储，1表示低频存储
+// ChangeMeta 用来修改文件的 MimeType 和自定义元数据（x-qn-meta-*），newMime 为空的时候不修改 MimeType，
+// 设置了 cond 的时候只有文件当前的信息满足条件才修改
+func (m *BucketManager) ChangeMeta(bucket, key, newMime string, metas map[string]string, cond *ChgmCond) (err error) {
+	if newMime == "" && len(metas) == 0 {
+		err = errors.New("nothing to change")
+		return
+	}
+	ctx := m.withMac(context.TODO())
+	reqHost, reqErr := m.RsReqHost(bucket)
+	if reqErr != nil {
+		err = reqErr
+		return
+	}
+	reqURL := fmt.Sprintf("%s%s", reqHost, URIChangeMeta(bucket, key, newMime, metas, cond))
+	headers := http.Header{}
+	headers.Add("Content-Type", conf.CONTENT_TYPE_FORM)
+	err = m.Client.Call(ctx, nil, "POST", reqURL, headers)
+	return
+}
+
+// ChangeType 用来更新文件的存储类型，0表示普通存储，1表示低频存储，2表示归档存储，3表示深度归档存储，见 FileTypeXXX
 func (m *BucketManager) ChangeType(bucket, key string, fileType int) (err error) {
-	ctx := context.WithValue(context.TODO(), "mac", m.Mac)
+	ctx := m.withMac(context.TODO())
 	reqHost, reqErr := m.RsReqHost(bucket)
 	if reqErr != nil {
 		err = reqErr
@@ -256,9 +354,29 @@ func (m *BucketManager) ChangeType(bucket, key string, fileType int) (err error)
 	return
 }
 
+// RestoreAr 用来解冻归档存储或者深度归档存储的文件，解冻需要一定的时间，解冻完成之后可以下载，
+// 在 freezeAfterDays 天之后重新冻结，freezeAfterDays 的范围为 1～7
+func (m *BucketManager) RestoreAr(bucket, key string, freezeAfterDays int) (err error) {
+	if freezeAfterDays < 1 || freezeAfterDays > 7 {
+		err = errors.New("freezeAfterDays must be between 1 and 7")
+		return
+	}
+	ctx := m.withMac(context.TODO())
+	reqHost, reqErr := m.RsReqHost(bucket)
+	if reqErr != nil {
+		err = reqErr
+		return
+	}
+	reqURL := fmt.Sprintf("%s%s", reqHost, URIRestoreAr(bucket, key, freezeAfterDays))
+	headers := http.Header{}
+	headers.Add("Content-Type", conf.CONTENT_TYPE_FORM)
+	err = m.Client.Call(ctx, nil, "POST", reqURL, headers)
+	return
+}
+
 // DeleteAfterDays 用来更新文件生命周期，如果 days 设置为0，则表示取消文件的定期删除功能，永久存储
 func (m *BucketManager) DeleteAfterDays(bucket, key string, days int) (err error) {
-	ctx := context.WithValue(context.TODO(), "mac", m.Mac)
+	ctx := m.withMac(context.TODO())
 	reqHost, reqErr := m.RsReqHost(bucket)
 	if reqErr != nil {
 		err = reqErr
@@ -274,16 +392,27 @@ func (m *BucketManager) DeleteAfterDays(bucket, key string, days int) (err error
 
 // Batch 接口提供了资源管理的批量操作，支持 stat，copy，move，delete，chgm，chtype，deleteAfterDays几个接口
 func (m *BucketManager) Batch(operations []string) (batchOpRet []BatchOpRet, err error) {
+	return m.batch(context.TODO(), operations)
+}
+
+// BatchContext 和 Batch 一样用来进行批量操作，可以通过 ctx 取消请求。
+// 和 Batch 不同的是部分操作失败（服务端返回 298）的时候 err 为 nil，每个操作的结果见 batchOpRet 中对应位置的 Code，
+// 可以使用 FailedBatchOps 找出需要重试的操作
+func (m *BucketManager) BatchContext(ctx context.Context, operations []string) (batchOpRet []BatchOpRet, err error) {
+	batchOpRet, err = m.batch(ctx, operations)
+	if e, ok := err.(*ErrorInfo); ok && e.Code == 298 {
+		err = nil
+	}
+	return
+}
+
+func (m *BucketManager) batch(ctx context.Context, operations []string) (batchOpRet []BatchOpRet, err error) {
 	if len(operations) > 1000 {
 		err = errors.New("batch operation count exceeds the limit of 1000")
 		return
 	}
-	ctx := context.WithValue(context.TODO(), "mac", m.Mac)
-	scheme := "http://"
-	if m.Cfg.UseHTTPS {
-		scheme = "https://"
-	}
-	reqURL := fmt.Sprintf("%s%s/batch", scheme, m.Cfg.CentralRsHost)
+	ctx = m.withMac(ctx)
+	reqURL := fmt.Sprintf("%s/batch", withScheme(m.Cfg.CentralRsHost, m.Cfg.useHTTPS()))
 	params := map[string][]string{
 		"op": operations,
 	}
@@ -293,7 +422,7 @@ func (m *BucketManager) Batch(operations []string) (batchOpRet []BatchOpRet, err
 
 // Fetch 根据提供的远程资源链接来抓取一个文件到空间并已指定文件名保存
 func (m *BucketManager) Fetch(resURL, bucket, key string) (fetchRet FetchRet, err error) {
-	ctx := context.WithValue(context.TODO(), "mac", m.Mac)
+	ctx := m.withMac(context.TODO())
 
 	reqHost, rErr := m.IoReqHost(bucket)
 	if rErr != nil {
@@ -319,9 +448,7 @@ func (m *BucketManager) RsReqHost(bucket string) (reqHost string, err error) {
 	} else {
 		reqHost = m.Cfg.RsHost
 	}
-	if !strings.HasPrefix(reqHost, "http") {
-		reqHost = "http://" + reqHost
-	}
+	reqHost = withScheme(reqHost, m.Cfg.useHTTPS())
 	return
 }
 
@@ -337,9 +464,7 @@ func (m *BucketManager) ApiReqHost(bucket string) (reqHost string, err error) {
 	} else {
 		reqHost = m.Cfg.ApiHost
 	}
-	if !strings.HasPrefix(reqHost, "http") {
-		reqHost = "http://" + reqHost
-	}
+	reqHost = withScheme(reqHost, m.Cfg.useHTTPS())
 	return
 }
 
@@ -355,9 +480,7 @@ func (m *BucketManager) RsfReqHost(bucket string) (reqHost string, err error) {
 	} else {
 		reqHost = m.Cfg.RsfHost
 	}
-	if !strings.HasPrefix(reqHost, "http") {
-		reqHost = "http://" + reqHost
-	}
+	reqHost = withScheme(reqHost, m.Cfg.useHTTPS())
 	return
 }
 
@@ -373,15 +496,13 @@ func (m *BucketManager) IoReqHost(bucket string) (reqHost string, err error) {
 	} else {
 		reqHost = m.Cfg.IoHost
 	}
-	if !strings.HasPrefix(reqHost, "http") {
-		reqHost = "http://" + reqHost
-	}
+	reqHost = withScheme(reqHost, m.Cfg.useHTTPS())
 	return
 }
 
 // FetchWithoutKey 根据提供的远程资源链接来抓取一个文件到空间并以文件的内容hash作为文件名
 func (m *BucketManager) FetchWithoutKey(resURL, bucket string) (fetchRet FetchRet, err error) {
-	ctx := context.WithValue(context.TODO(), "mac", m.Mac)
+	ctx := m.withMac(context.TODO())
 
 	reqHost, rErr := m.IoReqHost(bucket)
 	if rErr != nil {
@@ -397,7 +518,7 @@ func (m *BucketManager) FetchWithoutKey(resURL, bucket string) (fetchRet FetchRe
 
 // Prefetch 用来同步镜像空间的资源和镜像源资源内容
 func (m *BucketManager) Prefetch(bucket, key string) (err error) {
-	ctx := context.WithValue(context.TODO(), "mac", m.Mac)
+	ctx := m.withMac(context.TODO())
 	reqHost, reqErr := m.IoReqHost(bucket)
 	if reqErr != nil {
 		err = reqErr
@@ -412,7 +533,7 @@ func (m *BucketManager) Prefetch(bucket, key string) (err error) {
 
 // SetImage 用来设置空间镜像源
 func (m *BucketManager) SetImage(siteURL, bucket string) (err error) {
-	ctx := context.WithValue(context.TODO(), "mac", m.Mac)
+	ctx := m.withMac(context.TODO())
 	reqURL := fmt.Sprintf("http://%s%s", DefaultPubHost, uriSetImage(siteURL, bucket))
 	headers := http.Header{}
 	headers.Add("Content-Type", conf.CONTENT_TYPE_FORM)
@@ -422,7 +543,7 @@ func (m *BucketManager) SetImage(siteURL, bucket string) (err error) {
 
 // SetImageWithHost 用来设置空间镜像源，额外添加回源Host头部
 func (m *BucketManager) SetImageWithHost(siteURL, bucket, host string) (err error) {
-	ctx := context.WithValue(context.TODO(), "mac", m.Mac)
+	ctx := m.withMac(context.TODO())
 	reqURL := fmt.Sprintf("http://%s%s", DefaultPubHost,
 		uriSetImageWithHost(siteURL, bucket, host))
 	headers := http.Header{}
@@ -433,7 +554,7 @@ func (m *BucketManager) SetImageWithHost(siteURL, bucket, host string) (err erro
 
 // UnsetImage 用来取消空间镜像源设置
 func (m *BucketManager) UnsetImage(bucket string) (err error) {
-	ctx := context.WithValue(context.TODO(), "mac", m.Mac)
+	ctx := m.withMac(context.TODO())
 	reqURL := fmt.Sprintf("http://%s%s", DefaultPubHost, uriUnsetImage(bucket))
 	headers := http.Header{}
 	headers.Add("Content-Type", conf.CONTENT_TYPE_FORM)
@@ -450,13 +571,19 @@ type listFilesRet struct {
 // ListFiles 用来获取空间文件列表，可以根据需要指定文件的前缀 prefix，文件的目录 delimiter，循环列举的时候下次
 // 列举的位置 marker，以及每次返回的文件的最大数量limit，其中limit最大为1000。
 func (m *BucketManager) ListFiles(bucket, prefix, delimiter, marker string,
+	limit int) (entries []ListItem, commonPrefixes []string, nextMarker string, hasNext bool, err error) {
+	return m.ListFilesContext(context.TODO(), bucket, prefix, delimiter, marker, limit)
+}
+
+// ListFilesContext 和 ListFiles 相同，可以通过 ctx 取消请求
+func (m *BucketManager) ListFilesContext(ctx context.Context, bucket, prefix, delimiter, marker string,
 	limit int) (entries []ListItem, commonPrefixes []string, nextMarker string, hasNext bool, err error) {
 	if limit <= 0 || limit > 1000 {
 		err = errors.New("invalid list limit, only allow [1, 1000]")
 		return
 	}
 
-	ctx := context.WithValue(context.TODO(), "mac", m.Mac)
+	ctx = m.withMac(ctx)
 	reqHost, reqErr := m.RsfReqHost(bucket)
 	if reqErr != nil {
 		err = reqErr
@@ -465,9 +592,7 @@ func (m *BucketManager) ListFiles(bucket, prefix, delimiter, marker string,
 
 	ret := listFilesRet{}
 	reqURL := fmt.Sprintf("%s%s", reqHost, uriListFiles(bucket, prefix, delimiter, marker, limit))
-	headers := http.Header{}
-	headers.Add("Content-Type", conf.CONTENT_TYPE_FORM)
-	err = m.Client.Call(ctx, &ret, "POST", reqURL, headers)
+	err = m.query(ctx, &ret, reqURL)
 	if err != nil {
 		return
 	}
@@ -485,7 +610,7 @@ func (m *BucketManager) ListFiles(bucket, prefix, delimiter, marker string,
 // ListBucket 用来获取空间文件列表，可以根据需要指定文件的前缀 prefix，文件的目录 delimiter，流式返回每条数据。
 func (m *BucketManager) ListBucket(bucket, prefix, delimiter, marker string) (retCh chan listFilesRet2, err error) {
 
-	ctx := context.WithValue(context.TODO(), "mac", m.Mac)
+	ctx := m.withMac(context.TODO())
 	reqHost, reqErr := m.RsfReqHost(bucket)
 	if reqErr != nil {
 		err = reqErr
@@ -504,7 +629,7 @@ func (m *BucketManager) ListBucket(bucket, prefix, delimiter, marker string) (re
 // 接受的context可以用来取消列举操作
 func (m *BucketManager) ListBucketContext(ctx context.Context, bucket, prefix, delimiter, marker string) (retCh chan listFilesRet2, err error) {
 
-	vctx := context.WithValue(ctx, "mac", m.Mac)
+	vctx := m.withMac(ctx)
 	reqHost, reqErr := m.RsfReqHost(bucket)
 	if reqErr != nil {
 		err = reqErr
@@ -529,14 +654,23 @@ type AsyncFetchParam struct {
 	CallbackURL      string `json:"callbackurl,omitempty"`
 	CallbackBody     string `json:"callbackbody,omitempty"`
 	CallbackBodyType string `json:"callbackbodytype,omitempty"`
+	CallbackHost     string `json:"callbackhost,omitempty"`
 	FileType         int    `json:"file_type,omitempty"`
+	IgnoreSameKey    bool   `json:"ignore_same_key,omitempty"` // 为 true 的时候如果 key 已经存在则不抓取
 }
 
+// AsyncFetchRet 为异步抓取任务的提交和查询结果，Wait 为任务前面排队的任务数量，
+// 为 0 表示正在抓取，为 -1 表示任务已经被处理过（可能在重试中）
 type AsyncFetchRet struct {
 	Id   string `json:"id"`
 	Wait int    `json:"wait"`
 }
 
+// Done 返回异步抓取任务是否已经被处理过
+func (r *AsyncFetchRet) Done() bool {
+	return r.Wait == -1
+}
+
 func (m *BucketManager) AsyncFetch(param AsyncFetchParam) (ret AsyncFetchRet, err error) {
 
 	reqUrl, err := m.ApiReqHost(param.Bucket)
@@ -546,20 +680,55 @@ func (m *BucketManager) AsyncFetch(param AsyncFetchParam) (ret AsyncFetchRet, er
 
 	reqUrl += "/sisyphus/fetch"
 
-	ctx := context.WithValue(context.TODO(), "mac", m.Mac)
+	ctx := m.withMac(context.TODO())
 	headers := http.Header{}
 	headers.Add("Content-Type", conf.CONTENT_TYPE_JSON)
 	err = m.Client.CallWithJson(ctx, &ret, "POST", reqUrl, headers, param)
 	return
 }
 
+// QueryAsyncFetch 用来查询 AsyncFetch 提交的异步抓取任务的状态，bucket 为任务抓取到的空间，id 为 AsyncFetch 返回的任务 id
+func (m *BucketManager) QueryAsyncFetch(bucket, id string) (ret AsyncFetchRet, err error) {
+	return m.QueryAsyncFetchContext(context.TODO(), bucket, id)
+}
+
+// QueryAsyncFetchContext 和 QueryAsyncFetch 相同，可以通过 ctx 取消请求
+func (m *BucketManager) QueryAsyncFetchContext(ctx context.Context, bucket, id string) (ret AsyncFetchRet, err error) {
+	reqURL, err := m.ApiReqHost(bucket)
+	if err != nil {
+		return
+	}
+	reqURL += "/sisyphus/fetch?id=" + url.QueryEscape(id)
+
+	err = m.Client.Call(m.withMac(ctx), &ret, "GET", reqURL, nil)
+	return
+}
+
+// WaitAsyncFetch 每隔 interval 查询一次异步抓取任务的状态，直到任务被处理过或者 ctx 被取消
+func (m *BucketManager) WaitAsyncFetch(ctx context.Context, bucket, id string, interval time.Duration) (ret AsyncFetchRet, err error) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	for {
+		if ret, err = m.QueryAsyncFetchContext(ctx, bucket, id); err != nil || ret.Done() {
+			return
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		}
+	}
+}
+
 func (m *BucketManager) RsHost(bucket string) (rsHost string, err error) {
 	zone, err := m.Zone(bucket)
 	if err != nil {
 		return
 	}
 
-	rsHost = zone.GetRsHost(m.Cfg.UseHTTPS)
+	rsHost = zone.GetRsHost(m.Cfg.useHTTPS())
 	return
 }
 
@@ -569,7 +738,7 @@ func (m *BucketManager) RsfHost(bucket string) (rsfHost string, err error) {
 		return
 	}
 
-	rsfHost = zone.GetRsfHost(m.Cfg.UseHTTPS)
+	rsfHost = zone.GetRsfHost(m.Cfg.useHTTPS())
 	return
 }
 
@@ -579,7 +748,7 @@ func (m *BucketManager) IovipHost(bucket string) (iovipHost string, err error) {
 		return
 	}
 
-	iovipHost = zone.GetIoHost(m.Cfg.UseHTTPS)
+	iovipHost = zone.GetIoHost(m.Cfg.useHTTPS())
 	return
 }
 
@@ -589,7 +758,7 @@ func (m *BucketManager) ApiHost(bucket string) (apiHost string, err error) {
 		return
 	}
 
-	apiHost = zone.GetApiHost(m.Cfg.UseHTTPS)
+	apiHost = zone.GetApiHost(m.Cfg.useHTTPS())
 	return
 }
 
@@ -600,7 +769,7 @@ func (m *BucketManager) Zone(bucket string) (z *Zone, err error) {
 		return
 	}
 
-	z, err = GetZone(m.Mac.AccessKey, bucket)
+	z, err = getZone(context.TODO(), m.Client, m.Cfg.UcReqHost(), m.mac().AccessKey, bucket)
 	return
 }
 
@@ -639,11 +808,66 @@ func URIChangeMime(bucket, key, newMime string) string {
 		base64.URLEncoding.EncodeToString([]byte(newMime)))
 }
 
+// ChgmCond 为修改文件元信息的条件，只有文件当前的信息和设置的字段全部一致的时候才修改，没有设置的字段不作为条件
+type ChgmCond struct {
+	Hash     string
+	MimeType string
+	Fsize    int64
+	PutTime  int64
+}
+
+func (c *ChgmCond) encode() string {
+	var conds []string
+	if c.Hash != "" {
+		conds = append(conds, "hash="+c.Hash)
+	}
+	if c.MimeType != "" {
+		conds = append(conds, "mime="+c.MimeType)
+	}
+	if c.Fsize > 0 {
+		conds = append(conds, "fsize="+strconv.FormatInt(c.Fsize, 10))
+	}
+	if c.PutTime > 0 {
+		conds = append(conds, "putTime="+strconv.FormatInt(c.PutTime, 10))
+	}
+	return strings.Join(conds, "&")
+}
+
+// URIChangeMeta 构建修改文件 MimeType 和自定义元数据的 chgm 接口的请求命令，newMime 为空的时候不修改 MimeType，
+// metas 的 key 可以省略 "x-qn-meta-" 前缀，cond 可以为 nil
+func URIChangeMeta(bucket, key, newMime string, metas map[string]string, cond *ChgmCond) string {
+	uri := "/chgm/" + EncodedEntry(bucket, key)
+	if newMime != "" {
+		uri += "/mime/" + base64.URLEncoding.EncodeToString([]byte(newMime))
+	}
+
+	names := make([]string, 0, len(metas))
+	for name := range metas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		uri += "/" + metadataKey(name) + "/" + base64.URLEncoding.EncodeToString([]byte(metas[name]))
+	}
+
+	if cond != nil {
+		if c := cond.encode(); c != "" {
+			uri += "/cond/" + base64.URLEncoding.EncodeToString([]byte(c))
+		}
+	}
+	return uri
+}
+
 // URIChangeType 构建 chtype 接口的请求命令
 func URIChangeType(bucket, key string, fileType int) string {
 	return fmt.Sprintf("/chtype/%s/type/%d", EncodedEntry(bucket, key), fileType)
 }
 
+// URIRestoreAr 构建 restoreAr 接口的请求命令
+func URIRestoreAr(bucket, key string, freezeAfterDays int) string {
+	return fmt.Sprintf("/restoreAr/%s/freezeAfterDays/%d", EncodedEntry(bucket, key), freezeAfterDays)
+}
+
 // 构建op的方法，非导出的方法无法用在Batch操作中
 func uriFetch(resURL, bucket, key string) string {
 	return fmt.Sprintf("/fetch/%s/to/%s",
@@ -718,6 +942,46 @@ func EncodedEntryWithoutKey(bucket string) string {
 	return base64.URLEncoding.EncodeToString([]byte(bucket))
 }
 
+// EncodeEntry 生成资源管理请求中使用的 URL Safe Base64 编码的 Entry，和 EncodedEntry 相同
+func EncodeEntry(bucket, key string) string {
+	return EncodedEntry(bucket, key)
+}
+
+// DecodeEntry 解析 EncodeEntry 或者 EncodedEntryWithoutKey 生成的 Entry，后者的 hasKey 为 false。
+// 兼容没有 "=" 填充的编码
+func DecodeEntry(encodedEntry string) (bucket, key string, hasKey bool, err error) {
+	entry, err := decodeURLSafe(encodedEntry)
+	if err != nil {
+		return
+	}
+	pair := strings.SplitN(entry, ":", 2)
+	bucket = pair[0]
+	if len(pair) == 2 {
+		key, hasKey = pair[1], true
+	}
+	return
+}
+
+// EncodeKey 生成 URL Safe Base64 编码的 key，用于 mkfile、分片上传 v2 等请求路径中的 key
+func EncodeKey(key string) string {
+	return base64.URLEncoding.EncodeToString([]byte(key))
+}
+
+// DecodeKey 解析 EncodeKey 编码的 key，兼容没有 "=" 填充的编码
+func DecodeKey(encodedKey string) (key string, err error) {
+	return decodeURLSafe(encodedKey)
+}
+
+// decodeURLSafe 解码 URL Safe Base64 编码的字符串，没有 "=" 填充的时候按照不填充的方式解码
+func decodeURLSafe(s string) (string, error) {
+	if strings.HasSuffix(s, "=") || len(s)%4 == 0 {
+		data, err := base64.URLEncoding.DecodeString(s)
+		return string(data), err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	return string(data), err
+}
+
 // MakePublicURL 用来生成公开空间资源下载链接
 func MakePublicURL(domain, key string) (finalUrl string) {
 	domain = strings.TrimRight(domain, "/")
@@ -740,3 +1004,35 @@ func MakePrivateURL(mac *qbox.Mac, domain, key string, deadline int64) (privateU
 	privateURL = fmt.Sprintf("%s&token=%s", urlToSign, token)
 	return
 }
+
+// MakePrivateURLWithQuery 用来生成私有空间资源的下载链接，链接在 ttl 时间之后过期。
+//
+// key   会按照路径的规则进行转义，'/' 保留不变，所以 key 中可以包含 '?'、'#' 和空格等字符。
+// query 为链接中额外的查询参数，可以为 nil。值为空的参数原样保留而且不带 '='，用来设置数据处理参数，
+// 比如 url.Values{"imageView2/1/w/200": nil}，其他参数按照查询参数的规则进行转义。
+func MakePrivateURLWithQuery(mac *qbox.Mac, domain, key string, ttl time.Duration, query url.Values) (privateURL string) {
+	urlToSign := strings.TrimRight(domain, "/") + "/" + (&url.URL{Path: key}).EscapedPath()
+
+	params := make([]string, 0, len(query)+1)
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := query[name]
+		if len(values) == 0 || len(values) == 1 && values[0] == "" {
+			params = append(params, name)
+			continue
+		}
+		for _, value := range values {
+			params = append(params, url.QueryEscape(name)+"="+url.QueryEscape(value))
+		}
+	}
+	params = append(params, fmt.Sprintf("e=%d", time.Now().Add(ttl).Unix()))
+
+	urlToSign += "?" + strings.Join(params, "&")
+	token := mac.Sign([]byte(urlToSign))
+	privateURL = fmt.Sprintf("%s&token=%s", urlToSign, token)
+	return
+}
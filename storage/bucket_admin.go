@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qiniu/api.v7/conf"
+)
+
+// BucketInfo 为空间的基本信息
+type BucketInfo struct {
+	Region  string `json:"region"`  // 空间所在的机房，比如 RIDHuadong
+	Zone    string `json:"zone"`    // 空间所在的机房，和 Region 相同，部分老的空间只返回这个字段
+	Private int    `json:"private"` // 是否为私有空间，1 表示私有，0 表示公开
+	Ctime   int64  `json:"ctime"`   // 空间的创建时间，单位为秒
+
+	AntiLeechMode int      `json:"anti_leech_mode"` // 防盗链模式，见 RefererAntiLeech
+	ReferWl       []string `json:"refer_wl"`        // 防盗链白名单
+	ReferBl       []string `json:"refer_bl"`        // 防盗链黑名单
+	NoRefer       bool     `json:"no_refer"`        // 是否允许空 Referer 访问
+}
+
+// IsPrivate 返回空间是否为私有空间
+func (info *BucketInfo) IsPrivate() bool {
+	return info.Private == 1
+}
+
+// CreateTime 返回空间的创建时间
+func (info *BucketInfo) CreateTime() time.Time {
+	return time.Unix(info.Ctime, 0)
+}
+
+// CreateBucket 用来在 regionID 所表示的机房创建空间，regionID 为 RIDHuadong，RIDHuabei 等
+func (m *BucketManager) CreateBucket(bucket, regionID string) (err error) {
+	if bucket == "" || regionID == "" {
+		err = errors.New("bucket and region id are required")
+		return
+	}
+	ctx := m.withMac(context.TODO())
+	reqURL := fmt.Sprintf("%s/mkbucketv3/%s/region/%s", m.Cfg.RsReqHost(), bucket, regionID)
+	headers := http.Header{}
+	headers.Add("Content-Type", conf.CONTENT_TYPE_FORM)
+	err = m.Client.Call(ctx, nil, "POST", reqURL, headers)
+	return
+}
+
+// DropBucket 用来删除空间，空间中的文件需要先全部删除
+func (m *BucketManager) DropBucket(bucket string) (err error) {
+	ctx := m.withMac(context.TODO())
+	reqURL := fmt.Sprintf("%s/drop/%s", m.Cfg.RsReqHost(), bucket)
+	headers := http.Header{}
+	headers.Add("Content-Type", conf.CONTENT_TYPE_FORM)
+	err = m.Client.Call(ctx, nil, "POST", reqURL, headers)
+	return
+}
+
+// GetBucketInfo 用来获取空间所在的机房，是否为私有空间以及创建时间等信息
+func (m *BucketManager) GetBucketInfo(bucket string) (info BucketInfo, err error) {
+	ctx := m.withMac(context.TODO())
+	reqURL := m.Cfg.UcReqHost() + "/v2/bucketInfo"
+	params := map[string][]string{
+		"bucket": {bucket},
+	}
+	err = m.Client.CallWithForm(ctx, &info, "POST", reqURL, nil, params)
+	if err == nil && info.Region == "" {
+		info.Region = info.Zone
+	}
+	return
+}
+
+// SetBucketPrivate 用来设置空间为私有空间或者公开空间，私有空间的文件需要通过 MakePrivateURL 生成的链接下载
+func (m *BucketManager) SetBucketPrivate(bucket string, private bool) (err error) {
+	ctx := m.withMac(context.TODO())
+	reqURL := m.Cfg.UcReqHost() + "/private"
+	params := map[string][]string{
+		"bucket":  {bucket},
+		"private": {boolParam(private)},
+	}
+	err = m.Client.CallWithForm(ctx, nil, "POST", reqURL, nil, params)
+	return
+}
+
+// 防盗链模式
+const (
+	AntiLeechOff       = 0 // 关闭防盗链
+	AntiLeechWhitelist = 1 // 只允许白名单中的 Referer 访问
+	AntiLeechBlacklist = 2 // 禁止黑名单中的 Referer 访问
+)
+
+// RefererAntiLeech 为空间的 Referer 防盗链设置
+type RefererAntiLeech struct {
+	Mode int // AntiLeechOff，AntiLeechWhitelist 或者 AntiLeechBlacklist
+
+	// 白名单或者黑名单中的域名，支持 "*.example.com" 这样的通配符，模式为 AntiLeechOff 的时候忽略
+	Patterns []string
+
+	AllowEmptyReferer bool // 是否允许空 Referer 访问
+	SourceEnabled     bool // 是否同时对镜像回源请求生效
+}
+
+// SetRefererAntiLeech 用来设置空间的 Referer 防盗链
+func (m *BucketManager) SetRefererAntiLeech(bucket string, antiLeech *RefererAntiLeech) (err error) {
+	if antiLeech.Mode < AntiLeechOff || antiLeech.Mode > AntiLeechBlacklist {
+		err = errors.New("invalid anti leech mode: " + strconv.Itoa(antiLeech.Mode))
+		return
+	}
+	if antiLeech.Mode != AntiLeechOff && len(antiLeech.Patterns) == 0 {
+		err = errors.New("anti leech patterns are required")
+		return
+	}
+	ctx := m.withMac(context.TODO())
+	reqURL := m.Cfg.UcReqHost() + "/referAntiLeech"
+	params := map[string][]string{
+		"bucket":         {bucket},
+		"mode":           {strconv.Itoa(antiLeech.Mode)},
+		"norefer":        {boolParam(antiLeech.AllowEmptyReferer)},
+		"pattern":        {strings.Join(antiLeech.Patterns, ";")},
+		"source_enabled": {boolParam(antiLeech.SourceEnabled)},
+	}
+	err = m.Client.CallWithForm(ctx, nil, "POST", reqURL, nil, params)
+	return
+}
+
+func boolParam(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// ListDomains 用来获取空间绑定的全部域名
+func (m *BucketManager) ListDomains(bucket string) (domains []string, err error) {
+	ctx := m.withMac(context.TODO())
+	reqHost, reqErr := m.ApiReqHost(bucket)
+	if reqErr != nil {
+		err = reqErr
+		return
+	}
+	reqURL := reqHost + "/v6/domain/list"
+	params := map[string][]string{
+		"tbl": {bucket},
+	}
+	err = m.Client.CallWithForm(ctx, &domains, "GET", reqURL, nil, params)
+	return
+}
+
+// BindDomain 用来为空间绑定自定义域名，域名需要已经备案，并且将 CNAME 指向七牛提供的域名之后才能访问
+func (m *BucketManager) BindDomain(bucket, domain string) (err error) {
+	ctx := m.withMac(context.TODO())
+	reqURL := fmt.Sprintf("%s/publish/%s/from/%s", m.Cfg.UcReqHost(),
+		base64.URLEncoding.EncodeToString([]byte(domain)), bucket)
+	headers := http.Header{}
+	headers.Add("Content-Type", conf.CONTENT_TYPE_FORM)
+	err = m.Client.Call(ctx, nil, "POST", reqURL, headers)
+	return
+}
+
+// UnbindDomain 用来解除域名和空间的绑定
+func (m *BucketManager) UnbindDomain(domain string) (err error) {
+	ctx := m.withMac(context.TODO())
+	reqURL := fmt.Sprintf("%s/unpublish/%s", m.Cfg.UcReqHost(), base64.URLEncoding.EncodeToString([]byte(domain)))
+	headers := http.Header{}
+	headers.Add("Content-Type", conf.CONTENT_TYPE_FORM)
+	err = m.Client.Call(ctx, nil, "POST", reqURL, headers)
+	return
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreateDropBucket(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "POST" || !strings.HasPrefix(req.Header.Get("Authorization"), "QBox ") {
+			http.Error(w, `{"error":"bad request"}`, http.StatusBadRequest)
+			return
+		}
+		paths = append(paths, req.URL.Path)
+	}))
+	defer server.Close()
+
+	bucketManager := NewBucketManager(mac, &Config{RsHost: server.URL})
+	if err := bucketManager.CreateBucket("bucket", RIDHuabei); err != nil {
+		t.Fatalf("BucketManager#CreateBucket() error, %s", err)
+	}
+	if err := bucketManager.DropBucket("bucket"); err != nil {
+		t.Fatalf("BucketManager#DropBucket() error, %s", err)
+	}
+	if len(paths) != 2 || paths[0] != "/mkbucketv3/bucket/region/z1" || paths[1] != "/drop/bucket" {
+		t.Fatalf("BucketManager#CreateBucket() error, unexpected requests %v", paths)
+	}
+	if err := bucketManager.CreateBucket("bucket", ""); err == nil {
+		t.Fatalf("BucketManager#CreateBucket() should fail without region id")
+	}
+}
+
+func TestGetBucketInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		if req.URL.Path != "/v2/bucketInfo" || req.Form.Get("bucket") != "bucket" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"zone":"z2","private":1,"ctime":1500000000}`))
+	}))
+	defer server.Close()
+
+	bucketManager := NewBucketManager(mac, &Config{UcHost: server.URL})
+	info, err := bucketManager.GetBucketInfo("bucket")
+	if err != nil {
+		t.Fatalf("BucketManager#GetBucketInfo() error, %s", err)
+	}
+	if info.Region != RIDHuanan || !info.IsPrivate() || info.CreateTime().Unix() != 1500000000 {
+		t.Fatalf("BucketManager#GetBucketInfo() error, unexpected info %+v", info)
+	}
+}
+
+func TestBucketAccessControl(t *testing.T) {
+	forms := map[string]map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		form := map[string]string{}
+		for k := range req.Form {
+			form[k] = req.Form.Get(k)
+		}
+		forms[req.URL.Path] = form
+	}))
+	defer server.Close()
+
+	bucketManager := NewBucketManager(mac, &Config{UcHost: server.URL})
+	if err := bucketManager.SetBucketPrivate("bucket", true); err != nil {
+		t.Fatalf("BucketManager#SetBucketPrivate() error, %s", err)
+	}
+	if form := forms["/private"]; form["bucket"] != "bucket" || form["private"] != "1" {
+		t.Fatalf("BucketManager#SetBucketPrivate() error, unexpected form %v", form)
+	}
+
+	antiLeech := RefererAntiLeech{
+		Mode:              AntiLeechWhitelist,
+		Patterns:          []string{"*.example.com", "example.org"},
+		AllowEmptyReferer: true,
+	}
+	if err := bucketManager.SetRefererAntiLeech("bucket", &antiLeech); err != nil {
+		t.Fatalf("BucketManager#SetRefererAntiLeech() error, %s", err)
+	}
+	form := forms["/referAntiLeech"]
+	if form["mode"] != "1" || form["pattern"] != "*.example.com;example.org" || form["norefer"] != "1" || form["source_enabled"] != "0" {
+		t.Fatalf("BucketManager#SetRefererAntiLeech() error, unexpected form %v", form)
+	}
+	if err := bucketManager.SetRefererAntiLeech("bucket", &RefererAntiLeech{Mode: AntiLeechBlacklist}); err == nil {
+		t.Fatalf("BucketManager#SetRefererAntiLeech() should fail without patterns")
+	}
+}
+
+func TestBucketDomains(t *testing.T) {
+	domains := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		parts := strings.Split(req.URL.Path, "/")
+		switch {
+		case req.URL.Path == "/v6/domain/list":
+			if req.URL.Query().Get("tbl") != "bucket" {
+				http.NotFound(w, req)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(domains)
+		case len(parts) == 5 && parts[1] == "publish" && parts[4] == "bucket":
+			domain, _ := base64.URLEncoding.DecodeString(parts[2])
+			domains = append(domains, string(domain))
+		case len(parts) == 3 && parts[1] == "unpublish":
+			domains = domains[:0]
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	host := server.URL
+	bucketManager := NewBucketManager(mac, &Config{UcHost: host, ApiHost: host})
+	if err := bucketManager.BindDomain("bucket", "cdn.example.com"); err != nil {
+		t.Fatalf("BucketManager#BindDomain() error, %s", err)
+	}
+	got, err := bucketManager.ListDomains("bucket")
+	if err != nil {
+		t.Fatalf("BucketManager#ListDomains() error, %s", err)
+	}
+	if len(got) != 1 || got[0] != "cdn.example.com" {
+		t.Fatalf("BucketManager#ListDomains() error, unexpected domains %v", got)
+	}
+	if err = bucketManager.UnbindDomain("cdn.example.com"); err != nil {
+		t.Fatalf("BucketManager#UnbindDomain() error, %s", err)
+	}
+	if got, _ = bucketManager.ListDomains("bucket"); len(got) != 0 {
+		t.Fatalf("BucketManager#UnbindDomain() error, unexpected domains %v", got)
+	}
+}
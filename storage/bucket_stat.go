@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// 统计数据的时间粒度
+const (
+	StatGranularity5Min  = "5min"
+	StatGranularityHour  = "hour"
+	StatGranularityDay   = "day"
+	StatGranularityMonth = "month"
+)
+
+// 统计接口使用的时间格式
+const statTimeFormat = "20060102150405"
+
+// StatQuery 为统计接口的查询条件
+type StatQuery struct {
+	Begin       time.Time // 开始时间
+	End         time.Time // 结束时间
+	Granularity string    // 时间粒度，见 StatGranularityDay 等，不设定则为 StatGranularityDay
+}
+
+func (q *StatQuery) params() (params map[string][]string, err error) {
+	if q.Begin.IsZero() || q.End.IsZero() || q.End.Before(q.Begin) {
+		err = errors.New("stat query: invalid time range")
+		return
+	}
+	g := q.Granularity
+	if g == "" {
+		g = StatGranularityDay
+	}
+	params = map[string][]string{
+		"begin": {q.Begin.Format(statTimeFormat)},
+		"end":   {q.End.Format(statTimeFormat)},
+		"g":     {g},
+	}
+	return
+}
+
+// StatPoint 为统计数据中的一个点
+type StatPoint struct {
+	Time  time.Time
+	Value int64
+}
+
+// GetSpaceStat 用来查询空间的存储量，单位为字节
+func (m *BucketManager) GetSpaceStat(bucket string, query *StatQuery) (points []StatPoint, err error) {
+	return m.getSeriesStat("/v6/space", bucket, query)
+}
+
+// GetCountStat 用来查询空间的文件数量
+func (m *BucketManager) GetCountStat(bucket string, query *StatQuery) (points []StatPoint, err error) {
+	return m.getSeriesStat("/v6/count", bucket, query)
+}
+
+// getSeriesStat 查询 space 和 count 这类按照 times 和 datas 返回的统计数据
+func (m *BucketManager) getSeriesStat(path, bucket string, query *StatQuery) (points []StatPoint, err error) {
+	params, err := query.params()
+	if err != nil {
+		return
+	}
+	params["bucket"] = []string{bucket}
+
+	reqHost, reqErr := m.ApiReqHost(bucket)
+	if reqErr != nil {
+		err = reqErr
+		return
+	}
+	var ret struct {
+		Times []int64 `json:"times"`
+		Datas []int64 `json:"datas"`
+	}
+	ctx := m.withMac(context.TODO())
+	if err = m.Client.CallWithForm(ctx, &ret, "GET", reqHost+path, nil, params); err != nil {
+		return
+	}
+	if len(ret.Times) != len(ret.Datas) {
+		err = errors.New("stat: mismatched times and datas in response")
+		return
+	}
+	points = make([]StatPoint, len(ret.Times))
+	for i := range ret.Times {
+		points[i] = StatPoint{Time: time.Unix(ret.Times[i], 0), Value: ret.Datas[i]}
+	}
+	return
+}
+
+// GetBlobTransferStat 用来查询空间跨区域同步的流量，单位为字节
+func (m *BucketManager) GetBlobTransferStat(bucket string, query *StatQuery) (points []StatPoint, err error) {
+	return m.getValuesStat("/v6/blob_transfer", bucket, "size", query)
+}
+
+// GetBlobIOStat 用来查询空间的外网流出流量或者 GET 请求次数，selectField 为 "flow" 的时候查询流量，单位为字节，
+// 为 "hits" 的时候查询请求次数
+func (m *BucketManager) GetBlobIOStat(bucket, selectField string, query *StatQuery) (points []StatPoint, err error) {
+	if selectField != "flow" && selectField != "hits" {
+		err = errors.New("stat: select field must be flow or hits")
+		return
+	}
+	return m.getValuesStat("/v6/blob_io", bucket, selectField, query)
+}
+
+// getValuesStat 查询 blob_transfer 和 blob_io 这类按照 time 和 values 返回的统计数据
+func (m *BucketManager) getValuesStat(path, bucket, selectField string, query *StatQuery) (points []StatPoint, err error) {
+	params, err := query.params()
+	if err != nil {
+		return
+	}
+	params["$bucket"] = []string{bucket}
+	params["select"] = []string{selectField}
+
+	reqHost, reqErr := m.ApiReqHost(bucket)
+	if reqErr != nil {
+		err = reqErr
+		return
+	}
+	var ret []struct {
+		Time   time.Time        `json:"time"`
+		Values map[string]int64 `json:"values"`
+	}
+	ctx := m.withMac(context.TODO())
+	if err = m.Client.CallWithForm(ctx, &ret, "GET", reqHost+path, nil, params); err != nil {
+		return
+	}
+	points = make([]StatPoint, len(ret))
+	for i := range ret {
+		points[i] = StatPoint{Time: ret[i].Time, Value: ret[i].Values[selectField]}
+	}
+	return
+}
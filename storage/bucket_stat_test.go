@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBucketStat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		if query.Get("begin") != "20180101000000" || query.Get("end") != "20180103000000" || query.Get("g") != "day" {
+			http.Error(w, `{"error":"bad request"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/v6/space", "/v6/count":
+			if query.Get("bucket") != "bucket" {
+				http.NotFound(w, req)
+				return
+			}
+			w.Write([]byte(`{"times":[1514736000,1514822400],"datas":[100,200]}`))
+		case "/v6/blob_io":
+			if query.Get("$bucket") != "bucket" || query.Get("select") != "flow" {
+				http.NotFound(w, req)
+				return
+			}
+			w.Write([]byte(`[{"time":"2018-01-01T00:00:00+08:00","values":{"flow":300}}]`))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	bucketManager := NewBucketManager(mac, &Config{ApiHost: server.URL})
+	loc := time.FixedZone("CST", 8*3600)
+	query := StatQuery{
+		Begin: time.Date(2018, 1, 1, 0, 0, 0, 0, loc),
+		End:   time.Date(2018, 1, 3, 0, 0, 0, 0, loc),
+	}
+	points, err := bucketManager.GetSpaceStat("bucket", &query)
+	if err != nil {
+		t.Fatalf("BucketManager#GetSpaceStat() error, %s", err)
+	}
+	if len(points) != 2 || !points[0].Time.Equal(query.Begin) || points[1].Value != 200 {
+		t.Fatalf("BucketManager#GetSpaceStat() error, unexpected points %v", points)
+	}
+	points, err = bucketManager.GetBlobIOStat("bucket", "flow", &query)
+	if err != nil {
+		t.Fatalf("BucketManager#GetBlobIOStat() error, %s", err)
+	}
+	if len(points) != 1 || !points[0].Time.Equal(query.Begin) || points[0].Value != 300 {
+		t.Fatalf("BucketManager#GetBlobIOStat() error, unexpected points %v", points)
+	}
+
+	if _, err = bucketManager.GetCountStat("bucket", &StatQuery{Begin: query.End, End: query.Begin}); err == nil {
+		t.Fatalf("BucketManager#GetCountStat() should fail for invalid time range")
+	}
+}
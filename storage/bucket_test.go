@@ -1,10 +1,15 @@
 package storage
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -253,6 +258,50 @@ func TestMakePrivateUrl(t *testing.T) {
 	}
 }
 
+func TestMakePrivateURLWithQuery(t *testing.T) {
+	query := url.Values{"imageView2/1/w/200": nil, "attname": {"a b.jpg"}}
+	privateURL := MakePrivateURLWithQuery(mac, "http://example.com/", "dir/a ?#.jpg", time.Hour, query)
+
+	idx := strings.LastIndex(privateURL, "&token=")
+	if idx < 0 {
+		t.Fatalf("MakePrivateURLWithQuery() error, no token in %s", privateURL)
+	}
+	urlToSign, token := privateURL[:idx], privateURL[idx+len("&token="):]
+	if token != mac.Sign([]byte(urlToSign)) {
+		t.Fatalf("MakePrivateURLWithQuery() error, invalid token %s", token)
+	}
+	prefix := "http://example.com/dir/a%20%3F%23.jpg?attname=a+b.jpg&imageView2/1/w/200&e="
+	if !strings.HasPrefix(urlToSign, prefix) {
+		t.Fatalf("MakePrivateURLWithQuery() error, unexpected url %s", urlToSign)
+	}
+}
+
+func TestBatchPartialFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/batch" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(298)
+		w.Write([]byte(`[{"code":200},{"code":612,"data":{"error":"no such file or directory"}},{"code":599,"data":{"error":"server error"}}]`))
+	}))
+	defer server.Close()
+
+	bucketManager := NewBucketManager(mac, &Config{CentralRsHost: server.URL})
+	ops := []string{URIDelete("bucket", "a"), URIDelete("bucket", "b"), URIDelete("bucket", "c")}
+	rets, err := bucketManager.BatchContext(context.Background(), ops)
+	if err != nil {
+		t.Fatalf("BucketManager#BatchContext() error, %s", err)
+	}
+	if failed := FailedBatchOps(ops, rets, false); len(failed) != 2 || failed[0] != ops[1] || failed[1] != ops[2] {
+		t.Fatalf("FailedBatchOps() error, unexpected failed operations %v", failed)
+	}
+	if failed := FailedBatchOps(ops, rets, true); len(failed) != 1 || failed[0] != ops[2] {
+		t.Fatalf("FailedBatchOps() error, unexpected retryable operations %v", failed)
+	}
+}
+
 func TestBatch(t *testing.T) {
 	copyCnt := 100
 	copyOps := make([]string, 0, copyCnt)
@@ -280,3 +329,105 @@ func TestBatch(t *testing.T) {
 
 	t.Logf("BatchStat: %v", batchOpRets)
 }
+
+func TestURIRestoreAr(t *testing.T) {
+	if uri := URIRestoreAr("bucket", "key", 3); uri != "/restoreAr/"+EncodedEntry("bucket", "key")+"/freezeAfterDays/3" {
+		t.Fatalf("URIRestoreAr() error, %s", uri)
+	}
+	bucketManager := NewBucketManager(mac, &Config{})
+	if err := bucketManager.RestoreAr("bucket", "key", 8); err == nil {
+		t.Fatalf("BucketManager#RestoreAr() should fail for invalid freezeAfterDays")
+	}
+}
+
+func TestWaitAsyncFetch(t *testing.T) {
+	queries := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/sisyphus/fetch" || req.URL.Query().Get("id") != "job" {
+			http.NotFound(w, req)
+			return
+		}
+		queries++
+		wait := 2 - queries
+		if wait < 0 {
+			wait = -1
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"job","wait":%d}`, wait)
+	}))
+	defer server.Close()
+
+	bucketManager := NewBucketManager(mac, &Config{ApiHost: server.URL})
+	ret, err := bucketManager.WaitAsyncFetch(context.Background(), "bucket", "job", time.Millisecond)
+	if err != nil {
+		t.Fatalf("BucketManager#WaitAsyncFetch() error, %s", err)
+	}
+	if !ret.Done() || queries != 3 {
+		t.Fatalf("BucketManager#WaitAsyncFetch() error, ret %+v after %d queries", ret, queries)
+	}
+}
+
+func TestURIChangeMeta(t *testing.T) {
+	cond := ChgmCond{Hash: "hash", Fsize: 100}
+	uri := URIChangeMeta("bucket", "key", "image/png", map[string]string{"b": "2", "x-qn-meta-a": "1"}, &cond)
+	expected := "/chgm/" + EncodedEntry("bucket", "key") +
+		"/mime/" + base64.URLEncoding.EncodeToString([]byte("image/png")) +
+		"/x-qn-meta-b/" + base64.URLEncoding.EncodeToString([]byte("2")) +
+		"/x-qn-meta-a/" + base64.URLEncoding.EncodeToString([]byte("1")) +
+		"/cond/" + base64.URLEncoding.EncodeToString([]byte("hash=hash&fsize=100"))
+	if uri != expected {
+		t.Fatalf("URIChangeMeta() error, %s, expected %s", uri, expected)
+	}
+	if uri = URIChangeMeta("bucket", "key", "", nil, nil); uri != "/chgm/"+EncodedEntry("bucket", "key") {
+		t.Fatalf("URIChangeMeta() error, %s", uri)
+	}
+}
+
+func TestWaitAsyncFetchCanceled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	bucketManager := NewBucketManager(mac, &Config{ApiHost: server.URL})
+	done := make(chan error, 1)
+	go func() {
+		_, err := bucketManager.WaitAsyncFetch(ctx, "bucket", "job", time.Millisecond)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("BucketManager#WaitAsyncFetch() should fail after ctx is canceled")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("BucketManager#WaitAsyncFetch() should abort the in-flight query")
+	}
+}
+
+func TestEncodeEntryAndKey(t *testing.T) {
+	entry := EncodeEntry("bucket", "dir/a:b.txt")
+	if entry != EncodedEntry("bucket", "dir/a:b.txt") {
+		t.Fatalf("EncodeEntry() = %s", entry)
+	}
+	for _, encoded := range []string{entry, strings.TrimRight(entry, "=")} {
+		bucket, key, hasKey, err := DecodeEntry(encoded)
+		if err != nil || bucket != "bucket" || key != "dir/a:b.txt" || !hasKey {
+			t.Fatalf("DecodeEntry(%s) = %s, %s, %v, %v", encoded, bucket, key, hasKey, err)
+		}
+	}
+	if bucket, _, hasKey, err := DecodeEntry(EncodedEntryWithoutKey("bucket")); err != nil || bucket != "bucket" || hasKey {
+		t.Fatalf("DecodeEntry() without key = %s, %v, %v", bucket, hasKey, err)
+	}
+	if _, _, _, err := DecodeEntry("!invalid"); err == nil {
+		t.Fatal("DecodeEntry() should fail with invalid base64")
+	}
+
+	if key, err := DecodeKey(strings.TrimRight(EncodeKey("中文?.txt"), "=")); err != nil || key != "中文?.txt" {
+		t.Fatalf("DecodeKey() = %s, %v", key, err)
+	}
+}
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/qiniu/api.v7/auth/qbox"
+	"github.com/qiniu/api.v7/conf"
+)
+
+// 处理上传回调请求时可能遇到的错误
+var (
+	ErrInvalidCallback        = errors.New("invalid callback request, signature mismatch")
+	ErrUnsupportedCallbackRet = errors.New("form callback body can only be decoded into *url.Values or *map[string]string")
+)
+
+// Callback 表示上传成功之后七牛服务器回调业务服务器的设置
+type Callback struct {
+	// 必须。回调地址，可以指定多个，七牛服务器依次尝试回调，直到成功为止
+	URLs []string
+
+	// 可选。回调请求的 Host 头部
+	Host string
+
+	// 可选。回调请求的内容格式，为 conf.CONTENT_TYPE_FORM 或者 conf.CONTENT_TYPE_JSON，不设定则为 conf.CONTENT_TYPE_FORM
+	BodyType string
+
+	// 可选。回调请求中的字段，值可以使用魔法变量和自定义变量，比如 "$(key)"，"$(fsize)"，"$(x:user)"
+	Body map[string]string
+
+	// 可选。设置之后七牛服务器根据回调返回的内容中的 key 字段保存文件
+	FetchKey bool
+}
+
+// SetCallback 用来设置上传策略中的 callbackUrl，callbackHost，callbackBody，callbackBodyType 和 callbackFetchKey
+func (p *PutPolicy) SetCallback(cb *Callback) (err error) {
+	if len(cb.URLs) == 0 {
+		err = errors.New("callback url is required")
+		return
+	}
+
+	bodyType := cb.BodyType
+	if bodyType == "" {
+		bodyType = conf.CONTENT_TYPE_FORM
+	}
+	body, err := callbackBody(bodyType, cb.Body)
+	if err != nil {
+		return
+	}
+
+	p.CallbackURL = strings.Join(cb.URLs, ";")
+	p.CallbackHost = cb.Host
+	p.CallbackBody = body
+	p.CallbackBodyType = bodyType
+	p.CallbackFetchKey = 0
+	if cb.FetchKey {
+		p.CallbackFetchKey = 1
+	}
+	return
+}
+
+// callbackBody 按照 bodyType 生成回调请求的内容模板，魔法变量不做转义，交给七牛服务器替换
+func callbackBody(bodyType string, fields map[string]string) (body string, err error) {
+	switch bodyType {
+	case conf.CONTENT_TYPE_JSON:
+		if len(fields) == 0 {
+			body = "{}"
+			return
+		}
+		data, mErr := json.Marshal(fields)
+		if mErr != nil {
+			err = mErr
+			return
+		}
+		body = string(data)
+	case conf.CONTENT_TYPE_FORM:
+		keys := make([]string, 0, len(fields))
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		items := make([]string, 0, len(keys))
+		for _, k := range keys {
+			items = append(items, url.QueryEscape(k)+"="+fields[k])
+		}
+		body = strings.Join(items, "&")
+	default:
+		err = errors.New("unsupported callback body type: " + bodyType)
+	}
+	return
+}
+
+// VerifyCallback 用来在业务服务器上检查七牛的上传回调请求的签名是否正确，sk 是上传凭证对应的 SecretKey。
+// 支持 "QBox" 和 "Qiniu" 两种签名方式，"QBox" 的签名包括请求的路径、查询参数和 body，表单和 JSON 格式的 body 都包括在内。
+// 检查之后 req.Body 仍然可以读取。Authorization 头部不存在或者格式不正确的时候返回 false，读取 body 失败的时候返回错误
+func VerifyCallback(req *http.Request, sk string) (ok bool, err error) {
+	auth := req.Header.Get("Authorization")
+	qiniuAuth := strings.HasPrefix(auth, "Qiniu ")
+	if !qiniuAuth && !strings.HasPrefix(auth, "QBox ") {
+		return
+	}
+	token := auth[strings.Index(auth, " ")+1:]
+	ak := callbackAccessKey(req)
+	if ak == "" {
+		return
+	}
+
+	var body []byte
+	if req.Body != nil {
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	mac := qbox.NewMac(ak, sk)
+	var expected string
+	if qiniuAuth {
+		if expected, err = mac.SignRequestV2(req); err != nil {
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	} else {
+		data := req.URL.Path
+		if req.URL.RawQuery != "" {
+			data += "?" + req.URL.RawQuery
+		}
+		expected = mac.Sign(append([]byte(data+"\n"), body...))
+	}
+	ok = hmac.Equal([]byte(expected), []byte(token))
+	return
+}
+
+// callbackAccessKey 返回回调请求的 Authorization 头部中的 AccessKey，格式不正确的时候返回空字符串
+func callbackAccessKey(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	i := strings.Index(auth, " ")
+	j := strings.Index(auth, ":")
+	if i < 0 || j <= i+1 {
+		return ""
+	}
+	return auth[i+1 : j]
+}
+
+// ParseCallback 用来在业务服务器上处理七牛的上传回调请求，先检查请求的签名是否正确，然后将回调的内容解析到 ret 中。
+//
+// mac 是上传凭证对应的 AccessKey 和 SecretKey。
+// req 是七牛服务器发送的回调请求。
+// ret 用来保存解析的回调内容。回调内容为 JSON 格式的时候可以是任意的结构体指针，
+// 为表单格式的时候只能是 *url.Values 或者 *map[string]string。
+//
+// 签名不正确的时候返回 ErrInvalidCallback。
+func ParseCallback(mac *qbox.Mac, req *http.Request, ret interface{}) (err error) {
+	ok, err := VerifyCallback(req, string(mac.SecretKey))
+	if err != nil {
+		return
+	}
+	ok = ok && callbackAccessKey(req) == mac.AccessKey
+	if !ok {
+		return ErrInvalidCallback
+	}
+	if ret == nil || req.Body == nil {
+		return
+	}
+
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType == conf.CONTENT_TYPE_JSON {
+		return json.Unmarshal(data, ret)
+	}
+
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return
+	}
+	switch v := ret.(type) {
+	case *url.Values:
+		*v = values
+	case *map[string]string:
+		m := make(map[string]string, len(values))
+		for k := range values {
+			m[k] = values.Get(k)
+		}
+		*v = m
+	default:
+		err = ErrUnsupportedCallbackRet
+	}
+	return
+}
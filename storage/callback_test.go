@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/qiniu/api.v7/auth/qbox"
+	"github.com/qiniu/api.v7/conf"
+)
+
+func TestPutPolicySetCallback(t *testing.T) {
+	var putPolicy PutPolicy
+	err := putPolicy.SetCallback(&Callback{
+		URLs: []string{"http://a.example.com/callback", "http://b.example.com/callback"},
+		Body: map[string]string{"key": "$(key)", "fsize": "$(fsize)", "user": "$(x:user)"},
+	})
+	if err != nil {
+		t.Fatalf("PutPolicy#SetCallback() error, %s", err)
+	}
+	if putPolicy.CallbackURL != "http://a.example.com/callback;http://b.example.com/callback" {
+		t.Fatalf("PutPolicy#SetCallback() error, callbackUrl = %s", putPolicy.CallbackURL)
+	}
+	if putPolicy.CallbackBody != "fsize=$(fsize)&key=$(key)&user=$(x:user)" || putPolicy.CallbackBodyType != conf.CONTENT_TYPE_FORM {
+		t.Fatalf("PutPolicy#SetCallback() error, callbackBody = %s", putPolicy.CallbackBody)
+	}
+
+	err = putPolicy.SetCallback(&Callback{
+		URLs:     []string{"http://a.example.com/callback"},
+		BodyType: conf.CONTENT_TYPE_JSON,
+		Body:     map[string]string{"key": "$(key)", "hash": "$(etag)"},
+	})
+	if err != nil {
+		t.Fatalf("PutPolicy#SetCallback() error, %s", err)
+	}
+	if putPolicy.CallbackBody != `{"hash":"$(etag)","key":"$(key)"}` {
+		t.Fatalf("PutPolicy#SetCallback() error, callbackBody = %s", putPolicy.CallbackBody)
+	}
+
+	if err = putPolicy.SetCallback(&Callback{}); err == nil {
+		t.Fatalf("PutPolicy#SetCallback() should fail without callback url")
+	}
+}
+
+func TestParseCallback(t *testing.T) {
+	mac := qbox.NewMac("ak", "sk")
+	newRequest := func(contentType, body string, mac *qbox.Mac) *http.Request {
+		req := httptest.NewRequest("POST", "http://example.com/callback", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		// 七牛服务器的回调签名包括表单和 JSON 格式的 body
+		req.Header.Set("Authorization", "QBox "+mac.Sign([]byte("/callback\n"+body)))
+		return req
+	}
+
+	var values url.Values
+	req := newRequest(conf.CONTENT_TYPE_FORM, "key=a.txt&fsize=10", mac)
+	if err := ParseCallback(mac, req, &values); err != nil {
+		t.Fatalf("ParseCallback() error, %s", err)
+	}
+	if values.Get("key") != "a.txt" || values.Get("fsize") != "10" {
+		t.Fatalf("ParseCallback() error, unexpected values %v", values)
+	}
+
+	var ret struct {
+		Key   string `json:"key"`
+		Fsize int64  `json:"fsize"`
+	}
+	req = newRequest(conf.CONTENT_TYPE_JSON, `{"key":"a.txt","fsize":10}`, mac)
+	if err := ParseCallback(mac, req, &ret); err != nil {
+		t.Fatalf("ParseCallback() error, %s", err)
+	}
+	if ret.Key != "a.txt" || ret.Fsize != 10 {
+		t.Fatalf("ParseCallback() error, unexpected ret %+v", ret)
+	}
+
+	req = newRequest(conf.CONTENT_TYPE_FORM, "key=a.txt", qbox.NewMac("ak", "another"))
+	if err := ParseCallback(mac, req, &values); err != ErrInvalidCallback {
+		t.Fatalf("ParseCallback() error, expected ErrInvalidCallback, got %v", err)
+	}
+}
+
+func TestVerifyCallback(t *testing.T) {
+	mac := qbox.NewMac("ak", "sk")
+	body := `{"key":"a.txt","fsize":10}`
+	newRequest := func(auth string) *http.Request {
+		req := httptest.NewRequest("POST", "http://example.com/callback?user=1", strings.NewReader(body))
+		req.Header.Set("Content-Type", conf.CONTENT_TYPE_JSON)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		return req
+	}
+
+	req := newRequest("QBox " + mac.Sign([]byte("/callback?user=1\n"+body)))
+	if ok, err := VerifyCallback(req, "sk"); !ok || err != nil {
+		t.Fatalf("VerifyCallback() = %v, %v", ok, err)
+	}
+	if data, _ := ioutil.ReadAll(req.Body); string(data) != body {
+		t.Fatalf("VerifyCallback() should keep the body, got %s", data)
+	}
+
+	// 签名不包括 JSON 格式的 body 的时候 body 可能被篡改
+	req = newRequest("QBox " + mac.Sign([]byte("/callback?user=1\n")))
+	if ok, _ := VerifyCallback(req, "sk"); ok {
+		t.Fatal("VerifyCallback() should check the json body")
+	}
+
+	req = newRequest("")
+	token, _ := mac.SignRequestV2(req)
+	req = newRequest("Qiniu " + token)
+	if ok, err := VerifyCallback(req, "sk"); !ok || err != nil {
+		t.Fatalf("VerifyCallback() with Qiniu auth = %v, %v", ok, err)
+	}
+	for _, auth := range []string{"", "QBox", "QBox nocolon", "Bearer ak:sign"} {
+		if ok, err := VerifyCallback(newRequest(auth), "sk"); ok || err != nil {
+			t.Fatalf("VerifyCallback(%q) = %v, %v", auth, ok, err)
+		}
+	}
+	if ok, _ := VerifyCallback(newRequest("QBox "+mac.Sign([]byte("/callback?user=1\n"+body))), "another"); ok {
+		t.Fatal("VerifyCallback() should fail with another sk")
+	}
+}
@@ -3,7 +3,8 @@ package storage
 // Config 为文件上传，资源管理等配置
 type Config struct {
 	Zone          *Zone  //空间所在的机房
-	UseHTTPS      bool   //是否使用https域名
+	UseHTTPS      bool   //已废弃，默认使用https域名，需要使用http域名的时候设置 DisableHTTPS
+	DisableHTTPS  bool   //是否使用http域名，默认使用https域名
 	UseCdnDomains bool   //是否使用cdn加速域名
 	CentralRsHost string //中心机房的RsHost，用于list bucket
 	RsHost        string
@@ -11,15 +12,25 @@ type Config struct {
 	UpHost        string
 	ApiHost       string
 	IoHost        string
+	UcHost        string //空间设置相关接口的服务地址，不设定则为 UcHost 常量，可以包含协议
+}
+
+// useHTTPS 返回是否使用https访问没有指定协议的服务域名，只有设置了 DisableHTTPS 的时候才使用http
+func (c *Config) useHTTPS() bool {
+	return !c.DisableHTTPS
+}
+
+// UcReqHost 返回空间设置相关接口的服务地址
+func (c *Config) UcReqHost() string {
+	if c.UcHost == "" {
+		return UcHost
+	}
+	return withScheme(c.UcHost, c.useHTTPS())
 }
 
 func (c *Config) RsReqHost() string {
 	if c.RsHost == "" {
 		c.RsHost = DefaultRsHost
 	}
-	scheme := "http://"
-	if c.UseHTTPS {
-		scheme = "https://"
-	}
-	return scheme + c.RsHost
+	return withScheme(c.RsHost, c.useHTTPS())
 }
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+// CORSRule 为空间的跨域资源共享规则，浏览器直接上传或者下载空间中的文件的时候需要设置
+type CORSRule struct {
+	AllowedOrigin []string `json:"allowed_origin"`           // 允许的来源，比如 "https://www.example.com"，"*" 表示任意来源
+	AllowedMethod []string `json:"allowed_method"`           // 允许的请求方法，比如 "GET"，"POST"
+	AllowedHeader []string `json:"allowed_header,omitempty"` // 可选。允许的请求头部，"*" 表示任意头部
+	ExposedHeader []string `json:"exposed_header,omitempty"` // 可选。允许浏览器读取的响应头部
+	MaxAge        int64    `json:"max_age,omitempty"`        // 可选。预检请求结果的缓存时间，单位为秒
+}
+
+// Validate 检查跨域规则是否合法
+func (r *CORSRule) Validate() error {
+	if len(r.AllowedOrigin) == 0 || len(r.AllowedMethod) == 0 {
+		return errors.New("cors rule: allowed origin and allowed method are required")
+	}
+	if r.MaxAge < 0 {
+		return errors.New("cors rule: max age must not be negative")
+	}
+	return nil
+}
+
+// SetCORS 用来设置空间的跨域规则，会覆盖空间原有的全部规则，rules 为空表示清除跨域规则
+func (m *BucketManager) SetCORS(bucket string, rules []CORSRule) (err error) {
+	for i := range rules {
+		if err = rules[i].Validate(); err != nil {
+			return
+		}
+	}
+	if rules == nil {
+		rules = []CORSRule{}
+	}
+	ctx := m.withMac(context.TODO())
+	reqURL := m.Cfg.UcReqHost() + "/corsRules/set/" + bucket
+	err = m.Client.CallWithJson(ctx, nil, "POST", reqURL, nil, rules)
+	return
+}
+
+// GetCORS 用来获取空间的跨域规则
+func (m *BucketManager) GetCORS(bucket string) (rules []CORSRule, err error) {
+	ctx := m.withMac(context.TODO())
+	reqURL := m.Cfg.UcReqHost() + "/corsRules/get/" + bucket
+	err = m.Client.Call(ctx, &rules, "GET", reqURL, nil)
+	return
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestBucketCORS(t *testing.T) {
+	var stored []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/corsRules/set/bucket":
+			stored, _ = ioutil.ReadAll(req.Body)
+		case "/corsRules/get/bucket":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(stored)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	bucketManager := NewBucketManager(mac, &Config{UcHost: server.URL})
+	rules := []CORSRule{{
+		AllowedOrigin: []string{"https://www.example.com"},
+		AllowedMethod: []string{"GET", "POST"},
+		AllowedHeader: []string{"*"},
+		MaxAge:        600,
+	}}
+	if err := bucketManager.SetCORS("bucket", rules); err != nil {
+		t.Fatalf("BucketManager#SetCORS() error, %s", err)
+	}
+	got, err := bucketManager.GetCORS("bucket")
+	if err != nil {
+		t.Fatalf("BucketManager#GetCORS() error, %s", err)
+	}
+	if !reflect.DeepEqual(got, rules) {
+		t.Fatalf("BucketManager#GetCORS() error, unexpected rules %+v", got)
+	}
+
+	if err = bucketManager.SetCORS("bucket", nil); err != nil || string(stored) != "[]" {
+		t.Fatalf("BucketManager#SetCORS() error, %v, stored %s", err, stored)
+	}
+	if err = bucketManager.SetCORS("bucket", []CORSRule{{AllowedOrigin: []string{"*"}}}); err == nil {
+		t.Fatalf("BucketManager#SetCORS() should fail without allowed method")
+	}
+}
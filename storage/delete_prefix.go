@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+)
+
+// DeletePrefixOption 为 DeletePrefix 的可选参数
+type DeletePrefixOption struct {
+	// 可选。为 true 的时候只列举要删除的文件，不进行删除，可以配合 OnProgress 检查会被删除的文件
+	DryRun bool
+
+	// 可选。每次批量删除的文件数量，小于等于 0 或者大于 1000 的时候为 1000
+	BatchSize int
+
+	// 可选。每秒最多发送的批量删除请求数，小于等于 0 表示不限制
+	QPS int
+
+	// 可选。每处理完一批文件之后调用，keys 为这一批文件的 key，DryRun 的时候同样会调用
+	OnProgress func(ret DeletePrefixRet, keys []string)
+}
+
+// DeletePrefixRet 为 DeletePrefix 的执行结果
+type DeletePrefixRet struct {
+	Listed  int64 // 列举到的文件数
+	Deleted int64 // 删除成功的文件数，包括列举之后已经被删除的文件
+	Failed  int64 // 删除失败的文件数
+}
+
+// DeletePrefix 用来删除空间中全部以 prefix 开头的文件，列举文件之后按批删除，直到列举完成为止。
+// 单个文件删除失败不会中断删除，失败的数量见 DeletePrefixRet.Failed；列举或者批量请求出错的时候返回错误，
+// 这时候已经完成的部分见 ret，ctx 可以用来取消删除。
+func (m *BucketManager) DeletePrefix(ctx context.Context, bucket, prefix string,
+	opt *DeletePrefixOption) (ret DeletePrefixRet, err error) {
+	if opt == nil {
+		opt = &DeletePrefixOption{}
+	}
+	batchSize := opt.BatchSize
+	if batchSize <= 0 || batchSize > 1000 {
+		batchSize = 1000
+	}
+	var limiter *rateLimiter
+	if opt.QPS > 0 {
+		limiter = newRateLimiter(int64(opt.QPS))
+	}
+
+	keys := make([]string, 0, batchSize)
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		if !opt.DryRun {
+			if limiter != nil {
+				if wErr := limiter.wait(ctx, 1); wErr != nil {
+					return wErr
+				}
+			}
+			ops := make([]string, 0, len(keys))
+			for _, key := range keys {
+				ops = append(ops, URIDelete(bucket, key))
+			}
+			rets, bErr := m.BatchContext(ctx, ops)
+			if bErr != nil {
+				return bErr
+			}
+			for i := range rets {
+				// 612 表示文件已经不存在
+				if rets[i].Failed() && rets[i].Code != 612 {
+					ret.Failed++
+				} else {
+					ret.Deleted++
+				}
+			}
+		}
+		if opt.OnProgress != nil {
+			opt.OnProgress(ret, keys)
+		}
+		keys = keys[:0]
+		return nil
+	}
+
+	it := m.ListIterator(ctx, bucket, prefix, "", "", batchSize)
+	for it.Next() {
+		ret.Listed++
+		keys = append(keys, it.Item().Key)
+		if len(keys) == batchSize {
+			if err = flush(); err != nil {
+				return
+			}
+		}
+	}
+	if err = it.Err(); err != nil {
+		return
+	}
+	err = flush()
+	return
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDeletePrefix(t *testing.T) {
+	keys := map[string]bool{"p/1": true, "p/2": true, "p/3": true, "p/4": true, "p/5": true, "q/1": true}
+	batches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/list":
+			prefix := req.URL.Query().Get("prefix")
+			ret := listFilesRet{}
+			for _, key := range []string{"p/1", "p/2", "p/3", "p/4", "p/5", "q/1"} {
+				if strings.HasPrefix(key, prefix) && keys[key] {
+					ret.Items = append(ret.Items, ListItem{Key: key})
+				}
+			}
+			json.NewEncoder(w).Encode(ret)
+		case "/batch":
+			batches++
+			req.ParseForm()
+			rets := []BatchOpRet{}
+			code := 200
+			for _, op := range req.Form["op"] {
+				entry, _ := base64.URLEncoding.DecodeString(strings.TrimPrefix(op, "/delete/"))
+				key := strings.TrimPrefix(string(entry), "bucket:")
+				switch key {
+				case "p/3":
+					rets = append(rets, BatchOpRet{Code: 612})
+					code = 298
+				case "p/4":
+					rets = append(rets, BatchOpRet{Code: 400})
+					code = 298
+				default:
+					delete(keys, key)
+					rets = append(rets, BatchOpRet{Code: 200})
+				}
+			}
+			w.WriteHeader(code)
+			json.NewEncoder(w).Encode(rets)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	host := server.URL
+	bucketManager := NewBucketManager(mac, &Config{RsfHost: host, CentralRsHost: host})
+
+	var progress []string
+	opt := DeletePrefixOption{
+		DryRun:    true,
+		BatchSize: 2,
+		OnProgress: func(ret DeletePrefixRet, keys []string) {
+			progress = append(progress, strings.Join(keys, "+"))
+		},
+	}
+	ret, err := bucketManager.DeletePrefix(context.Background(), "bucket", "p/", &opt)
+	if err != nil {
+		t.Fatalf("DeletePrefix() error, %s", err)
+	}
+	if ret.Listed != 5 || ret.Deleted != 0 || batches != 0 || strings.Join(progress, ",") != "p/1+p/2,p/3+p/4,p/5" {
+		t.Fatalf("DeletePrefix() dry run error, ret %+v, progress %v", ret, progress)
+	}
+
+	opt.DryRun = false
+	opt.QPS = 100
+	ret, err = bucketManager.DeletePrefix(context.Background(), "bucket", "p/", &opt)
+	if err != nil {
+		t.Fatalf("DeletePrefix() error, %s", err)
+	}
+	if ret.Listed != 5 || ret.Deleted != 4 || ret.Failed != 1 || batches != 3 {
+		t.Fatalf("DeletePrefix() error, ret %+v after %d batches", ret, batches)
+	}
+	if len(keys) != 3 || !keys["q/1"] || !keys["p/4"] {
+		t.Fatalf("DeletePrefix() error, remaining keys %v", keys)
+	}
+}
@@ -0,0 +1,487 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qiniu/api.v7/auth/qbox"
+)
+
+// 下载过程中可能遇到的错误
+var (
+	ErrInvalidContentRange = errors.New("invalid content range in the download response")
+	ErrVerifyEtagWriter    = errors.New("VerifyEtag and VerifyStat require the writer to implement io.ReaderAt")
+	ErrVerifyStatOptions   = errors.New("VerifyStat requires BucketManager, Bucket and Key")
+)
+
+// EtagMismatchError 表示下载的数据的 etag 和空间中文件的 hash 不一致，数据可能在传输过程中损坏
+type EtagMismatchError struct {
+	Key      string
+	Expected string // 空间中文件的 hash
+	Actual   string // 下载的数据的 etag
+}
+
+func (e *EtagMismatchError) Error() string {
+	return fmt.Sprintf("%s: key %s, expected etag %s, got %s", ErrUnmatchedChecksum.Error(), e.Key, e.Expected, e.Actual)
+}
+
+// Is 使 errors.Is(err, ErrUnmatchedChecksum) 成立
+func (e *EtagMismatchError) Is(target error) bool {
+	return target == ErrUnmatchedChecksum
+}
+
+// 分块下载的默认设置
+const (
+	defaultGetChunkSize = 4 * 1024 * 1024
+	defaultGetWorkers   = 4
+	defaultGetTryTimes  = 3
+)
+
+// Downloader 用来下载空间中的文件，支持分块并行下载、失败重试以及断点续传
+type Downloader struct {
+	Client *Client
+
+	// 可选。下载私有空间的文件的时候用来签名下载链接
+	Mac *qbox.Mac
+
+	// 可选。GetPrivate 签名的下载链接的有效时间，不设定则为 1 小时。
+	// 下载时间超过有效时间的时候会重新签名，并从已经下载的位置继续下载
+	TTL time.Duration
+
+	// 可选。失败之后的重试策略，不设定则使用 DefaultRetryPolicy
+	RetryPolicy RetryPolicy
+
+	// 可选。为每个请求创建 span 的对象，不设定则不创建
+	Tracer Tracer
+}
+
+// NewDownloader 用来构建一个下载对象，只下载公开空间的文件或者已经签名的链接的时候 mac 可以为 nil
+func NewDownloader(mac *qbox.Mac) *Downloader {
+	return &Downloader{
+		Client: &DefaultClient,
+		Mac:    mac,
+	}
+}
+
+// NewDownloaderEx 用来构建一个下载对象，client 为 nil 的时候使用 DefaultClient
+func NewDownloaderEx(mac *qbox.Mac, client *Client) *Downloader {
+	if client == nil {
+		client = &DefaultClient
+	}
+	return &Downloader{
+		Client: client,
+		Mac:    mac,
+	}
+}
+
+// GetOptions 为下载的可选参数
+type GetOptions struct {
+	ChunkSize int64 // 可选。每个分块的大小，不设定则为 4MB
+	Workers   int   // 可选。并行下载的分块数量，不设定则为 4
+	TryTimes  int   // 可选。每个分块的尝试次数，不设定则为 3
+
+	// 可选。已经下载完成的分块的序号，用来从上次中断的位置继续下载，需要和上次下载的 ChunkSize 一致
+	Completed []int
+
+	// 可选。每个分块下载完成之后的回调，chunkIdx 为分块的序号（注意多个分块是并行下载的）
+	NotifyChunk func(chunkIdx int, offset, size int64)
+
+	// 可选。下载完成之后读回写入的数据计算 etag，和下载响应中的 ETag 不一致的时候返回 ErrUnmatchedEtag，
+	// 需要 w 同时实现 io.ReaderAt，比如 *os.File。响应中没有 ETag 的时候不校验
+	VerifyEtag bool
+
+	// 可选。整体下载进度的回调，downloaded 为已经下载的总字节数，total 为文件大小，
+	// 保证单调递增，可以在多个分块并行下载的时候直接用于显示进度条
+	OnProgress func(downloaded, total int64)
+
+	// 可选。下载限速，单位为字节每秒，为 0 表示不限速。多个分块并行下载的时候共用同一个限速
+	RateLimit int64
+
+	// 可选。下载完成之后使用 BucketManager 查询 Bucket 中 Key 的 hash，和下载的数据的 etag 比较，
+	// 不一致的时候返回 *EtagMismatchError。GetFile 需要 w 同时实现 io.ReaderAt，
+	// GetPrivate 在下载的同时计算 etag，Key 不设定的时候使用下载的 key
+	VerifyStat    bool
+	BucketManager *BucketManager
+	Bucket        string
+	Key           string
+}
+
+// verifyStat 查询空间中文件的 hash，和下载的数据的 etag 比较
+func (opts *GetOptions) verifyStat(key, etag string) (err error) {
+	if opts.Key != "" {
+		key = opts.Key
+	}
+	info, err := opts.BucketManager.Stat(opts.Bucket, key)
+	if err != nil {
+		return
+	}
+	if info.Hash != etag {
+		err = &EtagMismatchError{Key: key, Expected: info.Hash, Actual: etag}
+	}
+	return
+}
+
+func (opts *GetOptions) checkVerifyStat(key string) error {
+	if opts.VerifyStat && (opts.BucketManager == nil || opts.Bucket == "" || opts.Key == "" && key == "") {
+		return ErrVerifyStatOptions
+	}
+	return nil
+}
+
+// GetRet 为下载的文件的信息
+type GetRet struct {
+	Fsize    int64
+	Etag     string
+	MimeType string
+}
+
+// getChunk 为一个要下载的分块
+type getChunk struct {
+	idx    int
+	offset int64
+	size   int64
+}
+
+// getState 为一次下载中所有分块共用的状态
+type getState struct {
+	url      string
+	ranged   bool
+	tryTimes int
+	limiter  *rateLimiter
+	progress *downloadProgress
+}
+
+// downloadProgress 汇总多个分块的下载进度，分块重试的时候不会重复计算已经下载过的数据
+type downloadProgress struct {
+	mu         sync.Mutex
+	notify     func(downloaded, total int64)
+	total      int64
+	downloaded int64
+	chunks     map[int]int64 // 每个分块已经下载的最大字节数
+}
+
+func newDownloadProgress(notify func(downloaded, total int64), total, downloaded int64) *downloadProgress {
+	if notify == nil {
+		return nil
+	}
+	return &downloadProgress{notify: notify, total: total, downloaded: downloaded, chunks: make(map[int]int64)}
+}
+
+// report 报告第 idx 个分块已经下载了 n 个字节
+func (p *downloadProgress) report(idx int, n int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n <= p.chunks[idx] {
+		return
+	}
+	p.downloaded += n - p.chunks[idx]
+	p.chunks[idx] = n
+	p.notify(p.downloaded, p.total)
+}
+
+// offsetWriter 将数据从 offset 开始顺序写入 io.WriterAt，设置了 progress 的时候同时报告分块的下载进度
+type offsetWriter struct {
+	w        io.WriterAt
+	offset   int64
+	idx      int
+	written  int64
+	progress *downloadProgress
+}
+
+func (w *offsetWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	w.written += int64(n)
+	w.progress.report(w.idx, w.written)
+	return
+}
+
+// GetFile 用来下载 url 指向的文件并写入 w，服务端支持 Range 请求的时候按照 ChunkSize 分块并行下载，
+// 每个分块失败之后单独重试，否则顺序下载整个文件
+func (d *Downloader) GetFile(ctx context.Context, w io.WriterAt, url string, opts *GetOptions) (ret GetRet, err error) {
+	return d.getFile(ctx, w, url, opts, nil)
+}
+
+func (d *Downloader) getFile(ctx context.Context, w io.WriterAt, url string, opts *GetOptions,
+	recorder *downloadRecorder) (ret GetRet, err error) {
+	ctx = withSpanName(withTrace(ctx, d.Tracer), downloadSpanName)
+	if opts == nil {
+		opts = &GetOptions{}
+	}
+	chunkSize, workers, tryTimes := opts.ChunkSize, opts.Workers, opts.TryTimes
+	if chunkSize <= 0 {
+		chunkSize = defaultGetChunkSize
+	}
+	if workers <= 0 {
+		workers = defaultGetWorkers
+	}
+	if tryTimes <= 0 {
+		tryTimes = defaultGetTryTimes
+	}
+	if opts.VerifyEtag || opts.VerifyStat {
+		if _, ok := w.(io.ReaderAt); !ok {
+			err = ErrVerifyEtagWriter
+			return
+		}
+	}
+	if err = opts.checkVerifyStat(""); err != nil {
+		return
+	}
+
+	ret, acceptRanges, err := d.head(ctx, url)
+	if err != nil {
+		return
+	}
+
+	completed := make(map[int]bool, len(opts.Completed))
+	for _, idx := range opts.Completed {
+		completed[idx] = true
+	}
+	if recorder != nil {
+		for _, idx := range recorder.load(ret, chunkSize) {
+			completed[idx] = true
+		}
+	}
+
+	var chunks []getChunk
+	if !acceptRanges || ret.Fsize <= chunkSize {
+		if !completed[0] || ret.Fsize > chunkSize {
+			chunks = append(chunks, getChunk{idx: 0, size: ret.Fsize})
+		}
+	} else {
+		for idx, offset := 0, int64(0); offset < ret.Fsize; idx, offset = idx+1, offset+chunkSize {
+			if completed[idx] {
+				continue
+			}
+			size := chunkSize
+			if offset+size > ret.Fsize {
+				size = ret.Fsize - offset
+			}
+			chunks = append(chunks, getChunk{idx: idx, offset: offset, size: size})
+		}
+	}
+	st := &getState{
+		url:      url,
+		ranged:   acceptRanges && ret.Fsize > chunkSize,
+		tryTimes: tryTimes,
+	}
+	if opts.RateLimit > 0 {
+		st.limiter = newRateLimiter(opts.RateLimit)
+	}
+	left := int64(0)
+	for _, c := range chunks {
+		left += c.size
+	}
+	st.progress = newDownloadProgress(opts.OnProgress, ret.Fsize, ret.Fsize-left)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var firstErr error
+	tasks := make(chan getChunk)
+	var wg sync.WaitGroup
+	for i := 0; i < workers && i < len(chunks); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range tasks {
+				cErr := d.getChunkWithRetry(ctx, w, st, c)
+				if cErr == nil && recorder != nil {
+					cErr = recorder.done(c.idx)
+				}
+				if cErr != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = cErr
+					}
+					mu.Unlock()
+					cancel()
+					continue
+				}
+				if opts.NotifyChunk != nil {
+					opts.NotifyChunk(c.idx, c.offset, c.size)
+				}
+			}
+		}()
+	}
+	for _, c := range chunks {
+		select {
+		case tasks <- c:
+		case <-ctx.Done():
+		}
+	}
+	close(tasks)
+	wg.Wait()
+
+	if firstErr != nil {
+		err = firstErr
+		return
+	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	if opts.VerifyEtag && ret.Etag != "" || opts.VerifyStat {
+		r := io.NewSectionReader(w.(io.ReaderAt), 0, ret.Fsize)
+		etag, eErr := Etag(r, ret.Fsize)
+		if eErr != nil {
+			err = eErr
+			return
+		}
+		if opts.VerifyEtag && ret.Etag != "" && etag != ret.Etag {
+			err = ErrUnmatchedEtag
+			return
+		}
+		if opts.VerifyStat {
+			err = opts.verifyStat("", etag)
+		}
+	}
+	return
+}
+
+// head 获取文件的大小，etag 以及服务端是否支持 Range 请求
+func (d *Downloader) head(ctx context.Context, url string) (ret GetRet, acceptRanges bool, err error) {
+	resp, err := d.Client.DoRequest(ctx, "HEAD", url, nil)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		err = ResponseError(resp)
+		return
+	}
+	if resp.ContentLength < 0 {
+		err = errors.New("unknown content length of " + url)
+		return
+	}
+	ret.Fsize = resp.ContentLength
+	ret.Etag = strings.Trim(resp.Header.Get("Etag"), "\"")
+	ret.MimeType = resp.Header.Get("Content-Type")
+	acceptRanges = resp.Header.Get("Accept-Ranges") == "bytes"
+	return
+}
+
+func (d *Downloader) getChunkWithRetry(ctx context.Context, w io.WriterAt, st *getState, c getChunk) (err error) {
+	policy := retryPolicyOrDefault(d.RetryPolicy)
+	for attempt := 1; ; attempt++ {
+		err = d.getChunk(ctx, w, st, c)
+		if err == nil || ctx.Err() != nil || attempt >= st.tryTimes {
+			return
+		}
+		retry, delay := policy.Retry(attempt, err)
+		if !retry || sleepContext(ctx, delay) != nil {
+			return
+		}
+	}
+}
+
+// getChunk 下载一个分块，st.ranged 为 false 的时候下载整个文件
+func (d *Downloader) getChunk(ctx context.Context, w io.WriterAt, st *getState, c getChunk) (err error) {
+	headers := http.Header{}
+	if st.ranged {
+		headers.Set("Range", fmt.Sprintf("bytes=%d-%d", c.offset, c.offset+c.size-1))
+	}
+	resp, err := d.Client.DoRequest(ctx, "GET", st.url, headers)
+	if err != nil {
+		return
+	}
+	defer closeResponse(resp)
+
+	if resp.StatusCode/100 != 2 {
+		return ResponseError(resp)
+	}
+	if st.ranged {
+		if resp.StatusCode != http.StatusPartialContent {
+			return ErrInvalidContentRange
+		}
+		expected := fmt.Sprintf("bytes %d-%d/", c.offset, c.offset+c.size-1)
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), expected) {
+			return ErrInvalidContentRange
+		}
+	}
+
+	cw := &offsetWriter{w: w, offset: c.offset, idx: c.idx, progress: st.progress}
+	n, err := io.Copy(cw, limitReader(ctx, io.LimitReader(resp.Body, c.size), st.limiter))
+	if err == nil && n != c.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+// GetToFile 用来下载 url 指向的文件到本地的 localFile，下载过程中在 localFile 所在的目录下记录下载进度，
+// 下载中断之后再次调用会跳过已经下载完成的分块，远程文件的大小或者 etag 发生变化的时候重新下载
+func (d *Downloader) GetToFile(ctx context.Context, localFile, url string, opts *GetOptions) (ret GetRet, err error) {
+	f, err := os.OpenFile(localFile, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	recorder := &downloadRecorder{path: localFile + ".progress"}
+	ret, err = d.getFile(ctx, f, url, opts, recorder)
+	if err != nil {
+		return
+	}
+	if err = f.Truncate(ret.Fsize); err != nil {
+		return
+	}
+	os.Remove(recorder.path)
+	return
+}
+
+// downloadRecord 为持久化的下载进度
+type downloadRecord struct {
+	Fsize     int64  `json:"fsize"`
+	Etag      string `json:"etag"`
+	ChunkSize int64  `json:"chunkSize"`
+	Chunks    []int  `json:"chunks"`
+}
+
+// downloadRecorder 将下载进度保存到文件中，多个分块并行下载的时候可以同时调用 done
+type downloadRecorder struct {
+	mu     sync.Mutex
+	path   string
+	record downloadRecord
+}
+
+// load 读取已经下载完成的分块，文件的大小、etag 或者分块大小和记录不一致的时候丢弃记录
+func (r *downloadRecorder) load(ret GetRet, chunkSize int64) (chunks []int) {
+	r.record = downloadRecord{Fsize: ret.Fsize, Etag: ret.Etag, ChunkSize: chunkSize}
+	data, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return
+	}
+	var record downloadRecord
+	if json.Unmarshal(data, &record) != nil || record.Fsize != ret.Fsize || record.Etag != ret.Etag ||
+		record.ChunkSize != chunkSize {
+		return
+	}
+	r.record.Chunks = record.Chunks
+	return record.Chunks
+}
+
+// done 记录第 idx 个分块已经下载完成
+func (r *downloadRecorder) done(idx int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.record.Chunks = append(r.record.Chunks, idx)
+	data, err := json.Marshal(&r.record)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.path, data, 0644)
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrInvalidGetJob 表示 GetJob 没有指定下载链接或者本地文件
+var ErrInvalidGetJob = errors.New("get job requires LocalFile and either URL or Domain and Key")
+
+// 批量下载的默认设置
+const (
+	defaultGetFilesWorkers  = 4
+	defaultGetFilesTryTimes = 3
+)
+
+// GetJob 为批量下载中的一个文件
+type GetJob struct {
+	// 下载链接，为空的时候使用 Domain 和 Key 生成，设置了 Downloader.Mac 的时候生成私有链接，每次尝试重新签名
+	URL    string
+	Domain string
+	Key    string
+
+	// 下载到的本地文件，下载进度记录在 LocalFile + ".progress" 中，重试的时候跳过已经下载完成的分块
+	LocalFile string
+
+	// 可选。整个文件的尝试次数，不设定则为 3。context 被取消或者 hash 校验失败的时候不再重试
+	TryTimes int
+
+	// 可选。单个文件的下载参数，参考 GetOptions，VerifyStat 的 Key 不设定的时候使用 GetJob.Key
+	Options *GetOptions
+}
+
+func (job *GetJob) url(d *Downloader) string {
+	if job.URL != "" {
+		return job.URL
+	}
+	if d.Mac != nil {
+		signer := &privateURLSigner{d: d, domain: job.Domain, key: job.Key}
+		return signer.get(true)
+	}
+	return MakePublicURL(job.Domain, job.Key)
+}
+
+func (job *GetJob) options() *GetOptions {
+	if job.Options == nil {
+		return nil
+	}
+	opts := *job.Options
+	if opts.Key == "" {
+		opts.Key = job.Key
+	}
+	return &opts
+}
+
+// GetResult 为批量下载中一个文件的结果
+type GetResult struct {
+	Job   GetJob
+	Ret   GetRet
+	Tries int   // 实际尝试的次数
+	Err   error // 最后一次尝试的错误，为 nil 表示下载成功
+}
+
+// GetFiles 用来将多个文件下载到本地，workers 为同时下载的文件数量，不设定则为 4。
+// 每个文件使用 GetToFile 下载，失败的时候按照 GetJob.TryTimes 重试整个文件。
+// 返回的结果和 jobs 一一对应，单个文件失败不影响其他文件，context 被取消之后尚未开始的文件直接返回 ctx.Err()
+func (d *Downloader) GetFiles(ctx context.Context, jobs []GetJob, workers int) (results []GetResult) {
+	if workers <= 0 {
+		workers = defaultGetFilesWorkers
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	results = make([]GetResult, len(jobs))
+	jobCh := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobCh {
+				results[idx] = d.getJob(ctx, jobs[idx])
+			}
+		}()
+	}
+	for idx := range jobs {
+		jobCh <- idx
+	}
+	close(jobCh)
+	wg.Wait()
+	return
+}
+
+func (d *Downloader) getJob(ctx context.Context, job GetJob) (ret GetResult) {
+	ret.Job = job
+	if job.LocalFile == "" || job.URL == "" && (job.Domain == "" || job.Key == "") {
+		ret.Err = ErrInvalidGetJob
+		return
+	}
+	tryTimes := job.TryTimes
+	if tryTimes <= 0 {
+		tryTimes = defaultGetFilesTryTimes
+	}
+	opts := job.options()
+	for ret.Tries < tryTimes {
+		if ret.Err = ctx.Err(); ret.Err != nil {
+			return
+		}
+		ret.Tries++
+		ret.Ret, ret.Err = d.GetToFile(ctx, job.LocalFile, job.url(d), opts)
+		if ret.Err == nil || !shouldRetryGetJob(ret.Err) {
+			return
+		}
+	}
+	return
+}
+
+// shouldRetryGetJob 参数错误、文件不存在和 hash 校验失败的时候重试没有意义，
+// 401 和 403 可能是链接过期，重试的时候会重新签名
+func shouldRetryGetJob(err error) bool {
+	switch e := err.(type) {
+	case *EtagMismatchError:
+		return false
+	case *ErrorInfo:
+		return e.Code/100 != 4 || e.Code == 401 || e.Code == 403
+	}
+	switch err {
+	case ErrUnmatchedEtag, ErrVerifyEtagWriter, ErrVerifyStatOptions, context.Canceled, context.DeadlineExceeded:
+		return false
+	}
+	return true
+}
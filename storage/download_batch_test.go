@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestDownloaderGetFiles(t *testing.T) {
+	server := newFakeDownloadServer(10*1024 + 100)
+	defer server.Close()
+	var mu sync.Mutex
+	heads := 0
+	server.fail = func(rangeHeader string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		if rangeHeader == "" {
+			if heads++; heads == 1 {
+				return http.StatusBadGateway
+			}
+		}
+		return 0
+	}
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+
+	dir, err := ioutil.TempDir("", "getfiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := &GetOptions{ChunkSize: 1024}
+	jobs := []GetJob{
+		{URL: server.URL + "/a", LocalFile: filepath.Join(dir, "a"), Options: opts},
+		{Domain: server.URL, Key: "b", LocalFile: filepath.Join(dir, "b"), Options: opts},
+		{URL: missing.URL + "/c", LocalFile: filepath.Join(dir, "c")},
+		{Domain: server.URL, LocalFile: filepath.Join(dir, "d")},
+	}
+	d := NewDownloader(nil)
+	results := d.GetFiles(context.Background(), jobs, 2)
+	if len(results) != len(jobs) {
+		t.Fatalf("Downloader#GetFiles() returned %d results", len(results))
+	}
+	for i, ret := range results[:2] {
+		if ret.Err != nil || ret.Ret.Etag != server.etag {
+			t.Fatalf("Downloader#GetFiles() job %d error, %v", i, ret.Err)
+		}
+		data, _ := ioutil.ReadFile(jobs[i].LocalFile)
+		if !bytes.Equal(data, server.data) {
+			t.Fatalf("Downloader#GetFiles() job %d wrong data", i)
+		}
+	}
+	if results[0].Tries+results[1].Tries != 3 {
+		t.Fatalf("Downloader#GetFiles() should retry once, tries: %d, %d", results[0].Tries, results[1].Tries)
+	}
+	if e, ok := results[2].Err.(*ErrorInfo); !ok || e.Code != 404 || results[2].Tries != 1 {
+		t.Fatalf("Downloader#GetFiles() should not retry missing files, %v, %d", results[2].Err, results[2].Tries)
+	}
+	if results[3].Err != ErrInvalidGetJob {
+		t.Fatalf("Downloader#GetFiles() should reject invalid jobs, %v", results[3].Err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results = d.GetFiles(ctx, jobs[:1], 0)
+	if results[0].Err != context.Canceled || results[0].Tries != 0 {
+		t.Fatalf("Downloader#GetFiles() should stop when canceled, %v", results[0].Err)
+	}
+}
@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// ErrObjectReaderClosed 表示 ObjectReader 已经被关闭
+var ErrObjectReaderClosed = errors.New("object reader is closed")
+
+// 默认的读取缓冲区大小
+const defaultObjectReaderBufferSize = 1024 * 1024
+
+// ObjectReader 用来像本地文件一样读取空间中的文件，实现了 io.Reader，io.Seeker，io.ReaderAt 和 io.Closer，
+// 可以直接交给 archive/zip，archive/tar 或者音视频解析库使用，不需要先下载到本地。
+// 第一次读取的时候才发起下载请求，Seek 之后从新的位置使用 Range 请求继续读取，ReadAt 每次发起一个独立的 Range 请求。
+// Read 和 Seek 不能被多个 Goroutine 同时调用，ReadAt 可以。
+type ObjectReader struct {
+	ctx    context.Context
+	d      *Downloader
+	url    func() string
+	size   int64
+	etag   string
+	bufLen int
+
+	mu     sync.Mutex
+	pos    int64
+	body   io.ReadCloser
+	buf    *bufio.Reader
+	bufPos int64 // buf 中下一个字节在文件中的位置
+	closed bool
+}
+
+// Open 用来打开空间中的文件，domain 为空间绑定的域名，设置了 Downloader.Mac 的时候下载链接会被签名，
+// 并在过期之前重新签名。打开的时候会查询文件的大小，文件不存在的时候返回错误
+func (d *Downloader) Open(ctx context.Context, domain, key string) (r *ObjectReader, err error) {
+	ctx = withSpanName(withTrace(ctx, d.Tracer, AttrKey, key), downloadSpanName)
+	urlFunc := func() string {
+		return MakePublicURL(domain, key)
+	}
+	if d.Mac != nil {
+		signer := &privateURLSigner{d: d, domain: domain, key: key}
+		var mu sync.Mutex
+		urlFunc = func() string {
+			mu.Lock()
+			defer mu.Unlock()
+			return signer.get(false)
+		}
+	}
+
+	info, _, err := d.head(ctx, urlFunc())
+	if err != nil {
+		return
+	}
+	r = &ObjectReader{
+		ctx:    ctx,
+		d:      d,
+		url:    urlFunc,
+		size:   info.Fsize,
+		etag:   info.Etag,
+		bufLen: defaultObjectReaderBufferSize,
+	}
+	return
+}
+
+// Size 返回文件的大小
+func (r *ObjectReader) Size() int64 {
+	return r.size
+}
+
+// Etag 返回文件的 etag
+func (r *ObjectReader) Etag() string {
+	return r.etag
+}
+
+// Read 从当前位置读取数据
+func (r *ObjectReader) Read(p []byte) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return 0, ErrObjectReaderClosed
+	}
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return
+	}
+	for retried := false; ; retried = true {
+		if r.buf == nil || r.bufPos != r.pos {
+			if err = r.open(); err != nil {
+				return
+			}
+		}
+		n, err = r.buf.Read(p)
+		r.pos += int64(n)
+		r.bufPos = r.pos
+		if err == nil {
+			return
+		}
+
+		r.reset()
+		if err == io.EOF && r.pos >= r.size {
+			if n > 0 {
+				err = nil
+			}
+			return
+		}
+		if n > 0 {
+			// 已经读取到数据的时候先返回，下一次读取从当前位置重新请求
+			err = nil
+			return
+		}
+		if retried || r.ctx.Err() != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return
+		}
+		// 连接中断的时候从当前位置重新请求一次
+	}
+}
+
+// open 从当前位置发起 Range 请求
+func (r *ObjectReader) open() (err error) {
+	r.reset()
+	headers := http.Header{}
+	headers.Set("Range", fmt.Sprintf("bytes=%d-", r.pos))
+	resp, err := r.d.Client.DoRequest(r.ctx, "GET", r.url(), headers)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		defer closeResponse(resp)
+		if resp.StatusCode/100 != 2 {
+			return ResponseError(resp)
+		}
+		return ErrInvalidContentRange
+	}
+	r.body = resp.Body
+	r.buf = bufio.NewReaderSize(resp.Body, r.bufLen)
+	r.bufPos = r.pos
+	return
+}
+
+// reset 关闭当前的连接
+func (r *ObjectReader) reset() {
+	if r.body != nil {
+		r.body.Close()
+	}
+	r.body, r.buf = nil, nil
+}
+
+// Seek 设置下一次 Read 的位置，只记录位置，不会立即发起请求。
+// 向后移动的距离不超过缓冲区中已经读取的数据的时候直接丢弃缓冲区中的数据，不重新请求
+func (r *ObjectReader) Seek(offset int64, whence int) (pos int64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return 0, ErrObjectReaderClosed
+	}
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = r.pos + offset
+	case io.SeekEnd:
+		pos = r.size + offset
+	default:
+		return 0, errors.New("object reader: invalid whence")
+	}
+	if pos < 0 {
+		return 0, errors.New("object reader: negative position")
+	}
+	if r.buf != nil && pos > r.bufPos && pos-r.bufPos <= int64(r.buf.Buffered()) {
+		r.buf.Discard(int(pos - r.bufPos))
+		r.bufPos = pos
+	}
+	r.pos = pos
+	return
+}
+
+// ReadAt 读取从 off 开始的 len(p) 个字节，不影响 Read 的位置
+func (r *ObjectReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("object reader: negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	size := int64(len(p))
+	if off+size > r.size {
+		size = r.size - off
+	}
+	if size == 0 {
+		return
+	}
+
+	w := &bytesWriterAt{p: p[:size], base: off}
+	st := &getState{url: r.url(), ranged: true, tryTimes: defaultGetTryTimes}
+	err = r.d.getChunkWithRetry(r.ctx, w, st, getChunk{offset: off, size: size})
+	if err != nil {
+		return
+	}
+	n = int(size)
+	if size < int64(len(p)) {
+		err = io.EOF
+	}
+	return
+}
+
+// Close 关闭连接，之后不能再读取
+func (r *ObjectReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reset()
+	r.closed = true
+	return nil
+}
+
+// bytesWriterAt 将从 base 开始的数据写入 p
+type bytesWriterAt struct {
+	p    []byte
+	base int64
+}
+
+func (w *bytesWriterAt) WriteAt(p []byte, off int64) (n int, err error) {
+	start := off - w.base
+	if start < 0 || start+int64(len(p)) > int64(len(w.p)) {
+		return 0, errors.New("write out of range")
+	}
+	return copy(w.p[start:], p), nil
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloaderOpen(t *testing.T) {
+	var zipData bytes.Buffer
+	zw := zip.NewWriter(&zipData)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		fw, _ := zw.Create(name)
+		fw.Write(bytes.Repeat([]byte(name), 1000))
+	}
+	zw.Close()
+	data := zipData.Bytes()
+
+	var mu sync.Mutex
+	gets := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := NewDownloadTokenVerifier(mac, server.URL).Verify(req); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if req.Method == "GET" {
+			mu.Lock()
+			gets++
+			mu.Unlock()
+		}
+		http.ServeContent(w, req, "file.zip", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	if _, err := NewDownloader(nil).Open(context.Background(), server.URL, "file.zip"); err == nil {
+		t.Fatalf("Downloader#Open() should fail without signing the url")
+	}
+
+	r, err := NewDownloader(mac).Open(context.Background(), server.URL, "file.zip")
+	if err != nil {
+		t.Fatalf("Downloader#Open() error, %s", err)
+	}
+	defer r.Close()
+	if r.Size() != int64(len(data)) || gets != 0 {
+		t.Fatalf("Downloader#Open() error, size %d, %d gets", r.Size(), gets)
+	}
+
+	zr, err := zip.NewReader(r, r.Size())
+	if err != nil {
+		t.Fatalf("zip.NewReader() error, %s", err)
+	}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("zip.File#Open() error, %s", err)
+		}
+		content, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(content, bytes.Repeat([]byte(f.Name), 1000)) {
+			t.Fatalf("ObjectReader#ReadAt() error, %v", err)
+		}
+	}
+
+	gets = 0
+	buf := make([]byte, 7)
+	var got []byte
+	for {
+		n, err := r.Read(buf)
+		got = append(got, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ObjectReader#Read() error, %s", err)
+		}
+	}
+	if !bytes.Equal(got, data) || gets != 1 {
+		t.Fatalf("ObjectReader#Read() error, %d bytes, %d gets", len(got), gets)
+	}
+
+	if pos, err := r.Seek(-10, io.SeekEnd); err != nil || pos != int64(len(data)-10) {
+		t.Fatalf("ObjectReader#Seek() error, %v, pos %d", err, pos)
+	}
+	tail, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(tail, data[len(data)-10:]) || gets != 2 {
+		t.Fatalf("ObjectReader#Read() after Seek() error, %v, %d gets", err, gets)
+	}
+	r.Close()
+	if _, err = r.Read(buf); err != ErrObjectReaderClosed {
+		t.Fatalf("ObjectReader#Read() should fail after Close(), %v", err)
+	}
+}
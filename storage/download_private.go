@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoDownloaderMac 表示下载私有空间的文件的时候没有设置 Downloader.Mac
+var ErrNoDownloaderMac = errors.New("downloader: Mac is required to download private files")
+
+// 私有空间下载链接的默认有效时间
+const defaultPrivateURLTTL = time.Hour
+
+// 关闭响应之前最多读取并丢弃的剩余内容的字节数，剩余内容更多的时候直接关闭连接
+const maxDrainSize = 64 * 1024
+
+// privateURLSigner 为私有空间的文件生成下载链接，链接快要过期的时候重新签名
+type privateURLSigner struct {
+	d        *Downloader
+	domain   string
+	key      string
+	url      string
+	deadline time.Time
+}
+
+func (s *privateURLSigner) ttl() time.Duration {
+	if s.d.TTL > 0 {
+		return s.d.TTL
+	}
+	return defaultPrivateURLTTL
+}
+
+// get 返回当前可用的下载链接，force 为 true 或者链接在 1/10 的有效时间之内会过期的时候重新签名
+func (s *privateURLSigner) get(force bool) string {
+	ttl := s.ttl()
+	if force || s.url == "" || time.Now().Add(ttl/10).After(s.deadline) {
+		s.deadline = time.Now().Add(ttl)
+		s.url = MakePrivateURL(s.d.Mac, s.domain, s.key, s.deadline.Unix())
+	}
+	return s.url
+}
+
+// GetPrivate 用来下载私有空间中的文件并顺序写入 w，domain 为空间绑定的域名，比如 "https://cdn.example.com"。
+// 下载链接使用 Downloader.Mac 签名，服务端返回 30x 的时候跟随跳转（比如跳转到 CDN 节点）。
+// 下载中断或者链接过期的时候重新签名，并使用 Range 请求从已经写入的位置继续下载。
+func (d *Downloader) GetPrivate(ctx context.Context, domain, key string, w io.Writer) (ret GetRet, err error) {
+	return d.GetPrivateWithOptions(ctx, domain, key, w, nil)
+}
+
+// GetPrivateWithOptions 和 GetPrivate 相同，opts 中的 TryTimes，OnProgress，RateLimit 和 VerifyStat 生效，
+// TryTimes 为没有下载到新数据的情况下连续尝试的次数
+func (d *Downloader) GetPrivateWithOptions(ctx context.Context, domain, key string, w io.Writer,
+	opts *GetOptions) (ret GetRet, err error) {
+	ctx = withSpanName(withTrace(ctx, d.Tracer, AttrKey, key), downloadSpanName)
+	if opts == nil {
+		opts = &GetOptions{}
+	}
+	tryTimes := opts.TryTimes
+	if tryTimes <= 0 {
+		tryTimes = defaultGetTryTimes
+	}
+	st := &streamState{onProgress: opts.OnProgress}
+	if opts.RateLimit > 0 {
+		st.limiter = newRateLimiter(opts.RateLimit)
+	}
+	if d.Mac == nil {
+		err = ErrNoDownloaderMac
+		return
+	}
+	if err = opts.checkVerifyStat(key); err != nil {
+		return
+	}
+	var hasher *etagHasher
+	if opts.VerifyStat {
+		hasher = newEtagHasher()
+		w = io.MultiWriter(w, hasher)
+	}
+
+	signer := &privateURLSigner{d: d, domain: domain, key: key}
+	ret.Fsize = -1
+	var written int64
+	tries := 0
+	resign := false
+	policy := retryPolicyOrDefault(d.RetryPolicy)
+	for ret.Fsize < 0 || written < ret.Fsize {
+		var n int64
+		n, err = d.getStream(ctx, signer.get(resign), w, written, &ret, st)
+		written += n
+		if err == nil {
+			if ret.Fsize < 0 {
+				// 服务端没有返回文件大小，读取到 EOF 即为下载完成
+				ret.Fsize = written
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			return
+		}
+		if n > 0 {
+			tries = 0
+		}
+		tries++
+		if tries >= tryTimes {
+			return
+		}
+		// 链接过期的时候服务端返回 401 或者 403，重新签名之后再试，其它的错误按照 RetryPolicy 重试
+		resign = false
+		if ei, ok := err.(*ErrorInfo); ok && (ei.Code == http.StatusUnauthorized || ei.Code == http.StatusForbidden) {
+			resign = true
+			continue
+		}
+		retry, delay := policy.Retry(tries, err)
+		if !retry {
+			return
+		}
+		if sErr := sleepContext(ctx, delay); sErr != nil {
+			err = sErr
+			return
+		}
+	}
+	err = nil
+	if hasher != nil {
+		err = opts.verifyStat(key, hasher.Etag())
+	}
+	return
+}
+
+// streamState 为顺序下载中多次请求共用的状态
+type streamState struct {
+	limiter    *rateLimiter
+	onProgress func(downloaded, total int64)
+}
+
+// progressWriter 在写入数据之后报告整体的下载进度
+type progressWriter struct {
+	w          io.Writer
+	downloaded int64
+	total      int64
+	onProgress func(downloaded, total int64)
+}
+
+func (w *progressWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	if n > 0 {
+		w.downloaded += int64(n)
+		w.onProgress(w.downloaded, w.total)
+	}
+	return
+}
+
+// getStream 从 offset 开始下载文件并写入 w，返回写入的字节数，第一次下载的时候填充 ret
+func (d *Downloader) getStream(ctx context.Context, url string, w io.Writer, offset int64, ret *GetRet,
+	st *streamState) (n int64, err error) {
+	headers := http.Header{}
+	if offset > 0 {
+		headers.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := d.Client.DoRequest(ctx, "GET", url, headers)
+	if err != nil {
+		return
+	}
+	// 读取 body 之前返回的时候丢弃少量剩余内容以便复用连接，读取 body 的过程中出错的时候直接关闭
+	drain := true
+	defer func() {
+		if drain {
+			io.CopyN(ioutil.Discard, resp.Body, maxDrainSize)
+		}
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode/100 != 2 {
+		err = ResponseError(resp)
+		return
+	}
+	if offset > 0 {
+		if resp.StatusCode != http.StatusPartialContent ||
+			!strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			err = ErrInvalidContentRange
+			return
+		}
+	} else {
+		ret.Fsize = resp.ContentLength
+		ret.Etag = strings.Trim(resp.Header.Get("Etag"), "\"")
+		ret.MimeType = resp.Header.Get("Content-Type")
+	}
+	if ret.Fsize < 0 {
+		// Range 请求返回 Content-Range: bytes <start>-<end>/<total>
+		cr := resp.Header.Get("Content-Range")
+		if idx := strings.LastIndex(cr, "/"); idx >= 0 {
+			if total, pErr := strconv.ParseInt(cr[idx+1:], 10, 64); pErr == nil {
+				ret.Fsize = total
+			}
+		}
+	}
+
+	if st.onProgress != nil {
+		w = &progressWriter{w: w, downloaded: offset, total: ret.Fsize, onProgress: st.onProgress}
+	}
+	drain = false
+	n, err = io.Copy(w, limitReader(ctx, resp.Body, st.limiter))
+	if err == nil && ret.Fsize >= 0 && offset+n < ret.Fsize {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
@@ -0,0 +1,347 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDownloadServer 提供一个支持 Range 请求的下载服务，fail 返回非 0 的时候对应的请求返回这个状态码
+type fakeDownloadServer struct {
+	*httptest.Server
+	data []byte
+	etag string
+
+	mu     sync.Mutex
+	ranges []string
+	fail   func(rangeHeader string) int
+}
+
+func newFakeDownloadServer(size int) *fakeDownloadServer {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+	etag, _ := Etag(bytes.NewReader(data), int64(size))
+
+	s := &fakeDownloadServer{data: data, etag: etag}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rangeHeader := req.Header.Get("Range")
+		s.mu.Lock()
+		fail := s.fail
+		if req.Method == "GET" {
+			s.ranges = append(s.ranges, rangeHeader)
+		}
+		s.mu.Unlock()
+		if fail != nil {
+			if code := fail(rangeHeader); code != 0 {
+				http.Error(w, "fail", code)
+				return
+			}
+		}
+		w.Header().Set("Etag", `"`+s.etag+`"`)
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(s.data))
+	}))
+	return s
+}
+
+func (s *fakeDownloadServer) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.ranges)
+}
+
+func TestDownloaderGetFile(t *testing.T) {
+	server := newFakeDownloadServer(10*1024 + 100)
+	defer server.Close()
+
+	retried := false
+	server.fail = func(rangeHeader string) int {
+		if rangeHeader == "bytes=2048-3071" && !retried {
+			retried = true
+			return http.StatusInternalServerError
+		}
+		return 0
+	}
+
+	f, err := ioutil.TempFile("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	var mu sync.Mutex
+	notified := 0
+	d := NewDownloader(nil)
+	opts := GetOptions{
+		ChunkSize:  1024,
+		Workers:    3,
+		VerifyEtag: true,
+		NotifyChunk: func(chunkIdx int, offset, size int64) {
+			mu.Lock()
+			notified++
+			mu.Unlock()
+		},
+	}
+	ret, err := d.GetFile(context.Background(), f, server.URL, &opts)
+	if err != nil {
+		t.Fatalf("Downloader#GetFile() error, %s", err)
+	}
+	if ret.Fsize != int64(len(server.data)) || ret.Etag != server.etag || notified != 11 || server.requests() != 12 {
+		t.Fatalf("Downloader#GetFile() error, ret %+v, %d chunks, %d requests", ret, notified, server.requests())
+	}
+	got, _ := ioutil.ReadFile(f.Name())
+	if !bytes.Equal(got, server.data) {
+		t.Fatalf("Downloader#GetFile() error, unexpected data")
+	}
+
+	server.etag = "unmatched"
+	if _, err = d.GetFile(context.Background(), f, server.URL, &opts); err != ErrUnmatchedEtag {
+		t.Fatalf("Downloader#GetFile() should fail with ErrUnmatchedEtag, %v", err)
+	}
+	if _, err = d.GetFile(context.Background(), struct{ io.WriterAt }{f}, server.URL, &opts); err != ErrVerifyEtagWriter {
+		t.Fatalf("Downloader#GetFile() should fail with ErrVerifyEtagWriter, %v", err)
+	}
+}
+
+func TestDownloaderGetFileWithoutRange(t *testing.T) {
+	data := []byte(strings.Repeat("qiniu", 1000))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", "5000")
+		if req.Method == "GET" {
+			w.Write(data)
+		}
+	}))
+	defer server.Close()
+
+	f, err := ioutil.TempFile("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	d := NewDownloader(nil)
+	if _, err = d.GetFile(context.Background(), f, server.URL, &GetOptions{ChunkSize: 1024}); err != nil {
+		t.Fatalf("Downloader#GetFile() error, %s", err)
+	}
+	got, _ := ioutil.ReadFile(f.Name())
+	if !bytes.Equal(got, data) {
+		t.Fatalf("Downloader#GetFile() error, unexpected data")
+	}
+}
+
+func TestDownloaderGetToFileResume(t *testing.T) {
+	server := newFakeDownloadServer(8 * 1024)
+	defer server.Close()
+	server.fail = func(rangeHeader string) int {
+		if rangeHeader == "bytes=5120-6143" {
+			return http.StatusForbidden
+		}
+		return 0
+	}
+
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localFile := filepath.Join(dir, "file")
+
+	d := NewDownloader(nil)
+	opts := GetOptions{ChunkSize: 1024, Workers: 1}
+	if _, err = d.GetToFile(context.Background(), localFile, server.URL, &opts); err == nil {
+		t.Fatalf("Downloader#GetToFile() should fail")
+	}
+	if _, err = os.Stat(localFile + ".progress"); err != nil {
+		t.Fatalf("Downloader#GetToFile() should keep the progress, %v", err)
+	}
+
+	server.fail = nil
+	before := server.requests()
+	if _, err = d.GetToFile(context.Background(), localFile, server.URL, &opts); err != nil {
+		t.Fatalf("Downloader#GetToFile() error, %s", err)
+	}
+	if resumed := server.requests() - before; resumed != 3 {
+		t.Fatalf("Downloader#GetToFile() should only download the left chunks, %d requests", resumed)
+	}
+	got, _ := ioutil.ReadFile(localFile)
+	if !bytes.Equal(got, server.data) {
+		t.Fatalf("Downloader#GetToFile() error, unexpected data")
+	}
+	if _, err = os.Stat(localFile + ".progress"); !os.IsNotExist(err) {
+		t.Fatalf("Downloader#GetToFile() should remove the progress, %v", err)
+	}
+}
+
+func TestDownloaderGetPrivate(t *testing.T) {
+	data := make([]byte, 64*1024)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	var mu sync.Mutex
+	var deadlines []string
+	forbidden := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/cdn/") {
+			mu.Lock()
+			first := len(deadlines) == 1
+			mu.Unlock()
+			if first {
+				// 第一次下载写入一半数据之后等待链接过期，然后断开连接
+				w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+				w.Write(data[:len(data)/2])
+				w.(http.Flusher).Flush()
+				time.Sleep(1100 * time.Millisecond)
+				panic(http.ErrAbortHandler)
+			}
+			http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+			return
+		}
+		verifier := NewDownloadTokenVerifier(mac, server.URL)
+		if err := verifier.Verify(req); err != nil {
+			mu.Lock()
+			forbidden++
+			mu.Unlock()
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		deadlines = append(deadlines, req.URL.Query().Get("e"))
+		mu.Unlock()
+		http.Redirect(w, req, "/cdn"+req.URL.Path, http.StatusFound)
+	}))
+	defer server.Close()
+
+	if _, err := NewDownloader(nil).GetPrivate(context.Background(), server.URL, "file", ioutil.Discard); err != ErrNoDownloaderMac {
+		t.Fatalf("Downloader#GetPrivate() should fail without mac, %v", err)
+	}
+
+	d := NewDownloader(mac)
+	d.TTL = time.Second
+	var buf bytes.Buffer
+	ret, err := d.GetPrivate(context.Background(), server.URL, "file", &buf)
+	if err != nil {
+		t.Fatalf("Downloader#GetPrivate() error, %s", err)
+	}
+	if ret.Fsize != int64(len(data)) || !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("Downloader#GetPrivate() error, ret %+v, %d bytes", ret, buf.Len())
+	}
+	if len(deadlines) != 2 || deadlines[0] == deadlines[1] || forbidden != 0 {
+		t.Fatalf("Downloader#GetPrivate() should resign the url, deadlines %v, %d forbidden", deadlines, forbidden)
+	}
+}
+
+func TestDownloaderProgressAndRateLimit(t *testing.T) {
+	data := make([]byte, 24*1024)
+	rand.New(rand.NewSource(3)).Read(data)
+	var once sync.Once
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Range") == "bytes=1024-2047" {
+			aborted := false
+			once.Do(func() { aborted = true })
+			if aborted {
+				// 分块下载到一半的时候断开连接，重试的时候不应该重复计算进度
+				w.Header().Set("Content-Range", "bytes 1024-2047/"+strconv.Itoa(len(data)))
+				w.Header().Set("Content-Length", "1024")
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(data[1024:1536])
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+		}
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	f, err := ioutil.TempFile("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	var mu sync.Mutex
+	var last int64
+	monotonic := true
+	opts := GetOptions{
+		ChunkSize: 1024,
+		RateLimit: 16 * 1024,
+		OnProgress: func(downloaded, total int64) {
+			mu.Lock()
+			defer mu.Unlock()
+			if downloaded < last || total != int64(len(data)) {
+				monotonic = false
+			}
+			last = downloaded
+		},
+	}
+	start := time.Now()
+	d := NewDownloader(nil)
+	if _, err = d.GetFile(context.Background(), f, server.URL, &opts); err != nil {
+		t.Fatalf("Downloader#GetFile() error, %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("Downloader#GetFile() should be rate limited, elapsed %s", elapsed)
+	}
+	if !monotonic || last != int64(len(data)) {
+		t.Fatalf("Downloader#GetFile() error, progress %d, monotonic %v", last, monotonic)
+	}
+}
+
+func TestDownloaderVerifyStat(t *testing.T) {
+	server := newFakeDownloadServer(5000)
+	defer server.Close()
+	statHash := server.etag
+	rsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/stat/"+EncodedEntry("bucket", "file") {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"hash":"` + statHash + `","fsize":5000}`))
+	}))
+	defer rsServer.Close()
+
+	f, err := ioutil.TempFile("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	bucketManager := NewBucketManager(mac, &Config{RsHost: rsServer.URL})
+	opts := GetOptions{VerifyStat: true, BucketManager: bucketManager, Bucket: "bucket", Key: "file"}
+	d := NewDownloader(mac)
+	if _, err = d.GetFile(context.Background(), f, server.URL, &opts); err != nil {
+		t.Fatalf("Downloader#GetFile() error, %s", err)
+	}
+	if _, err = d.GetPrivateWithOptions(context.Background(), server.URL, "file", ioutil.Discard, &opts); err != nil {
+		t.Fatalf("Downloader#GetPrivateWithOptions() error, %s", err)
+	}
+
+	statHash = "corrupted"
+	_, err = d.GetFile(context.Background(), f, server.URL, &opts)
+	if e, ok := err.(*EtagMismatchError); !ok || e.Expected != "corrupted" || e.Actual != server.etag || !e.Is(ErrUnmatchedChecksum) {
+		t.Fatalf("Downloader#GetFile() should fail with EtagMismatchError, %v", err)
+	}
+	_, err = d.GetPrivateWithOptions(context.Background(), server.URL, "file", ioutil.Discard, &opts)
+	if e, ok := err.(*EtagMismatchError); !ok || e.Actual != server.etag {
+		t.Fatalf("Downloader#GetPrivateWithOptions() should fail with EtagMismatchError, %v", err)
+	}
+
+	opts.Key = ""
+	if _, err = d.GetFile(context.Background(), f, server.URL, &opts); err != ErrVerifyStatOptions {
+		t.Fatalf("Downloader#GetFile() should fail without key, %v", err)
+	}
+}
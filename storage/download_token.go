@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qiniu/api.v7/auth/qbox"
+)
+
+// 校验私有空间下载链接时可能遇到的错误
+var (
+	ErrNoDownloadToken      = errors.New("no download token in the url")
+	ErrInvalidDownloadToken = errors.New("invalid download token")
+	ErrDownloadTokenExpired = errors.New("download token expired")
+)
+
+// DownloadTokenVerifier 用来在自建的网关或者代理上校验 MakePrivateURL 生成的私有空间下载链接，
+// 校验的方式和七牛的下载服务一致
+type DownloadTokenVerifier struct {
+	Mac *qbox.Mac
+
+	// 可选。生成下载链接时使用的域名，包括 scheme，比如 "https://cdn.example.com"。
+	// 不设定则根据请求的 Host 以及是否为 TLS 连接生成，网关在负载均衡之后的时候需要设定
+	Domain string
+}
+
+// NewDownloadTokenVerifier 用来构建一个下载链接的校验对象
+func NewDownloadTokenVerifier(mac *qbox.Mac, domain string) *DownloadTokenVerifier {
+	return &DownloadTokenVerifier{Mac: mac, Domain: domain}
+}
+
+// Verify 校验请求中的 e 和 token 参数，校验通过的时候返回 nil
+func (v *DownloadTokenVerifier) Verify(req *http.Request) (err error) {
+	rawQuery := req.URL.RawQuery
+	idx := strings.LastIndex(rawQuery, "token=")
+	if idx < 0 || idx > 0 && rawQuery[idx-1] != '&' {
+		return ErrNoDownloadToken
+	}
+	token := rawQuery[idx+len("token="):]
+	signedQuery := strings.TrimSuffix(rawQuery[:idx], "&")
+
+	query, err := url.ParseQuery(signedQuery)
+	if err != nil {
+		return ErrInvalidDownloadToken
+	}
+	deadline, err := strconv.ParseInt(query.Get("e"), 10, 64)
+	if err != nil {
+		return ErrInvalidDownloadToken
+	}
+
+	domain := v.Domain
+	if domain == "" {
+		scheme := "http"
+		if req.TLS != nil {
+			scheme = "https"
+		}
+		domain = scheme + "://" + req.Host
+	}
+	urlToSign := strings.TrimRight(domain, "/") + req.URL.EscapedPath() + "?" + signedQuery
+	expected := v.Mac.Sign([]byte(urlToSign))
+	if !hmac.Equal([]byte(expected), []byte(token)) {
+		return ErrInvalidDownloadToken
+	}
+	if time.Now().Unix() > deadline {
+		return ErrDownloadTokenExpired
+	}
+	return
+}
+
+// Handler 返回一个校验下载链接的 http.Handler，校验通过的请求交给 next 处理，否则返回 401 或者 403
+func (v *DownloadTokenVerifier) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch err := v.Verify(req); err {
+		case nil:
+			next.ServeHTTP(w, req)
+		case ErrNoDownloadToken:
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		default:
+			http.Error(w, err.Error(), http.StatusForbidden)
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestDownloadTokenVerifier(t *testing.T) {
+	verifier := NewDownloadTokenVerifier(mac, "")
+	server := httptest.NewServer(verifier.Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("ok"))
+	})))
+	defer server.Close()
+
+	cases := []struct {
+		url  string
+		code int
+	}{
+		{MakePrivateURL(mac, server.URL, "a.jpg", time.Now().Add(time.Hour).Unix()), http.StatusOK},
+		{MakePrivateURLWithQuery(mac, server.URL, "dir/a b.jpg", time.Hour, url.Values{"imageView2/1/w/200": nil}), http.StatusOK},
+		{MakePrivateURL(mac, server.URL, "a.jpg", time.Now().Add(-time.Hour).Unix()), http.StatusForbidden},
+		{MakePrivateURL(mac, server.URL, "a.jpg", time.Now().Add(time.Hour).Unix()) + "x", http.StatusForbidden},
+		{server.URL + "/a.jpg", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		resp, err := http.Get(c.url)
+		if err != nil {
+			t.Fatalf("http.Get() error, %s", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.code {
+			t.Fatalf("DownloadTokenVerifier#Handler() error, %s returns %d, expected %d", c.url, resp.StatusCode, c.code)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+)
+
+// 上传之后校验文件 hash 时可能遇到的错误
+var (
+	ErrUnmatchedEtag = errors.New("unmatched etag")
+	ErrNoEtag        = errors.New("no hash field in the upload response, check the returnBody of the put policy")
+
+	ErrNoBucketManager = errors.New("SkipIfExists requires BucketManager to stat the target key")
+)
+
+// Etag 计算七牛 etag（qetag），和文件上传之后返回的 hash 值一致，fsize 为要计算的数据大小
+func Etag(r io.Reader, fsize int64) (etag string, err error) {
+	h := newEtagHasher()
+	n, err := io.CopyN(h, r, fsize)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+	if n != fsize {
+		err = io.ErrUnexpectedEOF
+		return
+	}
+	etag = h.Etag()
+	return
+}
+
+// etagHasher 按照 4MB 一个块计算每个块的 sha1，用来在上传的同时计算 etag
+type etagHasher struct {
+	blk     hash.Hash
+	blkSize int
+	sha1s   [][]byte
+}
+
+func newEtagHasher() *etagHasher {
+	return &etagHasher{blk: sha1.New()}
+}
+
+func (h *etagHasher) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		m := len(p)
+		if left := (1 << blockBits) - h.blkSize; m > left {
+			m = left
+		}
+		h.blk.Write(p[:m])
+		h.blkSize += m
+		n += m
+		p = p[m:]
+		if h.blkSize == 1<<blockBits {
+			h.sha1s = append(h.sha1s, h.blk.Sum(nil))
+			h.blk.Reset()
+			h.blkSize = 0
+		}
+	}
+	return
+}
+
+// Etag 返回已经写入的数据的 etag
+func (h *etagHasher) Etag() string {
+	sha1s := h.sha1s
+	if h.blkSize > 0 || len(sha1s) == 0 {
+		sha1s = append(sha1s[:len(sha1s):len(sha1s)], h.blk.Sum(nil))
+	}
+
+	var sum []byte
+	if len(sha1s) == 1 {
+		sum = append([]byte{0x16}, sha1s[0]...)
+	} else {
+		all := sha1.New()
+		for _, s := range sha1s {
+			all.Write(s)
+		}
+		sum = append([]byte{0x96}, all.Sum(nil)...)
+	}
+	return base64.URLEncoding.EncodeToString(sum)
+}
+
+// decodeAndVerifyEtag 将上传返回的内容解析到 ret 中，并检查返回的 hash 和本地计算的 etag 是否一致
+func decodeAndVerifyEtag(data json.RawMessage, ret interface{}, etag string) (err error) {
+	if ret != nil {
+		if err = json.Unmarshal(data, ret); err != nil {
+			return
+		}
+	}
+
+	var hashRet struct {
+		Hash string `json:"hash"`
+	}
+	if err = json.Unmarshal(data, &hashRet); err != nil {
+		return
+	}
+	if hashRet.Hash == "" {
+		return ErrNoEtag
+	}
+	if hashRet.Hash != etag {
+		return ErrUnmatchedEtag
+	}
+	return
+}
+
+// skipIfExists 查询 key 是否已经存在，已经存在而且大小和 hash 与 r 中的内容一致的时候返回 true，
+// 同时把 key 和 hash 填充到 ret 中。查询失败（包括文件不存在）的时候返回 false，由调用方继续上传
+func skipIfExists(bm *BucketManager, ret interface{}, upToken, key string, r io.ReaderAt, fsize int64) (skipped bool, err error) {
+	if bm == nil {
+		err = ErrNoBucketManager
+		return
+	}
+	_, bucket, err := getAkBucketFromUploadToken(upToken)
+	if err != nil {
+		return
+	}
+
+	info, sErr := bm.Stat(bucket, key)
+	if sErr != nil || info.Fsize != fsize {
+		return
+	}
+	etag, eErr := Etag(io.NewSectionReader(r, 0, fsize), fsize)
+	if eErr != nil || etag != info.Hash {
+		return
+	}
+
+	skipped = true
+	if ret != nil {
+		data, _ := json.Marshal(PutRet{Key: key, Hash: etag})
+		err = json.Unmarshal(data, ret)
+	}
+	return
+}
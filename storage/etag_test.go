@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"testing"
+)
+
+func TestEtag(t *testing.T) {
+	etag, err := Etag(bytes.NewReader(nil), 0)
+	if err != nil || etag != "Fto5o-5ea0sNMlW_75VgGJCv2AcJ" {
+		t.Fatalf("Etag() error, etag = %s, err = %v", etag, err)
+	}
+
+	data := make([]byte, 5*1024*1024)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	sha1Blk0 := sha1.Sum(data[:4*1024*1024])
+	sha1Blk1 := sha1.Sum(data[4*1024*1024:])
+	all := sha1.Sum(append(sha1Blk0[:], sha1Blk1[:]...))
+	expected := base64.URLEncoding.EncodeToString(append([]byte{0x96}, all[:]...))
+
+	etag, err = Etag(bytes.NewReader(data), int64(len(data)))
+	if err != nil || etag != expected {
+		t.Fatalf("Etag() error, etag = %s, expected %s, err = %v", etag, expected, err)
+	}
+
+	if _, err = Etag(bytes.NewReader(data), int64(len(data))+1); err == nil {
+		t.Fatalf("Etag() expected error for short data")
+	}
+}
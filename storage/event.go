@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+// 可以触发事件通知的文件操作
+const (
+	EventPut     = "put"     // 表单上传或者分片上传
+	EventMkfile  = "mkfile"  // 分片上传合成文件
+	EventDelete  = "delete"  // 删除文件
+	EventCopy    = "copy"    // 复制文件
+	EventMove    = "move"    // 移动或者重命名文件
+	EventAppend  = "append"  // 追加上传
+	EventDisable = "disable" // 禁用文件
+	EventEnable  = "enable"  // 启用文件
+)
+
+// BucketEventRule 为空间的事件通知规则，文件的 key 同时满足 Prefix 和 Suffix 的时候，
+// 发生 Events 中的操作之后七牛服务器会回调 CallbackURLs
+type BucketEventRule struct {
+	Name   string   `json:"name"`   // 规则名称，在空间中唯一
+	Prefix string   `json:"prefix"` // 可选。文件的前缀
+	Suffix string   `json:"suffix"` // 可选。文件的后缀
+	Events []string `json:"event"`  // 触发通知的操作，比如 EventPut，EventDelete
+
+	CallbackURLs []string `json:"callback_urls"`        // 回调地址，可以指定多个，依次尝试直到成功为止
+	AccessKey    string   `json:"access_key,omitempty"` // 可选。设置之后使用这个 AccessKey 对应的密钥对回调请求签名
+	Host         string   `json:"host,omitempty"`       // 可选。回调请求的 Host 头部
+}
+
+// Validate 检查事件通知规则是否合法
+func (r *BucketEventRule) Validate() error {
+	if r.Name == "" {
+		return errors.New("event rule: name is required")
+	}
+	if len(r.Events) == 0 {
+		return errors.New("event rule: events are required")
+	}
+	if len(r.CallbackURLs) == 0 {
+		return errors.New("event rule: callback urls are required")
+	}
+	return nil
+}
+
+func (r *BucketEventRule) params(bucket string) map[string][]string {
+	params := map[string][]string{
+		"bucket":      {bucket},
+		"name":        {r.Name},
+		"prefix":      {r.Prefix},
+		"suffix":      {r.Suffix},
+		"event":       r.Events,
+		"callbackURL": r.CallbackURLs,
+	}
+	if r.AccessKey != "" {
+		params["access_key"] = []string{r.AccessKey}
+	}
+	if r.Host != "" {
+		params["host"] = []string{r.Host}
+	}
+	return params
+}
+
+// AddBucketEventRule 用来为空间增加一条事件通知规则
+func (m *BucketManager) AddBucketEventRule(bucket string, rule *BucketEventRule) (err error) {
+	if err = rule.Validate(); err != nil {
+		return
+	}
+	ctx := m.withMac(context.TODO())
+	reqURL := m.Cfg.UcReqHost() + "/events/add"
+	err = m.Client.CallWithForm(ctx, nil, "POST", reqURL, nil, rule.params(bucket))
+	return
+}
+
+// DelBucketEventRule 用来删除空间中名称为 name 的事件通知规则
+func (m *BucketManager) DelBucketEventRule(bucket, name string) (err error) {
+	ctx := m.withMac(context.TODO())
+	reqURL := m.Cfg.UcReqHost() + "/events/delete"
+	params := map[string][]string{
+		"bucket": {bucket},
+		"name":   {name},
+	}
+	err = m.Client.CallWithForm(ctx, nil, "POST", reqURL, nil, params)
+	return
+}
+
+// GetBucketEventRules 用来获取空间的全部事件通知规则
+func (m *BucketManager) GetBucketEventRules(bucket string) (rules []BucketEventRule, err error) {
+	ctx := m.withMac(context.TODO())
+	reqURL := m.Cfg.UcReqHost() + "/events/get"
+	params := map[string][]string{
+		"bucket": {bucket},
+	}
+	err = m.Client.CallWithForm(ctx, &rules, "GET", reqURL, nil, params)
+	return
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestBucketEventRules(t *testing.T) {
+	var rules []BucketEventRule
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		if req.Form.Get("bucket") != "bucket" {
+			http.Error(w, `{"error":"bad request"}`, http.StatusBadRequest)
+			return
+		}
+		switch req.URL.Path {
+		case "/events/add":
+			rules = append(rules, BucketEventRule{
+				Name:         req.Form.Get("name"),
+				Suffix:       req.Form.Get("suffix"),
+				Events:       req.Form["event"],
+				CallbackURLs: req.Form["callbackURL"],
+			})
+		case "/events/delete":
+			rules = rules[:0]
+		case "/events/get":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(rules)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	bucketManager := NewBucketManager(mac, &Config{UcHost: server.URL})
+	rule := BucketEventRule{
+		Name:         "images",
+		Suffix:       ".jpg",
+		Events:       []string{EventPut, EventMkfile, EventDelete},
+		CallbackURLs: []string{"http://a.example.com/cb", "http://b.example.com/cb"},
+	}
+	if err := bucketManager.AddBucketEventRule("bucket", &rule); err != nil {
+		t.Fatalf("BucketManager#AddBucketEventRule() error, %s", err)
+	}
+	got, err := bucketManager.GetBucketEventRules("bucket")
+	if err != nil {
+		t.Fatalf("BucketManager#GetBucketEventRules() error, %s", err)
+	}
+	if len(got) != 1 || !reflect.DeepEqual(got[0], rule) {
+		t.Fatalf("BucketManager#GetBucketEventRules() error, unexpected rules %+v", got)
+	}
+	if err = bucketManager.DelBucketEventRule("bucket", "images"); err != nil {
+		t.Fatalf("BucketManager#DelBucketEventRule() error, %s", err)
+	}
+
+	if err = bucketManager.AddBucketEventRule("bucket", &BucketEventRule{Name: "invalid", Events: []string{EventPut}}); err == nil {
+		t.Fatalf("BucketManager#AddBucketEventRule() should fail without callback urls")
+	}
+}
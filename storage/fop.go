@@ -0,0 +1,321 @@
+package storage
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+// Fop 为一个数据处理指令，比如 imageView2/2/w/200，可以用于下载链接的处理参数，也可以用于 Pfop
+type Fop interface {
+	Fop() string
+}
+
+// RawFop 为没有提供类型的数据处理指令，原样使用
+type RawFop string
+
+// Fop 返回处理指令
+func (f RawFop) Fop() string {
+	return string(f)
+}
+
+// fopArgs 用来拼接处理指令的参数，参数值为空的时候忽略
+type fopArgs []string
+
+func (a *fopArgs) add(name, value string) {
+	if value != "" {
+		*a = append(*a, name, value)
+	}
+}
+
+func (a *fopArgs) addInt(name string, value int) {
+	if value > 0 {
+		a.add(name, strconv.Itoa(value))
+	}
+}
+
+func (a *fopArgs) addFloat(name string, value float64) {
+	if value > 0 {
+		a.add(name, strconv.FormatFloat(value, 'f', -1, 64))
+	}
+}
+
+func (a *fopArgs) addBool(name string, value bool) {
+	if value {
+		a.add(name, "1")
+	}
+}
+
+func (a *fopArgs) addBase64(name, value string) {
+	if value != "" {
+		a.add(name, base64.URLEncoding.EncodeToString([]byte(value)))
+	}
+}
+
+func (a fopArgs) join(cmd ...string) string {
+	return strings.Join(append(cmd, a...), "/")
+}
+
+// ImageView2 为图片基本处理指令 imageView2，参考 https://developer.qiniu.com/dora/manual/1279/basic-processing-images-imageview2
+type ImageView2 struct {
+	Mode      int    // 缩放模式，取值 0 到 5
+	Width     int    // 可选。宽度，单位为像素
+	Height    int    // 可选。高度，单位为像素
+	Format    string // 可选。输出格式，比如 jpg，png，webp
+	Interlace bool   // 可选。是否输出渐进显示的图片，只对 jpg 有效
+	Quality   int    // 可选。图片质量，取值 1 到 100
+
+	// 可选。处理失败的时候返回原图
+	IgnoreError bool
+}
+
+// Fop 返回处理指令
+func (f ImageView2) Fop() string {
+	var args fopArgs
+	args.addInt("w", f.Width)
+	args.addInt("h", f.Height)
+	args.add("format", f.Format)
+	args.addBool("interlace", f.Interlace)
+	args.addInt("q", f.Quality)
+	args.addBool("ignore-error", f.IgnoreError)
+	return args.join("imageView2", strconv.Itoa(f.Mode))
+}
+
+// ImageMogr2 为图片高级处理指令 imageMogr2，参考 https://developer.qiniu.com/dora/manual/1270/the-advanced-treatment-of-images-imagemogr2
+type ImageMogr2 struct {
+	AutoOrient bool   // 可选。根据 EXIF 中的方向信息自动旋转
+	Thumbnail  string // 可选。缩放参数，比如 "200x"，"!50p"
+	Strip      bool   // 可选。去除图片中的元信息
+	Gravity    string // 可选。裁剪的锚点，比如 Center，NorthWest
+	Crop       string // 可选。裁剪参数，比如 "300x300"
+	Rotate     int    // 可选。顺时针旋转的角度，取值 1 到 360
+	Format     string // 可选。输出格式
+	Blur       string // 可选。高斯模糊参数，格式为 <radius>x<sigma>
+	Interlace  bool   // 可选。是否输出渐进显示的图片
+	Quality    int    // 可选。图片质量，取值 1 到 100
+}
+
+// Fop 返回处理指令，参数按照服务端执行的顺序拼接
+func (f ImageMogr2) Fop() string {
+	var args fopArgs
+	if f.AutoOrient {
+		args = append(args, "auto-orient")
+	}
+	args.add("thumbnail", f.Thumbnail)
+	if f.Strip {
+		args = append(args, "strip")
+	}
+	args.add("gravity", f.Gravity)
+	args.add("crop", f.Crop)
+	args.addInt("rotate", f.Rotate)
+	args.add("format", f.Format)
+	args.add("blur", f.Blur)
+	args.addBool("interlace", f.Interlace)
+	args.addInt("quality", f.Quality)
+	return args.join("imageMogr2")
+}
+
+// 水印的位置
+const (
+	GravityNorthWest = "NorthWest"
+	GravityNorth     = "North"
+	GravityNorthEast = "NorthEast"
+	GravityWest      = "West"
+	GravityCenter    = "Center"
+	GravityEast      = "East"
+	GravitySouthWest = "SouthWest"
+	GravitySouth     = "South"
+	GravitySouthEast = "SouthEast"
+)
+
+// ImageWatermark 为图片水印指令 watermark/1，参考 https://developer.qiniu.com/dora/manual/1316/image-watermarking-processing-watermark
+type ImageWatermark struct {
+	Image    string // 水印图片的链接，会被 URL 安全的 Base64 编码
+	Dissolve int    // 可选。透明度，取值 1 到 100，不设定则为 100（不透明）
+	Gravity  string // 可选。水印位置，不设定则为 SouthEast
+	Dx       int    // 可选。横向边距，单位为像素
+	Dy       int    // 可选。纵向边距，单位为像素
+
+	// 可选。水印图片相对于原图的短边的缩放比例，取值 0 到 1
+	Scale float64
+}
+
+// Fop 返回处理指令
+func (f ImageWatermark) Fop() string {
+	var args fopArgs
+	args.addBase64("image", f.Image)
+	args.addInt("dissolve", f.Dissolve)
+	args.add("gravity", f.Gravity)
+	args.addInt("dx", f.Dx)
+	args.addInt("dy", f.Dy)
+	args.addFloat("ws", f.Scale)
+	return args.join("watermark", "1")
+}
+
+// TextWatermark 为文字水印指令 watermark/2
+type TextWatermark struct {
+	Text     string // 水印文字，会被 URL 安全的 Base64 编码
+	Font     string // 可选。字体名称，会被 URL 安全的 Base64 编码
+	FontSize int    // 可选。字体大小，单位为缇
+	Fill     string // 可选。字体颜色，比如 "#FFFFFF"，会被 URL 安全的 Base64 编码
+	Dissolve int    // 可选。透明度，取值 1 到 100
+	Gravity  string // 可选。水印位置，不设定则为 SouthEast
+	Dx       int    // 可选。横向边距，单位为像素
+	Dy       int    // 可选。纵向边距，单位为像素
+}
+
+// Fop 返回处理指令
+func (f TextWatermark) Fop() string {
+	var args fopArgs
+	args.addBase64("text", f.Text)
+	args.addBase64("font", f.Font)
+	args.addInt("fontsize", f.FontSize)
+	args.addBase64("fill", f.Fill)
+	args.addInt("dissolve", f.Dissolve)
+	args.add("gravity", f.Gravity)
+	args.addInt("dx", f.Dx)
+	args.addInt("dy", f.Dy)
+	return args.join("watermark", "2")
+}
+
+// Avthumb 为音视频转码指令 avthumb，参考 https://developer.qiniu.com/dora/manual/1248/audio-and-video-transcoding-avthumb
+type Avthumb struct {
+	Format       string  // 输出格式，比如 mp4，flv，mp3
+	Resolution   string  // 可选。分辨率，比如 "1280x720"
+	AutoScale    bool    // 可选。按照原视频的比例缩放到 Resolution 之内
+	VideoBitrate string  // 可选。视频码率，比如 "1m"，"500k"
+	FrameRate    int     // 可选。视频帧率
+	VideoCodec   string  // 可选。视频编码，比如 libx264
+	AudioBitrate string  // 可选。音频码率，比如 "128k"
+	AudioCodec   string  // 可选。音频编码，比如 libfdk_aac
+	SampleRate   int     // 可选。音频采样率
+	Start        float64 // 可选。开始时间，单位为秒
+	Duration     float64 // 可选。时长，单位为秒
+	StripMeta    bool    // 可选。去除元信息
+	NoVideo      bool    // 可选。去除视频流，用于提取音频
+	NoAudio      bool    // 可选。去除音频流
+}
+
+// Fop 返回处理指令
+func (f Avthumb) Fop() string {
+	var args fopArgs
+	args.add("s", f.Resolution)
+	args.addBool("autoscale", f.AutoScale)
+	args.add("vb", f.VideoBitrate)
+	args.addInt("r", f.FrameRate)
+	args.add("vcodec", f.VideoCodec)
+	args.add("ab", f.AudioBitrate)
+	args.add("acodec", f.AudioCodec)
+	args.addInt("ar", f.SampleRate)
+	args.addFloat("ss", f.Start)
+	args.addFloat("t", f.Duration)
+	args.addBool("stripmeta", f.StripMeta)
+	args.addBool("vn", f.NoVideo)
+	args.addBool("an", f.NoAudio)
+	return args.join("avthumb", f.Format)
+}
+
+// Vframe 为视频截帧指令 vframe，参考 https://developer.qiniu.com/dora/manual/1313/video-frame-thumbnails-vframe
+type Vframe struct {
+	Format string  // 输出格式，jpg 或者 png
+	Offset float64 // 截帧的时间点，单位为秒
+	Width  int     // 可选。宽度，单位为像素
+	Height int     // 可选。高度，单位为像素
+	Rotate string  // 可选。旋转，取值 90，180，270 或者 auto
+}
+
+// Fop 返回处理指令，Offset 为 0 的时候截取第一帧
+func (f Vframe) Fop() string {
+	args := fopArgs{"offset", strconv.FormatFloat(f.Offset, 'f', -1, 64)}
+	args.addInt("w", f.Width)
+	args.addInt("h", f.Height)
+	args.add("rotate", f.Rotate)
+	return args.join("vframe", f.Format)
+}
+
+// SaveAs 返回将处理结果保存到 bucket 中的 key 的 saveas 指令，key 为空的时候由服务端生成
+func SaveAs(bucket, key string) Fop {
+	if key == "" {
+		return RawFop("saveas/" + EncodedEntryWithoutKey(bucket))
+	}
+	return RawFop("saveas/" + EncodedEntry(bucket, key))
+}
+
+// FopBuilder 用来拼接数据处理指令。同一个处理流程中的指令使用 "|" 连接，前一个指令的输出作为后一个指令的输入，
+// 多个处理流程使用 ";" 连接，用于 Pfop 一次提交多个处理
+//
+//	fops := storage.NewFopBuilder().
+//		Pipe(storage.Avthumb{Format: "mp4", Resolution: "1280x720"}).SaveAs(bucket, "720p.mp4").
+//		Pipe(storage.Vframe{Format: "jpg", Offset: 1}).SaveAs(bucket, "cover.jpg").
+//		String()
+type FopBuilder struct {
+	fops []string
+	cur  []string
+	err  error
+}
+
+// NewFopBuilder 用来构建一个 FopBuilder
+func NewFopBuilder() *FopBuilder {
+	return &FopBuilder{}
+}
+
+// Pipe 将指令添加到当前的处理流程中，指令实现了 Validate() error 的时候检查参数，第一个错误通过 Err 返回
+func (b *FopBuilder) Pipe(fops ...Fop) *FopBuilder {
+	for _, fop := range fops {
+		if v, ok := fop.(interface {
+			Validate() error
+		}); ok && b.err == nil {
+			b.err = v.Validate()
+		}
+		if s := fop.Fop(); s != "" {
+			b.cur = append(b.cur, s)
+		}
+	}
+	return b
+}
+
+// SaveAs 将当前处理流程的结果保存到 bucket 中的 key，并结束当前的处理流程
+func (b *FopBuilder) SaveAs(bucket, key string) *FopBuilder {
+	return b.Pipe(SaveAs(bucket, key)).Next()
+}
+
+// Next 结束当前的处理流程，之后添加的指令属于新的处理流程
+func (b *FopBuilder) Next() *FopBuilder {
+	if len(b.cur) > 0 {
+		b.fops = append(b.fops, strings.Join(b.cur, "|"))
+		b.cur = nil
+	}
+	return b
+}
+
+// Err 返回添加的指令中第一个参数检查失败的错误
+func (b *FopBuilder) Err() error {
+	return b.err
+}
+
+// Fops 返回每个处理流程的指令
+func (b *FopBuilder) Fops() []string {
+	fops := append([]string{}, b.fops...)
+	if len(b.cur) > 0 {
+		fops = append(fops, strings.Join(b.cur, "|"))
+	}
+	return fops
+}
+
+// String 返回用于 Pfop 的 fops 参数
+func (b *FopBuilder) String() string {
+	return strings.Join(b.Fops(), ";")
+}
+
+// URL 返回对 srcURL 指向的文件进行实时处理的链接，比如 MakePublicURL 生成的链接，私有空间需要对返回的链接再次签名。
+// 实时处理只支持一个处理流程，包含多个处理流程的时候只使用第一个
+func (b *FopBuilder) URL(srcURL string) string {
+	fops := b.Fops()
+	if len(fops) == 0 {
+		return srcURL
+	}
+	if strings.Contains(srcURL, "?") {
+		return srcURL + "&" + fops[0]
+	}
+	return srcURL + "?" + fops[0]
+}
@@ -0,0 +1,105 @@
+package storage
+
+// AvthumbHLS 为转码成 HLS 的指令 avthumb/m3u8，输出 m3u8 播放列表和对应的 ts 切片
+type AvthumbHLS struct {
+	SegTime      int    // 可选。每个切片的时长，单位为秒，不设定则为 10
+	Resolution   string // 可选。分辨率，比如 "1280x720"
+	AutoScale    bool   // 可选。按照原视频的比例缩放到 Resolution 之内
+	VideoBitrate string // 可选。视频码率，比如 "2500k"
+	VideoCodec   string // 可选。视频编码，比如 libx264
+	AudioBitrate string // 可选。音频码率，比如 "128k"
+	AudioCodec   string // 可选。音频编码，比如 libfdk_aac
+
+	// 可选。m3u8 中的切片地址不包含域名，播放器使用 m3u8 所在的域名访问切片，适合绑定了多个域名的空间
+	NoDomain bool
+}
+
+// Fop 返回处理指令
+func (f AvthumbHLS) Fop() string {
+	var args fopArgs
+	args.addInt("segtime", f.SegTime)
+	args.add("s", f.Resolution)
+	args.addBool("autoscale", f.AutoScale)
+	args.add("vb", f.VideoBitrate)
+	args.add("vcodec", f.VideoCodec)
+	args.add("ab", f.AudioBitrate)
+	args.add("acodec", f.AudioCodec)
+	args.addBool("noDomain", f.NoDomain)
+	return args.join("avthumb", "m3u8")
+}
+
+// H264Rendition 为 H.264 编码的一个输出规格
+type H264Rendition struct {
+	Name         string // 规格的名称，用于生成保存的文件名，比如 "720p"
+	Resolution   string
+	VideoBitrate string
+	AudioBitrate string
+}
+
+// H264Ladder 为常用的 H.264 转码规格，从低到高排列
+var H264Ladder = []H264Rendition{
+	{Name: "360p", Resolution: "640x360", VideoBitrate: "800k", AudioBitrate: "96k"},
+	{Name: "480p", Resolution: "854x480", VideoBitrate: "1200k", AudioBitrate: "128k"},
+	{Name: "720p", Resolution: "1280x720", VideoBitrate: "2500k", AudioBitrate: "128k"},
+	{Name: "1080p", Resolution: "1920x1080", VideoBitrate: "5000k", AudioBitrate: "192k"},
+}
+
+// MP4 返回转码成该规格的 mp4 的指令，视频编码为 libx264，音频编码为 libfdk_aac，按照原视频的比例缩放
+func (r H264Rendition) MP4() Avthumb {
+	return Avthumb{
+		Format:       "mp4",
+		Resolution:   r.Resolution,
+		AutoScale:    true,
+		VideoBitrate: r.VideoBitrate,
+		VideoCodec:   "libx264",
+		AudioBitrate: r.AudioBitrate,
+		AudioCodec:   "libfdk_aac",
+	}
+}
+
+// HLS 返回转码成该规格的 HLS 的指令，segTime 为切片的时长，单位为秒，为 0 的时候使用服务端的默认值
+func (r H264Rendition) HLS(segTime int) AvthumbHLS {
+	return AvthumbHLS{
+		SegTime:      segTime,
+		Resolution:   r.Resolution,
+		AutoScale:    true,
+		VideoBitrate: r.VideoBitrate,
+		VideoCodec:   "libx264",
+		AudioBitrate: r.AudioBitrate,
+		AudioCodec:   "libfdk_aac",
+	}
+}
+
+// MP4Ladder 返回将视频转码成 renditions 中的每个规格的处理流程，结果保存为 bucket 中的 keyPrefix + Name + ".mp4"，
+// renditions 为空的时候使用 H264Ladder。返回的 FopBuilder 可以继续添加其他处理流程
+func MP4Ladder(bucket, keyPrefix string, renditions ...H264Rendition) *FopBuilder {
+	if len(renditions) == 0 {
+		renditions = H264Ladder
+	}
+	b := NewFopBuilder()
+	for _, r := range renditions {
+		b.Pipe(r.MP4()).SaveAs(bucket, keyPrefix+r.Name+".mp4")
+	}
+	return b
+}
+
+// HLSLadder 和 MP4Ladder 相同，输出 HLS，结果保存为 bucket 中的 keyPrefix + Name + ".m3u8"
+func HLSLadder(bucket, keyPrefix string, segTime int, renditions ...H264Rendition) *FopBuilder {
+	if len(renditions) == 0 {
+		renditions = H264Ladder
+	}
+	b := NewFopBuilder()
+	for _, r := range renditions {
+		b.Pipe(r.HLS(segTime)).SaveAs(bucket, keyPrefix+r.Name+".m3u8")
+	}
+	return b
+}
+
+// AudioExtract 返回从音视频中提取音频的指令，format 为输出格式，比如 mp3，m4a，bitrate 为音频码率，比如 "128k"，可以为空
+func AudioExtract(format, bitrate string) Avthumb {
+	return Avthumb{
+		Format:       format,
+		AudioBitrate: bitrate,
+		NoVideo:      true,
+	}
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAvthumbPresets(t *testing.T) {
+	want := "avthumb/mp4/s/1280x720/autoscale/1/vb/2500k/vcodec/libx264/ab/128k/acodec/libfdk_aac"
+	if got := H264Ladder[2].MP4().Fop(); got != want {
+		t.Fatalf("H264Rendition.MP4() = %s, want %s", got, want)
+	}
+	want = "avthumb/m3u8/segtime/6/s/640x360/autoscale/1/vb/800k/vcodec/libx264/ab/96k/acodec/libfdk_aac"
+	if got := H264Ladder[0].HLS(6).Fop(); got != want {
+		t.Fatalf("H264Rendition.HLS() = %s, want %s", got, want)
+	}
+	if got := (AvthumbHLS{NoDomain: true}).Fop(); got != "avthumb/m3u8/noDomain/1" {
+		t.Fatalf("AvthumbHLS.Fop() = %s", got)
+	}
+	if got := AudioExtract("mp3", "192k").Fop(); got != "avthumb/mp3/ab/192k/vn/1" {
+		t.Fatalf("AudioExtract() = %s", got)
+	}
+
+	fops := MP4Ladder("bucket", "video/a-").Fops()
+	if len(fops) != len(H264Ladder) {
+		t.Fatalf("MP4Ladder() returned %d fops", len(fops))
+	}
+	for i, r := range H264Ladder {
+		if fops[i] != r.MP4().Fop()+"|"+SaveAs("bucket", "video/a-"+r.Name+".mp4").Fop() {
+			t.Fatalf("MP4Ladder() fop %d = %s", i, fops[i])
+		}
+	}
+
+	custom := H264Rendition{Name: "4k", Resolution: "3840x2160", VideoBitrate: "16m", AudioBitrate: "256k"}
+	s := HLSLadder("bucket", "hls/", 10, H264Ladder[2], custom).
+		Pipe(Vframe{Format: "jpg", Offset: 1}).SaveAs("bucket", "hls/cover.jpg").
+		String()
+	parts := strings.Split(s, ";")
+	if len(parts) != 3 || !strings.HasSuffix(parts[1], SaveAs("bucket", "hls/4k.m3u8").Fop()) ||
+		!strings.HasPrefix(parts[1], "avthumb/m3u8/segtime/10/s/3840x2160") {
+		t.Fatalf("HLSLadder() = %s", s)
+	}
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImageInfo 为 imageInfo 返回的图片基本信息
+type ImageInfo struct {
+	Format      string `json:"format"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ColorModel  string `json:"colorModel"`
+	Size        int64  `json:"size"`
+	Orientation string `json:"orientation,omitempty"` // EXIF 中的方向，比如 "Top-left"，没有 EXIF 的时候为空
+	FrameNumber int    `json:"frameNumber,omitempty"` // gif 等动图的帧数
+}
+
+// ExifValue 为 exif 返回的一项 EXIF 信息
+type ExifValue struct {
+	Val  string `json:"val"`
+	Type int    `json:"type"`
+}
+
+// ExifInfo 为 exif 返回的 EXIF 信息，key 为 EXIF 的字段名，比如 "Orientation"，"DateTimeOriginal"
+type ExifInfo map[string]ExifValue
+
+// Get 返回字段 name 的值，不存在的时候返回空字符串
+func (e ExifInfo) Get(name string) string {
+	return e[name].Val
+}
+
+// AvStream 为 avinfo 返回的一个音视频流，数值字段按照服务端的返回保留为字符串
+type AvStream struct {
+	Index         int    `json:"index"`
+	CodecName     string `json:"codec_name"`
+	CodecLongName string `json:"codec_long_name"`
+	CodecType     string `json:"codec_type"` // video 或者 audio
+	Width         int    `json:"width,omitempty"`
+	Height        int    `json:"height,omitempty"`
+	FrameRate     string `json:"r_frame_rate,omitempty"` // 比如 "25/1"
+	SampleRate    string `json:"sample_rate,omitempty"`
+	Channels      int    `json:"channels,omitempty"`
+	Duration      string `json:"duration"`
+	BitRate       string `json:"bit_rate"`
+}
+
+// AvFormat 为 avinfo 返回的封装格式信息
+type AvFormat struct {
+	NbStreams      int    `json:"nb_streams"`
+	FormatName     string `json:"format_name"`
+	FormatLongName string `json:"format_long_name"`
+	Duration       string `json:"duration"`
+	Size           string `json:"size"`
+	BitRate        string `json:"bit_rate"`
+}
+
+// AvInfo 为 avinfo 返回的音视频元信息
+type AvInfo struct {
+	Streams []AvStream `json:"streams"`
+	Format  AvFormat   `json:"format"`
+}
+
+// Duration 返回音视频的时长，无法解析的时候返回 0
+func (info *AvInfo) Duration() time.Duration {
+	seconds, _ := strconv.ParseFloat(info.Format.Duration, 64)
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// BitRate 返回整体的码率，单位为 bit 每秒，无法解析的时候返回 0
+func (info *AvInfo) BitRate() int64 {
+	bitRate, _ := strconv.ParseInt(info.Format.BitRate, 10, 64)
+	return bitRate
+}
+
+// VideoStream 返回第一个视频流，没有的时候返回 nil
+func (info *AvInfo) VideoStream() *AvStream {
+	return info.stream("video")
+}
+
+// AudioStream 返回第一个音频流，没有的时候返回 nil
+func (info *AvInfo) AudioStream() *AvStream {
+	return info.stream("audio")
+}
+
+func (info *AvInfo) stream(codecType string) *AvStream {
+	for i := range info.Streams {
+		if info.Streams[i].CodecType == codecType {
+			return &info.Streams[i]
+		}
+	}
+	return nil
+}
+
+// fopURL 返回对 domain 下的 key 执行实时处理 fop 的链接，设置了 Downloader.Mac 的时候链接会被签名
+func (d *Downloader) fopURL(domain, key, fop string) string {
+	if d.Mac != nil {
+		ttl := d.TTL
+		if ttl <= 0 {
+			ttl = defaultPrivateURLTTL
+		}
+		return MakePrivateURLWithQuery(d.Mac, domain, key, ttl, url.Values{fop: nil})
+	}
+	return strings.TrimRight(domain, "/") + "/" + (&url.URL{Path: key}).EscapedPath() + "?" + fop
+}
+
+// ImageInfo 查询 domain 下的图片 key 的基本信息，设置了 Downloader.Mac 的时候使用私有链接
+func (d *Downloader) ImageInfo(ctx context.Context, domain, key string) (ret ImageInfo, err error) {
+	err = d.Client.Call(ctx, &ret, "GET", d.fopURL(domain, key, "imageInfo"), nil)
+	return
+}
+
+// Exif 查询 domain 下的图片 key 的 EXIF 信息，图片没有 EXIF 信息的时候服务端返回错误
+func (d *Downloader) Exif(ctx context.Context, domain, key string) (ret ExifInfo, err error) {
+	err = d.Client.Call(ctx, &ret, "GET", d.fopURL(domain, key, "exif"), nil)
+	return
+}
+
+// Avinfo 查询 domain 下的音视频 key 的元信息
+func (d *Downloader) Avinfo(ctx context.Context, domain, key string) (ret AvInfo, err error) {
+	err = d.Client.Call(ctx, &ret, "GET", d.fopURL(domain, key, "avinfo"), nil)
+	return
+}
+
+// qhash 支持的哈希算法
+const (
+	QHashMD5    = "md5"
+	QHashSHA1   = "sha1"
+	QHashSHA256 = "sha256"
+)
+
+// ErrInvalidQHashAlgo 表示 qhash 不支持的哈希算法
+var ErrInvalidQHashAlgo = errors.New("qhash: algo must be md5, sha1 or sha256")
+
+// QHashRet 为 qhash 返回的结果，Hash 为十六进制编码的哈希值
+type QHashRet struct {
+	Hash  string `json:"hash"`
+	Fsize int64  `json:"fsize"`
+}
+
+// QHash 由服务端计算 domain 下的 key 的哈希值，不需要下载文件就可以和本地的哈希值比较，algo 为 QHashMD5，QHashSHA1 或者 QHashSHA256
+func (d *Downloader) QHash(ctx context.Context, domain, key, algo string) (ret QHashRet, err error) {
+	switch algo {
+	case QHashMD5, QHashSHA1, QHashSHA256:
+	default:
+		err = ErrInvalidQHashAlgo
+		return
+	}
+	err = d.Client.Call(ctx, &ret, "GET", d.fopURL(domain, key, "qhash/"+algo), nil)
+	return
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDownloaderFopInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/a b.jpg" && req.URL.Path != "/v.mp4" {
+			http.NotFound(w, req)
+			return
+		}
+		if _, ok := req.URL.Query()["token"]; !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"bad token"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		q := req.URL.Query()
+		switch {
+		case q["imageInfo"] != nil:
+			w.Write([]byte(`{"size":1024,"format":"jpeg","width":640,"height":480,"colorModel":"ycbcr","orientation":"Top-left"}`))
+		case q["exif"] != nil:
+			w.Write([]byte(`{"Orientation":{"val":"Top-left","type":3},"Make":{"val":"Apple","type":2}}`))
+		case q["avinfo"] != nil:
+			w.Write([]byte(`{"streams":[{"index":0,"codec_type":"audio","codec_name":"aac","sample_rate":"44100","channels":2},` +
+				`{"index":1,"codec_type":"video","codec_name":"h264","width":1280,"height":720,"r_frame_rate":"25/1"}],` +
+				`"format":{"nb_streams":2,"format_name":"mov,mp4","duration":"12.500000","size":"1000000","bit_rate":"640000"}}`))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	d := NewDownloader(mac)
+	image, err := d.ImageInfo(context.Background(), server.URL, "a b.jpg")
+	if err != nil || image.Width != 640 || image.Height != 480 || image.Format != "jpeg" || image.Orientation != "Top-left" {
+		t.Fatalf("ImageInfo() error, %v, %+v", err, image)
+	}
+	exif, err := d.Exif(context.Background(), server.URL, "a b.jpg")
+	if err != nil || exif.Get("Make") != "Apple" || exif.Get("Missing") != "" {
+		t.Fatalf("Exif() error, %v, %+v", err, exif)
+	}
+	av, err := d.Avinfo(context.Background(), server.URL, "v.mp4")
+	if err != nil || av.Duration() != 12500*time.Millisecond || av.BitRate() != 640000 {
+		t.Fatalf("Avinfo() error, %v, %+v", err, av)
+	}
+	if v := av.VideoStream(); v == nil || v.Width != 1280 || v.CodecName != "h264" {
+		t.Fatalf("AvInfo.VideoStream() error, %+v", v)
+	}
+	if a := av.AudioStream(); a == nil || a.Channels != 2 {
+		t.Fatalf("AvInfo.AudioStream() error, %+v", a)
+	}
+
+	_, err = NewDownloader(nil).ImageInfo(context.Background(), server.URL, "a b.jpg")
+	if e, ok := err.(*ErrorInfo); !ok || e.Code != http.StatusUnauthorized {
+		t.Fatalf("ImageInfo() should fail without signing, %v", err)
+	}
+}
+
+func TestDownloaderQHash(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.RawQuery != "qhash/md5" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"hash":"5d41402abc4b2a76b9719d911017c592","fsize":5}`))
+	}))
+	defer server.Close()
+
+	d := NewDownloader(nil)
+	ret, err := d.QHash(context.Background(), server.URL, "hello.txt", QHashMD5)
+	if err != nil || ret.Hash != "5d41402abc4b2a76b9719d911017c592" || ret.Fsize != 5 {
+		t.Fatalf("QHash() error, %v, %+v", err, ret)
+	}
+	if _, err = d.QHash(context.Background(), server.URL, "hello.txt", "crc32"); err != ErrInvalidQHashAlgo {
+		t.Fatalf("QHash() should reject unknown algo, %v", err)
+	}
+}
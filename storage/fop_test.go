@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestFopBuilder(t *testing.T) {
+	b64 := func(s string) string {
+		return base64.URLEncoding.EncodeToString([]byte(s))
+	}
+
+	cases := []struct {
+		fop  Fop
+		want string
+	}{
+		{ImageView2{Mode: 2, Width: 200, Format: "webp", Quality: 75}, "imageView2/2/w/200/format/webp/q/75"},
+		{ImageMogr2{AutoOrient: true, Thumbnail: "!50p", Strip: true, Rotate: 90}, "imageMogr2/auto-orient/thumbnail/!50p/strip/rotate/90"},
+		{ImageWatermark{Image: "http://www.b.com/o.png", Dissolve: 50, Gravity: GravitySouthEast, Dx: 20},
+			"watermark/1/image/" + b64("http://www.b.com/o.png") + "/dissolve/50/gravity/SouthEast/dx/20"},
+		{TextWatermark{Text: "七牛云", Font: "宋体", FontSize: 500, Fill: "#FFFFFF"},
+			"watermark/2/text/" + b64("七牛云") + "/font/" + b64("宋体") + "/fontsize/500/fill/" + b64("#FFFFFF")},
+		{Avthumb{Format: "mp4", Resolution: "480x320", VideoBitrate: "500k", Start: 1.5}, "avthumb/mp4/s/480x320/vb/500k/ss/1.5"},
+		{Vframe{Format: "jpg", Offset: 10, Width: 480}, "vframe/jpg/offset/10/w/480"},
+		{SaveAs("bucket", ""), "saveas/" + b64("bucket")},
+	}
+	for _, c := range cases {
+		if got := c.fop.Fop(); got != c.want {
+			t.Errorf("Fop() = %s, want %s", got, c.want)
+		}
+	}
+
+	b := NewFopBuilder().
+		Pipe(Avthumb{Format: "mp4", Resolution: "480x320", VideoBitrate: "500k"}).SaveAs("bucket", "a.mp4").
+		Pipe(Vframe{Format: "jpg", Offset: 10}).SaveAs("bucket", "a.jpg").
+		Pipe(RawFop("vsample/jpg/interval/20"))
+	want := "avthumb/mp4/s/480x320/vb/500k|saveas/" + EncodedEntry("bucket", "a.mp4") +
+		";vframe/jpg/offset/10|saveas/" + EncodedEntry("bucket", "a.jpg") + ";vsample/jpg/interval/20"
+	if got := b.String(); got != want {
+		t.Fatalf("FopBuilder.String() = %s, want %s", got, want)
+	}
+
+	b = NewFopBuilder().Pipe(ImageView2{Mode: 1, Width: 100, Height: 100}, ImageWatermark{Image: "http://a.com/w.png"})
+	want = "http://a.com/k.jpg?imageView2/1/w/100/h/100|watermark/1/image/" + b64("http://a.com/w.png")
+	if got := b.URL("http://a.com/k.jpg"); got != want {
+		t.Fatalf("FopBuilder.URL() = %s, want %s", got, want)
+	}
+	if got := NewFopBuilder().URL("http://a.com/k.jpg"); got != "http://a.com/k.jpg" {
+		t.Fatalf("FopBuilder.URL() = %s", got)
+	}
+}
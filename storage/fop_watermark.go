@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var watermarkFillPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+func validGravity(gravity string) bool {
+	switch gravity {
+	case "", GravityNorthWest, GravityNorth, GravityNorthEast, GravityWest, GravityCenter, GravityEast,
+		GravitySouthWest, GravitySouth, GravitySouthEast:
+		return true
+	}
+	return false
+}
+
+// validateWatermarkPosition 检查水印共用的透明度、位置和边距参数
+func validateWatermarkPosition(dissolve int, gravity string, dx, dy int) error {
+	if dissolve < 0 || dissolve > 100 {
+		return errors.New("watermark: dissolve must be between 1 and 100")
+	}
+	if !validGravity(gravity) {
+		return errors.New("watermark: invalid gravity " + gravity)
+	}
+	if dx < 0 || dy < 0 {
+		return errors.New("watermark: dx and dy must not be negative")
+	}
+	return nil
+}
+
+func validWatermarkImageURL(image string) bool {
+	return strings.HasPrefix(image, "http://") || strings.HasPrefix(image, "https://") ||
+		strings.HasPrefix(image, "qiniu:///")
+}
+
+// Validate 检查图片水印的参数，Image 需要是 http，https 或者 KodoURL 生成的链接
+func (f ImageWatermark) Validate() error {
+	if !validWatermarkImageURL(f.Image) {
+		return errors.New("watermark: image must be an http, https or qiniu url")
+	}
+	if f.Scale < 0 || f.Scale > 1 {
+		return errors.New("watermark: scale must be between 0 and 1")
+	}
+	return validateWatermarkPosition(f.Dissolve, f.Gravity, f.Dx, f.Dy)
+}
+
+// Validate 检查文字水印的参数，Fill 需要是 #RRGGBB 格式的颜色
+func (f TextWatermark) Validate() error {
+	if f.Text == "" {
+		return errors.New("watermark: text is required")
+	}
+	if f.FontSize < 0 {
+		return errors.New("watermark: font size must not be negative")
+	}
+	if f.Fill != "" && !watermarkFillPattern.MatchString(f.Fill) {
+		return errors.New("watermark: fill must be a color like #FFFFFF")
+	}
+	return validateWatermarkPosition(f.Dissolve, f.Gravity, f.Dx, f.Dy)
+}
+
+// BlindWatermark 为盲水印指令 watermark/3，将肉眼不可见的文字或者图片嵌入到图片中，
+// 之后可以通过 BlindWatermarkDecode 提取出来用于追溯图片的来源。Text 和 Image 只能设置一个
+type BlindWatermark struct {
+	Text  string // 水印文字，会被 URL 安全的 Base64 编码
+	Image string // 水印图片的链接，会被 URL 安全的 Base64 编码
+}
+
+// Fop 返回处理指令
+func (f BlindWatermark) Fop() string {
+	var args fopArgs
+	args.addBase64("text", f.Text)
+	args.addBase64("image", f.Image)
+	return args.join("watermark", "3")
+}
+
+// Validate 检查盲水印的参数
+func (f BlindWatermark) Validate() error {
+	if f.Text == "" && f.Image == "" || f.Text != "" && f.Image != "" {
+		return errors.New("blind watermark: exactly one of text and image is required")
+	}
+	if f.Image != "" && !validWatermarkImageURL(f.Image) {
+		return errors.New("blind watermark: image must be an http, https or qiniu url")
+	}
+	return nil
+}
+
+// BlindWatermarkDecode 为盲水印提取指令 watermark/4，对添加过盲水印的图片执行，返回提取出的水印图片。
+// Original 为可选的添加水印之前的原图链接，提供之后提取的效果更好
+type BlindWatermarkDecode struct {
+	Original string
+}
+
+// Fop 返回处理指令
+func (f BlindWatermarkDecode) Fop() string {
+	var args fopArgs
+	args.addBase64("image", f.Original)
+	return args.join("watermark", "4")
+}
+
+// Validate 检查盲水印提取的参数
+func (f BlindWatermarkDecode) Validate() error {
+	if f.Original != "" && !validWatermarkImageURL(f.Original) {
+		return errors.New("blind watermark: original must be an http, https or qiniu url")
+	}
+	return nil
+}
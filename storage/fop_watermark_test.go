@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestWatermarkValidate(t *testing.T) {
+	cases := []struct {
+		fop   Fop
+		valid bool
+	}{
+		{ImageWatermark{Image: "https://a.com/logo.png", Dissolve: 80, Gravity: GravityNorthWest, Dx: 10, Scale: 0.2}, true},
+		{ImageWatermark{Image: KodoURL("bucket", "logo.png")}, true},
+		{ImageWatermark{Image: "logo.png"}, false},
+		{ImageWatermark{Image: "https://a.com/logo.png", Dissolve: 101}, false},
+		{ImageWatermark{Image: "https://a.com/logo.png", Gravity: "Middle"}, false},
+		{ImageWatermark{Image: "https://a.com/logo.png", Dx: -1}, false},
+		{ImageWatermark{Image: "https://a.com/logo.png", Scale: 1.5}, false},
+		{TextWatermark{Text: "七牛", Fill: "#ff0000", FontSize: 240}, true},
+		{TextWatermark{}, false},
+		{TextWatermark{Text: "七牛", Fill: "red"}, false},
+		{BlindWatermark{Text: "owner:123"}, true},
+		{BlindWatermark{}, false},
+		{BlindWatermark{Text: "a", Image: "https://a.com/w.png"}, false},
+		{BlindWatermarkDecode{}, true},
+		{BlindWatermarkDecode{Original: "ftp://a.com/o.jpg"}, false},
+	}
+	for i, c := range cases {
+		b := NewFopBuilder().Pipe(ImageView2{Mode: 2, Width: 100}, c.fop)
+		if err := b.Err(); (err == nil) != c.valid {
+			t.Errorf("case %d: FopBuilder.Err() = %v, valid %v", i, err, c.valid)
+		}
+	}
+
+	b64 := func(s string) string {
+		return base64.URLEncoding.EncodeToString([]byte(s))
+	}
+	if got := (BlindWatermark{Text: "owner:123"}).Fop(); got != "watermark/3/text/"+b64("owner:123") {
+		t.Fatalf("BlindWatermark.Fop() = %s", got)
+	}
+	if got := (BlindWatermarkDecode{Original: "https://a.com/o.jpg"}).Fop(); got != "watermark/4/image/"+b64("https://a.com/o.jpg") {
+		t.Fatalf("BlindWatermarkDecode.Fop() = %s", got)
+	}
+	if got := (ImageWatermark{Image: "https://a.com/w.png", Scale: 0.25}).Fop(); got != "watermark/1/image/"+b64("https://a.com/w.png")+"/ws/0.25" {
+		t.Fatalf("ImageWatermark.Fop() = %s", got)
+	}
+}
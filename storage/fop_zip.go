@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+)
+
+// MkzipEntry 为 mkzip 打包的一个文件
+type MkzipEntry struct {
+	URL   string // 文件的链接，空间中的文件可以使用 KodoURL 生成
+	Alias string // 可选。文件在压缩包中的路径，不设定则由链接决定
+}
+
+func (e MkzipEntry) args() fopArgs {
+	var args fopArgs
+	args.addBase64("url", e.URL)
+	args.addBase64("alias", e.Alias)
+	return args
+}
+
+// Mkzip 为多文件压缩指令 mkzip/2，文件的链接直接写在指令中，适合文件数量较少的场景，
+// 文件较多的时候使用 MkzipIndex 生成索引文件，对索引文件执行 MkzipWithIndex。
+// 参考 https://developer.qiniu.com/dora/manual/1667/mkzip
+type Mkzip struct {
+	Entries  []MkzipEntry
+	Encoding string // 可选。压缩包中文件名的编码，比如 gbk，不设定则为 utf-8
+}
+
+// Fop 返回处理指令，执行的时候作为 Pfop 的 key 的文件不会被打包
+func (f Mkzip) Fop() string {
+	var args fopArgs
+	args.addBase64("encoding", f.Encoding)
+	for _, e := range f.Entries {
+		args = append(args, e.args()...)
+	}
+	return args.join("mkzip", "2")
+}
+
+// MkzipWithIndex 为使用索引文件的多文件压缩指令 mkzip/4，需要对 MkzipIndex 生成的索引文件执行
+type MkzipWithIndex struct {
+	Encoding string // 可选。压缩包中文件名的编码，不设定则为 utf-8
+}
+
+// Fop 返回处理指令
+func (f MkzipWithIndex) Fop() string {
+	var args fopArgs
+	args.addBase64("encoding", f.Encoding)
+	return args.join("mkzip", "4")
+}
+
+// MkzipIndex 生成 MkzipWithIndex 使用的索引文件的内容，每行一个文件
+func MkzipIndex(entries []MkzipEntry) []byte {
+	var buf bytes.Buffer
+	for _, e := range entries {
+		buf.WriteString("/" + e.args().join() + "\n")
+	}
+	return buf.Bytes()
+}
+
+// Concat 为文件合并指令 concat，将 URLs 指向的文件按照顺序追加到执行 Pfop 的 key 的后面
+type Concat struct {
+	MimeType string   // 合并之后的文件的 MIME 类型
+	URLs     []string // 追加的文件的链接，空间中的文件可以使用 KodoURL 生成
+}
+
+// Fop 返回处理指令
+func (f Concat) Fop() string {
+	var args fopArgs
+	args.addBase64("mimeType", f.MimeType)
+	for _, u := range f.URLs {
+		args = append(args, base64.URLEncoding.EncodeToString([]byte(u)))
+	}
+	return args.join("concat")
+}
+
+// KodoURL 返回 bucket 中的 key 在数据处理中使用的链接，私有空间的文件也不需要签名
+func KodoURL(bucket, key string) string {
+	return "qiniu:///" + bucket + "/" + key
+}
+
+// ErrNoZipObjects 表示 ZipObjects 没有指定需要打包的文件
+var ErrNoZipObjects = errors.New("zip objects: no keys")
+
+// mkzip/2 的指令中直接包含的最多文件数量，超过之后上传索引文件
+const maxMkzipInlineEntries = 50
+
+// ZipObjects 将 bucket 中的 keys 打包保存为 bucket 中的 targetKey，压缩包中的路径和 key 相同，并等待打包完成。
+// 文件较多的时候先上传索引文件 targetKey + ".index"，打包完成之后不会删除。
+// 打包失败的时候返回 PrefopRet.Err()
+func (m *OperationManager) ZipObjects(ctx context.Context, bucket string, keys []string, targetKey string) (ret PrefopRet, err error) {
+	if len(keys) == 0 {
+		err = ErrNoZipObjects
+		return
+	}
+	entries := make([]MkzipEntry, len(keys))
+	for i, key := range keys {
+		entries[i] = MkzipEntry{URL: KodoURL(bucket, key), Alias: key}
+	}
+
+	srcKey := keys[0]
+	b := NewFopBuilder()
+	if len(entries) <= maxMkzipInlineEntries {
+		b.Pipe(Mkzip{Entries: entries})
+	} else {
+		srcKey = targetKey + ".index"
+		if err = m.putMkzipIndex(ctx, bucket, srcKey, MkzipIndex(entries)); err != nil {
+			return
+		}
+		b.Pipe(MkzipWithIndex{})
+	}
+	fops := b.SaveAs(bucket, targetKey).String()
+
+	persistentID, err := m.PfopContext(ctx, bucket, srcKey, fops, "", "", false)
+	if err != nil {
+		return
+	}
+	if ret, err = m.WaitForPfop(ctx, persistentID, 0); err != nil {
+		return
+	}
+	err = ret.Err()
+	return
+}
+
+func (m *OperationManager) putMkzipIndex(ctx context.Context, bucket, key string, data []byte) error {
+	putPolicy := PutPolicy{Scope: bucket + ":" + key}
+	uploader := NewFormUploaderEx(m.Cfg, m.Client)
+	return uploader.Put(ctx, nil, putPolicy.UploadToken(m.mac()), key, bytes.NewReader(data), int64(len(data)), nil)
+}
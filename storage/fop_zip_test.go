@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMkzipAndConcat(t *testing.T) {
+	b64 := func(s string) string {
+		return base64.URLEncoding.EncodeToString([]byte(s))
+	}
+	entries := []MkzipEntry{
+		{URL: "http://a.com/1.jpg", Alias: "图片/1.jpg"},
+		{URL: KodoURL("bucket", "2.jpg")},
+	}
+	want := "mkzip/2/encoding/" + b64("gbk") + "/url/" + b64("http://a.com/1.jpg") + "/alias/" + b64("图片/1.jpg") +
+		"/url/" + b64("qiniu:///bucket/2.jpg")
+	if got := (Mkzip{Entries: entries, Encoding: "gbk"}).Fop(); got != want {
+		t.Fatalf("Mkzip.Fop() = %s, want %s", got, want)
+	}
+	want = "/url/" + b64("http://a.com/1.jpg") + "/alias/" + b64("图片/1.jpg") + "\n/url/" + b64("qiniu:///bucket/2.jpg") + "\n"
+	if got := string(MkzipIndex(entries)); got != want {
+		t.Fatalf("MkzipIndex() = %s, want %s", got, want)
+	}
+	if got := (MkzipWithIndex{}).Fop(); got != "mkzip/4" {
+		t.Fatalf("MkzipWithIndex.Fop() = %s", got)
+	}
+	want = "concat/mimeType/" + b64("video/mp4") + "/" + b64("http://a.com/2.mp4") + "/" + b64("http://a.com/3.mp4")
+	if got := (Concat{MimeType: "video/mp4", URLs: []string{"http://a.com/2.mp4", "http://a.com/3.mp4"}}).Fop(); got != want {
+		t.Fatalf("Concat.Fop() = %s, want %s", got, want)
+	}
+}
+
+func TestZipObjects(t *testing.T) {
+	var mu sync.Mutex
+	var pfops []url.Values
+	var index string
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/pfop/":
+			req.ParseForm()
+			pfops = append(pfops, req.PostForm)
+			w.Write([]byte(`{"persistentId":"z0.zip"}`))
+		case "/status/get/prefop":
+			if fail {
+				w.Write([]byte(`{"id":"z0.zip","code":3,"items":[{"cmd":"mkzip/2","code":3,"error":"bad url"}]}`))
+				return
+			}
+			w.Write([]byte(`{"id":"z0.zip","code":0,"items":[{"cmd":"mkzip/2","code":0,"key":"a.zip"}]}`))
+		case "/":
+			file, _, err := req.FormFile("file")
+			if err != nil || req.FormValue("key") != "big.zip.index" {
+				http.Error(w, "bad upload", http.StatusBadRequest)
+				return
+			}
+			data, _ := ioutil.ReadAll(file)
+			index = string(data)
+			w.Write([]byte(`{"key":"big.zip.index","hash":"h"}`))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	host := server.URL
+	m := NewOperationManager(mac, &Config{Zone: &Zone{ApiHost: host, SrcUpHosts: []string{host}}})
+	if _, err := m.ZipObjects(context.Background(), "bucket", nil, "a.zip"); err != ErrNoZipObjects {
+		t.Fatalf("ZipObjects() should fail without keys, %v", err)
+	}
+
+	ret, err := m.ZipObjects(context.Background(), "bucket", []string{"1.jpg", "2.jpg"}, "a.zip")
+	if err != nil || ret.Code != PfopStatusSuccess {
+		t.Fatalf("ZipObjects() error, %v, %v", err, ret)
+	}
+	want := Mkzip{Entries: []MkzipEntry{
+		{URL: KodoURL("bucket", "1.jpg"), Alias: "1.jpg"},
+		{URL: KodoURL("bucket", "2.jpg"), Alias: "2.jpg"},
+	}}.Fop() + "|" + SaveAs("bucket", "a.zip").Fop()
+	if pfops[0].Get("key") != "1.jpg" || pfops[0].Get("fops") != want {
+		t.Fatalf("ZipObjects() wrong pfop params, %v", pfops[0])
+	}
+
+	keys := make([]string, maxMkzipInlineEntries+1)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%d.jpg", i)
+	}
+	if _, err = m.ZipObjects(context.Background(), "bucket", keys, "big.zip"); err != nil {
+		t.Fatalf("ZipObjects() error, %v", err)
+	}
+	if pfops[1].Get("key") != "big.zip.index" || !strings.HasPrefix(pfops[1].Get("fops"), "mkzip/4|saveas/") ||
+		strings.Count(index, "\n") != len(keys) {
+		t.Fatalf("ZipObjects() should use index file, %v, %s", pfops[1], index)
+	}
+
+	fail = true
+	if _, err = m.ZipObjects(context.Background(), "bucket", keys[:1], "a.zip"); err == nil || !strings.Contains(err.Error(), "bad url") {
+		t.Fatalf("ZipObjects() should fail, %v", err)
+	}
+}
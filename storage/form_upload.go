@@ -3,6 +3,7 @@ package storage
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"hash"
 	"hash/crc32"
@@ -28,20 +29,57 @@ type PutExtra struct {
 
 	// 上传事件：进度通知。这个事件的回调函数应该尽可能快地结束。
 	OnProgress func(fsize, uploaded int64)
+
+	// 可选，用户自定义的文件元数据，上传的时候作为 "x-qn-meta-" 开头的参数发送。key 可以省略 "x-qn-meta-" 前缀，值为空的时候忽略。
+	Metadata map[string]string
+
+	// 可选，上传限速，单位为字节每秒，为 0 表示不限速。
+	RateLimit int64
+
+	// 可选，上传成功之后检查返回的 hash 和本地计算的 etag 是否一致，不一致的时候返回 ErrUnmatchedEtag。
+	// 需要上传返回的内容中包含 hash 字段，自定义了 returnBody 的时候需要包含 "hash":"$(etag)"。
+	VerifyEtag bool
+
+	// 可选，上传之前使用 BucketManager 查询 key 是否已经存在，大小和 hash 都与本地计算的 etag 一致的时候跳过上传，
+	// 这时 ret 中只会填充 key 和 hash 字段。只在指定了 key 的上传中生效，数据需要实现 io.ReaderAt（比如 PutFile）
+	SkipIfExists bool
+
+	// 可选，设置了 SkipIfExists 的时候用来查询 key 是否已经存在
+	BucketManager *BucketManager
 }
 
-// PutRet 为七牛标准的上传回复内容。
-// 如果使用了上传回调或者自定义了returnBody，那么需要根据实际情况，自己自定义一个返回值结构体
+// PutRet 为七牛标准的上传回复内容，标准的回复只包括 Hash、PersistentID 和 Key。
+// 上传策略的 returnBody 设置为 PutRetReturnBody 生成的模板的时候其它的字段也会被填充；
+// 如果使用了上传回调或者自定义了其它格式的returnBody，那么需要根据实际情况，自己自定义一个返回值结构体
 type PutRet struct {
 	Hash         string `json:"hash"`
 	PersistentID string `json:"persistentId"`
 	Key          string `json:"key"`
+
+	Fsize     int64         `json:"fsize,omitempty"`
+	Bucket    string        `json:"bucket,omitempty"`
+	Name      string        `json:"name,omitempty"` // 上传的原始文件名，即魔法变量 $(fname)
+	MimeType  string        `json:"mimeType,omitempty"`
+	ImageInfo *ImageInfo    `json:"imageInfo,omitempty"` // 图片的基本信息，上传的文件不是图片的时候为 nil
+	Avinfo    *PutRetAvinfo `json:"avinfo,omitempty"`    // 音视频的元信息，上传的文件不是音视频的时候为 nil
 }
 
 // FormUploader 表示一个表单上传的对象
 type FormUploader struct {
 	Client *Client
 	Cfg    *Config
+
+	// 可选。上传域名的探测结果，设置之后优先使用延迟最低的可用域名
+	HostProber *UpHostProber
+
+	// 可选。失败之后的重试策略，不设定则使用 DefaultRetryPolicy。只有 data 实现了 io.Seeker 的时候才会重试，比如 PutFile 打开的文件
+	RetryPolicy RetryPolicy
+
+	// 可选。记录上传次数、数据量、分片耗时和重试次数的对象，不设定则不记录
+	Metrics Metrics
+
+	// 可选。为每个请求创建 span 的对象，不设定则不创建
+	Tracer Tracer
 }
 
 // NewFormUploader 用来构建一个表单上传的对象
@@ -160,9 +198,29 @@ func (p *FormUploader) put(
 	ctx context.Context, ret interface{}, uptoken string,
 	key string, hasKey bool, data io.Reader, size int64, extra *PutExtra, fileName string) (err error) {
 
-	var upHost string
+	if extra == nil {
+		extra = &PutExtra{}
+	}
+	ctx = traceUpload(ctx, p.Tracer, uptoken, key, hasKey)
+	done := recordUploadStart(p.Metrics, methodForm)
+	defer func() { done(err) }()
+
+	if err = checkPutPolicy(uptoken, size, extra.MimeType); err != nil {
+		return
+	}
+
+	if extra.SkipIfExists && hasKey {
+		if ra, ok := data.(io.ReaderAt); ok {
+			skipped, sErr := skipIfExists(extra.BucketManager, ret, uptoken, key, ra, size)
+			if sErr != nil || skipped {
+				return sErr
+			}
+		}
+	}
+
+	var upHosts []string
 	if extra.UpHost != "" {
-		upHost = extra.UpHost
+		upHosts = []string{extra.UpHost}
 	} else {
 		ak, bucket, gErr := getAkBucketFromUploadToken(uptoken)
 		if gErr != nil {
@@ -170,22 +228,72 @@ func (p *FormUploader) put(
 			return
 		}
 
-		upHost, err = p.UpHost(ak, bucket)
-		if err != nil {
+		hosts, hErr := getUpHosts(p.Cfg, p.Client, ak, bucket)
+		if hErr != nil {
+			err = hErr
+			return
+		}
+		upHosts = orderUpHosts(hosts, p.HostProber)
+	}
+
+	// 重试的时候需要从头读取 data，切换到下一个上传域名
+	seeker, _ := data.(io.Seeker)
+	var start int64
+	if seeker != nil {
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			seeker, err = nil, nil
+		}
+	}
+	policy := retryPolicyOrDefault(p.RetryPolicy)
+	for attempt := 1; ; attempt++ {
+		upHost := upHosts[(attempt-1)%len(upHosts)]
+		err = p.putOnce(ctx, ret, upHost, uptoken, key, hasKey, data, size, extra, fileName)
+		if err == nil {
+			recordUploadedBytes(p.Metrics, methodForm, upHost, size, nil)
+			break
+		}
+		if shouldFreezeHost(err) {
+			upHostFreezer.freeze(upHost, HostFreezeDuration)
+		}
+		if seeker == nil || ctx.Err() != nil || attempt >= defaultTryTimes {
+			return
+		}
+		retry, delay := policy.Retry(attempt, err)
+		if !retry || sleepContext(ctx, delay) != nil {
+			return
+		}
+		if _, sErr := seeker.Seek(start, io.SeekStart); sErr != nil {
 			return
 		}
+		recordRetry(p.Metrics, methodForm)
 	}
+	if extra.OnProgress != nil {
+		extra.OnProgress(size, size)
+	}
+	return
+}
 
+// putOnce 向 upHost 发送一次表单上传的请求
+func (p *FormUploader) putOnce(
+	ctx context.Context, ret interface{}, upHost, uptoken string,
+	key string, hasKey bool, data io.Reader, size int64, extra *PutExtra, fileName string) (err error) {
+
+	// 只有 multipart 的表单字段和文件头部写入内存，文件内容在发送请求的时候从 data 中流式读取，
+	// 所以上传的时候不需要将整个文件读入内存
 	var b bytes.Buffer
 	writer := multipart.NewWriter(&b)
 
-	if extra == nil {
-		extra = &PutExtra{}
+	if extra.RateLimit > 0 {
+		data = limitReader(ctx, data, newRateLimiter(extra.RateLimit))
 	}
-
 	if extra.OnProgress != nil {
 		data = &readerWithProgress{reader: data, fsize: size, onProgress: extra.OnProgress}
 	}
+	var hasher *etagHasher
+	if extra.VerifyEtag {
+		hasher = newEtagHasher()
+		data = io.TeeReader(data, hasher)
+	}
 
 	err = writeMultipart(writer, uptoken, key, hasKey, extra, fileName)
 	if err != nil {
@@ -224,14 +332,15 @@ func (p *FormUploader) put(
 	contentType := writer.FormDataContentType()
 	headers := http.Header{}
 	headers.Add("Content-Type", contentType)
-	err = p.Client.CallWith64(ctx, ret, "POST", upHost, headers, mr, bodyLen)
-	if err != nil {
-		return
-	}
-	if extra.OnProgress != nil {
-		extra.OnProgress(size, size)
+	if hasher != nil {
+		var respData json.RawMessage
+		err = p.Client.CallWith64(ctx, &respData, "POST", upHost, headers, mr, bodyLen)
+		if err == nil {
+			err = decodeAndVerifyEtag(respData, ret, hasher.Etag())
+		}
+	} else {
+		err = p.Client.CallWith64(ctx, ret, "POST", upHost, headers, mr, bodyLen)
 	}
-
 	return
 }
 
@@ -272,30 +381,7 @@ func (r crc32Reader) length() (length int64) {
 }
 
 func (p *FormUploader) UpHost(ak, bucket string) (upHost string, err error) {
-	var zone *Zone
-	if p.Cfg.Zone != nil {
-		zone = p.Cfg.Zone
-	} else {
-		if v, zoneErr := GetZone(ak, bucket); zoneErr != nil {
-			err = zoneErr
-			return
-		} else {
-			zone = v
-		}
-	}
-
-	scheme := "http://"
-	if p.Cfg.UseHTTPS {
-		scheme = "https://"
-	}
-
-	host := zone.SrcUpHosts[0]
-	if p.Cfg.UseCdnDomains {
-		host = zone.CdnUpHosts[0]
-	}
-
-	upHost = fmt.Sprintf("%s%s", scheme, host)
-	return
+	return getUpHost(p.Cfg, p.Client, ak, bucket)
 }
 
 type readerWithProgress struct {
@@ -342,6 +428,15 @@ func writeMultipart(writer *multipart.Writer, uptoken, key string, hasKey bool,
 		}
 	}
 
+	//extra.Metadata
+	for k, v := range extra.Metadata {
+		if v != "" {
+			if err = writer.WriteField(metadataKey(k), v); err != nil {
+				return
+			}
+		}
+	}
+
 	return err
 }
 
@@ -1,11 +1,17 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 )
 
@@ -29,3 +35,90 @@ func TestFormUploadPutFile(t *testing.T) {
 	}
 	t.Logf("Key: %s, Hash:%s", putRet.Key, putRet.Hash)
 }
+
+func TestWriteMultipartMetadata(t *testing.T) {
+	var b bytes.Buffer
+	writer := multipart.NewWriter(&b)
+	extra := PutExtra{Metadata: map[string]string{"author": "qiniu", "x-qn-meta-type": "doc", "empty": ""}}
+	if err := writeMultipart(writer, "token", "key", true, &extra, "file"); err != nil {
+		t.Fatalf("writeMultipart() error, %s", err)
+	}
+	writer.Close()
+
+	form, err := multipart.NewReader(&b, writer.Boundary()).ReadForm(1024)
+	if err != nil {
+		t.Fatalf("ReadForm() error, %s", err)
+	}
+	if v := form.Value["x-qn-meta-author"]; len(v) != 1 || v[0] != "qiniu" {
+		t.Fatalf("writeMultipart() error, x-qn-meta-author = %v", v)
+	}
+	if v := form.Value["x-qn-meta-type"]; len(v) != 1 || v[0] != "doc" {
+		t.Fatalf("writeMultipart() error, x-qn-meta-type = %v", v)
+	}
+	if _, ok := form.Value["x-qn-meta-empty"]; ok {
+		t.Fatalf("writeMultipart() error, empty metadata should be ignored")
+	}
+}
+
+type countingTransport struct {
+	requests int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.requests, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNewClientTransport(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+	ucServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ttl":600,"io":{"src":{"main":["io.kodo.example.com"]}},"up":{}}`))
+	}))
+	defer ucServer.Close()
+	defer func() {
+		zoneMutext.Lock()
+		delete(zoneCache, ucServer.URL+":"+mac.AccessKey+":client-bucket")
+		zoneMutext.Unlock()
+	}()
+
+	tr := &countingTransport{}
+	client := NewClient(tr)
+	uploader := NewFormUploaderEx(&Config{Zone: &Zone{SrcUpHosts: []string{server.URL}}}, client)
+	var putRet PutRet
+	if err := uploader.Put(context.Background(), &putRet, (&PutPolicy{Scope: "bucket"}).UploadToken(mac), "client", bytes.NewReader([]byte("data")), 4, nil); err != nil {
+		t.Fatalf("FormUploader#Put() error, %s", err)
+	}
+	if n := atomic.LoadInt32(&tr.requests); n != 1 {
+		t.Fatalf("FormUploader#Put() should use the custom transport, requests = %d", n)
+	}
+
+	// 查询机房信息也通过自定义的 Client 发送
+	bucketManager := NewBucketManagerEx(mac, &Config{UcHost: ucServer.URL}, client)
+	if zone, err := bucketManager.Zone("client-bucket"); err != nil || zone.IovipHost != "io.kodo.example.com" {
+		t.Fatalf("BucketManager#Zone() = %v, %v", zone, err)
+	}
+	if n := atomic.LoadInt32(&tr.requests); n != 2 {
+		t.Fatalf("BucketManager#Zone() should use the custom transport, requests = %d", n)
+	}
+}
+
+func TestFormUploadPutStream(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	data := make([]byte, 3*1024*1024+5)
+	rand.Read(data)
+
+	// 只实现了 io.Reader 的数据也能够设置正确的 Content-Length 并流式上传
+	var putRet PutRet
+	reader := struct{ io.Reader }{bytes.NewReader(data)}
+	err := formUploader.Put(context.Background(), &putRet, "token", "stream", reader, int64(len(data)), &PutExtra{UpHost: server.URL})
+	if err != nil {
+		t.Fatalf("FormUploader#Put() error, %s", err)
+	}
+	if !bytes.Equal(server.file("stream"), data) {
+		t.Fatalf("FormUploader#Put() error, uploaded data mismatch")
+	}
+}
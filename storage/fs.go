@@ -0,0 +1,226 @@
+//go:build go1.16
+// +build go1.16
+
+package storage
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BucketFS 将空间中的文件以 fs.FS 的方式提供，key 中的 "/" 作为目录分隔符，
+// 可以用于 http.FileServer(http.FS(fsys))，template.ParseFS 等使用 fs.FS 的场景。
+// 文件内容通过 Downloader.Open 读取，目录通过 delimiter 为 "/" 的列举实现。
+type BucketFS struct {
+	bm         *BucketManager
+	downloader *Downloader
+	bucket     string
+	domain     string
+}
+
+// NewFS 用来构建一个空间的 fs.FS，domain 为空间绑定的域名，比如 "https://cdn.example.com"，
+// 下载链接使用 bucketManager 的密钥签名，可以同时用于公开空间和私有空间
+func NewFS(bucketManager *BucketManager, bucket, domain string) *BucketFS {
+	return &BucketFS{
+		bm:         bucketManager,
+		downloader: NewDownloaderEx(bucketManager.mac(), bucketManager.Client),
+		bucket:     bucket,
+		domain:     domain,
+	}
+}
+
+// Open 打开文件或者目录，实现 fs.FS
+func (fsys *BucketFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	info, err := fsys.stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if info.IsDir() {
+		return &bucketDir{fsys: fsys, name: name, info: info}, nil
+	}
+	r, err := fsys.downloader.Open(context.Background(), fsys.domain, name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &bucketFile{ObjectReader: r, info: info}, nil
+}
+
+// Stat 返回文件或者目录的信息，实现 fs.StatFS
+func (fsys *BucketFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	info, err := fsys.stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return info, nil
+}
+
+// ReadDir 返回目录中的文件和子目录，按照名称排序，实现 fs.ReadDirFS
+func (fsys *BucketFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entries, err := fsys.readDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+func dirPrefix(name string) string {
+	if name == "." {
+		return ""
+	}
+	return name + "/"
+}
+
+// stat 先查询 name 对应的文件，不存在的时候检查是否有以 name + "/" 开头的文件，有则认为是目录
+func (fsys *BucketFS) stat(name string) (info *bucketFileInfo, err error) {
+	if name == "." {
+		return &bucketFileInfo{name: ".", dir: true}, nil
+	}
+	fi, err := fsys.bm.Stat(fsys.bucket, name)
+	if err == nil {
+		return &bucketFileInfo{name: path.Base(name), size: fi.Fsize, putTime: fi.PutTime}, nil
+	}
+	if ei, ok := err.(*ErrorInfo); !ok || ei.Code != 612 {
+		return
+	}
+	entries, _, _, _, err := fsys.bm.ListFilesContext(context.Background(), fsys.bucket, dirPrefix(name), "", "", 1)
+	if err != nil {
+		return
+	}
+	if len(entries) == 0 {
+		err = fs.ErrNotExist
+		return
+	}
+	return &bucketFileInfo{name: path.Base(name), dir: true}, nil
+}
+
+func (fsys *BucketFS) readDir(name string) (entries []fs.DirEntry, err error) {
+	prefix := dirPrefix(name)
+	it := fsys.bm.ListIterator(context.Background(), fsys.bucket, prefix, "/", "", 1000)
+	for it.Next() {
+		item := it.Item()
+		// 以 "/" 结尾的 key 通常是控制台创建的空目录，不作为文件返回
+		if item.Key == prefix || strings.HasSuffix(item.Key, "/") {
+			continue
+		}
+		entries = append(entries, &bucketFileInfo{
+			name:    strings.TrimPrefix(item.Key, prefix),
+			size:    item.Fsize,
+			putTime: item.PutTime,
+		})
+	}
+	if err = it.Err(); err != nil {
+		return
+	}
+	for _, p := range it.CommonPrefixes() {
+		entries = append(entries, &bucketFileInfo{
+			name: strings.TrimSuffix(strings.TrimPrefix(p, prefix), "/"),
+			dir:  true,
+		})
+	}
+	if len(entries) == 0 && name != "." {
+		if _, err = fsys.stat(name); err != nil {
+			return
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return
+}
+
+// bucketFileInfo 实现 fs.FileInfo 和 fs.DirEntry
+type bucketFileInfo struct {
+	name    string
+	size    int64
+	putTime int64 // 单位为 100 纳秒
+	dir     bool
+}
+
+func (fi *bucketFileInfo) Name() string { return fi.name }
+func (fi *bucketFileInfo) Size() int64  { return fi.size }
+func (fi *bucketFileInfo) IsDir() bool  { return fi.dir }
+func (fi *bucketFileInfo) Sys() interface{} {
+	return nil
+}
+
+func (fi *bucketFileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (fi *bucketFileInfo) ModTime() time.Time {
+	if fi.putTime == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, fi.putTime*100)
+}
+
+func (fi *bucketFileInfo) Type() fs.FileMode          { return fi.Mode().Type() }
+func (fi *bucketFileInfo) Info() (fs.FileInfo, error) { return fi, nil }
+
+// bucketFile 为打开的文件，支持 Seek 和 ReadAt，http.FileServer 可以直接处理 Range 请求
+type bucketFile struct {
+	*ObjectReader
+	info *bucketFileInfo
+}
+
+func (f *bucketFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// bucketDir 为打开的目录，实现 fs.ReadDirFile
+type bucketDir struct {
+	fsys    *BucketFS
+	name    string
+	info    *bucketFileInfo
+	entries []fs.DirEntry
+	loaded  bool
+}
+
+func (d *bucketDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *bucketDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: fs.ErrInvalid}
+}
+
+func (d *bucketDir) Close() error {
+	return nil
+}
+
+// ReadDir 按照 fs.ReadDirFile 的约定返回目录中的文件，n 小于等于 0 的时候返回剩余的全部文件
+func (d *bucketDir) ReadDir(n int) (entries []fs.DirEntry, err error) {
+	if !d.loaded {
+		if d.entries, err = d.fsys.readDir(d.name); err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: err}
+		}
+		d.loaded = true
+	}
+	if n <= 0 {
+		entries, d.entries = d.entries, nil
+		return
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries, d.entries = d.entries[:n], d.entries[n:]
+	return
+}
@@ -0,0 +1,103 @@
+//go:build go1.16
+// +build go1.16
+
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestBucketFS(t *testing.T) {
+	files := map[string]string{
+		"index.html":       "<html></html>",
+		"css/site.css":     "body {}",
+		"css/img/logo.png": "png",
+		"docs/":            "",
+		"docs/readme.md":   "# readme",
+	}
+	keys := make([]string, 0, len(files))
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case strings.HasPrefix(req.URL.Path, "/stat/"):
+			entry, _ := base64.URLEncoding.DecodeString(strings.TrimPrefix(req.URL.Path, "/stat/"))
+			content, ok := files[strings.TrimPrefix(string(entry), "bucket:")]
+			w.Header().Set("Content-Type", "application/json")
+			if !ok {
+				w.WriteHeader(612)
+				w.Write([]byte(`{"error":"no such file or directory"}`))
+				return
+			}
+			json.NewEncoder(w).Encode(FileInfo{Fsize: int64(len(content)), PutTime: 15000000000000000})
+		case req.URL.Path == "/list":
+			query := req.URL.Query()
+			prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+			ret := listFilesRet{}
+			seen := map[string]bool{}
+			for _, key := range keys {
+				if !strings.HasPrefix(key, prefix) {
+					continue
+				}
+				rest := key[len(prefix):]
+				if idx := strings.Index(rest, "/"); delimiter == "/" && idx >= 0 {
+					dir := prefix + rest[:idx+1]
+					if !seen[dir] {
+						seen[dir] = true
+						ret.CommonPrefixes = append(ret.CommonPrefixes, dir)
+					}
+					continue
+				}
+				ret.Items = append(ret.Items, ListItem{Key: key, Fsize: int64(len(files[key])), PutTime: 15000000000000000})
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(ret)
+		default:
+			content, ok := files[strings.TrimPrefix(req.URL.Path, "/")]
+			if !ok {
+				http.NotFound(w, req)
+				return
+			}
+			http.ServeContent(w, req, req.URL.Path, time.Time{}, bytes.NewReader([]byte(content)))
+		}
+	}))
+	defer server.Close()
+
+	host := server.URL
+	bucketManager := NewBucketManager(mac, &Config{RsHost: host, RsfHost: host})
+	fsys := NewFS(bucketManager, "bucket", server.URL)
+
+	if err := fstest.TestFS(fsys, "index.html", "css/site.css", "css/img/logo.png", "docs/readme.md"); err != nil {
+		t.Fatalf("BucketFS error, %s", err)
+	}
+
+	content, err := fs.ReadFile(fsys, "css/site.css")
+	if err != nil || string(content) != "body {}" {
+		t.Fatalf("fs.ReadFile() error, %v, %s", err, content)
+	}
+	entries, err := fs.ReadDir(fsys, "docs")
+	if err != nil || len(entries) != 1 || entries[0].Name() != "readme.md" {
+		t.Fatalf("fs.ReadDir() error, %v, %v", err, entries)
+	}
+	if _, err = fs.Stat(fsys, "missing"); !errorsIsNotExist(err) {
+		t.Fatalf("fs.Stat() should fail with fs.ErrNotExist, %v", err)
+	}
+}
+
+func errorsIsNotExist(err error) bool {
+	pe, ok := err.(*fs.PathError)
+	return ok && pe.Err == fs.ErrNotExist
+}
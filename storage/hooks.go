@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"net/http"
+	"time"
+)
+
+// Hooks 为 Client 发送每个请求前后调用的回调，设置到 Client.Hooks 之后通过该 Client 上传、下载和管理资源的请求都会调用，
+// 可以用来统计请求的耗时和错误、记录审计日志或者修改请求，比如：
+//
+//	client := storage.NewClient(nil)
+//	client.Hooks = &storage.Hooks{OnResponse: func(req *http.Request, resp *http.Response, elapsed time.Duration, err error) { ... }}
+//	uploader := storage.NewUploaderEx(&cfg, client)
+//
+// 回调会被并行上传的多个 goroutine 同时调用，实现的时候需要注意并发安全
+type Hooks struct {
+	// 可选。发送请求之前调用，可以修改 req 的 Header 等内容。修改签名过的内容（比如 URL）会导致服务端鉴权失败。不设定则不调用
+	OnRequest func(req *http.Request)
+
+	// 可选。收到响应或者请求失败之后调用，elapsed 为从发送请求到收到响应 Header 的时间，err 不为 nil 的时候 resp 为 nil。
+	// 不要在回调中读取或者关闭 resp.Body。不设定则不调用
+	OnResponse func(req *http.Request, resp *http.Response, elapsed time.Duration, err error)
+}
+
+// beforeRequest 在 h 不为 nil 的时候调用 OnRequest
+func (h *Hooks) beforeRequest(req *http.Request) {
+	if h != nil && h.OnRequest != nil {
+		h.OnRequest(req)
+	}
+}
+
+// afterResponse 在 h 不为 nil 的时候调用 OnResponse
+func (h *Hooks) afterResponse(req *http.Request, resp *http.Response, start time.Time, err error) {
+	if h != nil && h.OnResponse != nil {
+		h.OnResponse(req, resp, time.Since(start), err)
+	}
+}
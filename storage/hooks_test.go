@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClientHooks(t *testing.T) {
+	upServer := newFakeUpServer()
+	defer upServer.Close()
+	var mu sync.Mutex
+	var traced, requests, responses, failures int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		if req.Header.Get("X-Trace-Id") == "trace" {
+			traced++
+		}
+		mu.Unlock()
+		upServer.serveHTTP(w, req)
+	}))
+	defer server.Close()
+
+	client := NewClient(nil)
+	client.Hooks = &Hooks{
+		OnRequest: func(req *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			requests++
+			req.Header.Set("X-Trace-Id", "trace")
+		},
+		OnResponse: func(req *http.Request, resp *http.Response, elapsed time.Duration, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			responses++
+			if err != nil {
+				failures++
+			} else if resp.Request != req || elapsed < 0 {
+				t.Errorf("OnResponse() with unexpected response %v, %s", resp.Request, elapsed)
+			}
+		},
+	}
+
+	uploader := NewUploaderEx(nil, client)
+	data := make([]byte, 5*1024*1024)
+	var putRet PutRet
+	err := uploader.Resume.Put(context.Background(), &putRet, "token", "hooks", bytes.NewReader(data), int64(len(data)), &RputExtra{UpHost: server.URL})
+	if err != nil || !bytes.Equal(upServer.file("hooks"), data) {
+		t.Fatalf("ResumeUploader#Put() error, %v", err)
+	}
+	if requests == 0 || requests != responses || traced != requests || failures != 0 {
+		t.Fatalf("requests = %d, responses = %d, traced = %d, failures = %d", requests, responses, traced, failures)
+	}
+
+	requests, responses = 0, 0
+	resp, err := client.DoRequest(context.Background(), "GET", "http://127.0.0.1:1/", nil)
+	if err == nil {
+		closeResponse(resp)
+	}
+	if requests != 1 || responses != 1 || failures != 1 {
+		t.Fatalf("Hooks should be called on error, requests = %d, responses = %d, failures = %d", requests, responses, failures)
+	}
+}
@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostFreezeDuration 为上传域名返回 5xx 错误或者无法连接之后被冻结的时间，冻结期间优先使用其它的上传域名
+var HostFreezeDuration = 10 * time.Minute
+
+// hostFreezer 记录被冻结的上传域名，所有的上传对象共用同一个冻结列表
+type hostFreezer struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+var upHostFreezer = &hostFreezer{until: make(map[string]time.Time)}
+
+// freeze 冻结 host，d 时间之后自动解冻
+func (f *hostFreezer) freeze(host string, d time.Duration) {
+	f.mu.Lock()
+	f.until[hostKey(host)] = time.Now().Add(d)
+	f.mu.Unlock()
+}
+
+// frozen 返回 host 是否处于冻结状态
+func (f *hostFreezer) frozen(host string) bool {
+	key := hostKey(host)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	until, ok := f.until[key]
+	if ok && !time.Now().Before(until) {
+		delete(f.until, key)
+		return false
+	}
+	return ok
+}
+
+// shouldFreezeHost 判断 err 是否说明上传域名不可用，5xx 错误和网络错误需要冻结域名。
+// 579 为上传成功之后回调业务服务器失败，和上传域名无关
+func shouldFreezeHost(err error) bool {
+	switch e := err.(type) {
+	case *ErrorInfo:
+		return e.Code/100 == 5 && e.Code != 579
+	case net.Error:
+		return true
+	}
+	return false
+}
+
+// hostKey 去掉域名中的协议，同一个域名使用 http 和 https 访问的时候共用冻结状态和探测结果
+func hostKey(host string) string {
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	return strings.TrimRight(host, "/")
+}
+
+// UpHostProber 在后台定期探测上传域名的延迟和可用性，设置到 FormUploader.HostProber 或者 ResumeUploader.HostProber 之后，
+// 每次上传优先使用延迟最低的可用域名，无法访问或者返回 5xx 错误的域名排在最后。
+// 同一个 UpHostProber 可以在多个上传对象之间共用
+type UpHostProber struct {
+	Client   *http.Client  // 可选。发送探测请求的客户端，不设定则使用 http.DefaultClient
+	Interval time.Duration // 可选。探测的间隔，不设定则为1分钟
+	Timeout  time.Duration // 可选。每次探测的超时时间，不设定则为5秒
+
+	hosts    []string
+	useHTTPS bool
+
+	mu      sync.RWMutex
+	stats   map[string]hostStat
+	started bool
+	stop    chan struct{}
+}
+
+type hostStat struct {
+	latency time.Duration
+	healthy bool
+}
+
+// NewUpHostProber 用来构建一个探测 hosts 的对象，hosts 为上传域名，比如 "https://upload.qiniup.com"，没有协议的时候使用 https
+func NewUpHostProber(hosts []string) *UpHostProber {
+	return NewUpHostProberEx(hosts, nil)
+}
+
+// NewUpHostProberEx 和 NewUpHostProber 一样用来构建一个探测 hosts 的对象，
+// 没有协议的域名和上传时一样根据 cfg 决定使用 http 还是 https，cfg 为 nil 的时候使用 https
+func NewUpHostProberEx(hosts []string, cfg *Config) *UpHostProber {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	return &UpHostProber{
+		hosts:    append([]string(nil), hosts...),
+		useHTTPS: cfg.useHTTPS(),
+		stats:    make(map[string]hostStat),
+	}
+}
+
+// Start 立即探测一次全部的上传域名，之后每隔 Interval 在后台探测一次，直到调用 Stop
+func (p *UpHostProber) Start() {
+	p.mu.Lock()
+	if p.started {
+		p.mu.Unlock()
+		return
+	}
+	p.started = true
+	p.stop = make(chan struct{})
+	stop := p.stop
+	p.mu.Unlock()
+
+	interval := p.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			p.Probe(context.Background())
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止后台的探测，已经得到的探测结果继续有效
+func (p *UpHostProber) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.started {
+		close(p.stop)
+		p.started = false
+	}
+}
+
+// Probe 并行探测一次全部的上传域名，全部探测完毕之后返回
+func (p *UpHostProber) Probe(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, host := range p.hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			stat := p.probe(ctx, host)
+			p.mu.Lock()
+			p.stats[hostKey(host)] = stat
+			p.mu.Unlock()
+		}(host)
+	}
+	wg.Wait()
+}
+
+func (p *UpHostProber) probe(ctx context.Context, host string) (stat hostStat) {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequest("GET", withScheme(host, p.useHTTPS), nil)
+	if err != nil {
+		return
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	start := time.Now()
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	closeResponse(resp)
+	stat.latency = time.Since(start)
+	stat.healthy = resp.StatusCode/100 != 5
+	return
+}
+
+// Latency 返回最近一次探测 host 的延迟，healthy 表示 host 是否可用，还没有探测过的时候 ok 为 false
+func (p *UpHostProber) Latency(host string) (latency time.Duration, healthy, ok bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	stat, ok := p.stats[hostKey(host)]
+	return stat.latency, stat.healthy, ok
+}
+
+// Sort 返回按照优先级排序的 hosts：可用的域名按照延迟从低到高排在最前面，之后是还没有探测过的域名，
+// 然后是不可用的域名，被冻结的域名排在最后。相同优先级的域名保持原来的顺序
+func (p *UpHostProber) Sort(hosts []string) []string {
+	return orderUpHosts(hosts, p)
+}
+
+type rankedHost struct {
+	host    string
+	rank    int
+	latency time.Duration
+}
+
+type rankedHosts []rankedHost
+
+func (r rankedHosts) Len() int      { return len(r) }
+func (r rankedHosts) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r rankedHosts) Less(i, j int) bool {
+	if r[i].rank != r[j].rank {
+		return r[i].rank < r[j].rank
+	}
+	return r[i].latency < r[j].latency
+}
+
+// orderUpHosts 将 hosts 按照优先级排序，prober 为 nil 的时候只把被冻结的域名移到最后
+func orderUpHosts(hosts []string, prober *UpHostProber) []string {
+	ranked := make(rankedHosts, len(hosts))
+	for i, host := range hosts {
+		ranked[i] = rankedHost{host: host, rank: 1}
+		if prober != nil {
+			if latency, healthy, ok := prober.Latency(host); ok {
+				if healthy {
+					ranked[i].rank, ranked[i].latency = 0, latency
+				} else {
+					ranked[i].rank = 2
+				}
+			}
+		}
+		if upHostFreezer.frozen(host) {
+			ranked[i].rank = 3
+		}
+	}
+	sort.Stable(ranked)
+	ordered := make([]string, len(ranked))
+	for i, h := range ranked {
+		ordered[i] = h.host
+	}
+	return ordered
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpHostProberSort(t *testing.T) {
+	newServer := func(delay time.Duration, status int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			time.Sleep(delay)
+			w.WriteHeader(status)
+		}))
+	}
+	slow := newServer(50*time.Millisecond, http.StatusMethodNotAllowed)
+	defer slow.Close()
+	fast := newServer(0, http.StatusMethodNotAllowed)
+	defer fast.Close()
+	broken := newServer(0, http.StatusBadGateway)
+	defer broken.Close()
+	unknown := "http://127.0.0.1:1"
+
+	prober := NewUpHostProber([]string{broken.URL, slow.URL, fast.URL})
+	prober.Probe(context.Background())
+	if _, healthy, ok := prober.Latency(broken.URL); !ok || healthy {
+		t.Fatalf("Latency() broken host should be probed as unhealthy")
+	}
+
+	hosts := prober.Sort([]string{broken.URL, unknown, slow.URL, fast.URL})
+	want := []string{fast.URL, slow.URL, unknown, broken.URL}
+	for i := range want {
+		if hosts[i] != want[i] {
+			t.Fatalf("Sort() = %v, want %v", hosts, want)
+		}
+	}
+
+	upHostFreezer.freeze(fast.URL, time.Minute)
+	defer upHostFreezer.freeze(fast.URL, 0)
+	if hosts = prober.Sort(want); hosts[0] != slow.URL || hosts[3] != fast.URL {
+		t.Fatalf("Sort() frozen host should be the last, got %v", hosts)
+	}
+}
+
+func TestUpHostProberStartStop(t *testing.T) {
+	probes := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		probes <- struct{}{}
+	}))
+	defer server.Close()
+
+	prober := NewUpHostProber([]string{server.URL})
+	prober.Interval = 10 * time.Millisecond
+	prober.Start()
+	prober.Start()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-probes:
+		case <-time.After(5 * time.Second):
+			t.Fatal("UpHostProber should probe in background")
+		}
+	}
+	prober.Stop()
+	prober.Stop()
+	if _, healthy, ok := prober.Latency(server.URL); !ok || !healthy {
+		t.Fatal("Latency() host should be healthy")
+	}
+}
+
+func TestUpHostProberScheme(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	// 没有协议的域名默认使用 https 探测
+	prober := NewUpHostProber([]string{host})
+	prober.Probe(context.Background())
+	if _, healthy, ok := prober.Latency(host); !ok || healthy {
+		t.Fatal("Latency() host without scheme should be probed over https")
+	}
+
+	prober = NewUpHostProberEx([]string{host}, &Config{DisableHTTPS: true})
+	prober.Probe(context.Background())
+	if _, healthy, ok := prober.Latency(host); !ok || !healthy {
+		t.Fatal("Latency() host without scheme should be probed over http when DisableHTTPS is set")
+	}
+}
+
+func TestUpHostFreezeOn5xx(t *testing.T) {
+	badServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error":"service unavailable"}`))
+	}))
+	defer badServer.Close()
+	server := newFakeUpServer()
+	defer server.Close()
+	defer upHostFreezer.freeze(badServer.URL, 0)
+
+	uploader := NewFormUploader(nil)
+	var putRet PutRet
+	err := uploader.Put(context.Background(), &putRet, "token", "frozen", bytes.NewReader(make([]byte, 4096)), 4096, &PutExtra{UpHost: badServer.URL})
+	if err == nil {
+		t.Fatal("FormUploader#Put() should fail")
+	}
+	if !upHostFreezer.frozen(badServer.URL) {
+		t.Fatal("FormUploader#Put() should freeze the host returning 5xx")
+	}
+
+	// 分片上传优先使用没有被冻结的域名
+	resumeUploader := NewResumeUploader(nil)
+	resumeUploader.UpHosts = []string{badServer.URL, server.URL}
+	hosts, err := resumeUploader.rputUpHosts("token", &RputExtra{})
+	if err != nil || hosts.host() != server.URL {
+		t.Fatalf("rputUpHosts() should skip the frozen host, got %v", hosts.hosts)
+	}
+
+	if shouldFreezeHost(&ErrorInfo{Code: 579}) || shouldFreezeHost(&ErrorInfo{Code: 401}) {
+		t.Fatal("shouldFreezeHost() should only freeze 5xx errors except 579")
+	}
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+// BucketLifecycleRule 为空间的生命周期规则，文件上传之后经过指定的天数自动转换存储类型或者删除，
+// 天数为 0 表示不进行对应的操作
+type BucketLifecycleRule struct {
+	Name   string `json:"name"`   // 规则名称，在空间中唯一
+	Prefix string `json:"prefix"` // 规则生效的文件前缀，为空表示对空间中全部文件生效
+
+	DeleteAfterDays        int `json:"delete_after_days"`          // 上传多少天之后删除
+	ToLineAfterDays        int `json:"to_line_after_days"`         // 上传多少天之后转为低频存储
+	ToArchiveAfterDays     int `json:"to_archive_after_days"`      // 上传多少天之后转为归档存储
+	ToDeepArchiveAfterDays int `json:"to_deep_archive_after_days"` // 上传多少天之后转为深度归档存储
+}
+
+// Validate 检查生命周期规则是否合法，设置了多个操作的时候天数需要按照 低频、归档、深度归档、删除 的顺序递增
+func (r *BucketLifecycleRule) Validate() error {
+	if r.Name == "" {
+		return errors.New("lifecycle rule: name is required")
+	}
+	days := []int{r.ToLineAfterDays, r.ToArchiveAfterDays, r.ToDeepArchiveAfterDays, r.DeleteAfterDays}
+	last := 0
+	for _, d := range days {
+		if d < 0 {
+			return errors.New("lifecycle rule: days must not be negative")
+		}
+		if d == 0 {
+			continue
+		}
+		if d <= last {
+			return errors.New("lifecycle rule: days must increase in the order of line, archive, deep archive and delete")
+		}
+		last = d
+	}
+	if last == 0 {
+		return errors.New("lifecycle rule: no action is specified")
+	}
+	return nil
+}
+
+func (r *BucketLifecycleRule) params(bucket string) map[string][]string {
+	return map[string][]string{
+		"bucket":                     {bucket},
+		"name":                       {r.Name},
+		"prefix":                     {r.Prefix},
+		"delete_after_days":          {strconv.Itoa(r.DeleteAfterDays)},
+		"to_line_after_days":         {strconv.Itoa(r.ToLineAfterDays)},
+		"to_archive_after_days":      {strconv.Itoa(r.ToArchiveAfterDays)},
+		"to_deep_archive_after_days": {strconv.Itoa(r.ToDeepArchiveAfterDays)},
+	}
+}
+
+// AddBucketLifecycleRule 用来为空间增加一条生命周期规则
+func (m *BucketManager) AddBucketLifecycleRule(bucket string, rule *BucketLifecycleRule) (err error) {
+	return m.postLifecycleRule("/rules/add", bucket, rule)
+}
+
+// UpdateBucketLifecycleRule 用来更新空间中名称为 rule.Name 的生命周期规则
+func (m *BucketManager) UpdateBucketLifecycleRule(bucket string, rule *BucketLifecycleRule) (err error) {
+	return m.postLifecycleRule("/rules/update", bucket, rule)
+}
+
+func (m *BucketManager) postLifecycleRule(path, bucket string, rule *BucketLifecycleRule) (err error) {
+	if err = rule.Validate(); err != nil {
+		return
+	}
+	ctx := m.withMac(context.TODO())
+	reqURL := m.Cfg.UcReqHost() + path
+	err = m.Client.CallWithForm(ctx, nil, "POST", reqURL, nil, rule.params(bucket))
+	return
+}
+
+// DelBucketLifecycleRule 用来删除空间中名称为 name 的生命周期规则
+func (m *BucketManager) DelBucketLifecycleRule(bucket, name string) (err error) {
+	ctx := m.withMac(context.TODO())
+	reqURL := m.Cfg.UcReqHost() + "/rules/delete"
+	params := map[string][]string{
+		"bucket": {bucket},
+		"name":   {name},
+	}
+	err = m.Client.CallWithForm(ctx, nil, "POST", reqURL, nil, params)
+	return
+}
+
+// GetBucketLifecycleRules 用来获取空间的全部生命周期规则
+func (m *BucketManager) GetBucketLifecycleRules(bucket string) (rules []BucketLifecycleRule, err error) {
+	ctx := m.withMac(context.TODO())
+	reqURL := m.Cfg.UcReqHost() + "/rules/get"
+	params := map[string][]string{
+		"bucket": {bucket},
+	}
+	err = m.Client.CallWithForm(ctx, &rules, "GET", reqURL, nil, params)
+	return
+}
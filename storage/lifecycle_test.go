@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBucketLifecycleRules(t *testing.T) {
+	var rules []BucketLifecycleRule
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		if req.Form.Get("bucket") != "bucket" || !strings.HasPrefix(req.Header.Get("Authorization"), "QBox ") {
+			http.Error(w, `{"error":"bad request"}`, http.StatusBadRequest)
+			return
+		}
+		switch req.URL.Path {
+		case "/rules/add":
+			days, _ := strconv.Atoi(req.Form.Get("to_line_after_days"))
+			deleteDays, _ := strconv.Atoi(req.Form.Get("delete_after_days"))
+			rules = append(rules, BucketLifecycleRule{
+				Name:            req.Form.Get("name"),
+				Prefix:          req.Form.Get("prefix"),
+				ToLineAfterDays: days,
+				DeleteAfterDays: deleteDays,
+			})
+		case "/rules/delete":
+			rules = rules[:0]
+		case "/rules/get":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(rules)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	bucketManager := NewBucketManager(mac, &Config{UcHost: server.URL})
+	rule := BucketLifecycleRule{Name: "logs", Prefix: "logs/", ToLineAfterDays: 30, DeleteAfterDays: 90}
+	if err := bucketManager.AddBucketLifecycleRule("bucket", &rule); err != nil {
+		t.Fatalf("BucketManager#AddBucketLifecycleRule() error, %s", err)
+	}
+	got, err := bucketManager.GetBucketLifecycleRules("bucket")
+	if err != nil {
+		t.Fatalf("BucketManager#GetBucketLifecycleRules() error, %s", err)
+	}
+	if len(got) != 1 || got[0] != rule {
+		t.Fatalf("BucketManager#GetBucketLifecycleRules() error, unexpected rules %+v", got)
+	}
+	if err = bucketManager.DelBucketLifecycleRule("bucket", "logs"); err != nil {
+		t.Fatalf("BucketManager#DelBucketLifecycleRule() error, %s", err)
+	}
+
+	invalid := BucketLifecycleRule{Name: "invalid", ToLineAfterDays: 90, DeleteAfterDays: 30}
+	if err = bucketManager.AddBucketLifecycleRule("bucket", &invalid); err == nil {
+		t.Fatalf("BucketManager#AddBucketLifecycleRule() should fail for invalid rule")
+	}
+}
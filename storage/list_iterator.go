@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+)
+
+// ListIterator 用来逐个遍历空间中的文件，自动根据 marker 获取下一页，直到列举完成为止
+//
+//	it := bucketManager.ListIterator(ctx, bucket, prefix, "", "", 1000)
+//	for it.Next() {
+//		item := it.Item()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type ListIterator struct {
+	m         *BucketManager
+	ctx       context.Context
+	bucket    string
+	prefix    string
+	delimiter string
+	marker    string
+	limit     int
+
+	items          []ListItem
+	pos            int
+	item           ListItem
+	commonPrefixes []string
+	hasNext        bool
+	err            error
+}
+
+// ListIterator 用来构建一个从 marker 开始遍历空间文件的 ListIterator，limit 为每次请求返回的最大数量，
+// 小于等于 0 的时候为 1000
+func (m *BucketManager) ListIterator(ctx context.Context, bucket, prefix, delimiter, marker string, limit int) *ListIterator {
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	return &ListIterator{
+		m:         m,
+		ctx:       ctx,
+		bucket:    bucket,
+		prefix:    prefix,
+		delimiter: delimiter,
+		marker:    marker,
+		limit:     limit,
+		hasNext:   true,
+	}
+}
+
+// Next 移动到下一个文件，没有更多的文件或者出错的时候返回 false
+func (it *ListIterator) Next() bool {
+	for it.err == nil {
+		for it.pos < len(it.items) {
+			it.item = it.items[it.pos]
+			it.pos++
+			if !it.item.IsEmpty() {
+				return true
+			}
+		}
+		if !it.hasNext {
+			return false
+		}
+
+		var commonPrefixes []string
+		it.items, commonPrefixes, it.marker, it.hasNext, it.err = it.m.ListFilesContext(it.ctx,
+			it.bucket, it.prefix, it.delimiter, it.marker, it.limit)
+		it.pos = 0
+		it.commonPrefixes = append(it.commonPrefixes, commonPrefixes...)
+	}
+	return false
+}
+
+// Item 返回当前的文件
+func (it *ListIterator) Item() ListItem {
+	return it.item
+}
+
+// CommonPrefixes 返回到目前为止列举到的全部目录，只有设置了 delimiter 的时候才有
+func (it *ListIterator) CommonPrefixes() []string {
+	return it.commonPrefixes
+}
+
+// Marker 返回获取下一页使用的 marker，当前页的文件全部遍历之后可以用来从中断的位置继续列举
+func (it *ListIterator) Marker() string {
+	return it.marker
+}
+
+// Err 返回遍历过程中遇到的错误
+func (it *ListIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestListIterator(t *testing.T) {
+	keys := []string{"a/1", "a/2", "a/3", "a/4", "a/5"}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		if req.URL.Path != "/list" || query.Get("bucket") != "bucket" || query.Get("prefix") != "a/" {
+			http.NotFound(w, req)
+			return
+		}
+		requests++
+		start, _ := strconv.Atoi(query.Get("marker"))
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		end := start + limit
+		ret := listFilesRet{}
+		if end < len(keys) {
+			ret.Marker = strconv.Itoa(end)
+		} else {
+			end = len(keys)
+		}
+		for _, key := range keys[start:end] {
+			ret.Items = append(ret.Items, ListItem{Key: key, Fsize: 1})
+		}
+		if start == 0 {
+			ret.Items = append(ret.Items, ListItem{})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ret)
+	}))
+	defer server.Close()
+
+	bucketManager := NewBucketManager(mac, &Config{RsfHost: server.URL})
+	it := bucketManager.ListIterator(context.Background(), "bucket", "a/", "", "", 2)
+	var got []string
+	for it.Next() {
+		got = append(got, it.Item().Key)
+	}
+	if it.Err() != nil {
+		t.Fatalf("ListIterator error, %s", it.Err())
+	}
+	if strings.Join(got, ",") != strings.Join(keys, ",") || requests != 3 || it.Marker() != "" {
+		t.Fatalf("ListIterator error, got %v after %d requests", got, requests)
+	}
+
+	it = bucketManager.ListIterator(context.Background(), "other", "a/", "", "", 2)
+	if it.Next() || it.Err() == nil {
+		t.Fatalf("ListIterator should fail for unknown bucket")
+	}
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"sync"
+)
+
+// ParallelListOption 为 ListParallel 的可选参数
+type ParallelListOption struct {
+	// 可选。按照 prefix 之后的下一个字符拆分列举任务使用的字符集合。
+	// 不设定的时候按照下一个字节的全部 256 种取值拆分，可以列举到全部文件；
+	// 设定之后下一个字符不在 Alphabet 中的文件不会被列举，比如 key 全部为十六进制的时候可以设定为 "0123456789abcdef"
+	Alphabet string
+
+	// 可选。同时进行的列举任务的数量，小于等于 0 的时候为 8
+	Concurrency int
+
+	// 可选。每次请求返回的最大数量，小于等于 0 的时候为 1000
+	Limit int
+}
+
+const defaultParallelListConcurrency = 8
+
+// shards 返回按照下一个字符拆分之后的前缀
+func (opt *ParallelListOption) shards(prefix string) (prefixes []string) {
+	if opt.Alphabet != "" {
+		seen := make(map[rune]bool)
+		for _, r := range opt.Alphabet {
+			if !seen[r] {
+				seen[r] = true
+				prefixes = append(prefixes, prefix+string(r))
+			}
+		}
+		return
+	}
+	prefixes = make([]string, 0, 256)
+	for b := 0; b < 256; b++ {
+		prefixes = append(prefixes, prefix+string([]byte{byte(b)}))
+	}
+	return
+}
+
+// ListParallel 用来并发地列举空间中以 prefix 开头的文件，适用于文件数量非常多的空间。
+// 列举任务按照 prefix 之后的下一个字符拆分，结果通过 retCh 返回，不保证按照 key 的顺序返回。
+// retCh 关闭之后 errCh 返回一个值，为 nil 表示列举完成，否则为遇到的第一个错误，出错之后其它的列举任务会被取消。
+// 取消 ctx 可以提前结束列举，调用者不再读取 retCh 的时候必须取消 ctx。
+func (m *BucketManager) ListParallel(ctx context.Context, bucket, prefix string,
+	opt *ParallelListOption) (retCh <-chan ListItem, errCh <-chan error) {
+	if opt == nil {
+		opt = &ParallelListOption{}
+	}
+	concurrency := opt.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultParallelListConcurrency
+	}
+	limit := opt.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	items := make(chan ListItem, limit)
+	errs := make(chan error, 1)
+
+	var once sync.Once
+	var firstErr error
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	// 按下一个字符拆分的前缀列举不到 key 和 prefix 相同的文件，单独查询一次
+	if prefix != "" {
+		entries, _, _, _, err := m.ListFilesContext(ctx, bucket, prefix, "", "", 1)
+		if err != nil {
+			cancel()
+			close(items)
+			errs <- err
+			return items, errs
+		}
+		if len(entries) > 0 && entries[0].Key == prefix {
+			items <- entries[0]
+		}
+	}
+
+	shards := make(chan string)
+	go func() {
+		defer close(shards)
+		for _, p := range opt.shards(prefix) {
+			select {
+			case shards <- p:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range shards {
+				it := m.ListIterator(ctx, bucket, p, "", "", limit)
+				for it.Next() {
+					select {
+					case items <- it.Item():
+					case <-ctx.Done():
+						return
+					}
+				}
+				if err := it.Err(); err != nil {
+					fail(err)
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		err := firstErr
+		if err == nil {
+			err = ctx.Err()
+		}
+		cancel()
+		close(items)
+		errs <- err
+	}()
+	return items, errs
+}
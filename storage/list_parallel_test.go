@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func newFakeRsfServer(keys []string, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(requests, 1)
+		query := req.URL.Query()
+		if req.URL.Path != "/list" || query.Get("bucket") != "bucket" {
+			http.NotFound(w, req)
+			return
+		}
+		ret := listFilesRet{}
+		for _, key := range keys {
+			if strings.HasPrefix(key, query.Get("prefix")) {
+				ret.Items = append(ret.Items, ListItem{Key: key, Fsize: 1})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ret)
+	}))
+}
+
+func TestListParallel(t *testing.T) {
+	keys := []string{"logs/", "logs/0a", "logs/1b", "logs/f", "logs/~", "logs/中文", "other"}
+	var requests int32
+	server := newFakeRsfServer(keys, &requests)
+	defer server.Close()
+
+	bucketManager := NewBucketManager(mac, &Config{RsfHost: server.URL})
+	retCh, errCh := bucketManager.ListParallel(context.Background(), "bucket", "logs/", &ParallelListOption{Concurrency: 4})
+	var got []string
+	for item := range retCh {
+		got = append(got, item.Key)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("ListParallel() error, %s", err)
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != strings.Join(keys[:6], ",") || requests != 257 {
+		t.Fatalf("ListParallel() error, got %v after %d requests", got, requests)
+	}
+
+	requests = 0
+	retCh, errCh = bucketManager.ListParallel(context.Background(), "bucket", "logs/", &ParallelListOption{Alphabet: "0123456789abcdef"})
+	got = got[:0]
+	for item := range retCh {
+		got = append(got, item.Key)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("ListParallel() error, %s", err)
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != "logs/,logs/0a,logs/1b,logs/f" || requests != 17 {
+		t.Fatalf("ListParallel() error, got %v after %d requests", got, requests)
+	}
+
+	retCh, errCh = bucketManager.ListParallel(context.Background(), "unknown", "", nil)
+	for range retCh {
+	}
+	if err := <-errCh; err == nil {
+		t.Fatalf("ListParallel() should fail for unknown bucket")
+	}
+}
+
+func TestListParallelCancel(t *testing.T) {
+	keys := make([]string, 0, 256)
+	for b := 'a'; b <= 'z'; b++ {
+		keys = append(keys, string(b)+"1", string(b)+"2")
+	}
+	var requests int32
+	server := newFakeRsfServer(keys, &requests)
+	defer server.Close()
+
+	bucketManager := NewBucketManager(mac, &Config{RsfHost: server.URL})
+	ctx, cancel := context.WithCancel(context.Background())
+	retCh, errCh := bucketManager.ListParallel(ctx, "bucket", "", &ParallelListOption{Limit: 1})
+	<-retCh
+	cancel()
+	for range retCh {
+	}
+	if err := <-errCh; err != context.Canceled {
+		t.Fatalf("ListParallel() should be canceled, %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/qiniu/api.v7/conf"
+)
+
+// ListBucketStream 用来逐条读取 /v2/list 接口返回的文件列表，接口每行返回一个 JSON 对象，
+// 读取的时候逐行解码，不需要将整个列表读入内存。和 ListBucket 不同的是，
+// 列举过程中连接中断或者服务端返回的错误会通过 Err 返回，可以用 Marker 从中断的位置继续列举。
+//
+//	stream, err := bucketManager.ListBucketStream(ctx, bucket, prefix, "", "")
+//	if err != nil {
+//		...
+//	}
+//	defer stream.Close()
+//	for stream.Next() {
+//		item := stream.Item()
+//		...
+//	}
+//	if err := stream.Err(); err != nil {
+//		...
+//	}
+type ListBucketStream struct {
+	body   io.ReadCloser
+	dec    *json.Decoder
+	reqid  string
+	marker string
+	item   ListItem
+	dir    string
+	err    error
+}
+
+// ListBucketStream 用来流式地列举空间中的文件，可以根据需要指定文件的前缀 prefix，文件的目录 delimiter，
+// 以及开始列举的位置 marker，ctx 可以用来取消列举
+func (m *BucketManager) ListBucketStream(ctx context.Context, bucket, prefix, delimiter, marker string) (stream *ListBucketStream, err error) {
+	ctx = m.withMac(ctx)
+	reqHost, reqErr := m.RsfReqHost(bucket)
+	if reqErr != nil {
+		err = reqErr
+		return
+	}
+
+	reqURL := fmt.Sprintf("%s%s", reqHost, uriListFiles2(bucket, prefix, delimiter, marker))
+	headers := http.Header{}
+	headers.Add("Content-Type", conf.CONTENT_TYPE_FORM)
+	resp, err := m.Client.DoRequestWith(ctx, "POST", reqURL, headers, nil, 0)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode/100 != 2 {
+		err = ResponseError(resp)
+		closeResponse(resp)
+		return
+	}
+	stream = &ListBucketStream{
+		body:   resp.Body,
+		dec:    json.NewDecoder(resp.Body),
+		reqid:  resp.Header.Get("X-Reqid"),
+		marker: marker,
+	}
+	return
+}
+
+// Next 读取下一条记录，列举完成或者出错的时候返回 false，并关闭连接
+func (s *ListBucketStream) Next() bool {
+	if s.err != nil || s.dec == nil {
+		return false
+	}
+
+	var line struct {
+		listFilesRet2
+		Error string `json:"error"`
+	}
+	err := s.dec.Decode(&line)
+	switch {
+	case err == io.EOF:
+		s.Close()
+		return false
+	case err != nil:
+		s.err = err
+	case line.Error != "":
+		s.err = &ErrorInfo{Err: line.Error, Reqid: s.reqid, Code: http.StatusOK}
+	}
+	if s.err != nil {
+		s.Close()
+		return false
+	}
+
+	s.item, s.dir, s.marker = line.Item, line.Dir, line.Marker
+	return true
+}
+
+// Item 返回当前记录中的文件，当前记录为目录的时候为空
+func (s *ListBucketStream) Item() ListItem {
+	return s.item
+}
+
+// Dir 返回当前记录中的目录，只有设置了 delimiter 的时候才有
+func (s *ListBucketStream) Dir() string {
+	return s.dir
+}
+
+// Marker 返回当前记录之后继续列举使用的 marker，列举完成之后为空
+func (s *ListBucketStream) Marker() string {
+	return s.marker
+}
+
+// Err 返回读取过程中遇到的错误，正常列举完成的时候为 nil
+func (s *ListBucketStream) Err() error {
+	return s.err
+}
+
+// Close 关闭连接，没有读取完全部记录的时候需要调用
+func (s *ListBucketStream) Close() error {
+	if s.dec == nil {
+		return nil
+	}
+	s.dec = nil
+	return s.body.Close()
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestListBucketStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v2/list" || req.URL.Query().Get("bucket") != "bucket" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write([]byte(`{"marker":"m1","item":{"key":"a/1","fsize":1},"dir":""}` + "\n"))
+		w.Write([]byte(`{"marker":"m2","item":null,"dir":"a/b/"}` + "\n"))
+		if req.URL.Query().Get("marker") == "" {
+			w.Write([]byte(`{"error":"internal error"}` + "\n"))
+			return
+		}
+		w.Write([]byte(`{"marker":"","item":{"key":"a/3","fsize":3},"dir":""}` + "\n"))
+	}))
+	defer server.Close()
+
+	bucketManager := NewBucketManager(mac, &Config{RsfHost: server.URL})
+	stream, err := bucketManager.ListBucketStream(context.Background(), "bucket", "a/", "/", "")
+	if err != nil {
+		t.Fatalf("ListBucketStream() error, %s", err)
+	}
+	var got []string
+	for stream.Next() {
+		got = append(got, stream.Item().Key+stream.Dir())
+	}
+	if stream.Err() == nil || stream.Err().Error() != "internal error" || stream.Marker() != "m2" {
+		t.Fatalf("ListBucketStream() should fail, err %v, marker %s", stream.Err(), stream.Marker())
+	}
+	if strings.Join(got, ",") != "a/1,a/b/" {
+		t.Fatalf("ListBucketStream() error, got %v", got)
+	}
+
+	stream, err = bucketManager.ListBucketStream(context.Background(), "bucket", "a/", "/", stream.Marker())
+	if err != nil {
+		t.Fatalf("ListBucketStream() error, %s", err)
+	}
+	defer stream.Close()
+	got = got[:0]
+	for stream.Next() {
+		got = append(got, stream.Item().Key+stream.Dir())
+	}
+	if stream.Err() != nil || strings.Join(got, ",") != "a/1,a/b/,a/3" || stream.Marker() != "" {
+		t.Fatalf("ListBucketStream() error, %v, got %v, marker %s", stream.Err(), got, stream.Marker())
+	}
+
+	if _, err = bucketManager.ListBucketStream(context.Background(), "unknown", "", "", ""); err == nil {
+		t.Fatalf("ListBucketStream() should fail for unknown bucket")
+	}
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/qiniu/x/reqid.v7"
+	"github.com/qiniu/x/xlog.v7"
+)
+
+// Logger 为分片上传输出日志的接口，比如切换上传域名、分片重试和块上传失败的原因。
+// fields 依次为字段名称和值，比如 Warn("mkblk failed", "block", 0, "error", err)，请求的上下文中有 reqid 的时候包含 "reqid" 字段。
+// 多个 goroutine 会同时调用，实现的时候需要注意并发安全
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+	Info(msg string, fields ...interface{})
+	Warn(msg string, fields ...interface{})
+	Error(msg string, fields ...interface{})
+}
+
+// NopLogger 不输出任何日志，没有设置 Logger 的时候使用
+var NopLogger Logger = nopLogger{}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, fields ...interface{}) {}
+func (nopLogger) Info(msg string, fields ...interface{})  {}
+func (nopLogger) Warn(msg string, fields ...interface{})  {}
+func (nopLogger) Error(msg string, fields ...interface{}) {}
+
+// NewXlogLogger 用来构建一个通过 github.com/qiniu/x/xlog.v7 输出日志的 Logger，日志格式和之前的版本相同，
+// 字段按照 "名称=值" 的格式输出在 msg 之后
+func NewXlogLogger() Logger {
+	return xlogLogger{}
+}
+
+type xlogLogger struct{}
+
+func (xlogLogger) Debug(msg string, fields ...interface{}) {
+	newXlog(fields).Debug(xlogArgs(msg, fields)...)
+}
+func (xlogLogger) Info(msg string, fields ...interface{}) {
+	newXlog(fields).Info(xlogArgs(msg, fields)...)
+}
+func (xlogLogger) Warn(msg string, fields ...interface{}) {
+	newXlog(fields).Warn(xlogArgs(msg, fields)...)
+}
+func (xlogLogger) Error(msg string, fields ...interface{}) {
+	newXlog(fields).Error(xlogArgs(msg, fields)...)
+}
+
+// newXlog 使用 fields 中的 reqid 构建 xlog.Logger
+func newXlog(fields []interface{}) *xlog.Logger {
+	ctx := context.Background()
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i] == "reqid" {
+			ctx = reqid.NewContext(ctx, fmt.Sprint(fields[i+1]))
+		}
+	}
+	return xlog.NewWith(ctx)
+}
+
+// xlogArgs 把 msg 和 reqid 之外的字段转换成 xlog 的参数
+func xlogArgs(msg string, fields []interface{}) []interface{} {
+	args := []interface{}{msg}
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i] != "reqid" {
+			args = append(args, fmt.Sprintf("%v=%v", fields[i], fields[i+1]))
+		}
+	}
+	return args
+}
+
+// withReqid 返回在每条日志中加上 ctx 中的 reqid 的 Logger，l 为 nil 的时候返回 NopLogger
+func withReqid(ctx context.Context, l Logger) Logger {
+	if l == nil {
+		return NopLogger
+	}
+	if ctx == nil {
+		return l
+	}
+	id, ok := reqid.FromContext(ctx)
+	if !ok {
+		return l
+	}
+	return reqidLogger{l: l, reqid: id}
+}
+
+type reqidLogger struct {
+	l     Logger
+	reqid string
+}
+
+func (r reqidLogger) Debug(msg string, fields ...interface{}) { r.l.Debug(msg, r.fields(fields)...) }
+func (r reqidLogger) Info(msg string, fields ...interface{})  { r.l.Info(msg, r.fields(fields)...) }
+func (r reqidLogger) Warn(msg string, fields ...interface{})  { r.l.Warn(msg, r.fields(fields)...) }
+func (r reqidLogger) Error(msg string, fields ...interface{}) { r.l.Error(msg, r.fields(fields)...) }
+
+func (r reqidLogger) fields(fields []interface{}) []interface{} {
+	return append(append([]interface{}{}, fields...), "reqid", r.reqid)
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/qiniu/x/reqid.v7"
+)
+
+// memLogger 记录输出的日志，每条日志为级别、msg 和字段拼接成的字符串
+type memLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *memLogger) log(level, msg string, fields []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprint(level, " ", msg, " ", fields))
+}
+
+func (l *memLogger) Debug(msg string, fields ...interface{}) { l.log("DEBUG", msg, fields) }
+func (l *memLogger) Info(msg string, fields ...interface{})  { l.log("INFO", msg, fields) }
+func (l *memLogger) Warn(msg string, fields ...interface{})  { l.log("WARN", msg, fields) }
+func (l *memLogger) Error(msg string, fields ...interface{}) { l.log("ERROR", msg, fields) }
+
+func TestResumeUploaderLogger(t *testing.T) {
+	upServer := newFakeUpServer()
+	defer upServer.Close()
+	server, _ := newFlakyServer(1, http.StatusServiceUnavailable, http.HandlerFunc(upServer.serveHTTP))
+	defer server.Close()
+	defer upHostFreezer.freeze(server.URL, 0)
+
+	logger := &memLogger{}
+	uploader := NewResumeUploader(nil)
+	uploader.Settings = &Settings{Logger: logger}
+	uploader.RetryPolicy = &BackoffRetryPolicy{}
+	ctx := reqid.NewContext(context.Background(), "test-reqid")
+	var putRet PutRet
+	err := uploader.Put(ctx, &putRet, "token", "logger", bytes.NewReader(make([]byte, 1024)), 1024, &RputExtra{UpHost: server.URL})
+	if err != nil {
+		t.Fatalf("ResumeUploader#Put() error, %s", err)
+	}
+	logs := strings.Join(logger.lines, "\n")
+	if !strings.Contains(logs, "WARN ResumableBlockput: mkblk failed [block 0 error") ||
+		!strings.Contains(logs, "INFO ResumableBlockput: retrying [block 0 reqid test-reqid]") {
+		t.Fatalf("unexpected logs:\n%s", logs)
+	}
+
+	// 上传对象的 Logger 优先于 Settings 中的 Logger
+	uploader.Logger = NopLogger
+	if uploader.logger(context.Background()) != NopLogger {
+		t.Fatal("ResumeUploader#logger() should use ResumeUploader.Logger")
+	}
+	if args := xlogArgs("msg", []interface{}{"block", 1, "reqid", "id"}); len(args) != 2 || args[1] != "block=1" {
+		t.Fatalf("xlogArgs() = %v", args)
+	}
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Metrics 记录 SDK 操作的计数器和直方图，设置到上传对象的 Metrics 之后记录上传的次数、数据量、分片的耗时和重试的次数。
+// 接口只包含计数器和直方图两种操作，可以很容易地对接到 Prometheus 的 CounterVec/HistogramVec 或者 OpenTelemetry 的 Counter/Histogram，
+// 每个指标使用的名称和标签见 MetricUploadsStarted 等常量的说明。
+// 多个 goroutine 会同时调用，实现的时候需要注意并发安全
+type Metrics interface {
+	// AddCounter 把名称为 name 的计数器增加 value
+	AddCounter(name string, value float64, labels map[string]string)
+
+	// Observe 向名称为 name 的直方图添加一个观测值
+	Observe(name string, value float64, labels map[string]string)
+}
+
+// Metrics 记录的指标名称。标签 method 为上传方式，取值为 "form"、"resumable" 和 "resumable_v2"；
+// 标签 host 为请求的域名；标签 result 为 "success" 或者 "failure"
+const (
+	MetricUploadsStarted   = "qiniu_uploads_started_total"         // 计数器，开始的上传数量，标签 method
+	MetricUploadsSucceeded = "qiniu_uploads_succeeded_total"       // 计数器，成功的上传数量，标签 method
+	MetricUploadsFailed    = "qiniu_uploads_failed_total"          // 计数器，失败的上传数量，标签 method
+	MetricUploadedBytes    = "qiniu_uploaded_bytes_total"          // 计数器，上传成功的数据量（字节），包括失败的上传中已经上传成功的分片，标签 method 和 host
+	MetricChunkDuration    = "qiniu_upload_chunk_duration_seconds" // 直方图，每个分片请求的耗时（秒），标签 method、host 和 result
+	MetricUploadRetries    = "qiniu_upload_retries_total"          // 计数器，上传请求的重试次数，标签 method
+	MetricRequestDuration  = "qiniu_request_duration_seconds"      // 直方图，MetricsHooks 记录的每个请求的耗时（秒），标签 host、code 和 result
+)
+
+// 标签 method 的取值
+const (
+	methodForm        = "form"
+	methodResumable   = "resumable"
+	methodResumableV2 = "resumable_v2"
+)
+
+// MetricsHooks 返回把通过 Client 发送的每个请求的耗时记录到 m 的 Hooks，按照标签 host 和 result 统计可以得到每个域名的错误率。
+// 标签 code 为 HTTP 状态码，请求失败没有收到响应的时候为 "0"；状态码为 5xx 的时候 result 也为 "failure"
+func MetricsHooks(m Metrics) *Hooks {
+	return &Hooks{
+		OnResponse: func(req *http.Request, resp *http.Response, elapsed time.Duration, err error) {
+			code := 0
+			if resp != nil {
+				code = resp.StatusCode
+			}
+			failed := err != nil || code/100 == 5
+			m.Observe(MetricRequestDuration, elapsed.Seconds(), map[string]string{
+				"host": req.URL.Host, "code": strconv.Itoa(code), "result": metricResult(failed),
+			})
+		},
+	}
+}
+
+// recordUploadStart 记录一次上传开始，返回的函数在上传结束之后调用，记录上传成功或者失败
+func recordUploadStart(m Metrics, method string) func(err error) {
+	if m == nil {
+		return func(error) {}
+	}
+	labels := map[string]string{"method": method}
+	m.AddCounter(MetricUploadsStarted, 1, labels)
+	return func(err error) {
+		if err == nil {
+			m.AddCounter(MetricUploadsSucceeded, 1, labels)
+		} else {
+			m.AddCounter(MetricUploadsFailed, 1, labels)
+		}
+	}
+}
+
+// recordChunk 记录一个分片请求的耗时，成功的时候同时记录上传的数据量
+func recordChunk(m Metrics, method, host string, size int, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.Observe(MetricChunkDuration, time.Since(start).Seconds(), map[string]string{
+		"method": method, "host": hostKey(host), "result": metricResult(err != nil),
+	})
+	recordUploadedBytes(m, method, host, int64(size), err)
+}
+
+// recordUploadedBytes 在 err 为 nil 的时候记录上传成功的数据量
+func recordUploadedBytes(m Metrics, method, host string, size int64, err error) {
+	if m != nil && err == nil && size > 0 {
+		m.AddCounter(MetricUploadedBytes, float64(size), map[string]string{"method": method, "host": hostKey(host)})
+	}
+}
+
+// recordRetry 记录一次上传请求的重试
+func recordRetry(m Metrics, method string) {
+	if m != nil {
+		m.AddCounter(MetricUploadRetries, 1, map[string]string{"method": method})
+	}
+}
+
+func metricResult(failed bool) string {
+	if failed {
+		return "failure"
+	}
+	return "success"
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memMetrics 在内存中按照名称和标签累加指标，用来检查记录的指标
+type memMetrics struct {
+	mu     sync.Mutex
+	values map[string]float64
+	counts map[string]int
+}
+
+func newMemMetrics() *memMetrics {
+	return &memMetrics{values: make(map[string]float64), counts: make(map[string]int)}
+}
+
+func (m *memMetrics) AddCounter(name string, value float64, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[name] += value
+	m.counts[name+labels["result"]]++
+}
+
+func (m *memMetrics) Observe(name string, value float64, labels map[string]string) {
+	m.AddCounter(name, value, labels)
+}
+
+func TestUploadMetrics(t *testing.T) {
+	upServer := newFakeUpServer()
+	defer upServer.Close()
+	server, _ := newFlakyServer(1, http.StatusServiceUnavailable, http.HandlerFunc(upServer.serveHTTP))
+	defer server.Close()
+	defer upHostFreezer.freeze(server.URL, 0)
+
+	metrics := newMemMetrics()
+	client := NewClient(nil)
+	client.Hooks = MetricsHooks(metrics)
+	uploader := NewResumeUploaderEx(nil, client)
+	uploader.Metrics = metrics
+	uploader.RetryPolicy = &BackoffRetryPolicy{}
+	data := make([]byte, 5*1024*1024)
+	var putRet PutRet
+	err := uploader.Put(context.Background(), &putRet, "token", "metrics", bytes.NewReader(data), int64(len(data)), &RputExtra{UpHost: server.URL, TryTimes: 3})
+	if err != nil {
+		t.Fatalf("ResumeUploader#Put() error, %s", err)
+	}
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if metrics.values[MetricUploadsStarted] != 1 || metrics.values[MetricUploadsSucceeded] != 1 || metrics.values[MetricUploadsFailed] != 0 {
+		t.Fatalf("unexpected upload counters %v", metrics.values)
+	}
+	if metrics.values[MetricUploadedBytes] != float64(len(data)) || metrics.values[MetricUploadRetries] != 1 {
+		t.Fatalf("unexpected bytes or retries %v", metrics.values)
+	}
+	// 第一个分片失败一次，2个块共 3 次分片请求，加上 mkfile 一共 4 次请求
+	if metrics.counts[MetricChunkDuration+"failure"] != 1 || metrics.counts[MetricChunkDuration+"success"] != 2 {
+		t.Fatalf("unexpected chunk metrics %v", metrics.counts)
+	}
+	if metrics.counts[MetricRequestDuration+"failure"] != 1 || metrics.counts[MetricRequestDuration+"success"] != 3 {
+		t.Fatalf("unexpected request metrics %v", metrics.counts)
+	}
+
+	// 没有设置 Metrics 的时候不记录
+	form := NewFormUploader(nil)
+	if err = form.Put(context.Background(), &putRet, "token", "metrics", strings.NewReader("form"), 4, &PutExtra{UpHost: upServer.URL}); err != nil {
+		t.Fatalf("FormUploader#Put() error, %s", err)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package storage
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapReaderAt 在不支持 mmap 的平台上没有实现，mmapFile 总是返回错误
+type mmapReaderAt struct{}
+
+// mmapFile 在不支持 mmap 的平台上总是返回错误，调用方回退到直接读取文件
+func mmapFile(f *os.File, size int64) (r *mmapReaderAt, err error) {
+	err = errors.New("mmap: not supported on this platform")
+	return
+}
+
+func (r *mmapReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	return 0, errors.New("mmap: not supported on this platform")
+}
+
+func (r *mmapReaderAt) Close() error {
+	return nil
+}
@@ -0,0 +1,68 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// errMmapClosed 表示在 Close 之后调用了 ReadAt
+var errMmapClosed = errors.New("mmap: reader is closed")
+
+// mmapReaderAt 是使用 mmap 映射整个文件的 io.ReaderAt，读取数据的时候不需要额外的系统调用。
+// 上传返回之后 http.Transport 可能还在读取请求的 body，所以 Close 需要等待正在进行的 ReadAt 结束之后才解除映射，
+// 之后的 ReadAt 返回错误，而不是访问已经解除映射的内存
+type mmapReaderAt struct {
+	mu   sync.RWMutex
+	data []byte
+}
+
+// mmapFile 将文件 f 的前 size 个字节映射到内存中，映射失败的时候返回错误，调用方应该回退到直接读取文件
+func mmapFile(f *os.File, size int64) (r *mmapReaderAt, err error) {
+	if size <= 0 || int64(int(size)) != size {
+		err = errors.New("mmap: invalid file size")
+		return
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return
+	}
+	r = &mmapReaderAt{data: data}
+	return
+}
+
+func (r *mmapReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("mmap: negative offset")
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.data == nil {
+		return 0, errMmapClosed
+	}
+	if off >= int64(len(r.data)) {
+		return 0, io.EOF
+	}
+	n = copy(p, r.data[off:])
+	if n < len(p) {
+		err = io.EOF
+	}
+	return
+}
+
+// Close 等待正在进行的 ReadAt 结束之后解除文件的内存映射，之后的 ReadAt 返回错误
+func (r *mmapReaderAt) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.data == nil {
+		return nil
+	}
+	data := r.data
+	r.data = nil
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,38 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestMmapReaderAtClose(t *testing.T) {
+	f, err := ioutil.TempFile("", "mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	f.Write([]byte("0123456789"))
+
+	m, err := mmapFile(f, 10)
+	if err != nil {
+		t.Fatalf("mmapFile() error, %s", err)
+	}
+	p := make([]byte, 4)
+	if n, err := m.ReadAt(p, 3); err != nil || string(p[:n]) != "3456" {
+		t.Fatalf("ReadAt() = %q, %v", p[:n], err)
+	}
+	if err = m.Close(); err != nil {
+		t.Fatalf("Close() error, %s", err)
+	}
+	if _, err = m.ReadAt(p, 0); err != errMmapClosed {
+		t.Fatalf("ReadAt() after Close error = %v, want errMmapClosed", err)
+	}
+	if err = m.Close(); err != nil {
+		t.Fatalf("Close() twice error, %s", err)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/qiniu/api.v7/auth/qbox"
 	"github.com/qiniu/api.v7/conf"
 	"net/http"
+	"net/url"
+	"time"
 )
 
 // OperationManager 提供了数据处理相关的方法
@@ -13,6 +15,12 @@ type OperationManager struct {
 	Client *Client
 	Mac    *qbox.Mac
 	Cfg    *Config
+
+	// 可选。设置之后使用 Credentials 当前的密钥对请求签名，忽略 Mac，用来在运行时更换密钥
+	Credentials qbox.Credentials
+
+	// 可选。管理凭证的签名方式，默认为 qbox.AuthQBox，调用 JSON 格式 body 的 API 的时候可以使用 qbox.AuthAuto
+	AuthType qbox.AuthType
 }
 
 // NewOperationManager 用来构建一个新的数据处理对象
@@ -45,11 +53,33 @@ func NewOperationManagerEx(mac *qbox.Mac, cfg *Config, client *Client) *Operatio
 	}
 }
 
+// mac 返回当前用来签名的密钥
+func (m *OperationManager) mac() *qbox.Mac {
+	if m.Credentials != nil {
+		return m.Credentials.Get()
+	}
+	return m.Mac
+}
+
+// withMac 在 ctx 中设置签名使用的密钥和签名方式
+func (m *OperationManager) withMac(ctx context.Context) context.Context {
+	return withMac(ctx, m.mac(), m.AuthType)
+}
+
 // PfopRet 为数据处理请求的回复内容
 type PfopRet struct {
 	PersistentID string `json:"persistentId,omitempty"`
 }
 
+// 持久化数据处理的状态码，参考 PrefopRet.Code
+const (
+	PfopStatusSuccess      = 0 // 成功
+	PfopStatusWaiting      = 1 // 等待处理
+	PfopStatusProcessing   = 2 // 正在处理
+	PfopStatusFailed       = 3 // 处理失败
+	PfopStatusNotifyFailed = 4 // 处理成功，但是通知 notifyURL 失败
+)
+
 // PrefopRet 为数据处理请求的状态查询回复内容
 type PrefopRet struct {
 	ID          string `json:"id"`
@@ -62,6 +92,24 @@ type PrefopRet struct {
 	Items       []FopResult
 }
 
+// Done 返回数据处理是否已经结束，结束之后通过 Code 判断是否成功
+func (r *PrefopRet) Done() bool {
+	return r.Code != PfopStatusWaiting && r.Code != PfopStatusProcessing
+}
+
+// Err 在数据处理失败的时候返回错误，包含第一个失败的指令的错误信息，处理成功或者只是通知失败的时候返回 nil
+func (r *PrefopRet) Err() error {
+	if r.Code == PfopStatusSuccess || r.Code == PfopStatusNotifyFailed || !r.Done() {
+		return nil
+	}
+	for _, item := range r.Items {
+		if item.Error != "" {
+			return fmt.Errorf("pfop %s failed: %s: %s", r.ID, item.Cmd, item.Error)
+		}
+	}
+	return fmt.Errorf("pfop %s failed: %s", r.ID, r.Desc)
+}
+
 func (r *PrefopRet) String() string {
 	strData := fmt.Sprintf("Id: %s\r\nCode: %d\r\nDesc: %s\r\n", r.ID, r.Code, r.Desc)
 	if r.InputBucket != "" {
@@ -125,6 +173,12 @@ type FopResult struct {
 //	force		强制执行数据处理
 //
 func (m *OperationManager) Pfop(bucket, key, fops, pipeline, notifyURL string,
+	force bool) (persistentID string, err error) {
+	return m.PfopContext(context.TODO(), bucket, key, fops, pipeline, notifyURL, force)
+}
+
+// PfopContext 和 Pfop 相同，ctx 用来取消请求，fops 可以使用 FopBuilder 生成
+func (m *OperationManager) PfopContext(ctx context.Context, bucket, key, fops, pipeline, notifyURL string,
 	force bool) (persistentID string, err error) {
 	pfopParams := map[string][]string{
 		"bucket": []string{bucket},
@@ -144,7 +198,7 @@ func (m *OperationManager) Pfop(bucket, key, fops, pipeline, notifyURL string,
 		pfopParams["force"] = []string{"1"}
 	}
 	var ret PfopRet
-	ctx := context.WithValue(context.TODO(), "mac", m.Mac)
+	ctx = m.withMac(ctx)
 	reqHost, reqErr := m.ApiHost(bucket)
 	if reqErr != nil {
 		err = reqErr
@@ -164,21 +218,52 @@ func (m *OperationManager) Pfop(bucket, key, fops, pipeline, notifyURL string,
 
 // Prefop 持久化处理状态查询
 func (m *OperationManager) Prefop(persistentID string) (ret PrefopRet, err error) {
-	ctx := context.TODO()
+	return m.PrefopContext(context.TODO(), persistentID)
+}
+
+// PrefopContext 和 Prefop 相同，ctx 用来取消请求
+func (m *OperationManager) PrefopContext(ctx context.Context, persistentID string) (ret PrefopRet, err error) {
 	reqHost := m.PrefopApiHost(persistentID)
-	reqURL := fmt.Sprintf("%s/status/get/prefop?id=%s", reqHost, persistentID)
+	reqURL := fmt.Sprintf("%s/status/get/prefop?id=%s", reqHost, url.QueryEscape(persistentID))
 	headers := http.Header{}
 	headers.Add("Content-Type", conf.CONTENT_TYPE_FORM)
 	err = m.Client.Call(ctx, &ret, "GET", reqURL, headers)
 	return
 }
 
+// 查询持久化数据处理状态的最长间隔
+const maxPfopWaitInterval = 30 * time.Second
+
+// WaitForPfop 查询持久化数据处理的状态，直到处理结束或者 ctx 被取消。
+// 查询的间隔从 interval 开始（不设定则为 1 秒），每次加倍，最长为 30 秒，
+// 处理结束之后返回最后一次查询的结果，需要通过 ret.Code 判断是否处理成功
+func (m *OperationManager) WaitForPfop(ctx context.Context, persistentID string,
+	interval time.Duration) (ret PrefopRet, err error) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	for {
+		if ret, err = m.PrefopContext(ctx, persistentID); err != nil || ret.Done() {
+			return
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		}
+		if interval *= 2; interval > maxPfopWaitInterval {
+			interval = maxPfopWaitInterval
+		}
+	}
+}
+
 func (m *OperationManager) ApiHost(bucket string) (apiHost string, err error) {
 	var zone *Zone
 	if m.Cfg.Zone != nil {
 		zone = m.Cfg.Zone
 	} else {
-		if v, zoneErr := GetZone(m.Mac.AccessKey, bucket); zoneErr != nil {
+		if v, zoneErr := getZone(context.TODO(), m.Client, m.Cfg.UcReqHost(), m.mac().AccessKey, bucket); zoneErr != nil {
 			err = zoneErr
 			return
 		} else {
@@ -186,11 +271,7 @@ func (m *OperationManager) ApiHost(bucket string) (apiHost string, err error) {
 		}
 	}
 
-	scheme := "http://"
-	if m.Cfg.UseHTTPS {
-		scheme = "https://"
-	}
-	apiHost = fmt.Sprintf("%s%s", scheme, zone.ApiHost)
+	apiHost = zone.GetApiHost(m.Cfg.useHTTPS())
 
 	return
 }
@@ -201,11 +282,7 @@ func (m *OperationManager) PrefopApiHost(persistentID string) (apiHost string) {
 		apiHost = m.Cfg.Zone.ApiHost
 	}
 
-	if m.Cfg.UseHTTPS {
-		apiHost = fmt.Sprintf("https://%s", apiHost)
-	} else {
-		apiHost = fmt.Sprintf("http://%s", apiHost)
-	}
+	apiHost = withScheme(apiHost, m.Cfg.useHTTPS())
 
 	return
 }
@@ -1,10 +1,15 @@
 package storage
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -43,3 +48,53 @@ func TestPfop(t *testing.T) {
 	t.Logf("persistentId: %s", pid)
 
 }
+
+func TestWaitForPfop(t *testing.T) {
+	var pfopParams url.Values
+	queries := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/pfop/":
+			req.ParseForm()
+			pfopParams = req.PostForm
+			w.Write([]byte(`{"persistentId":"z0.abc"}`))
+		case "/status/get/prefop":
+			if req.URL.Query().Get("id") != "z0.abc" {
+				http.NotFound(w, req)
+				return
+			}
+			queries++
+			code := PfopStatusProcessing
+			if queries == 3 {
+				code = PfopStatusSuccess
+			}
+			fmt.Fprintf(w, `{"id":"z0.abc","code":%d,"items":[{"cmd":"avthumb/mp4","code":%d}]}`, code, code)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	m := NewOperationManager(mac, &Config{Zone: &Zone{ApiHost: server.URL}})
+	fops := NewFopBuilder().Pipe(Avthumb{Format: "mp4"}).SaveAs("bucket", "a.mp4").String()
+	pid, err := m.PfopContext(context.Background(), "bucket", "a.mov", fops, "pipeline", "", true)
+	if err != nil || pid != "z0.abc" {
+		t.Fatalf("PfopContext() error, %v, %s", err, pid)
+	}
+	if pfopParams.Get("fops") != fops || pfopParams.Get("pipeline") != "pipeline" || pfopParams.Get("force") != "1" {
+		t.Fatalf("PfopContext() wrong params, %v", pfopParams)
+	}
+
+	ret, err := m.WaitForPfop(context.Background(), pid, time.Millisecond)
+	if err != nil || !ret.Done() || ret.Code != PfopStatusSuccess || queries != 3 {
+		t.Fatalf("WaitForPfop() error, %v, %v, %d", err, ret, queries)
+	}
+
+	queries = -100
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err = m.WaitForPfop(ctx, pid, time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatalf("WaitForPfop() should stop when ctx is done, %v", err)
+	}
+}
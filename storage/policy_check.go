@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PolicyViolationError 表示要上传的文件不满足上传凭证中的上传策略，在上传之前就可以发现，不需要等到服务端返回 403
+type PolicyViolationError struct {
+	Field   string // 不满足的上传策略字段，比如 "fsizeLimit" 或者 "mimeLimit"
+	Message string
+}
+
+func (e *PolicyViolationError) Error() string {
+	return fmt.Sprintf("put policy violation, %s: %s", e.Field, e.Message)
+}
+
+// checkPutPolicy 检查要上传的文件是否满足上传凭证中的 fsizeMin、fsizeLimit 和 mimeLimit，
+// fsize 小于 0 的时候不检查大小，mimeType 为空的时候不检查 MimeType。上传凭证无法解析的时候不检查，交给服务端处理。
+func checkPutPolicy(upToken string, fsize int64, mimeType string) error {
+	info, err := ParseUploadToken(upToken)
+	if err != nil {
+		return nil
+	}
+	policy := &info.Policy
+
+	if fsize >= 0 {
+		if policy.FsizeLimit > 0 && fsize > policy.FsizeLimit {
+			return &PolicyViolationError{
+				Field:   "fsizeLimit",
+				Message: fmt.Sprintf("file size %d exceeds the limit %d", fsize, policy.FsizeLimit),
+			}
+		}
+		if policy.FsizeMin > 0 && fsize < policy.FsizeMin {
+			return &PolicyViolationError{
+				Field:   "fsizeMin",
+				Message: fmt.Sprintf("file size %d is less than the minimum %d", fsize, policy.FsizeMin),
+			}
+		}
+	}
+	if mimeType != "" && policy.MimeLimit != "" && !matchMimeLimit(policy.MimeLimit, mimeType) {
+		return &PolicyViolationError{
+			Field:   "mimeLimit",
+			Message: fmt.Sprintf("mime type %s is not allowed by %s", mimeType, policy.MimeLimit),
+		}
+	}
+	return nil
+}
+
+// matchMimeLimit 检查 mimeType 是否满足 mimeLimit，mimeLimit 为以 ';' 分隔的 MimeType 列表，可以使用 "image/*" 的形式，
+// 以 '!' 开头的时候表示不允许列表中的 MimeType
+func matchMimeLimit(mimeLimit, mimeType string) bool {
+	deny := strings.HasPrefix(mimeLimit, "!")
+	mimeLimit = strings.TrimPrefix(mimeLimit, "!")
+	if i := strings.IndexByte(mimeType, ';'); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+
+	matched := false
+	for _, pattern := range strings.Split(mimeLimit, ";") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == mimeType || strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mimeType, pattern[:len(pattern)-1]) {
+			matched = true
+			break
+		}
+	}
+	return matched != deny
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestMatchMimeLimit(t *testing.T) {
+	cases := []struct {
+		mimeLimit, mimeType string
+		matched             bool
+	}{
+		{"image/*", "image/jpeg", true},
+		{"image/*", "video/mp4", false},
+		{"image/jpeg;image/png", "image/png", true},
+		{"!application/json;text/plain", "text/plain; charset=utf-8", false},
+		{"!application/json;text/plain", "image/png", true},
+	}
+	for _, c := range cases {
+		if matched := matchMimeLimit(c.mimeLimit, c.mimeType); matched != c.matched {
+			t.Fatalf("matchMimeLimit(%q, %q) = %v", c.mimeLimit, c.mimeType, matched)
+		}
+	}
+}
+
+func TestPutPolicyViolation(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	upToken, err := MakeUploadToken(mac, "bucket", "", 0, &PutPolicy{FsizeLimit: 1024, MimeLimit: "image/*"})
+	if err != nil {
+		t.Fatalf("MakeUploadToken() error, %s", err)
+	}
+
+	data := make([]byte, 2048)
+	var putRet PutRet
+	err = formUploader.Put(context.Background(), &putRet, upToken, "large", bytes.NewReader(data), int64(len(data)), &PutExtra{UpHost: server.URL})
+	if pErr, ok := err.(*PolicyViolationError); !ok || pErr.Field != "fsizeLimit" {
+		t.Fatalf("FormUploader#Put() error, expected fsizeLimit violation, got %v", err)
+	}
+
+	extra := RputExtra{UpHost: server.URL, MimeType: "video/mp4"}
+	err = resumeUploader.Put(context.Background(), &putRet, upToken, "video", bytes.NewReader(data[:1000]), 1000, &extra)
+	if pErr, ok := err.(*PolicyViolationError); !ok || pErr.Field != "mimeLimit" {
+		t.Fatalf("ResumeUploader#Put() error, expected mimeLimit violation, got %v", err)
+	}
+	if server.forms != 0 || len(server.blocks) != 0 {
+		t.Fatalf("files violating the put policy should not be uploaded")
+	}
+}
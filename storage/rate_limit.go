@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimitReadSize 为限速时每次读取数据的最大字节数，避免一次读取太多数据导致速度波动过大
+const rateLimitReadSize = 32 * 1024
+
+// rateLimiter 是一个简单的令牌桶限速器，多个并发上传的 Goroutine 可以共用同一个限速器
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   int64     // 每秒允许通过的字节数，同时也是令牌桶的容量
+	tokens float64   // 当前可用的令牌数，可以为负数，表示已经预支的令牌
+	last   time.Time // 上一次补充令牌的时间
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{
+		rate:   rate,
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// wait 申请 n 个字节的令牌，令牌不足的时候等待，直到令牌补足或者 ctx 被取消
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+	if l.tokens > float64(l.rate) {
+		l.tokens = float64(l.rate)
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimitedReader 按照限速器的速度读取数据
+type rateLimitedReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *rateLimiter
+}
+
+// limitReader 在设置了限速器的时候返回一个限速读取的 io.Reader，否则直接返回 r
+func limitReader(ctx context.Context, r io.Reader, limiter *rateLimiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+	return &rateLimitedReader{ctx: ctx, reader: r, limiter: limiter}
+}
+
+func (r *rateLimitedReader) Read(p []byte) (n int, err error) {
+	if len(p) > rateLimitReadSize {
+		p = p[:rateLimitReadSize]
+	}
+	n, err = r.reader.Read(p)
+	if n > 0 {
+		if wErr := r.limiter.wait(r.ctx, n); wErr != nil {
+			err = wErr
+		}
+	}
+	return
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedReader(t *testing.T) {
+	data := make([]byte, 128*1024)
+	limiter := newRateLimiter(64 * 1024)
+
+	start := time.Now()
+	n, err := io.Copy(ioutil.Discard, limitReader(context.Background(), bytes.NewReader(data), limiter))
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("rateLimitedReader.Read() error, n = %d, err = %v", n, err)
+	}
+	// 令牌桶初始时有 1 秒的令牌，剩下的 64KB 需要再等待 1 秒
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Fatalf("rateLimitedReader.Read() too fast, elapsed %s", elapsed)
+	}
+}
+
+func TestRateLimitedReaderCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	data := make([]byte, 128*1024)
+	limiter := newRateLimiter(1024)
+	_, err := io.Copy(ioutil.Discard, limitReader(ctx, bytes.NewReader(data), limiter))
+	if err != context.Canceled {
+		t.Fatalf("rateLimitedReader.Read() expected context.Canceled, got %v", err)
+	}
+}
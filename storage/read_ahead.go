@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// chunkReader 读取分片上传中每个片的数据。开启预读之后，在上传当前片的同时在后台读取下一个片的数据，
+// 减少高延迟网络下读取文件的等待时间，每个正在上传的块最多额外占用两个片大小的内存。
+// 使用完毕之后需要调用 close 等待后台的读取结束，之后调用方才可以关闭 f
+type chunkReader struct {
+	ctx       context.Context
+	f         io.ReaderAt
+	readAhead bool
+
+	// 当前片的数据，重试的时候直接使用
+	curOff  int64
+	curData []byte
+
+	// 正在预读的片
+	nextOff  int64
+	nextSize int
+	next     chan chunkData
+}
+
+type chunkData struct {
+	data []byte
+	err  error
+}
+
+func newChunkReader(ctx context.Context, f io.ReaderAt, readAhead bool) *chunkReader {
+	return &chunkReader{ctx: ctx, f: f, readAhead: readAhead}
+}
+
+// read 返回从 off 开始的 size 个字节的数据
+func (r *chunkReader) read(off int64, size int) (io.Reader, error) {
+	if !r.readAhead {
+		return io.NewSectionReader(r.f, off, int64(size)), nil
+	}
+
+	if r.curData == nil || r.curOff != off || len(r.curData) != size {
+		r.curData = nil
+		if r.next != nil && r.nextOff == off && r.nextSize == size {
+			chunk := <-r.next
+			r.next = nil
+			if chunk.err != nil {
+				return nil, chunk.err
+			}
+			r.curData = chunk.data
+		} else {
+			r.discard()
+			data, err := readChunk(r.f, off, size)
+			if err != nil {
+				return nil, err
+			}
+			r.curData = data
+		}
+		r.curOff = off
+	}
+	return bytes.NewReader(r.curData), nil
+}
+
+// prefetch 在后台读取从 off 开始的 size 个字节的数据，没有开启预读的时候什么也不做
+func (r *chunkReader) prefetch(off int64, size int) {
+	if !r.readAhead || size <= 0 {
+		return
+	}
+	if r.next != nil && r.nextOff == off && r.nextSize == size {
+		return
+	}
+
+	r.discard()
+
+	next := make(chan chunkData, 1)
+	r.nextOff, r.nextSize, r.next = off, size, next
+	ctx, f := r.ctx, r.f
+	go func() {
+		if err := ctx.Err(); err != nil {
+			next <- chunkData{err: err}
+			return
+		}
+		data, err := readChunk(f, off, size)
+		next <- chunkData{data: data, err: err}
+	}()
+}
+
+// discard 等待正在预读的片读取完毕并丢弃读取的数据
+func (r *chunkReader) discard() {
+	if r.next != nil {
+		<-r.next
+		r.next = nil
+	}
+}
+
+// close 等待后台的预读结束，返回之后不会再读取 f
+func (r *chunkReader) close() {
+	r.discard()
+	r.curData = nil
+}
+
+func readChunk(f io.ReaderAt, off int64, size int) (data []byte, err error) {
+	data = make([]byte, size)
+	n, err := f.ReadAt(data, off)
+	if n == size {
+		return data, nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return nil, err
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type blockingReaderAt struct {
+	started chan struct{}
+	release chan struct{}
+	reads   int32
+}
+
+func (r *blockingReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	atomic.AddInt32(&r.reads, 1)
+	r.started <- struct{}{}
+	<-r.release
+	return len(p), nil
+}
+
+func TestChunkReaderCloseWaitsPrefetch(t *testing.T) {
+	f := &blockingReaderAt{started: make(chan struct{}, 1), release: make(chan struct{})}
+	chunks := newChunkReader(context.Background(), f, true)
+	chunks.prefetch(0, 16)
+	<-f.started
+
+	closed := make(chan struct{})
+	go func() {
+		chunks.close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("close() should wait for the prefetch goroutine")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(f.release)
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close() did not return after the prefetch finished")
+	}
+}
+
+func TestChunkReaderPrefetchCanceled(t *testing.T) {
+	f := &blockingReaderAt{started: make(chan struct{}, 1), release: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	chunks := newChunkReader(ctx, f, true)
+	chunks.prefetch(0, 16)
+	if _, err := chunks.read(0, 16); err != context.Canceled {
+		t.Fatalf("read() error = %v, want context.Canceled", err)
+	}
+	chunks.close()
+	if n := atomic.LoadInt32(&f.reads); n != 0 {
+		t.Fatalf("prefetch should not read after ctx is canceled, reads = %d", n)
+	}
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ProgressRecorder 用来持久化分片上传的进度，上传中断之后可以从记录的进度继续上传
+type ProgressRecorder interface {
+	// Get 读取上传进度，没有记录的时候返回 nil
+	Get(key string) ([]BlkputRet, error)
+
+	// Set 保存上传进度，每个块上传完毕之后都会调用
+	Set(key string, progresses []BlkputRet) error
+
+	// Delete 删除上传进度，文件上传成功之后调用
+	Delete(key string) error
+}
+
+// FileProgressRecorder 将上传进度以文件的方式保存在指定的目录下
+type FileProgressRecorder struct {
+	Dir string
+}
+
+// NewFileProgressRecorder 用来构建一个基于本地文件的上传进度记录器，dir 目录不存在时会自动创建
+func NewFileProgressRecorder(dir string) (*FileProgressRecorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileProgressRecorder{Dir: dir}, nil
+}
+
+type fileProgress struct {
+	Progresses []BlkputRet `json:"progresses"`
+}
+
+func (r *FileProgressRecorder) path(key string) string {
+	h := md5.Sum([]byte(key))
+	return filepath.Join(r.Dir, hex.EncodeToString(h[:])+".progress")
+}
+
+// Get 读取上传进度，没有记录的时候返回 nil
+func (r *FileProgressRecorder) Get(key string) (progresses []BlkputRet, err error) {
+	data, err := ioutil.ReadFile(r.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	var record fileProgress
+	if err = json.Unmarshal(data, &record); err != nil {
+		return
+	}
+	progresses = record.Progresses
+	return
+}
+
+// Set 保存上传进度
+func (r *FileProgressRecorder) Set(key string, progresses []BlkputRet) (err error) {
+	data, err := json.Marshal(fileProgress{Progresses: progresses})
+	if err != nil {
+		return
+	}
+
+	// 先写临时文件再重命名，避免进程中途退出留下不完整的进度文件
+	path := r.path(key)
+	tmpPath := path + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Delete 删除上传进度
+func (r *FileProgressRecorder) Delete(key string) (err error) {
+	err = os.Remove(r.path(key))
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
+
+// recorderKey 生成本地文件上传进度的记录标识，文件大小、修改时间或者块大小发生变化后不会再复用之前的进度
+func recorderKey(upToken, key, localFile string, fi os.FileInfo, blkSize int) string {
+	_, bucket, _ := getAkBucketFromUploadToken(upToken)
+	if absPath, err := filepath.Abs(localFile); err == nil {
+		localFile = absPath
+	}
+	return fmt.Sprintf("%s:%s:%s:%d:%d:%d", bucket, key, localFile, fi.Size(), fi.ModTime().UnixNano(), blkSize)
+}
+
+// loadProgresses 读取记录的上传进度，记录无效的时候返回 nil，过期的块会被重置，重新上传
+func loadProgresses(recorder ProgressRecorder, key string, blockCnt int) []BlkputRet {
+	progresses, err := recorder.Get(key)
+	if err != nil || len(progresses) != blockCnt {
+		return nil
+	}
+	for i := range progresses {
+		if IsContextExpired(progresses[i]) {
+			progresses[i] = BlkputRet{}
+		}
+	}
+	return progresses
+}
+
+// progressRecord 用来在多个块并行上传的时候保存上传进度
+type progressRecord struct {
+	mu         sync.Mutex
+	recorder   ProgressRecorder
+	key        string
+	progresses []BlkputRet
+}
+
+func newProgressRecord(recorder ProgressRecorder, key string, progresses []BlkputRet) *progressRecord {
+	r := &progressRecord{
+		recorder:   recorder,
+		key:        key,
+		progresses: make([]BlkputRet, len(progresses)),
+	}
+	copy(r.progresses, progresses)
+	return r
+}
+
+func (r *progressRecord) save(blkIdx int, ret BlkputRet) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.progresses[blkIdx] = ret
+	return r.recorder.Set(r.key, r.progresses)
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFileProgressRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qiniu-progress")
+	if err != nil {
+		t.Fatalf("TempDir() error, %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	recorder, err := NewFileProgressRecorder(dir)
+	if err != nil {
+		t.Fatalf("NewFileProgressRecorder() error, %s", err)
+	}
+
+	recordKey := "bucket:key:/path/to/file"
+	progresses, err := recorder.Get(recordKey)
+	if err != nil || progresses != nil {
+		t.Fatalf("Get() expect empty progress, got %v, %v", progresses, err)
+	}
+
+	saved := []BlkputRet{{Ctx: "ctx1", Offset: 4194304}, {}}
+	if err = recorder.Set(recordKey, saved); err != nil {
+		t.Fatalf("Set() error, %s", err)
+	}
+	progresses, err = recorder.Get(recordKey)
+	if err != nil {
+		t.Fatalf("Get() error, %s", err)
+	}
+	if len(progresses) != 2 || progresses[0].Ctx != "ctx1" || progresses[0].Offset != 4194304 {
+		t.Fatalf("Get() unexpected progress, %v", progresses)
+	}
+
+	if err = recorder.Delete(recordKey); err != nil {
+		t.Fatalf("Delete() error, %s", err)
+	}
+	if progresses, _ = recorder.Get(recordKey); progresses != nil {
+		t.Fatalf("Get() expect empty progress after Delete(), got %v", progresses)
+	}
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"strings"
+)
+
+// Region 为空间所在区域的服务域名，UpHosts 中优先使用的上传域名排在前面。
+// 域名一般不包含协议，默认使用 https，设置了 Config.DisableHTTPS 的时候使用 http；包含协议的域名按照指定的协议访问
+type Region struct {
+	UpHosts []string
+	IoHost  string
+	RsHost  string
+	RsfHost string
+	ApiHost string
+}
+
+// Region 返回机房对应的区域，useCdnDomains 为 true 的时候加速上传域名排在源站上传域名前面
+func (z *Zone) Region(useCdnDomains bool) *Region {
+	hosts, backupHosts := z.SrcUpHosts, z.CdnUpHosts
+	if useCdnDomains {
+		hosts, backupHosts = z.CdnUpHosts, z.SrcUpHosts
+	}
+	upHosts := make([]string, 0, len(hosts)+len(backupHosts))
+	upHosts = append(upHosts, hosts...)
+	upHosts = append(upHosts, backupHosts...)
+	return &Region{
+		UpHosts: upHosts,
+		IoHost:  z.IovipHost,
+		RsHost:  z.RsHost,
+		RsfHost: z.RsfHost,
+		ApiHost: z.ApiHost,
+	}
+}
+
+// Zone 返回区域对应的机房，用于设置 Config.Zone，UpHosts 全部作为源站上传域名
+func (r *Region) Zone() *Zone {
+	return &Zone{
+		SrcUpHosts: append([]string(nil), r.UpHosts...),
+		IovipHost:  r.IoHost,
+		RsHost:     r.RsHost,
+		RsfHost:    r.RsfHost,
+		ApiHost:    r.ApiHost,
+	}
+}
+
+// GetRegion 根据 ak 和 bucket 查询空间所在的区域，查询结果和 GetZone 共用缓存，按照服务端返回的 ttl 过期
+func GetRegion(ak, bucket string) (region *Region, err error) {
+	return GetRegionContext(context.Background(), ak, bucket)
+}
+
+// GetRegionContext 和 GetRegion 相同，ctx 用于取消查询请求
+func GetRegionContext(ctx context.Context, ak, bucket string) (region *Region, err error) {
+	zone, err := getZone(ctx, nil, UcHost, ak, bucket)
+	if err != nil {
+		return
+	}
+	region = zone.Region(false)
+	return
+}
+
+// 公有云各个区域的服务域名
+var (
+	RegionHuadong  = *ZoneHuadong.Region(false)
+	RegionHuabei   = *ZoneHuabei.Region(false)
+	RegionHuanan   = *ZoneHuanan.Region(false)
+	RegionBeimei   = *ZoneBeimei.Region(false)
+	RegionXinjiapo = *ZoneXinjiapo.Region(false)
+)
+
+// GetRegionByID 根据区域 ID 获取公有云的区域，比如 RIDHuadong，返回的是预设区域的副本，不存在的区域 ID 返回 false
+func GetRegionByID(regionID string) (region Region, ok bool) {
+	switch regionID {
+	case RIDHuadong:
+		region, ok = RegionHuadong, true
+	case RIDHuabei:
+		region, ok = RegionHuabei, true
+	case RIDHuanan:
+		region, ok = RegionHuanan, true
+	case RIDBeimei:
+		region, ok = RegionBeimei, true
+	case RIDXinjiapo:
+		region, ok = RegionXinjiapo, true
+	}
+	region.UpHosts = append([]string(nil), region.UpHosts...)
+	return
+}
+
+// WithScheme 返回全部域名都使用 scheme 的区域，scheme 为 http 或者 https。
+// 指定了协议的域名不受 Config.DisableHTTPS 的影响，一般用于私有云只提供其中一种协议的场景，比如：
+//
+//	region := storage.Region{
+//		UpHosts: []string{"up.kodo.example.com"},
+//		IoHost:  "io.kodo.example.com",
+//		RsHost:  "rs.kodo.example.com",
+//		RsfHost: "rsf.kodo.example.com",
+//		ApiHost: "api.kodo.example.com",
+//	}
+//	cfg.Zone = region.WithScheme("http").Zone()
+func (r *Region) WithScheme(scheme string) *Region {
+	prefix := strings.TrimSuffix(scheme, "://") + "://"
+	setScheme := func(host string) string {
+		if host == "" {
+			return host
+		}
+		if i := strings.Index(host, "://"); i >= 0 {
+			host = host[i+3:]
+		}
+		return prefix + host
+	}
+	region := &Region{
+		UpHosts: make([]string, len(r.UpHosts)),
+		IoHost:  setScheme(r.IoHost),
+		RsHost:  setScheme(r.RsHost),
+		RsfHost: setScheme(r.RsfHost),
+		ApiHost: setScheme(r.ApiHost),
+	}
+	for i, host := range r.UpHosts {
+		region.UpHosts[i] = setScheme(host)
+	}
+	return region
+}
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetZoneCacheTTL(t *testing.T) {
+	queries := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		if r.URL.Path != "/v2/query" || r.URL.Query().Get("ak") != "ak" || r.URL.Query().Get("bucket") != "region-bucket" {
+			t.Errorf("unexpected query %s", r.URL)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ttl":600,"io":{"src":{"main":["iovip-z1.qbox.me"]}},` +
+			`"up":{"src":{"main":["up-z1.qiniup.com"]},"acc":{"main":["upload-z1.qiniup.com"],"backup":["upload-z1-bak.qiniup.com"]}}}`))
+	}))
+	defer server.Close()
+
+	zoneID := server.URL + ":ak:region-bucket"
+	defer func() {
+		zoneMutext.Lock()
+		delete(zoneCache, zoneID)
+		zoneMutext.Unlock()
+	}()
+
+	zone, err := getZone(context.Background(), nil, server.URL, "ak", "region-bucket")
+	if err != nil {
+		t.Fatalf("getZone() error, %s", err)
+	}
+	if zone.RsHost != "rs-z1.qbox.me" || zone.ApiHost != "api-z1.qiniu.com" || zone.IovipHost != "iovip-z1.qbox.me" {
+		t.Fatalf("getZone() = %v", zone)
+	}
+	zoneMutext.RLock()
+	entry := zoneCache[zoneID]
+	zoneMutext.RUnlock()
+	if ttl := entry.expiresAt.Sub(time.Now()); ttl < 590*time.Second || ttl > 600*time.Second {
+		t.Fatalf("cache ttl = %s, want 600s", ttl)
+	}
+
+	if _, err = getZone(context.Background(), nil, server.URL, "ak", "region-bucket"); err != nil || queries != 1 {
+		t.Fatalf("getZone() should use cache, queries = %d, error = %v", queries, err)
+	}
+
+	zoneMutext.Lock()
+	entry.expiresAt = time.Now().Add(-time.Second)
+	zoneCache[zoneID] = entry
+	zoneMutext.Unlock()
+	if _, err = getZone(context.Background(), nil, server.URL, "ak", "region-bucket"); err != nil || queries != 2 {
+		t.Fatalf("getZone() should query again after ttl, queries = %d, error = %v", queries, err)
+	}
+
+	region := zone.Region(true)
+	want := []string{"upload-z1.qiniup.com", "upload-z1-bak.qiniup.com", "up-z1.qiniup.com"}
+	if len(region.UpHosts) != len(want) {
+		t.Fatalf("Region().UpHosts = %v, want %v", region.UpHosts, want)
+	}
+	for i, host := range want {
+		if region.UpHosts[i] != host {
+			t.Fatalf("Region().UpHosts = %v, want %v", region.UpHosts, want)
+		}
+	}
+	if region.RsfHost != "rsf-z1.qbox.me" || region.IoHost != "iovip-z1.qbox.me" {
+		t.Fatalf("Region() = %v", region)
+	}
+	if z := region.Zone(); len(z.SrcUpHosts) != 3 || z.ApiHost != zone.ApiHost {
+		t.Fatalf("Region().Zone() = %v", z)
+	}
+}
+
+func TestGetZoneNoIoHost(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ttl":600,"io":{},"up":{}}`))
+	}))
+	defer server.Close()
+
+	if _, err := getZone(context.Background(), nil, server.URL, "ak", "empty-bucket"); err == nil {
+		t.Fatal("getZone() should fail without io host")
+	}
+}
+
+func TestGetZoneCachePerUcHost(t *testing.T) {
+	newServer := func(ioHost string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"ttl":600,"io":{"src":{"main":["` + ioHost + `"]}},"up":{}}`))
+		}))
+	}
+	server1, server2 := newServer("iovip-z1.qbox.me"), newServer("io.kodo.example.com")
+	defer server1.Close()
+	defer server2.Close()
+	defer func() {
+		zoneMutext.Lock()
+		delete(zoneCache, server1.URL+":ak:shared-bucket")
+		delete(zoneCache, server2.URL+":ak:shared-bucket")
+		zoneMutext.Unlock()
+	}()
+
+	zone1, err := getZone(context.Background(), nil, server1.URL, "ak", "shared-bucket")
+	if err != nil {
+		t.Fatalf("getZone() error, %s", err)
+	}
+	zone2, err := getZone(context.Background(), nil, server2.URL, "ak", "shared-bucket")
+	if err != nil {
+		t.Fatalf("getZone() error, %s", err)
+	}
+	if zone1.IovipHost != "iovip-z1.qbox.me" || zone2.IovipHost != "io.kodo.example.com" {
+		t.Fatalf("getZone() should cache per uc host, got %s and %s", zone1.IovipHost, zone2.IovipHost)
+	}
+}
+
+func TestRegionPresets(t *testing.T) {
+	region, ok := GetRegionByID(RIDHuanan)
+	if !ok || region.RsHost != "rs-z2.qbox.me" || region.UpHosts[0] != "up-z2.qiniup.com" || len(region.UpHosts) != 6 {
+		t.Fatalf("GetRegionByID(z2) = %v, %v", region, ok)
+	}
+	region.UpHosts[0] = "up.example.com"
+	if RegionHuanan.UpHosts[0] != "up-z2.qiniup.com" {
+		t.Fatal("GetRegionByID() should not share UpHosts with the presets")
+	}
+	if _, ok = GetRegionByID("z9"); ok {
+		t.Fatal("GetRegionByID(z9) should not exist")
+	}
+}
+
+func TestRegionWithScheme(t *testing.T) {
+	region := Region{
+		UpHosts: []string{"up.kodo.example.com", "https://up2.kodo.example.com"},
+		IoHost:  "io.kodo.example.com",
+		RsHost:  "rs.kodo.example.com",
+		ApiHost: "api.kodo.example.com",
+	}
+	private := region.WithScheme("http")
+	if private.UpHosts[1] != "http://up2.kodo.example.com" || private.RsfHost != "" || region.UpHosts[0] != "up.kodo.example.com" {
+		t.Fatalf("WithScheme() = %v", private)
+	}
+
+	cfg := Config{Zone: private.Zone()}
+	upHosts, err := getUpHosts(&cfg, nil, "ak", "bucket")
+	if err != nil || len(upHosts) != 2 || upHosts[0] != "http://up.kodo.example.com" {
+		t.Fatalf("getUpHosts() = %v, %v", upHosts, err)
+	}
+	if host := cfg.Zone.GetRsHost(cfg.useHTTPS()); host != "http://rs.kodo.example.com" {
+		t.Fatalf("GetRsHost() = %s", host)
+	}
+	if host := ZoneHuadong.GetRsHost(true); host != "https://rs.qbox.me" {
+		t.Fatalf("GetRsHost() = %s", host)
+	}
+	cfg.UcHost = "http://uc.kodo.example.com"
+	if host := cfg.UcReqHost(); host != "http://uc.kodo.example.com" {
+		t.Fatalf("UcReqHost() = %s", host)
+	}
+	pfop := NewOperationManager(nil, &cfg)
+	if host := pfop.PrefopApiHost("id"); host != "http://api.kodo.example.com" {
+		t.Fatalf("PrefopApiHost() = %s", host)
+	}
+}
+
+func TestConfigDisableHTTPS(t *testing.T) {
+	cfg := Config{Zone: &ZoneHuadong, ApiHost: "api.kodo.example.com"}
+	bucketManager := NewBucketManager(mac, &cfg)
+	if host, _ := bucketManager.RsHost("bucket"); host != "https://rs.qbox.me" {
+		t.Fatalf("RsHost() = %s, want https by default", host)
+	}
+	if host, _ := bucketManager.ApiReqHost("bucket"); host != "https://api.kodo.example.com" {
+		t.Fatalf("ApiReqHost() = %s, want https by default", host)
+	}
+	if upHosts, _ := getUpHosts(&cfg, nil, "ak", "bucket"); upHosts[0] != "https://up.qiniup.com" {
+		t.Fatalf("getUpHosts() = %v, want https by default", upHosts)
+	}
+
+	cfg.DisableHTTPS = true
+	if host, _ := bucketManager.IoReqHost("bucket"); host != "http://iovip.qbox.me" {
+		t.Fatalf("IoReqHost() = %s, want http with DisableHTTPS", host)
+	}
+	if host, _ := bucketManager.ApiReqHost("bucket"); host != "http://api.kodo.example.com" {
+		t.Fatalf("ApiReqHost() = %s, want http with DisableHTTPS", host)
+	}
+	if host := cfg.RsReqHost(); host != "http://"+DefaultRsHost {
+		t.Fatalf("RsReqHost() = %s, want http with DisableHTTPS", host)
+	}
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+// BucketReplicationRule 为空间的跨区域同步规则，源空间中新上传的文件会被同步到目标空间
+type BucketReplicationRule struct {
+	Name      string `json:"name"`       // 规则名称，在源空间中唯一
+	SrcBucket string `json:"src_bucket"` // 源空间
+	DstBucket string `json:"dst_bucket"` // 目标空间
+	DstRegion string `json:"dst_region"` // 目标空间所在的机房，比如 RIDHuabei
+	Prefix    string `json:"prefix"`     // 只同步以 Prefix 开头的文件，为空表示同步全部文件
+
+	// 源空间删除文件的时候是否同时删除目标空间中的文件
+	SyncDelete bool `json:"sync_delete"`
+}
+
+// Validate 检查同步规则是否合法
+func (r *BucketReplicationRule) Validate() error {
+	if r.Name == "" {
+		return errors.New("replication rule: name is required")
+	}
+	if r.SrcBucket == "" || r.DstBucket == "" || r.DstRegion == "" {
+		return errors.New("replication rule: source bucket, destination bucket and destination region are required")
+	}
+	if r.SrcBucket == r.DstBucket {
+		return errors.New("replication rule: source and destination bucket must be different")
+	}
+	return nil
+}
+
+// 同步任务的状态
+const (
+	ReplicationStatusSyncing = "syncing" // 正在同步
+	ReplicationStatusStopped = "stopped" // 已停止
+	ReplicationStatusFailed  = "failed"  // 同步出错，见 ReplicationStatus.Error
+)
+
+// ReplicationStatus 为同步规则的执行状态
+type ReplicationStatus struct {
+	Name         string `json:"name"`
+	Status       string `json:"status"`
+	SyncedCount  int64  `json:"synced_count"`   // 已经同步的文件数
+	SyncedBytes  int64  `json:"synced_bytes"`   // 已经同步的数据量，单位为字节
+	PendingCount int64  `json:"pending_count"`  // 等待同步的文件数
+	LastSyncTime int64  `json:"last_sync_time"` // 最近一次同步的时间，单位为秒
+	Error        string `json:"error,omitempty"`
+}
+
+// AddBucketReplication 用来为源空间增加一条跨区域同步规则
+func (m *BucketManager) AddBucketReplication(rule *BucketReplicationRule) (err error) {
+	if err = rule.Validate(); err != nil {
+		return
+	}
+	ctx := m.withMac(context.TODO())
+	reqURL := m.Cfg.UcReqHost() + "/replication/add"
+	err = m.Client.CallWithJson(ctx, nil, "POST", reqURL, nil, rule)
+	return
+}
+
+// DelBucketReplication 用来删除源空间中名称为 name 的同步规则，已经同步的文件不会被删除
+func (m *BucketManager) DelBucketReplication(srcBucket, name string) (err error) {
+	ctx := m.withMac(context.TODO())
+	reqURL := m.Cfg.UcReqHost() + "/replication/delete"
+	params := map[string][]string{
+		"bucket": {srcBucket},
+		"name":   {name},
+	}
+	err = m.Client.CallWithForm(ctx, nil, "POST", reqURL, nil, params)
+	return
+}
+
+// GetBucketReplications 用来获取源空间的全部同步规则
+func (m *BucketManager) GetBucketReplications(srcBucket string) (rules []BucketReplicationRule, err error) {
+	ctx := m.withMac(context.TODO())
+	reqURL := m.Cfg.UcReqHost() + "/replication/get"
+	params := map[string][]string{
+		"bucket": {srcBucket},
+	}
+	err = m.Client.CallWithForm(ctx, &rules, "GET", reqURL, nil, params)
+	return
+}
+
+// GetBucketReplicationStatus 用来查询源空间中名称为 name 的同步规则的执行状态
+func (m *BucketManager) GetBucketReplicationStatus(srcBucket, name string) (status ReplicationStatus, err error) {
+	ctx := m.withMac(context.TODO())
+	reqURL := m.Cfg.UcReqHost() + "/replication/status"
+	params := map[string][]string{
+		"bucket": {srcBucket},
+		"name":   {name},
+	}
+	err = m.Client.CallWithForm(ctx, &status, "GET", reqURL, nil, params)
+	return
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBucketReplication(t *testing.T) {
+	var rules []BucketReplicationRule
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/replication/add":
+			var rule BucketReplicationRule
+			if err := json.NewDecoder(req.Body).Decode(&rule); err != nil {
+				http.Error(w, `{"error":"bad request"}`, http.StatusBadRequest)
+				return
+			}
+			rules = append(rules, rule)
+		case "/replication/get":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(rules)
+		case "/replication/status":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"name":"` + req.URL.Query().Get("name") + `","status":"syncing","synced_count":10}`))
+		case "/replication/delete":
+			req.ParseForm()
+			if req.Form.Get("bucket") != "src" || req.Form.Get("name") != "dr" {
+				http.NotFound(w, req)
+				return
+			}
+			rules = rules[:0]
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	bucketManager := NewBucketManager(mac, &Config{UcHost: server.URL})
+	rule := BucketReplicationRule{Name: "dr", SrcBucket: "src", DstBucket: "dst", DstRegion: RIDHuabei, SyncDelete: true}
+	if err := bucketManager.AddBucketReplication(&rule); err != nil {
+		t.Fatalf("BucketManager#AddBucketReplication() error, %s", err)
+	}
+	got, err := bucketManager.GetBucketReplications("src")
+	if err != nil {
+		t.Fatalf("BucketManager#GetBucketReplications() error, %s", err)
+	}
+	if len(got) != 1 || got[0] != rule {
+		t.Fatalf("BucketManager#GetBucketReplications() error, unexpected rules %+v", got)
+	}
+	status, err := bucketManager.GetBucketReplicationStatus("src", "dr")
+	if err != nil {
+		t.Fatalf("BucketManager#GetBucketReplicationStatus() error, %s", err)
+	}
+	if status.Name != "dr" || status.Status != ReplicationStatusSyncing || status.SyncedCount != 10 {
+		t.Fatalf("BucketManager#GetBucketReplicationStatus() error, unexpected status %+v", status)
+	}
+	if err = bucketManager.DelBucketReplication("src", "dr"); err != nil {
+		t.Fatalf("BucketManager#DelBucketReplication() error, %s", err)
+	}
+
+	invalid := BucketReplicationRule{Name: "self", SrcBucket: "src", DstBucket: "src", DstRegion: RIDHuadong}
+	if err = bucketManager.AddBucketReplication(&invalid); err == nil {
+		t.Fatalf("BucketManager#AddBucketReplication() should fail for the same bucket")
+	}
+}
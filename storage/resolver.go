@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultResolveTTL 为 HostResolver 缓存解析结果的默认时间
+const DefaultResolveTTL = 5 * time.Minute
+
+// lookupHost 解析域名，测试的时候可以替换
+var lookupHost = net.LookupHost
+
+// HostResolver 缓存上传和资源管理域名的解析结果，设置到 TransportOptions.Resolver 之后建立连接的时候直接使用缓存的 IP，
+// 本地 DNS 很慢或者不可用的时候每个分片的请求不再需要等待解析。
+// 连接成功的 IP 会被固定下来一直使用，连接失败之后才依次尝试其它的 IP；重新解析失败的时候继续使用过期的结果，
+// 从来没有解析成功过的域名交给系统解析。同一个 HostResolver 可以在多个 Transport 之间共用
+type HostResolver struct {
+	TTL time.Duration // 可选。解析结果的缓存时间，不设定则为 DefaultResolveTTL
+
+	mu      sync.Mutex
+	entries map[string]*resolveEntry
+}
+
+type resolveEntry struct {
+	ips       []string
+	pinned    int
+	expiresAt time.Time
+}
+
+// NewHostResolver 用来构建一个缓存域名解析结果的对象
+func NewHostResolver() *HostResolver {
+	return &HostResolver{entries: make(map[string]*resolveEntry)}
+}
+
+// Preresolve 解析 hosts 并缓存结果，在上传之前调用可以避免第一个请求等待解析。
+// hosts 可以包含协议和端口，比如 "https://upload.qiniup.com"，返回第一个解析失败的错误
+func (r *HostResolver) Preresolve(hosts ...string) (err error) {
+	for _, host := range hosts {
+		if _, lErr := r.LookupHost(host); lErr != nil && err == nil {
+			err = lErr
+		}
+	}
+	return
+}
+
+// LookupHost 返回 host 的 IP，固定使用的 IP 排在第一个。缓存过期之后重新解析，解析失败的时候返回过期的结果
+func (r *HostResolver) LookupHost(host string) (ips []string, err error) {
+	host = hostname(host)
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	r.mu.Lock()
+	entry, ok := r.entries[host]
+	if ok && time.Now().Before(entry.expiresAt) {
+		ips = entry.orderedIPs()
+		r.mu.Unlock()
+		return
+	}
+	r.mu.Unlock()
+
+	newIPs, lErr := lookupHost(host)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if lErr != nil || len(newIPs) == 0 {
+		if entry, ok = r.entries[host]; ok {
+			return entry.orderedIPs(), nil
+		}
+		if lErr == nil {
+			lErr = &net.DNSError{Err: "no such host", Name: host}
+		}
+		return nil, lErr
+	}
+
+	ttl := r.TTL
+	if ttl <= 0 {
+		ttl = DefaultResolveTTL
+	}
+	newEntry := &resolveEntry{ips: newIPs, expiresAt: time.Now().Add(ttl)}
+	// 重新解析之后仍然存在的固定 IP 继续使用
+	if entry, ok = r.entries[host]; ok {
+		pinned := entry.ips[entry.pinned]
+		for i, ip := range newIPs {
+			if ip == pinned {
+				newEntry.pinned = i
+			}
+		}
+	}
+	if r.entries == nil {
+		r.entries = make(map[string]*resolveEntry)
+	}
+	r.entries[host] = newEntry
+	return newEntry.orderedIPs(), nil
+}
+
+// orderedIPs 返回从固定的 IP 开始依次排列的全部 IP
+func (e *resolveEntry) orderedIPs() []string {
+	ips := make([]string, 0, len(e.ips))
+	ips = append(ips, e.ips[e.pinned:]...)
+	return append(ips, e.ips[:e.pinned]...)
+}
+
+// pin 记录连接 host 的结果，连接成功的 IP 被固定使用，固定的 IP 连接失败之后换成下一个 IP
+func (r *HostResolver) pin(host, ip string, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, found := r.entries[host]
+	if !found {
+		return
+	}
+	for i := range entry.ips {
+		if entry.ips[i] != ip {
+			continue
+		}
+		if ok {
+			entry.pinned = i
+		} else if entry.pinned == i {
+			entry.pinned = (i + 1) % len(entry.ips)
+		}
+		return
+	}
+}
+
+// dialContext 返回按照缓存的 IP 建立连接的 DialContext，所有的 IP 都连接失败或者没有解析结果的时候使用 dial 直接连接 addr
+func (r *HostResolver) dialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (conn net.Conn, err error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+		ips, lErr := r.LookupHost(host)
+		if lErr != nil {
+			return dial(ctx, network, addr)
+		}
+		for _, ip := range ips {
+			conn, err = dial(ctx, network, net.JoinHostPort(ip, port))
+			r.pin(host, ip, err == nil)
+			if err == nil || ctx.Err() != nil {
+				return
+			}
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// hostname 去掉 host 中的协议、端口和路径，比如 "https://upload.qiniup.com:443/" 返回 "upload.qiniup.com"
+func hostname(host string) string {
+	host = hostKey(host)
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return strings.Trim(host, "[]")
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHostResolverPinAndFallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.Host))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+
+	lookups := 0
+	var lookupErr error
+	defer func(f func(string) ([]string, error)) { lookupHost = f }(lookupHost)
+	lookupHost = func(host string) ([]string, error) {
+		lookups++
+		if host != "up.kodo.example.com" {
+			t.Errorf("unexpected lookup %s", host)
+		}
+		// 127.0.0.2 上没有监听端口，连接失败之后使用 127.0.0.1
+		return []string{"127.0.0.2", "127.0.0.1"}, lookupErr
+	}
+
+	resolver := NewHostResolver()
+	if err := resolver.Preresolve("https://up.kodo.example.com/"); err != nil || lookups != 1 {
+		t.Fatalf("Preresolve() error = %v, lookups = %d", err, lookups)
+	}
+
+	client := NewClient(NewTransport(&TransportOptions{Resolver: resolver}))
+	url := "http://up.kodo.example.com:" + port + "/"
+	for i := 0; i < 2; i++ {
+		resp, err := client.DoRequest(context.Background(), "GET", url, nil)
+		if err != nil {
+			t.Fatalf("DoRequest() error, %s", err)
+		}
+		closeResponse(resp)
+	}
+	if lookups != 1 {
+		t.Fatalf("HostResolver should use the cache, lookups = %d", lookups)
+	}
+	if ips, _ := resolver.LookupHost("up.kodo.example.com"); ips[0] != "127.0.0.1" {
+		t.Fatalf("LookupHost() should pin the healthy ip, got %v", ips)
+	}
+
+	// 缓存过期之后解析失败的时候继续使用过期的结果
+	resolver.mu.Lock()
+	resolver.entries["up.kodo.example.com"].expiresAt = time.Now().Add(-time.Second)
+	resolver.mu.Unlock()
+	lookupErr = errors.New("dns timeout")
+	ips, err := resolver.LookupHost("up.kodo.example.com")
+	if err != nil || len(ips) != 2 || ips[0] != "127.0.0.1" || lookups != 2 {
+		t.Fatalf("LookupHost() = %v, %v, lookups = %d", ips, err, lookups)
+	}
+
+	if _, err = NewHostResolver().LookupHost("up.kodo.example.com"); err == nil {
+		t.Fatal("LookupHost() should fail without cached result")
+	}
+	if ips, err = resolver.LookupHost("127.0.0.1:80"); err != nil || ips[0] != "127.0.0.1" || lookups != 3 {
+		t.Fatalf("LookupHost() should not resolve ip, %v, %v, lookups = %d", ips, err, lookups)
+	}
+}
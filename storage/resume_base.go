@@ -9,16 +9,38 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/qiniu/api.v7/conf"
 	"github.com/qiniu/x/bytes.v7"
-	"github.com/qiniu/x/xlog.v7"
 )
 
 // ResumeUploader 表示一个分片上传的对象
 type ResumeUploader struct {
 	Client *Client
 	Cfg    *Config
+
+	// 可选。该上传对象专用的分片上传设置，不设定则使用 SetSettings 设置的全局参数。
+	Settings *Settings
+
+	// 可选。上传域名列表，比如 "https://upload.qiniup.com"。一个域名上传失败之后，重试的时候会切换到下一个域名。
+	// 不设定则使用空间所在机房的全部上传域名。
+	UpHosts []string
+
+	// 可选。上传域名的探测结果，设置之后优先使用延迟最低的可用域名
+	HostProber *UpHostProber
+
+	// 可选。失败之后的重试策略，不设定则使用 DefaultRetryPolicy
+	RetryPolicy RetryPolicy
+
+	// 可选。记录上传次数、数据量、分片耗时和重试次数的对象，不设定则不记录
+	Metrics Metrics
+
+	// 可选。为每个请求创建 span 的对象，不设定则不创建
+	Tracer Tracer
+
+	// 可选。输出日志的对象，不设定则使用 Settings 中的 Logger
+	Logger Logger
 }
 
 // NewResumeUploader 表示构建一个新的分片上传的对象
@@ -75,39 +97,104 @@ func (p *ResumeUploader) Bput(
 
 // 分片上传请求
 func (p *ResumeUploader) resumableBput(
-	ctx context.Context, upToken string, upHost string, ret *BlkputRet, f io.ReaderAt, blkIdx, blkSize int, extra *RputExtra) (err error) {
+	ctx context.Context, upToken string, hosts *upHostSelector, ret *BlkputRet, f io.ReaderAt, blkIdx, blkSize int,
+	extra *RputExtra) (err error) {
 
-	log := xlog.NewWith(ctx)
+	ctx = withTrace(ctx, nil, AttrBlockIndex, blkIdx)
+	log := p.logger(ctx)
 	h := crc32.NewIEEE()
-	offbase := int64(blkIdx) << blockBits
+	offbase := int64(blkIdx) * int64(extra.BlockSize)
 	chunkSize := extra.ChunkSize
 
 	var bodyLength int
+	restarted := false
+	chunks := newChunkReader(ctx, f, extra.ReadAhead)
+	defer chunks.close()
+
+	// 请求失败之后切换到备用的上传域名重试，同一个机房的上传域名都可以继续上传已经创建的块
+	upHost := hosts.host()
+	failover := func(err error) {
+		if _, ok := err.(*ChecksumError); ok {
+			return
+		}
+		hosts.failover(upHost, err)
+		upHost = hosts.host()
+		if ret.Ctx != "" {
+			ret.Host = upHost
+		}
+		log.Info("ResumableBlockput: switch to up host", "block", blkIdx, "host", upHost, "reason", err)
+	}
+	// retry 判断第 attempt 次尝试失败之后是否重试，重试之前等待 RetryPolicy 指定的时间
+	policy := retryPolicyOrDefault(p.RetryPolicy)
+	retry := func(attempt int, err error) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		ok, delay := policy.Retry(attempt, err)
+		if !ok || !extra.retries.take(blkIdx) || sleepContext(ctx, delay) != nil {
+			return false
+		}
+		recordRetry(p.Metrics, methodResumable)
+		return true
+	}
 
+lzRestart:
 	if ret.Ctx == "" {
 
+		if err = extra.pause.wait(ctx); err != nil {
+			return
+		}
+
 		if chunkSize < blkSize {
 			bodyLength = chunkSize
 		} else {
 			bodyLength = blkSize
 		}
 
-		body1 := io.NewSectionReader(f, offbase, int64(bodyLength))
-		body := io.TeeReader(body1, h)
+		tryTimes := extra.TryTimes
+
+	lzRetryMkblk:
+		// 服务端提前返回错误的时候 http.Transport 可能还在读取上一次请求的 body，重试时使用新的 hash，不能 Reset
+		h = crc32.NewIEEE()
+		body1, rErr := chunks.read(offbase, bodyLength)
+		if rErr != nil {
+			return rErr
+		}
+		chunks.prefetch(offbase+int64(bodyLength), minInt(chunkSize, blkSize-bodyLength))
+		body := io.TeeReader(limitReader(ctx, body1, extra.limiter), h)
 
+		start := time.Now()
 		err = p.Mkblk(ctx, upToken, upHost, ret, blkSize, body, bodyLength)
-		if err != nil {
-			return
+		if err == nil {
+			if ret.Crc32 == h.Sum32() && int(ret.Offset) == bodyLength {
+				extra.notifyChunk(blkIdx, 0, bodyLength)
+				extra.Notify(blkIdx, blkSize, ret)
+			} else {
+				log.Warn("ResumableBlockput: invalid checksum, retry", "block", blkIdx)
+				err = &ChecksumError{BlkIdx: blkIdx, Offset: 0, Expected: h.Sum32(), Actual: ret.Crc32}
+				*ret = BlkputRet{} // 服务端保存的块数据有误，需要重新创建块
+			}
+		} else {
+			log.Warn("ResumableBlockput: mkblk failed", "block", blkIdx, "error", err)
 		}
-		if ret.Crc32 != h.Sum32() || int(ret.Offset) != bodyLength {
-			err = ErrUnmatchedChecksum
+		recordChunk(p.Metrics, methodResumable, upHost, bodyLength, start, err)
+		if err != nil {
+			if tryTimes > 1 && retry(extra.TryTimes-tryTimes+1, err) {
+				tryTimes--
+				failover(err)
+				log.Info("ResumableBlockput: retrying", "block", blkIdx)
+				goto lzRetryMkblk
+			}
 			return
 		}
-		extra.Notify(blkIdx, blkSize, ret)
 	}
 
 	for int(ret.Offset) < blkSize {
 
+		if err = extra.pause.wait(ctx); err != nil {
+			return
+		}
+
 		if chunkSize < blkSize-int(ret.Offset) {
 			bodyLength = chunkSize
 		} else {
@@ -115,31 +202,49 @@ func (p *ResumeUploader) resumableBput(
 		}
 
 		tryTimes := extra.TryTimes
+		prev := *ret
 
 	lzRetry:
-		h.Reset()
-		body1 := io.NewSectionReader(f, offbase+int64(ret.Offset), int64(bodyLength))
-		body := io.TeeReader(body1, h)
+		h = crc32.NewIEEE()
+		body1, rErr := chunks.read(offbase+int64(ret.Offset), bodyLength)
+		if rErr != nil {
+			return rErr
+		}
+		next := int(ret.Offset) + bodyLength
+		chunks.prefetch(offbase+int64(next), minInt(chunkSize, blkSize-next))
+		body := io.TeeReader(limitReader(ctx, body1, extra.limiter), h)
 
+		bputHost, start := ret.Host, time.Now()
 		err = p.Bput(ctx, upToken, ret, body, bodyLength)
 		if err == nil {
 			if ret.Crc32 == h.Sum32() {
+				recordChunk(p.Metrics, methodResumable, bputHost, bodyLength, start, nil)
+				extra.notifyChunk(blkIdx, prev.Offset, bodyLength)
 				extra.Notify(blkIdx, blkSize, ret)
 				continue
 			}
-			log.Warn("ResumableBlockput: invalid checksum, retry")
-			err = ErrUnmatchedChecksum
+			log.Warn("ResumableBlockput: invalid checksum, retry", "block", blkIdx)
+			err = &ChecksumError{BlkIdx: blkIdx, Offset: int64(prev.Offset), Expected: h.Sum32(), Actual: ret.Crc32}
+			*ret = prev // 从上一个片的位置重新上传
 		} else {
 			if ei, ok := err.(*ErrorInfo); ok && ei.Code == InvalidCtx {
-				ret.Ctx = "" // reset
-				log.Warn("ResumableBlockput: invalid ctx, please retry")
+				// 块的上下文已经过期，从头重新上传这个块，同一次上传中只重新开始一次，避免无限重试
+				*ret = BlkputRet{}
+				if !restarted {
+					restarted = true
+					log.Warn("ResumableBlockput: invalid ctx, restart block", "block", blkIdx)
+					goto lzRestart
+				}
+				log.Warn("ResumableBlockput: invalid ctx, please retry", "block", blkIdx)
 				return
 			}
-			log.Warn("ResumableBlockput: bput failed -", err)
+			log.Warn("ResumableBlockput: bput failed", "block", blkIdx, "error", err)
 		}
-		if tryTimes > 1 {
+		recordChunk(p.Metrics, methodResumable, bputHost, bodyLength, start, err)
+		if tryTimes > 1 && retry(extra.TryTimes-tryTimes+1, err) {
 			tryTimes--
-			log.Info("ResumableBlockput retrying ...")
+			failover(err)
+			log.Info("ResumableBlockput: retrying", "block", blkIdx)
 			goto lzRetry
 		}
 		break
@@ -150,20 +255,15 @@ func (p *ResumeUploader) resumableBput(
 // 创建文件请求
 func (p *ResumeUploader) Mkfile(
 	ctx context.Context, upToken string, upHost string, ret interface{}, key string, hasKey bool, fsize int64, extra *RputExtra) (err error) {
+	return p.mkfileWithName(ctx, upToken, upHost, ret, key, hasKey, fsize, extra.FileName, extra)
+}
 
-	url := upHost + "/mkfile/" + strconv.FormatInt(fsize, 10)
+// mkfileWithName 创建文件，fname 为原始文件名，用于魔法变量 $(fname)，为空的时候不发送
+func (p *ResumeUploader) mkfileWithName(
+	ctx context.Context, upToken string, upHost string, ret interface{}, key string, hasKey bool, fsize int64,
+	fname string, extra *RputExtra) (err error) {
 
-	if extra.MimeType != "" {
-		url += "/mimeType/" + encode(extra.MimeType)
-	}
-	if hasKey {
-		url += "/key/" + encode(key)
-	}
-	for k, v := range extra.Params {
-		if (strings.HasPrefix(k, "x:") || strings.HasPrefix(k, "x-qn-meta-")) && v != "" {
-			url += fmt.Sprintf("/%s/%s", k, encode(v))
-		}
-	}
+	url := mkfileURL(upHost, key, hasKey, fsize, fname, extra)
 
 	buf := make([]byte, 0, 196*len(extra.Progresses))
 	for _, prog := range extra.Progresses {
@@ -182,6 +282,32 @@ func (p *ResumeUploader) Mkfile(
 		ctx, ret, "POST", url, headers, bytes.NewReader(buf), len(buf))
 }
 
+// mkfileURL 生成创建文件请求的地址，包括文件名、MIME 类型、key、自定义变量和自定义元数据
+func mkfileURL(upHost, key string, hasKey bool, fsize int64, fname string, extra *RputExtra) string {
+	url := upHost + "/mkfile/" + strconv.FormatInt(fsize, 10)
+
+	if extra.MimeType != "" {
+		url += "/mimeType/" + encode(extra.MimeType)
+	}
+	if fname != "" {
+		url += "/fname/" + encode(fname)
+	}
+	if hasKey {
+		url += "/key/" + EncodeKey(key)
+	}
+	for k, v := range extra.Params {
+		if (strings.HasPrefix(k, "x:") || strings.HasPrefix(k, "x-qn-meta-")) && v != "" {
+			url += fmt.Sprintf("/%s/%s", k, encode(v))
+		}
+	}
+	for k, v := range extra.Metadata {
+		if v != "" {
+			url += fmt.Sprintf("/%s/%s", metadataKey(k), encode(v))
+		}
+	}
+	return url
+}
+
 func encode(raw string) string {
 	return base64.URLEncoding.EncodeToString([]byte(raw))
 }
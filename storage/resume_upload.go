@@ -1,24 +1,150 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
-
-	"github.com/qiniu/x/xlog.v7"
+	"time"
 )
 
 // 分片上传过程中可能遇到的错误
 var (
 	ErrInvalidPutProgress = errors.New("invalid put progress")
-	ErrPutFailed          = errors.New("resumable put failed")
+	ErrPutFailed          = errors.New("resumable put failed") // 已废弃。上传失败返回 *PutError，服务端返回的错误可以通过 AsError 得到 *Error
 	ErrUnmatchedChecksum  = errors.New("unmatched checksum")
 	ErrBadToken           = errors.New("invalid token")
+	ErrInvalidSection     = errors.New("invalid section, offset and length must not be negative")
 )
 
+// ChecksumError 表示上传的片的 crc32 和服务端返回的 crc32 不一致，Offset 为片在块中的偏移位置
+type ChecksumError struct {
+	BlkIdx   int
+	Offset   int64
+	Expected uint32
+	Actual   uint32
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%s: block %d, offset %d, expected crc32 %d, got %d",
+		ErrUnmatchedChecksum.Error(), e.BlkIdx, e.Offset, e.Expected, e.Actual)
+}
+
+// Is 用于兼容之前返回 ErrUnmatchedChecksum 的判断方式
+func (e *ChecksumError) Is(target error) bool {
+	return target == ErrUnmatchedChecksum
+}
+
+// BlockError 表示分片上传中一个块上传失败的错误，Retries 为这个块在本次上传中重试的次数
+type BlockError struct {
+	BlkIdx  int
+	Retries int
+	Err     error
+}
+
+// PutError 表示分片上传失败，包含了每一个上传失败的块的错误，按照块的序号排序
+type PutError struct {
+	BlockErrors []BlockError
+}
+
+func (e *PutError) Error() string {
+	msgs := make([]string, 0, len(e.BlockErrors))
+	for _, be := range e.BlockErrors {
+		msgs = append(msgs, fmt.Sprintf("block %d (%d retries): %v", be.BlkIdx, be.Retries, be.Err))
+	}
+	return ErrPutFailed.Error() + ": " + strings.Join(msgs, "; ")
+}
+
+// Err 返回第一个失败的块的错误
+func (e *PutError) Err() error {
+	if len(e.BlockErrors) == 0 {
+		return nil
+	}
+	return e.BlockErrors[0].Err
+}
+
+// Unwrap 返回第一个失败的块的错误，用于 errors.As 判断具体的错误类型
+func (e *PutError) Unwrap() error {
+	return e.Err()
+}
+
+// Is 用于兼容之前返回 ErrPutFailed 的判断方式，errors.Is(err, ErrPutFailed) 仍然成立
+func (e *PutError) Is(target error) bool {
+	return target == ErrPutFailed
+}
+
+// retryBudget 记录一次上传中所有块的重试次数，总的重试次数超过限制之后不再重试
+type retryBudget struct {
+	mu      sync.Mutex
+	max     int // 为 0 表示不限制
+	total   int
+	retries map[int]int
+}
+
+func newRetryBudget(max int) *retryBudget {
+	return &retryBudget{max: max, retries: make(map[int]int)}
+}
+
+// take 申请为第 blkIdx 个块重试一次，超过总的重试次数限制的时候返回 false
+func (b *retryBudget) take(blkIdx int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.max > 0 && b.total >= b.max {
+		return false
+	}
+	b.total++
+	b.retries[blkIdx]++
+	return true
+}
+
+// count 返回第 blkIdx 个块已经重试的次数
+func (b *retryBudget) count(blkIdx int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.retries[blkIdx]
+}
+
+// putErrors 用来在多个块并行上传的时候收集上传失败的块的错误
+type putErrors struct {
+	mu     sync.Mutex
+	errors []BlockError
+}
+
+func (e *putErrors) add(blkIdx, retries int, err error) {
+	e.mu.Lock()
+	e.errors = append(e.errors, BlockError{BlkIdx: blkIdx, Retries: retries, Err: err})
+	e.mu.Unlock()
+}
+
+// err 在有块上传失败的时候返回 *PutError，否则返回 nil
+func (e *putErrors) err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.errors) == 0 {
+		return nil
+	}
+	blockErrors := make([]BlockError, len(e.errors))
+	copy(blockErrors, e.errors)
+	sort.Sort(byBlock(blockErrors))
+	return &PutError{BlockErrors: blockErrors}
+}
+
+// byBlock 将 BlockError 按块的序号排序，sort.Slice 需要 Go 1.8
+type byBlock []BlockError
+
+func (b byBlock) Len() int           { return len(b) }
+func (b byBlock) Less(i, j int) bool { return b[i].BlkIdx < b[j].BlkIdx }
+func (b byBlock) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
 // 上传进度过期错误
 const (
 	InvalidCtx = 701 // UP: 无效的上下文(bput)，可能情况：Ctx非法或者已经被淘汰（太久未使用）
@@ -28,15 +154,20 @@ const (
 const (
 	defaultWorkers   = 4               // 默认的并发上传的块数量
 	defaultChunkSize = 4 * 1024 * 1024 // 默认的分片大小，4MB
+	defaultBlockSize = 1 << blockBits  // 默认的块大小，4MB
 	defaultTryTimes  = 3               // bput 失败重试次数
 )
 
 // Settings 为分片上传设置
 type Settings struct {
-	TaskQsize int // 可选。任务队列大小。为 0 表示取 Workers * 4。
-	Workers   int // 并行 Goroutine 数目。
+	TaskQsize int // 已废弃。每次上传都使用独立的 Goroutine，不再需要任务队列。
+	Workers   int // 每次上传并行上传的块数量。
 	ChunkSize int // 默认的Chunk大小，不设定则为4M
 	TryTimes  int // 默认的尝试次数，不设定则为3
+	BlockSize int // 默认的块大小，不设定则为4M。七牛公有云只支持4M的块，其它的块大小只用于支持的私有部署
+
+	// 可选。输出日志的对象，上传对象没有设置 Logger 的时候使用，不设定则不输出日志。需要之前版本的日志可以设置为 NewXlogLogger()
+	Logger Logger
 }
 
 // 分片上传的默认设置
@@ -45,38 +176,32 @@ var settings = Settings{
 	Workers:   defaultWorkers,
 	ChunkSize: defaultChunkSize,
 	TryTimes:  defaultTryTimes,
+	BlockSize: defaultBlockSize,
 }
 
 // SetSettings 可以用来设置分片上传参数
 func SetSettings(v *Settings) {
-	settings = *v
-	if settings.Workers == 0 {
-		settings.Workers = defaultWorkers
-	}
-	if settings.TaskQsize == 0 {
-		settings.TaskQsize = settings.Workers * 4
+	settings = v.withDefaults()
+}
+
+// withDefaults 返回填充了默认值的设置
+func (s Settings) withDefaults() Settings {
+	if s.Workers == 0 {
+		s.Workers = defaultWorkers
 	}
-	if settings.ChunkSize == 0 {
-		settings.ChunkSize = defaultChunkSize
+	if s.TaskQsize == 0 {
+		s.TaskQsize = s.Workers * 4
 	}
-	if settings.TryTimes == 0 {
-		settings.TryTimes = defaultTryTimes
+	if s.ChunkSize == 0 {
+		s.ChunkSize = defaultChunkSize
 	}
-}
-
-var tasks chan func()
-
-func worker(tasks chan func()) {
-	for {
-		task := <-tasks
-		task()
+	if s.TryTimes == 0 {
+		s.TryTimes = defaultTryTimes
 	}
-}
-func initWorkers() {
-	tasks = make(chan func(), settings.TaskQsize)
-	for i := 0; i < settings.Workers; i++ {
-		go worker(tasks)
+	if s.BlockSize == 0 {
+		s.BlockSize = defaultBlockSize
 	}
+	return s
 }
 
 // 上传完毕块之后的回调
@@ -88,11 +213,24 @@ const (
 	blockMask = (1 << blockBits) - 1
 )
 
-// BlockCount 用来计算文件的分块数量
+// BlockCount 用来计算文件按照默认的 4MB 大小分块的数量，设置了 RputExtra.BlockSize 的时候需要使用 BlockCountWithSize
 func BlockCount(fsize int64) int {
 	return int((fsize + blockMask) >> blockBits)
 }
 
+// BlockCountWithSize 用来计算文件按照 blockSize 大小分块的数量，blockSize 不大于 0 的时候使用默认的 4MB
+func BlockCountWithSize(fsize int64, blockSize int) int {
+	if blockSize <= 0 {
+		return BlockCount(fsize)
+	}
+	return blockCount(fsize, blockSize)
+}
+
+// blockCount 用来计算文件按照 blkSize 大小分块的数量
+func blockCount(fsize int64, blkSize int) int {
+	return int((fsize + int64(blkSize) - 1) / int64(blkSize))
+}
+
 // BlkputRet 表示分片上传每个片上传完毕的返回值
 type BlkputRet struct {
 	Ctx       string `json:"ctx"`
@@ -106,16 +244,66 @@ type BlkputRet struct {
 // RputExtra 表示分片上传额外可以指定的参数
 type RputExtra struct {
 	Params     map[string]string // 可选。用户自定义参数，以"x:"开头，而且值不能为空，否则忽略
+	Metadata   map[string]string // 可选。用户自定义的文件元数据，key 可以省略 "x-qn-meta-" 前缀，值为空的时候忽略
+	FileName   string            // 可选。原始文件名，用于魔法变量 $(fname)，不设定时 PutFile 使用本地文件的文件名
 	UpHost     string
 	MimeType   string                                        // 可选。
 	ChunkSize  int                                           // 可选。每次上传的Chunk大小
+	BlockSize  int                                           // 可选。块大小，不设定则使用 Settings 中的设置
 	TryTimes   int                                           // 可选。尝试次数
-	Progresses []BlkputRet                                   // 可选。上传进度
+	Progresses []BlkputRet                                   // 可选。上传进度，长度为 BlockCountWithSize(fsize, BlockSize)，上传结束的时候写回，用于之后断点续传
 	Notify     func(blkIdx int, blkSize int, ret *BlkputRet) // 可选。进度提示（注意多个block是并行传输的）
 	NotifyErr  func(blkIdx int, blkSize int, err error)
-}
 
-var once sync.Once
+	// 可选。每个片上传成功之后的回调，offset 为这个片在块中的起始位置，chunkSize 为这个片的大小，
+	// 在 Notify 之前调用，可以用来显示块内的上传进度（注意多个block是并行传输的）
+	NotifyChunk func(blkIdx int, offset uint32, chunkSize int)
+
+	// 可选。上传进度记录器，只对 PutFile 和 PutFileWithoutKey 生效。
+	// 设置之后每个块上传完毕都会保存进度，再次上传同一个文件时从保存的进度继续上传，上传成功之后删除进度。
+	Recorder ProgressRecorder
+
+	// 可选。整体上传进度的回调，fsize 为文件大小，uploaded 为已经上传的总字节数，保证单调递增，
+	// 可以在多个块并行上传的时候直接用于显示进度条。参数顺序和 PutExtra.OnProgress 保持一致。
+	// PutStream 不知道数据的总大小，fsize 为目前已经读取的数据大小。
+	OnProgress func(fsize, uploaded int64)
+
+	// 可选。上传限速，单位为字节每秒，为 0 表示不限速。多个块并行上传的时候共用同一个限速。
+	RateLimit int64
+
+	// 可选。任意一个块上传失败之后立即放弃其它还没有上传完毕的块。
+	// 不设置的时候只有遇到无法重试的错误（比如上传凭证无效等 4xx 错误）才会放弃其它的块。
+	FailFast bool
+
+	// 可选。在上传当前片的同时预读下一个片的数据，可以减少高延迟网络下的上传时间，每个并行上传的块会额外占用两个片大小的内存
+	ReadAhead bool
+
+	// 可选。本次上传所有块加起来最多的重试次数，为 0 表示只受 TryTimes 限制。
+	// 上传失败时 PutError 中会记录每个块重试的次数。
+	MaxTotalRetries int
+
+	// 可选。本次上传的截止时间，超过之后放弃上传并返回 context.DeadlineExceeded
+	Deadline time.Time
+
+	// 可选。上传本地文件的时候使用 mmap 映射文件读取数据，可以减少大文件上传时的内存拷贝和系统调用，
+	// 只在 Linux 和 macOS 的 PutFile 中生效，映射失败的时候自动回退到直接读取文件
+	Mmap bool
+
+	// 可选。上传之前使用 BucketManager 查询 key 是否已经存在，大小和 hash 都与本地计算的 etag 一致的时候跳过上传，
+	// 这时 ret 中只会填充 key 和 hash 字段。只在指定了 key 的上传中生效，不支持 PutStream
+	SkipIfExists bool
+
+	// 可选。设置了 SkipIfExists 的时候用来查询 key 是否已经存在
+	BucketManager *BucketManager
+
+	// 可选。上传成功之后检查返回的 hash 和本地计算的 etag 是否一致，不一致的时候返回 ErrUnmatchedEtag。
+	// 需要上传返回的内容中包含 hash 字段，自定义了 returnBody 的时候需要包含 "hash":"$(etag)"。
+	VerifyEtag bool
+
+	limiter *rateLimiter
+	pause   *pauseGate
+	retries *retryBudget
+}
 
 // Put 方法用来上传一个文件，支持断点续传和分块上传。
 //
@@ -129,7 +317,7 @@ var once sync.Once
 //
 func (p *ResumeUploader) Put(ctx context.Context, ret interface{}, upToken string, key string, f io.ReaderAt,
 	fsize int64, extra *RputExtra) (err error) {
-	err = p.rput(ctx, ret, upToken, key, true, f, fsize, extra)
+	err = p.rput(ctx, ret, upToken, key, true, f, fsize, extra, "", "")
 	return
 }
 
@@ -145,7 +333,7 @@ func (p *ResumeUploader) Put(ctx context.Context, ret interface{}, upToken strin
 //
 func (p *ResumeUploader) PutWithoutKey(
 	ctx context.Context, ret interface{}, upToken string, f io.ReaderAt, fsize int64, extra *RputExtra) (err error) {
-	err = p.rput(ctx, ret, upToken, "", false, f, fsize, extra)
+	err = p.rput(ctx, ret, upToken, "", false, f, fsize, extra, "", "")
 	return
 }
 
@@ -180,94 +368,486 @@ func (p *ResumeUploader) PutFileWithoutKey(
 	return p.rputFile(ctx, ret, upToken, "", false, localFile, extra)
 }
 
+// PutStream 方法用来上传一个数据流，比如标准输入、HTTP 响应内容或者解压缩后的数据，不需要预先知道数据的大小。
+// 数据会按块依次读入内存后顺序上传，所以不支持多个块的并行上传以及断点续传。
+//
+// ctx     是请求的上下文。
+// ret     是上传成功后返回的数据。如果 upToken 中没有设置 CallbackUrl 或 ReturnBody，那么返回的数据结构是 PutRet 结构。
+// upToken 是由业务服务器颁发的上传凭证。
+// key     是要上传的文件访问路径。比如："foo/bar.jpg"。注意我们建议 key 不要以 '/' 开头。另外，key 为空字符串是合法的。
+// r       是要上传的数据流。
+// extra   是上传的一些可选项。详细见 RputExtra 结构的描述。
+//
+func (p *ResumeUploader) PutStream(
+	ctx context.Context, ret interface{}, upToken, key string, r io.Reader, extra *RputExtra) (err error) {
+	return p.rputStream(ctx, ret, upToken, key, true, r, extra)
+}
+
+// PutStreamWithoutKey 方法用来上传一个数据流，和 PutStream 不同的是不指定文件上传后保存的 key，文件命名方式首先看看
+// upToken 中是否设置了 saveKey，如果设置了 saveKey，那么按 saveKey 要求的规则生成 key，否则自动以文件的 hash 做 key。
+func (p *ResumeUploader) PutStreamWithoutKey(
+	ctx context.Context, ret interface{}, upToken string, r io.Reader, extra *RputExtra) (err error) {
+	return p.rputStream(ctx, ret, upToken, "", false, r, extra)
+}
+
+// PutSection 方法用来上传文件中的一段数据，比如容器或者虚拟机镜像中的一个分段，不需要先复制到临时文件中。
+// 和 Put 不同的只是上传的数据为 f 中从 off 开始的 length 个字节。
+//
+// ctx     是请求的上下文。
+// ret     是上传成功后返回的数据。如果 upToken 中没有设置 CallbackUrl 或 ReturnBody，那么返回的数据结构是 PutRet 结构。
+// upToken 是由业务服务器颁发的上传凭证。
+// key     是要上传的文件访问路径。比如："foo/bar.jpg"。注意我们建议 key 不要以 '/' 开头。另外，key 为空字符串是合法的。
+// f       是文件内容的访问接口。
+// off     是要上传的数据在 f 中的起始位置。
+// length  是要上传的数据大小。
+// extra   是上传的一些可选项。详细见 RputExtra 结构的描述。
+//
+func (p *ResumeUploader) PutSection(ctx context.Context, ret interface{}, upToken string, key string, f io.ReaderAt,
+	off, length int64, extra *RputExtra) (err error) {
+	if off < 0 || length < 0 {
+		return ErrInvalidSection
+	}
+	return p.rput(ctx, ret, upToken, key, true, io.NewSectionReader(f, off, length), length, extra, "", "")
+}
+
+// PutSectionWithoutKey 方法用来上传文件中的一段数据，和 PutSection 不同的是不指定文件上传后保存的 key，文件命名方式首先看看
+// upToken 中是否设置了 saveKey，如果设置了 saveKey，那么按 saveKey 要求的规则生成 key，否则自动以文件的 hash 做 key。
+func (p *ResumeUploader) PutSectionWithoutKey(ctx context.Context, ret interface{}, upToken string, f io.ReaderAt,
+	off, length int64, extra *RputExtra) (err error) {
+	if off < 0 || length < 0 {
+		return ErrInvalidSection
+	}
+	return p.rput(ctx, ret, upToken, "", false, io.NewSectionReader(f, off, length), length, extra, "", "")
+}
+
 func (p *ResumeUploader) rput(
 	ctx context.Context, ret interface{}, upToken string,
-	key string, hasKey bool, f io.ReaderAt, fsize int64, extra *RputExtra) (err error) {
+	key string, hasKey bool, f io.ReaderAt, fsize int64, e *RputExtra, fileName, recordKey string) (err error) {
 
-	once.Do(initWorkers)
-
-	log := xlog.NewWith(ctx)
-	blockCnt := BlockCount(fsize)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = traceUpload(ctx, p.Tracer, upToken, key, hasKey)
+	done := recordUploadStart(p.Metrics, methodResumable)
+	defer func() { done(err) }()
+	log := p.logger(ctx)
 
-	if extra == nil {
-		extra = new(RputExtra)
+	extra := p.initExtra(e)
+	if err = checkPutPolicy(upToken, fsize, extra.MimeType); err != nil {
+		return
+	}
+	if extra.SkipIfExists && hasKey {
+		skipped, sErr := skipIfExists(extra.BucketManager, ret, upToken, key, f, fsize)
+		if sErr != nil || skipped {
+			return sErr
+		}
 	}
+	ctx, cancelDeadline := withDeadline(ctx, extra)
+	defer cancelDeadline()
+	blockCnt := blockCount(fsize, extra.BlockSize)
 	if extra.Progresses == nil {
 		extra.Progresses = make([]BlkputRet, blockCnt)
 	} else if len(extra.Progresses) != blockCnt {
 		return ErrInvalidPutProgress
 	}
-
-	if extra.ChunkSize == 0 {
-		extra.ChunkSize = settings.ChunkSize
-	}
-	if extra.TryTimes == 0 {
-		extra.TryTimes = settings.TryTimes
-	}
-	if extra.Notify == nil {
-		extra.Notify = notifyNil
-	}
-	if extra.NotifyErr == nil {
-		extra.NotifyErr = notifyErrNil
+	defer writeBackProgresses(e, extra)
+	if extra.OnProgress != nil {
+		_, restore := trackProgress(extra, fsize)
+		defer restore()
 	}
-	//get up host
 
-	var upHost string
-	if extra.UpHost != "" {
-		upHost = extra.UpHost
-	} else {
-		ak, bucket, gErr := getAkBucketFromUploadToken(upToken)
-		if gErr != nil {
-			err = gErr
-			return
-		}
+	var record *progressRecord
+	if extra.Recorder != nil && recordKey != "" {
+		record = newProgressRecord(extra.Recorder, recordKey, extra.Progresses)
+	}
 
-		upHost, gErr = p.UpHost(ak, bucket)
-		if gErr != nil {
-			err = gErr
-			return
-		}
+	hosts, err := p.rputUpHosts(upToken, extra)
+	if err != nil {
+		return
 	}
 
+	// 出现无法恢复的错误之后通过 blkCtx 取消其它还没有上传完毕的块
+	blkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 每次上传使用独立的 Goroutine，最多同时上传 Workers 个块，不同的上传之间互不影响
+	sem := make(chan struct{}, p.settings().Workers)
 	var wg sync.WaitGroup
-	wg.Add(blockCnt)
 
 	last := blockCnt - 1
-	blkSize := 1 << blockBits
-	nfails := 0
+	blkSize := extra.BlockSize
+	var fails putErrors
 
+enqueue:
 	for i := 0; i < blockCnt; i++ {
 		blkIdx := i
 		blkSize1 := blkSize
 		if i == last {
-			offbase := int64(blkIdx) << blockBits
+			offbase := int64(blkIdx) * int64(blkSize)
 			blkSize1 = int(fsize - offbase)
 		}
 		task := func() {
 			defer wg.Done()
-			tryTimes := extra.TryTimes
-		lzRetry:
-			err := p.resumableBput(ctx, upToken, upHost, &extra.Progresses[blkIdx], f, blkIdx, blkSize1, extra)
-			if err != nil {
-				if tryTimes > 1 {
-					tryTimes--
-					log.Info("resumable.Put retrying ...", blkIdx, "reason:", err)
-					goto lzRetry
+			// 上传已经被取消，排队中的任务直接放弃
+			if blkCtx.Err() != nil {
+				return
+			}
+			if err := p.putBlock(blkCtx, upToken, hosts, f, blkIdx, blkSize1, extra); err != nil {
+				if blkCtx.Err() == nil {
+					fails.add(blkIdx, extra.retries.count(blkIdx), err)
+					if extra.FailFast || !IsRetryableError(err) {
+						cancel()
+					}
+				}
+				return
+			}
+			if record != nil {
+				if rErr := record.save(blkIdx, extra.Progresses[blkIdx]); rErr != nil {
+					log.Warn("resumable.Put: save progress failed", "block", blkIdx, "error", rErr)
 				}
-				log.Warn("resumable.Put", blkIdx, "failed:", err)
-				extra.NotifyErr(blkIdx, blkSize1, err)
-				nfails++
 			}
 		}
-		tasks <- task
+		wg.Add(1)
+		select {
+		case sem <- struct{}{}:
+			go func() {
+				defer func() { <-sem }()
+				task()
+			}()
+		case <-blkCtx.Done():
+			wg.Done()
+			break enqueue
+		}
 	}
 
 	wg.Wait()
-	if nfails != 0 {
-		return ErrPutFailed
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err = fails.err(); err != nil {
+		return
+	}
+
+	err = p.mkfile(ctx, upToken, hosts.host(), ret, key, hasKey, fsize, fileName, extra, func() (string, error) {
+		return Etag(io.NewSectionReader(f, 0, fsize), fsize)
+	})
+	if err == nil && record != nil {
+		if rErr := extra.Recorder.Delete(recordKey); rErr != nil {
+			log.Warn("resumable.Put: delete progress failed", "error", rErr)
+		}
+	}
+	return
+}
+
+// rputStream 从 io.Reader 中依次读取每个块的数据并按顺序上传，最后以读取到的数据总大小创建文件
+func (p *ResumeUploader) rputStream(
+	ctx context.Context, ret interface{}, upToken string,
+	key string, hasKey bool, r io.Reader, e *RputExtra) (err error) {
+
+	if ctx == nil {
+		ctx = context.Background()
 	}
+	ctx = traceUpload(ctx, p.Tracer, upToken, key, hasKey)
+	done := recordUploadStart(p.Metrics, methodResumable)
+	defer func() { done(err) }()
 
-	return p.Mkfile(ctx, upToken, upHost, ret, key, hasKey, fsize, extra)
+	// 数据流无法回溯，不支持断点续传
+	extra := p.initExtra(e)
+	if len(extra.Progresses) != 0 {
+		return ErrInvalidPutProgress
+	}
+	defer writeBackProgresses(e, extra)
+	if err = checkPutPolicy(upToken, -1, extra.MimeType); err != nil {
+		return
+	}
+	ctx, cancelDeadline := withDeadline(ctx, extra)
+	defer cancelDeadline()
+
+	hosts, err := p.rputUpHosts(upToken, extra)
+	if err != nil {
+		return
+	}
+
+	var tracker *progressTracker
+	if extra.OnProgress != nil {
+		var restore func()
+		tracker, restore = trackProgress(extra, 0)
+		defer restore()
+	}
+
+	var hasher *etagHasher
+	if extra.VerifyEtag {
+		hasher = newEtagHasher()
+	}
+
+	var fsize int64
+	buf := make([]byte, extra.BlockSize)
+	for blkIdx := 0; ; blkIdx++ {
+		n, rErr := io.ReadFull(r, buf)
+		if rErr != nil && rErr != io.EOF && rErr != io.ErrUnexpectedEOF {
+			return rErr
+		}
+		if n == 0 {
+			break
+		}
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
+		extra.Progresses = append(extra.Progresses, BlkputRet{})
+		blk := &blockReaderAt{data: buf[:n], off: fsize}
+		fsize += int64(n)
+		if tracker != nil {
+			tracker.grow(fsize)
+		}
+		if hasher != nil {
+			hasher.Write(buf[:n])
+		}
+		if err = p.putBlock(ctx, upToken, hosts, blk, blkIdx, n, extra); err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return
+		}
+
+		if n < len(buf) {
+			break
+		}
+	}
+
+	return p.mkfile(ctx, upToken, hosts.host(), ret, key, hasKey, fsize, "", extra, func() (string, error) {
+		return hasher.Etag(), nil
+	})
+}
+
+// mkfile 创建文件，没有设置 extra.FileName 的时候使用 fileName 作为原始文件名。
+// 设置了 VerifyEtag 的时候检查返回的 hash 和 etag 函数计算的本地文件的 etag 是否一致。
+func (p *ResumeUploader) mkfile(
+	ctx context.Context, upToken string, upHost string, ret interface{}, key string, hasKey bool, fsize int64,
+	fileName string, extra *RputExtra, etag func() (string, error)) (err error) {
+
+	if extra.FileName != "" {
+		fileName = extra.FileName
+	}
+	if !extra.VerifyEtag {
+		return p.mkfileWithName(ctx, upToken, upHost, ret, key, hasKey, fsize, fileName, extra)
+	}
+
+	var data json.RawMessage
+	if err = p.mkfileWithName(ctx, upToken, upHost, &data, key, hasKey, fsize, fileName, extra); err != nil {
+		return
+	}
+	localEtag, err := etag()
+	if err != nil {
+		return
+	}
+	return decodeAndVerifyEtag(data, ret, localEtag)
+}
+
+// extraMu 保护调用方的 RputExtra，上传开始的时候从中复制可选项，上传结束的时候写回 Progresses
+var extraMu sync.Mutex
+
+// initExtra 返回 extra 的一个副本，并为没有指定的可选项设置默认值。
+// 上传过程中只修改这个副本，Progresses 也会被复制，上传结束之后由 writeBackProgresses 写回
+func (p *ResumeUploader) initExtra(e *RputExtra) (extra *RputExtra) {
+	extra = new(RputExtra)
+	if e != nil {
+		extraMu.Lock()
+		*extra = *e
+		if e.Progresses != nil {
+			extra.Progresses = append([]BlkputRet(nil), e.Progresses...)
+		}
+		extraMu.Unlock()
+	}
+
+	s := p.settings()
+	if extra.ChunkSize == 0 {
+		extra.ChunkSize = s.ChunkSize
+	}
+	if extra.TryTimes == 0 {
+		extra.TryTimes = s.TryTimes
+	}
+	if extra.BlockSize <= 0 {
+		extra.BlockSize = s.BlockSize
+	}
+	if extra.Notify == nil {
+		extra.Notify = notifyNil
+	}
+	if extra.NotifyErr == nil {
+		extra.NotifyErr = notifyErrNil
+	}
+	extra.limiter = nil
+	if extra.RateLimit > 0 {
+		extra.limiter = newRateLimiter(extra.RateLimit)
+	}
+	extra.retries = newRetryBudget(extra.MaxTotalRetries)
+	return
+}
+
+// writeBackProgresses 在上传结束的时候将本次上传的进度写回调用方的 e.Progresses，
+// 调用方没有指定 Progresses 的时候设置为新的进度，指定了的时候更新其中的内容，用于之后断点续传
+func writeBackProgresses(e, extra *RputExtra) {
+	if e == nil {
+		return
+	}
+	extraMu.Lock()
+	defer extraMu.Unlock()
+	if e.Progresses == nil {
+		e.Progresses = extra.Progresses
+	} else if len(e.Progresses) == len(extra.Progresses) {
+		copy(e.Progresses, extra.Progresses)
+	}
+}
+
+// notifyChunk 在设置了 NotifyChunk 的时候通知一个片上传成功
+func (extra *RputExtra) notifyChunk(blkIdx int, offset uint32, chunkSize int) {
+	if extra.NotifyChunk != nil {
+		extra.NotifyChunk(blkIdx, offset, chunkSize)
+	}
+}
+
+// withDeadline 在设置了 extra.Deadline 的时候为 ctx 加上截止时间
+func withDeadline(ctx context.Context, extra *RputExtra) (context.Context, context.CancelFunc) {
+	if extra.Deadline.IsZero() {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, extra.Deadline)
+}
+
+// rputUpHosts 获取分片上传使用的上传域名列表，extra.UpHost 优先于 ResumeUploader.UpHosts
+func (p *ResumeUploader) rputUpHosts(upToken string, extra *RputExtra) (hosts *upHostSelector, err error) {
+	if extra.UpHost != "" {
+		return newUpHostSelector([]string{extra.UpHost}), nil
+	}
+	if len(p.UpHosts) > 0 {
+		return newUpHostSelector(orderUpHosts(p.UpHosts, p.HostProber)), nil
+	}
+
+	ak, bucket, err := getAkBucketFromUploadToken(upToken)
+	if err != nil {
+		return
+	}
+	upHosts, err := getUpHosts(p.Cfg, p.Client, ak, bucket)
+	if err != nil {
+		return
+	}
+	return newUpHostSelector(orderUpHosts(upHosts, p.HostProber)), nil
+}
+
+// upHostSelector 在一次上传的所有块之间共享当前使用的上传域名，一个域名失败之后所有的块都切换到下一个域名
+type upHostSelector struct {
+	mu    sync.Mutex
+	hosts []string
+	idx   int
+}
+
+func newUpHostSelector(hosts []string) *upHostSelector {
+	return &upHostSelector{hosts: hosts}
+}
+
+// host 返回当前使用的上传域名
+func (s *upHostSelector) host() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hosts[s.idx]
+}
+
+// failover 在 failedHost 上传失败之后切换到下一个上传域名，其它块已经切换过的时候不再切换。
+// err 为 5xx 错误或者网络错误的时候冻结 failedHost，之后的上传在冻结期间优先使用其它的域名
+func (s *upHostSelector) failover(failedHost string, err error) {
+	if shouldFreezeHost(err) {
+		upHostFreezer.freeze(failedHost, HostFreezeDuration)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hosts[s.idx] == failedHost {
+		s.idx = (s.idx + 1) % len(s.hosts)
+	}
+}
+
+// putBlock 上传一个块，每个片失败的时候按照 extra.TryTimes 进行重试，重试时切换到备用的上传域名
+func (p *ResumeUploader) putBlock(
+	ctx context.Context, upToken string, hosts *upHostSelector, f io.ReaderAt, blkIdx, blkSize int,
+	extra *RputExtra) (err error) {
+
+	err = p.resumableBput(ctx, upToken, hosts, &extra.Progresses[blkIdx], f, blkIdx, blkSize, extra)
+	if err != nil && ctx.Err() == nil {
+		p.logger(ctx).Warn("resumable.Put: block failed", "block", blkIdx, "error", err)
+		extra.NotifyErr(blkIdx, blkSize, err)
+	}
+	return
+}
+
+// progressTracker 汇总多个块并行上传时的整体进度
+type progressTracker struct {
+	mu         sync.Mutex
+	onProgress func(fsize, uploaded int64)
+	fsize      int64
+	uploaded   int64
+	offsets    map[int]int64
+}
+
+func newProgressTracker(onProgress func(fsize, uploaded int64), fsize int64) *progressTracker {
+	return &progressTracker{
+		onProgress: onProgress,
+		fsize:      fsize,
+		offsets:    make(map[int]int64),
+	}
+}
+
+// grow 更新数据的总大小，用于 PutStream 这种不知道总大小的上传
+func (t *progressTracker) grow(fsize int64) {
+	t.mu.Lock()
+	t.fsize = fsize
+	t.mu.Unlock()
+}
+
+// update 记录一个块的上传进度，块被重新上传（比如 ctx 过期）时不会回退已经报告的进度
+func (t *progressTracker) update(blkIdx int, ret *BlkputRet) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	offset := int64(ret.Offset)
+	if offset <= t.offsets[blkIdx] {
+		return
+	}
+	t.uploaded += offset - t.offsets[blkIdx]
+	t.offsets[blkIdx] = offset
+	t.onProgress(t.fsize, t.uploaded)
+}
+
+// trackProgress 在 extra.Notify 之上汇总整体的上传进度，返回的函数用来恢复原来的 Notify
+func trackProgress(extra *RputExtra, fsize int64) (tracker *progressTracker, restore func()) {
+	tracker = newProgressTracker(extra.OnProgress, fsize)
+	for blkIdx := range extra.Progresses {
+		if extra.Progresses[blkIdx].Ctx != "" {
+			tracker.offsets[blkIdx] = int64(extra.Progresses[blkIdx].Offset)
+			tracker.uploaded += int64(extra.Progresses[blkIdx].Offset)
+		}
+	}
+	if tracker.uploaded > 0 {
+		tracker.onProgress(fsize, tracker.uploaded)
+	}
+
+	notify := extra.Notify
+	extra.Notify = func(blkIdx int, blkSize int, ret *BlkputRet) {
+		notify(blkIdx, blkSize, ret)
+		tracker.update(blkIdx, ret)
+	}
+	restore = func() {
+		extra.Notify = notify
+	}
+	return
+}
+
+// blockReaderAt 将单个块的数据映射到它在文件中的偏移位置
+type blockReaderAt struct {
+	data []byte
+	off  int64
+}
+
+func (b *blockReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	return bytes.NewReader(b.data).ReadAt(p, off-b.off)
 }
 
 func (p *ResumeUploader) rputFile(
@@ -285,32 +865,51 @@ func (p *ResumeUploader) rputFile(
 		return
 	}
 
-	return p.rput(ctx, ret, upToken, key, hasKey, f, fi.Size(), extra)
-}
-
-func (p *ResumeUploader) UpHost(ak, bucket string) (upHost string, err error) {
-	var zone *Zone
-	if p.Cfg.Zone != nil {
-		zone = p.Cfg.Zone
-	} else {
-		if v, zoneErr := GetZone(ak, bucket); zoneErr != nil {
-			err = zoneErr
-			return
-		} else {
-			zone = v
+	var recordKey string
+	if extra != nil && extra.Recorder != nil {
+		blkSize := extra.BlockSize
+		if blkSize <= 0 {
+			blkSize = p.settings().BlockSize
+		}
+		recordKey = recorderKey(upToken, key, localFile, fi, blkSize)
+		extraMu.Lock()
+		e := *extra
+		extraMu.Unlock()
+		if e.Progresses == nil {
+			// 从记录中恢复的进度保存在副本中，上传结束之后再写回调用方的 extra
+			e.Progresses = loadProgresses(extra.Recorder, recordKey, blockCount(fi.Size(), blkSize))
+			defer writeBackProgresses(extra, &e)
+			extra = &e
 		}
 	}
 
-	scheme := "http://"
-	if p.Cfg.UseHTTPS {
-		scheme = "https://"
+	var r io.ReaderAt = f
+	if extra != nil && extra.Mmap {
+		if m, mErr := mmapFile(f, fi.Size()); mErr == nil {
+			defer m.Close()
+			r = m
+		}
 	}
 
-	host := zone.SrcUpHosts[0]
-	if p.Cfg.UseCdnDomains {
-		host = zone.CdnUpHosts[0]
+	return p.rput(ctx, ret, upToken, key, hasKey, r, fi.Size(), extra, filepath.Base(localFile), recordKey)
+}
+
+func (p *ResumeUploader) UpHost(ak, bucket string) (upHost string, err error) {
+	return getUpHost(p.Cfg, p.Client, ak, bucket)
+}
+
+// settings 返回该上传对象使用的分片上传设置，没有单独设置时使用全局设置
+func (p *ResumeUploader) settings() Settings {
+	if p.Settings == nil {
+		return settings
 	}
+	return p.Settings.withDefaults()
+}
 
-	upHost = fmt.Sprintf("%s%s", scheme, host)
-	return
+// logger 返回输出日志的对象，优先使用 p.Logger，其次使用 Settings 中的 Logger
+func (p *ResumeUploader) logger(ctx context.Context) Logger {
+	if p.Logger != nil {
+		return withReqid(ctx, p.Logger)
+	}
+	return withReqid(ctx, p.settings().Logger)
 }
@@ -1,10 +1,23 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"hash/crc32"
+	"io/ioutil"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestResumeUploadPutFile(t *testing.T) {
@@ -23,3 +36,838 @@ func TestResumeUploadPutFile(t *testing.T) {
 	}
 	t.Logf("Key: %s, Hash:%s", putRet.Key, putRet.Hash)
 }
+
+func TestResumeUploadPutFileWithSettings(t *testing.T) {
+	var putRet PutRet
+	ctx := context.TODO()
+	putPolicy := PutPolicy{
+		Scope:           testBucket,
+		DeleteAfterDays: 7,
+	}
+	upToken := putPolicy.UploadToken(mac)
+	testKey := fmt.Sprintf("testRPutFileKey_%d", rand.Int())
+
+	uploader := NewResumeUploader(&Config{Zone: &Zone_z0})
+	uploader.Settings = &Settings{Workers: 2, ChunkSize: 1024 * 1024}
+
+	err := uploader.PutFile(ctx, &putRet, upToken, testKey, testLocalFile, nil)
+	if err != nil {
+		t.Fatalf("ResumeUploader#PutFile() error, %s", err)
+	}
+	t.Logf("Key: %s, Hash:%s", putRet.Key, putRet.Hash)
+}
+
+func TestResumeUploadPutCanceled(t *testing.T) {
+	var putRet PutRet
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	data := make([]byte, 9*1024*1024)
+	extra := RputExtra{UpHost: "http://127.0.0.1:1"}
+	err := resumeUploader.Put(ctx, &putRet, "token", "canceled", bytes.NewReader(data), int64(len(data)), &extra)
+	if err != context.Canceled {
+		t.Fatalf("ResumeUploader#Put() error, expect %v, got %v", context.Canceled, err)
+	}
+}
+
+// fakeUpServer 模拟分片上传的 mkblk/bput/mkfile 接口，用来在本地测试分片上传的流程
+type fakeUpServer struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	blocks map[string][]byte
+	files  map[string][]byte
+
+	// 返回错误 crc32 的 mkblk 请求数量，用来测试 crc32 校验失败之后的重试
+	corruptMkblk int
+
+	// 表单上传请求的数量
+	forms int
+}
+
+func newFakeUpServer() *fakeUpServer {
+	s := &fakeUpServer{
+		blocks: make(map[string][]byte),
+		files:  make(map[string][]byte),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *fakeUpServer) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch parts[0] {
+	case "":
+		// 表单上传
+		if req.ContentLength != int64(len(body)) {
+			http.Error(w, `{"error":"content length mismatch"}`, http.StatusBadRequest)
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err := req.ParseMultipartForm(32 << 20); err != nil {
+			http.Error(w, `{"error":"invalid multipart form"}`, http.StatusBadRequest)
+			return
+		}
+		file, _, err := req.FormFile("file")
+		if err != nil {
+			http.Error(w, `{"error":"no file"}`, http.StatusBadRequest)
+			return
+		}
+		data, _ := ioutil.ReadAll(file)
+		key := req.FormValue("key")
+		s.files[key] = data
+		s.forms++
+		etag, _ := Etag(bytes.NewReader(data), int64(len(data)))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"key":%q,"hash":%q}`, key, etag)
+	case "stat":
+		entry, _ := base64.URLEncoding.DecodeString(parts[1])
+		key := strings.SplitN(string(entry), ":", 2)[1]
+		data, ok := s.files[key]
+		if !ok {
+			http.Error(w, `{"error":"no such file or directory"}`, 612)
+			return
+		}
+		etag, _ := Etag(bytes.NewReader(data), int64(len(data)))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"hash":%q,"fsize":%d}`, etag, len(data))
+	case "mkblk":
+		ctx := fmt.Sprintf("ctx%d", len(s.blocks))
+		s.blocks[ctx] = body
+		if s.corruptMkblk > 0 {
+			s.corruptMkblk--
+			s.writeBlkputRet(w, ctx, append([]byte{0}, body...))
+			return
+		}
+		s.writeBlkputRet(w, ctx, body)
+	case "bput":
+		ctx := parts[1]
+		if _, ok := s.blocks[ctx]; !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(InvalidCtx)
+			fmt.Fprint(w, `{"error":"invalid ctx"}`)
+			return
+		}
+		s.blocks[ctx] = append(s.blocks[ctx], body...)
+		s.writeBlkputRet(w, ctx, body)
+	case "mkfile":
+		var data []byte
+		for _, ctx := range strings.Split(string(body), ",") {
+			data = append(data, s.blocks[ctx]...)
+		}
+		key := ""
+		for i := 2; i+1 < len(parts); i += 2 {
+			if parts[i] == "key" {
+				k, _ := base64.URLEncoding.DecodeString(parts[i+1])
+				key = string(k)
+			}
+		}
+		if strconv.Itoa(len(data)) != parts[1] {
+			http.Error(w, `{"error":"fsize mismatch"}`, http.StatusBadRequest)
+			return
+		}
+		s.files[key] = data
+		etag, _ := Etag(bytes.NewReader(data), int64(len(data)))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"key":%q,"hash":%q}`, key, etag)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (s *fakeUpServer) writeBlkputRet(w http.ResponseWriter, ctx string, chunk []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BlkputRet{
+		Ctx:    ctx,
+		Crc32:  crc32.ChecksumIEEE(chunk),
+		Offset: uint32(len(s.blocks[ctx])),
+		Host:   s.URL,
+	})
+}
+
+func (s *fakeUpServer) file(key string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.files[key]
+}
+
+func TestResumeUploadPutStream(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	data := make([]byte, 9*1024*1024+100)
+	rand.Read(data)
+
+	var putRet PutRet
+	extra := RputExtra{UpHost: server.URL, ChunkSize: 1024 * 1024}
+	err := resumeUploader.PutStream(context.Background(), &putRet, "token", "stream", bytes.NewBuffer(data), &extra)
+	if err != nil {
+		t.Fatalf("ResumeUploader#PutStream() error, %s", err)
+	}
+	if !bytes.Equal(server.file("stream"), data) {
+		t.Fatalf("ResumeUploader#PutStream() error, uploaded data mismatch")
+	}
+	if len(extra.Progresses) != BlockCount(int64(len(data))) {
+		t.Fatalf("ResumeUploader#PutStream() error, unexpected block count %d", len(extra.Progresses))
+	}
+}
+
+func TestResumeUploadPutFakeServer(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	data := make([]byte, 13*1024*1024+7)
+	rand.Read(data)
+
+	var putRet PutRet
+	extra := RputExtra{UpHost: server.URL, ChunkSize: 1024 * 1024}
+	err := resumeUploader.Put(context.Background(), &putRet, "token", "fake", bytes.NewReader(data), int64(len(data)), &extra)
+	if err != nil {
+		t.Fatalf("ResumeUploader#Put() error, %s", err)
+	}
+	if putRet.Key != "fake" || !bytes.Equal(server.file("fake"), data) {
+		t.Fatalf("ResumeUploader#Put() error, uploaded data mismatch")
+	}
+}
+
+func TestResumeUploadPutOnProgress(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	data := make([]byte, 9*1024*1024+5)
+	rand.Read(data)
+
+	var mu sync.Mutex
+	var last int64
+	extra := RputExtra{UpHost: server.URL, ChunkSize: 512 * 1024}
+	extra.OnProgress = func(fsize, uploaded int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fsize != int64(len(data)) || uploaded < last || uploaded > fsize {
+			t.Errorf("ResumeUploader#Put() OnProgress(%d, %d) after %d", fsize, uploaded, last)
+		}
+		last = uploaded
+	}
+
+	var putRet PutRet
+	err := resumeUploader.Put(context.Background(), &putRet, "token", "progress", bytes.NewReader(data), int64(len(data)), &extra)
+	if err != nil {
+		t.Fatalf("ResumeUploader#Put() error, %s", err)
+	}
+	if last != int64(len(data)) {
+		t.Fatalf("ResumeUploader#Put() error, uploaded %d bytes, expected %d", last, len(data))
+	}
+}
+
+func TestResumeUploadPutError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"error":"service unavailable"}`)
+	}))
+	defer server.Close()
+
+	data := make([]byte, 9*1024*1024)
+	var putRet PutRet
+	extra := RputExtra{UpHost: server.URL, TryTimes: 1}
+	err := resumeUploader.Put(context.Background(), &putRet, "token", "error", bytes.NewReader(data), int64(len(data)), &extra)
+	putErr, ok := err.(*PutError)
+	if !ok {
+		t.Fatalf("ResumeUploader#Put() expected *PutError, got %v", err)
+	}
+	if len(putErr.BlockErrors) != BlockCount(int64(len(data))) {
+		t.Fatalf("ResumeUploader#Put() error, unexpected block errors %v", putErr)
+	}
+	for i, be := range putErr.BlockErrors {
+		if be.BlkIdx != i {
+			t.Fatalf("ResumeUploader#Put() error, block errors not sorted %v", putErr)
+		}
+	}
+	if ei, ok := putErr.Err().(*ErrorInfo); !ok || ei.Code != http.StatusServiceUnavailable {
+		t.Fatalf("ResumeUploader#Put() error, unexpected underlying error %v", putErr.Err())
+	}
+}
+
+func TestResumeUploadPutAsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Reqid", "reqid-401")
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":"bad token"}`)
+	}))
+	defer server.Close()
+
+	var putRet PutRet
+	extra := RputExtra{UpHost: server.URL}
+	err := resumeUploader.Put(context.Background(), &putRet, "token", "error", bytes.NewReader(make([]byte, 1024)), 1024, &extra)
+	e, ok := AsError(err)
+	if !ok || e.Code != http.StatusUnauthorized || e.Reqid != "reqid-401" || e.Message != "bad token" {
+		t.Fatalf("AsError() = %v, %v", e, ok)
+	}
+	if _, ok = e.Unwrap().(*ErrorInfo); !ok {
+		t.Fatalf("Error#Unwrap() = %v, want *ErrorInfo", e.Unwrap())
+	}
+	if _, ok = AsError(ErrBadToken); ok {
+		t.Fatal("AsError() should fail for non-server errors")
+	}
+}
+
+func TestResumeUploadPutFailFast(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":"bad token"}`)
+	}))
+	defer server.Close()
+
+	uploader := NewResumeUploader(nil)
+	uploader.Settings = &Settings{Workers: 1}
+
+	data := make([]byte, 9*1024*1024)
+	var putRet PutRet
+	extra := RputExtra{UpHost: server.URL}
+	err := uploader.Put(context.Background(), &putRet, "token", "failfast", bytes.NewReader(data), int64(len(data)), &extra)
+	if putErr, ok := err.(*PutError); !ok || len(putErr.BlockErrors) != 1 {
+		t.Fatalf("ResumeUploader#Put() expected a single block error, got %v", err)
+	}
+	if requests != 1 {
+		t.Fatalf("ResumeUploader#Put() error, expected 1 request, got %d", requests)
+	}
+}
+
+func TestResumeUploadPutUpHostFailover(t *testing.T) {
+	badServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"error":"service unavailable"}`)
+	}))
+	defer badServer.Close()
+	server := newFakeUpServer()
+	defer server.Close()
+
+	uploader := NewResumeUploader(nil)
+	uploader.UpHosts = []string{badServer.URL, server.URL}
+
+	data := make([]byte, 9*1024*1024)
+	rand.Read(data)
+
+	var putRet PutRet
+	err := uploader.Put(context.Background(), &putRet, "token", "failover", bytes.NewReader(data), int64(len(data)), nil)
+	if err != nil {
+		t.Fatalf("ResumeUploader#Put() error, %s", err)
+	}
+	if !bytes.Equal(server.file("failover"), data) {
+		t.Fatalf("ResumeUploader#Put() error, uploaded data mismatch")
+	}
+}
+
+func TestResumeUploadPutExtraUpHost(t *testing.T) {
+	var badRequests int32
+	badServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&badRequests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer badServer.Close()
+	server := newFakeUpServer()
+	defer server.Close()
+
+	uploader := NewResumeUploader(nil)
+	uploader.UpHosts = []string{badServer.URL}
+
+	data := make([]byte, 5*1024*1024)
+	rand.Read(data)
+
+	var putRet PutRet
+	err := uploader.Put(context.Background(), &putRet, "token", "uphost", bytes.NewReader(data), int64(len(data)), &RputExtra{UpHost: server.URL})
+	if err != nil {
+		t.Fatalf("ResumeUploader#Put() error, %s", err)
+	}
+	if !bytes.Equal(server.file("uphost"), data) {
+		t.Fatalf("ResumeUploader#Put() error, uploaded data mismatch")
+	}
+	if n := atomic.LoadInt32(&badRequests); n != 0 {
+		t.Fatalf("ResumeUploader#Put() should use RputExtra.UpHost, got %d requests to UpHosts", n)
+	}
+}
+
+func TestResumeUploadPutChecksumRetry(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+	server.corruptMkblk = 1
+
+	data := make([]byte, 5*1024*1024)
+	rand.Read(data)
+
+	uploader := NewResumeUploader(nil)
+	uploader.Settings = &Settings{Workers: 1}
+
+	var putRet PutRet
+	extra := RputExtra{UpHost: server.URL, TryTimes: 2}
+	err := uploader.Put(context.Background(), &putRet, "token", "checksum", bytes.NewReader(data), int64(len(data)), &extra)
+	if err != nil {
+		t.Fatalf("ResumeUploader#Put() error, %s", err)
+	}
+	if !bytes.Equal(server.file("checksum"), data) {
+		t.Fatalf("ResumeUploader#Put() error, uploaded data mismatch")
+	}
+
+	server.corruptMkblk = 1
+	extra = RputExtra{UpHost: server.URL, TryTimes: 1}
+	err = uploader.Put(context.Background(), &putRet, "token", "checksum", bytes.NewReader(data), int64(len(data)), &extra)
+	putErr, ok := err.(*PutError)
+	if !ok {
+		t.Fatalf("ResumeUploader#Put() expected *PutError, got %v", err)
+	}
+	if ce, ok := putErr.Err().(*ChecksumError); !ok || ce.BlkIdx != 0 || ce.Offset != 0 {
+		t.Fatalf("ResumeUploader#Put() expected *ChecksumError, got %v", putErr.Err())
+	}
+}
+
+func TestResumeUploadPutVerifyEtag(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	data := make([]byte, 9*1024*1024+3)
+	rand.Read(data)
+
+	var putRet PutRet
+	extra := RputExtra{UpHost: server.URL, VerifyEtag: true}
+	err := resumeUploader.Put(context.Background(), &putRet, "token", "etag", bytes.NewReader(data), int64(len(data)), &extra)
+	if err != nil || putRet.Key != "etag" {
+		t.Fatalf("ResumeUploader#Put() error, %v", err)
+	}
+
+	extra = RputExtra{UpHost: server.URL, VerifyEtag: true}
+	err = resumeUploader.PutStream(context.Background(), &putRet, "token", "etag", bytes.NewReader(data), &extra)
+	if err != nil {
+		t.Fatalf("ResumeUploader#PutStream() error, %v", err)
+	}
+
+	if err = decodeAndVerifyEtag([]byte(`{"hash":"fake"}`), nil, putRet.Hash); err != ErrUnmatchedEtag {
+		t.Fatalf("decodeAndVerifyEtag() expected ErrUnmatchedEtag, got %v", err)
+	}
+}
+
+func TestResumeUploadPutInvalidCtx(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	data := make([]byte, 5*1024*1024)
+	rand.Read(data)
+
+	// 第一个块使用一个服务端已经淘汰的上下文，上传时需要从头重新上传这个块
+	progresses := make([]BlkputRet, BlockCount(int64(len(data))))
+	progresses[0] = BlkputRet{Ctx: "expired", Offset: 1024 * 1024, Host: server.URL}
+
+	var putRet PutRet
+	extra := RputExtra{UpHost: server.URL, TryTimes: 1, Progresses: progresses}
+	err := resumeUploader.Put(context.Background(), &putRet, "token", "expired", bytes.NewReader(data), int64(len(data)), &extra)
+	if err != nil {
+		t.Fatalf("ResumeUploader#Put() error, %s", err)
+	}
+	if !bytes.Equal(server.file("expired"), data) {
+		t.Fatalf("ResumeUploader#Put() error, uploaded data mismatch")
+	}
+}
+
+func TestResumeUploadPutBlockSize(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	data := make([]byte, 5*1024*1024+1)
+	rand.Read(data)
+
+	var putRet PutRet
+	extra := RputExtra{UpHost: server.URL, BlockSize: 2 * 1024 * 1024, ChunkSize: 1024 * 1024}
+	err := resumeUploader.Put(context.Background(), &putRet, "token", "blocksize", bytes.NewReader(data), int64(len(data)), &extra)
+	if err != nil {
+		t.Fatalf("ResumeUploader#Put() error, %s", err)
+	}
+	if !bytes.Equal(server.file("blocksize"), data) {
+		t.Fatalf("ResumeUploader#Put() error, uploaded data mismatch")
+	}
+	if len(extra.Progresses) != 3 {
+		t.Fatalf("ResumeUploader#Put() error, unexpected block count %d", len(extra.Progresses))
+	}
+	if n := BlockCountWithSize(int64(len(data)), extra.BlockSize); n != 3 {
+		t.Fatalf("BlockCountWithSize() = %d, want 3", n)
+	}
+	if n := BlockCountWithSize(int64(len(data)), 0); n != BlockCount(int64(len(data))) {
+		t.Fatalf("BlockCountWithSize() = %d, should use the default block size", n)
+	}
+}
+
+func TestResumeUploadPutTryTimes(t *testing.T) {
+	var requests int32
+	newBadServer := func() *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"error":"service unavailable"}`)
+		}))
+	}
+	badServer1, badServer2 := newBadServer(), newBadServer()
+	defer badServer1.Close()
+	defer badServer2.Close()
+
+	uploader := NewResumeUploader(nil)
+	uploader.UpHosts = []string{badServer1.URL, badServer2.URL}
+
+	data := make([]byte, 1024*1024)
+	rand.Read(data)
+
+	// 切换上传域名和片的重试共用 TryTimes 次尝试
+	var putRet PutRet
+	err := uploader.Put(context.Background(), &putRet, "token", "trytimes", bytes.NewReader(data), int64(len(data)), &RputExtra{TryTimes: 3})
+	if err == nil {
+		t.Fatal("ResumeUploader#Put() should fail")
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Fatalf("ResumeUploader#Put() error, expected 3 requests, got %d", n)
+	}
+}
+
+func TestMkfileURL(t *testing.T) {
+	extra := RputExtra{
+		MimeType: "text/plain",
+		Params:   map[string]string{"x:user": "qiniu", "ignored": "value"},
+		Metadata: map[string]string{"author": "qiniu"},
+	}
+	url := mkfileURL("http://up.qiniu.com", "key", true, 10, "a.txt", &extra)
+	expected := []string{
+		"http://up.qiniu.com/mkfile/10/",
+		"/mimeType/" + encode("text/plain"),
+		"/fname/" + encode("a.txt"),
+		"/key/" + encode("key"),
+		"/x:user/" + encode("qiniu"),
+		"/x-qn-meta-author/" + encode("qiniu"),
+	}
+	for _, e := range expected {
+		if !strings.Contains(url, e) {
+			t.Fatalf("mkfileURL() = %s, should contain %s", url, e)
+		}
+	}
+	if strings.Contains(url, "ignored") {
+		t.Fatalf("mkfileURL() = %s, should ignore params without x: prefix", url)
+	}
+}
+
+func TestResumeUploadPutSection(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	data := make([]byte, 10*1024*1024)
+	rand.Read(data)
+	off, length := int64(3*1024*1024+7), int64(5*1024*1024)
+
+	var putRet PutRet
+	extra := RputExtra{UpHost: server.URL}
+	err := resumeUploader.PutSection(context.Background(), &putRet, "token", "section", bytes.NewReader(data), off, length, &extra)
+	if err != nil {
+		t.Fatalf("ResumeUploader#PutSection() error, %s", err)
+	}
+	if !bytes.Equal(server.file("section"), data[off:off+length]) {
+		t.Fatalf("ResumeUploader#PutSection() error, uploaded data mismatch")
+	}
+}
+
+func TestResumeUploadPutRetryBudget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"error":"service unavailable"}`)
+	}))
+	defer server.Close()
+
+	uploader := NewResumeUploader(nil)
+	uploader.Settings = &Settings{Workers: 1}
+
+	data := make([]byte, 5*1024*1024)
+	var putRet PutRet
+	extra := RputExtra{UpHost: server.URL, TryTimes: 5, MaxTotalRetries: 2}
+	err := uploader.Put(context.Background(), &putRet, "token", "budget", bytes.NewReader(data), int64(len(data)), &extra)
+	putErr, ok := err.(*PutError)
+	if !ok {
+		t.Fatalf("ResumeUploader#Put() expected *PutError, got %v", err)
+	}
+	retries := 0
+	for _, be := range putErr.BlockErrors {
+		retries += be.Retries
+	}
+	if retries != 2 {
+		t.Fatalf("ResumeUploader#Put() error, expected 2 retries in total, got %d: %v", retries, putErr)
+	}
+
+	extra = RputExtra{UpHost: server.URL, Deadline: time.Now().Add(-time.Second)}
+	err = uploader.Put(context.Background(), &putRet, "token", "deadline", bytes.NewReader(data), int64(len(data)), &extra)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("ResumeUploader#Put() expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestResumeUploadPutNotifyChunk(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	data := make([]byte, 5*1024*1024)
+	rand.Read(data)
+
+	var mu sync.Mutex
+	chunks := make(map[int]uint32)
+	extra := RputExtra{UpHost: server.URL, ChunkSize: 1024 * 1024}
+	extra.NotifyChunk = func(blkIdx int, offset uint32, chunkSize int) {
+		mu.Lock()
+		defer mu.Unlock()
+		if offset != chunks[blkIdx] {
+			t.Errorf("NotifyChunk(%d, %d, %d) error, expected offset %d", blkIdx, offset, chunkSize, chunks[blkIdx])
+		}
+		chunks[blkIdx] = offset + uint32(chunkSize)
+	}
+
+	var putRet PutRet
+	err := resumeUploader.Put(context.Background(), &putRet, "token", "chunk", bytes.NewReader(data), int64(len(data)), &extra)
+	if err != nil {
+		t.Fatalf("ResumeUploader#Put() error, %s", err)
+	}
+	if chunks[0] != 4*1024*1024 || chunks[1] != 1024*1024 {
+		t.Fatalf("ResumeUploader#Put() error, unexpected chunk progress %v", chunks)
+	}
+}
+
+func TestResumeUploadPutReadAhead(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+	server.corruptMkblk = 1
+
+	data := make([]byte, 9*1024*1024+11)
+	rand.Read(data)
+
+	var putRet PutRet
+	extra := RputExtra{UpHost: server.URL, ChunkSize: 512 * 1024, ReadAhead: true}
+	err := resumeUploader.Put(context.Background(), &putRet, "token", "readahead", bytes.NewReader(data), int64(len(data)), &extra)
+	if err != nil {
+		t.Fatalf("ResumeUploader#Put() error, %s", err)
+	}
+	if !bytes.Equal(server.file("readahead"), data) {
+		t.Fatalf("ResumeUploader#Put() error, uploaded data mismatch")
+	}
+}
+
+func TestResumeUploadPutFileMmap(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	f, err := ioutil.TempFile("", "mmap")
+	if err != nil {
+		t.Fatalf("TempFile() error, %s", err)
+	}
+	defer os.Remove(f.Name())
+
+	data := make([]byte, 5*1024*1024+7)
+	rand.Read(data)
+	f.Write(data)
+	f.Close()
+
+	var putRet PutRet
+	extra := RputExtra{UpHost: server.URL, Mmap: true}
+	err = resumeUploader.PutFile(context.Background(), &putRet, "token", "mmap", f.Name(), &extra)
+	if err != nil {
+		t.Fatalf("ResumeUploader#PutFile() error, %s", err)
+	}
+	if !bytes.Equal(server.file("mmap"), data) {
+		t.Fatalf("ResumeUploader#PutFile() error, uploaded data mismatch")
+	}
+}
+
+func TestResumeUploadPutSharedExtra(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	// 多个并发的上传使用同一个 RputExtra 的副本，默认值和内部状态不会写入共用的可选项
+	extra := RputExtra{UpHost: server.URL, ChunkSize: 1024 * 1024, RateLimit: 1 << 30}
+	files := make([][]byte, 4)
+	extras := make([]RputExtra, len(files))
+	var wg sync.WaitGroup
+	for i := range files {
+		files[i] = make([]byte, (i+1)*3*1024*1024+i)
+		rand.Read(files[i])
+		extras[i] = extra
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var putRet PutRet
+			key := fmt.Sprintf("shared%d", i)
+			err := resumeUploader.Put(context.Background(), &putRet, "token", key, bytes.NewReader(files[i]), int64(len(files[i])), &extras[i])
+			if err != nil {
+				t.Errorf("ResumeUploader#Put() error, %s", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, data := range files {
+		if !bytes.Equal(server.file(fmt.Sprintf("shared%d", i)), data) {
+			t.Fatalf("ResumeUploader#Put() error, shared%d uploaded data mismatch", i)
+		}
+		if len(extras[i].Progresses) != BlockCount(int64(len(data))) || extras[i].Notify != nil || extras[i].TryTimes != 0 {
+			t.Fatalf("ResumeUploader#Put() error, only Progresses should be written back, got %+v", extras[i])
+		}
+	}
+	if extra.Progresses != nil {
+		t.Fatalf("ResumeUploader#Put() error, shared extra should not be modified")
+	}
+}
+
+func TestResumeUploadPutProgressesCopied(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	data := make([]byte, 4*4*1024*1024)
+	rand.Read(data)
+
+	progresses := make([]BlkputRet, BlockCount(int64(len(data))))
+	extra := &RputExtra{
+		UpHost:     server.URL,
+		Progresses: progresses,
+		Notify: func(blkIdx int, blkSize int, ret *BlkputRet) {
+			// 上传过程中不会修改调用方的 Progresses
+			for i := range progresses {
+				if progresses[i].Ctx != "" {
+					t.Errorf("ResumeUploader#Put() error, caller's Progresses[%d] modified during upload", i)
+				}
+			}
+		},
+	}
+	var putRet PutRet
+	err := resumeUploader.Put(context.Background(), &putRet, "token", "copied", bytes.NewReader(data), int64(len(data)), extra)
+	if err != nil {
+		t.Fatalf("ResumeUploader#Put() error, %s", err)
+	}
+	if !bytes.Equal(server.file("copied"), data) {
+		t.Fatalf("ResumeUploader#Put() error, uploaded data mismatch")
+	}
+	for i := range progresses {
+		if progresses[i].Ctx == "" {
+			t.Fatalf("ResumeUploader#Put() error, Progresses[%d] should be written back", i)
+		}
+	}
+}
+
+func TestResumeUploadPutAsync(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	data := make([]byte, 8*1024*1024)
+	rand.Read(data)
+
+	var (
+		mu     sync.Mutex
+		chunks int
+	)
+	paused := make(chan struct{})
+	var handle *UploadHandle
+	extra := RputExtra{
+		UpHost:    server.URL,
+		ChunkSize: 512 * 1024,
+		NotifyChunk: func(blkIdx int, offset uint32, chunkSize int) {
+			mu.Lock()
+			defer mu.Unlock()
+			if chunks++; chunks == 2 {
+				handle.Pause()
+				close(paused)
+			}
+		},
+	}
+	settings := Settings{Workers: 1}
+	uploader := &ResumeUploader{Client: resumeUploader.Client, Cfg: resumeUploader.Cfg, Settings: &settings}
+
+	var putRet PutRet
+	mu.Lock()
+	handle = uploader.PutAsync(context.Background(), &putRet, "token", "async", bytes.NewReader(data), int64(len(data)), &extra)
+	mu.Unlock()
+
+	<-paused
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	pausedChunks := chunks
+	mu.Unlock()
+	if pausedChunks != 2 {
+		t.Fatalf("UploadHandle#Pause() error, %d chunks uploaded while paused", pausedChunks)
+	}
+
+	handle.Resume()
+	if err := <-handle.Done(); err != nil {
+		t.Fatalf("ResumeUploader#PutAsync() error, %s", err)
+	}
+	if !bytes.Equal(server.file("async"), data) {
+		t.Fatalf("ResumeUploader#PutAsync() error, uploaded data mismatch")
+	}
+
+	// 暂停之后取消上传
+	handle = uploader.PutAsync(context.Background(), &putRet, "token", "async", bytes.NewReader(data), int64(len(data)), &RputExtra{UpHost: server.URL})
+	handle.Pause()
+	handle.Cancel()
+	if err := <-handle.Done(); err != context.Canceled {
+		t.Fatalf("UploadHandle#Cancel() error, %v", err)
+	}
+}
+
+func TestResumeUploadPutAsyncCancelAndResume(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	data := make([]byte, 8*1024*1024)
+	rand.Read(data)
+
+	settings := Settings{Workers: 1}
+	uploader := &ResumeUploader{Client: resumeUploader.Client, Cfg: resumeUploader.Cfg, Settings: &settings}
+
+	// 第一个块上传完毕之后取消上传，调用方没有指定 Progresses
+	var handle *UploadHandle
+	ready := make(chan struct{})
+	extra := RputExtra{
+		UpHost:    server.URL,
+		ChunkSize: 4 * 1024 * 1024,
+		Notify: func(blkIdx int, blkSize int, ret *BlkputRet) {
+			<-ready
+			handle.Cancel()
+		},
+	}
+	var putRet PutRet
+	handle = uploader.PutAsync(context.Background(), &putRet, "token", "resumed", bytes.NewReader(data), int64(len(data)), &extra)
+	close(ready)
+	if err := <-handle.Done(); err != context.Canceled {
+		t.Fatalf("UploadHandle#Cancel() error, %v", err)
+	}
+	if len(extra.Progresses) != 2 || extra.Progresses[0].Ctx == "" || extra.Progresses[1].Ctx != "" {
+		t.Fatalf("ResumeUploader#PutAsync() error, unexpected Progresses written back: %+v", extra.Progresses)
+	}
+
+	// 使用写回的进度继续上传，只需要上传剩下的块
+	var blocks []int
+	extra.Notify = func(blkIdx int, blkSize int, ret *BlkputRet) {
+		blocks = append(blocks, blkIdx)
+	}
+	handle = uploader.PutAsync(context.Background(), &putRet, "token", "resumed", bytes.NewReader(data), int64(len(data)), &extra)
+	if err := <-handle.Done(); err != nil {
+		t.Fatalf("ResumeUploader#PutAsync() error, %s", err)
+	}
+	if len(blocks) != 1 || blocks[0] != 1 {
+		t.Fatalf("ResumeUploader#PutAsync() error, blocks uploaded when resuming: %v", blocks)
+	}
+	if !bytes.Equal(server.file("resumed"), data) {
+		t.Fatalf("ResumeUploader#PutAsync() error, uploaded data mismatch")
+	}
+}
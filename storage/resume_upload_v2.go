@@ -0,0 +1,489 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qiniu/api.v7/conf"
+)
+
+// 分片上传 v2 的分片大小限制
+const (
+	minPartSize     = 1024 * 1024        // 最小的分片大小，1MB
+	maxPartSize     = 1024 * 1024 * 1024 // 最大的分片大小，1GB
+	defaultPartSize = 4 * 1024 * 1024    // 默认的分片大小，4MB
+	maxPartCount    = 10000              // 单个文件最多的分片数量
+)
+
+// 分片上传 v2 过程中可能遇到的错误
+var (
+	ErrInvalidPartSize   = errors.New("invalid part size, only allow [1MB, 1GB]")
+	ErrTooManyParts      = errors.New("too many parts, the part count exceeds the limit of 10000")
+	ErrUnmatchedPartMD5  = errors.New("unmatched part md5")
+	ErrInvalidPartNumber = errors.New("invalid part number")
+)
+
+// InitPartsRet 表示初始化分片上传任务的返回值
+type InitPartsRet struct {
+	UploadID string `json:"uploadId"`
+	ExpireAt int64  `json:"expireAt"`
+}
+
+// UploadPartsRet 表示上传一个分片的返回值
+type UploadPartsRet struct {
+	Etag string `json:"etag"`
+	MD5  string `json:"md5"`
+}
+
+// UploadPartInfo 表示一个已经上传完毕的分片
+type UploadPartInfo struct {
+	Etag       string `json:"etag"`
+	PartNumber int64  `json:"partNumber"`
+}
+
+// RputV2Extra 表示分片上传 v2 额外可以指定的参数
+type RputV2Extra struct {
+	Metadata   map[string]string // 可选。用户自定义的文件元数据，key 可以省略 "x-qn-meta-" 前缀，值为空的时候忽略
+	CustomVars map[string]string // 可选。用户自定义参数，key 需要以 "x:" 开头，而且值不能为空，否则忽略
+	UpHost     string
+	MimeType   string // 可选。
+	FileName   string // 可选。原始文件名，用于魔法变量 $(fname)
+	PartSize   int64  // 可选。每个分片的大小，不设定则为4M，取值范围为 [1MB, 1GB]
+	TryTimes   int    // 可选。尝试次数
+
+	// 可选。上一次上传的 uploadId 和已经上传完毕的分片，用于断点续传。
+	// 上传结束的时候 UploadID 和 Progresses 写回，Progresses 按分片序号保存各个分片的上传结果，没有上传完毕的分片 Etag 为空。
+	UploadID   string
+	Progresses []UploadPartInfo
+
+	Notify    func(partNumber int64, ret *UploadPartsRet) // 可选。进度提示（注意多个分片是并行传输的）
+	NotifyErr func(partNumber int64, err error)
+}
+
+// ResumeUploaderV2 表示一个基于分片上传 v2 协议的上传对象。和 ResumeUploader 相比，
+// 分片大小可以在 1MB 到 1GB 之间指定，更适合于大文件的上传。
+type ResumeUploaderV2 struct {
+	Client *Client
+	Cfg    *Config
+
+	// 可选。并发上传的设置，只使用其中的 Workers 和 TryTimes，不设定则使用 SetSettings 设置的全局参数
+	Settings *Settings
+
+	// 可选。失败之后的重试策略，不设定则使用 DefaultRetryPolicy
+	RetryPolicy RetryPolicy
+
+	// 可选。记录上传次数、数据量、分片耗时和重试次数的对象，不设定则不记录
+	Metrics Metrics
+
+	// 可选。为每个请求创建 span 的对象，不设定则不创建
+	Tracer Tracer
+
+	// 可选。输出日志的对象，不设定则使用 Settings 中的 Logger
+	Logger Logger
+}
+
+// NewResumeUploaderV2 表示构建一个新的分片上传 v2 的对象
+func NewResumeUploaderV2(cfg *Config) *ResumeUploaderV2 {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	return &ResumeUploaderV2{
+		Cfg:    cfg,
+		Client: &DefaultClient,
+	}
+}
+
+// NewResumeUploaderV2Ex 表示构建一个新的分片上传 v2 的对象
+func NewResumeUploaderV2Ex(cfg *Config, client *Client) *ResumeUploaderV2 {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	if client == nil {
+		client = &DefaultClient
+	}
+
+	return &ResumeUploaderV2{
+		Client: client,
+		Cfg:    cfg,
+	}
+}
+
+// 分片上传 v2 的请求路径前缀，没有指定 key 的时候使用 "~"
+func uploadsPath(upHost, bucket, key string, hasKey bool) string {
+	encodedKey := "~"
+	if hasKey {
+		encodedKey = EncodeKey(key)
+	}
+	return upHost + "/buckets/" + bucket + "/objects/" + encodedKey + "/uploads"
+}
+
+// InitParts 初始化一个分片上传任务，返回的 uploadId 用于标识该上传任务
+func (p *ResumeUploaderV2) InitParts(
+	ctx context.Context, upToken, upHost, bucket, key string, hasKey bool, ret *InitPartsRet) error {
+
+	reqURL := uploadsPath(upHost, bucket, key, hasKey)
+	headers := http.Header{}
+	headers.Add("Authorization", "UpToken "+upToken)
+
+	return p.Client.Call(ctx, ret, "POST", reqURL, headers)
+}
+
+// UploadParts 上传一个分片，partNumber 从 1 开始，partMD5 为分片内容的 md5 的十六进制编码，可以为空
+func (p *ResumeUploaderV2) UploadParts(
+	ctx context.Context, upToken, upHost, bucket, key string, hasKey bool, uploadID string,
+	partNumber int64, partMD5 string, ret *UploadPartsRet, body io.Reader, size int) error {
+
+	reqURL := uploadsPath(upHost, bucket, key, hasKey) + "/" + uploadID + "/" + strconv.FormatInt(partNumber, 10)
+	headers := http.Header{}
+	headers.Add("Content-Type", conf.CONTENT_TYPE_OCTET)
+	headers.Add("Authorization", "UpToken "+upToken)
+	if partMD5 != "" {
+		headers.Add("Content-MD5", partMD5)
+	}
+
+	return p.Client.CallWith(ctx, ret, "PUT", reqURL, headers, body, size)
+}
+
+// completePartsBody 为完成分片上传任务的请求内容
+type completePartsBody struct {
+	Parts      []UploadPartInfo  `json:"parts"`
+	FileName   string            `json:"fname,omitempty"`
+	MimeType   string            `json:"mimeType,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	CustomVars map[string]string `json:"customVars,omitempty"`
+}
+
+// CompleteParts 根据已经上传完毕的分片完成分片上传任务，生成最终的文件
+func (p *ResumeUploaderV2) CompleteParts(
+	ctx context.Context, upToken, upHost string, ret interface{}, bucket, key string, hasKey bool,
+	uploadID string, extra *RputV2Extra) error {
+
+	body := completePartsBody{
+		Parts:    extra.Progresses,
+		FileName: extra.FileName,
+		MimeType: extra.MimeType,
+	}
+	for k, v := range extra.Metadata {
+		if v != "" {
+			if body.Metadata == nil {
+				body.Metadata = make(map[string]string)
+			}
+			body.Metadata[metadataKey(k)] = v
+		}
+	}
+	for k, v := range extra.CustomVars {
+		if strings.HasPrefix(k, "x:") && v != "" {
+			if body.CustomVars == nil {
+				body.CustomVars = make(map[string]string)
+			}
+			body.CustomVars[k] = v
+		}
+	}
+
+	reqURL := uploadsPath(upHost, bucket, key, hasKey) + "/" + uploadID
+	headers := http.Header{}
+	headers.Add("Authorization", "UpToken "+upToken)
+
+	return p.Client.CallWithJson(ctx, ret, "POST", reqURL, headers, body)
+}
+
+// Put 方法用来以分片上传 v2 的方式上传一个文件，支持断点续传。
+//
+// ctx     是请求的上下文。
+// ret     是上传成功后返回的数据。如果 upToken 中没有设置 CallbackUrl 或 ReturnBody，那么返回的数据结构是 PutRet 结构。
+// upToken 是由业务服务器颁发的上传凭证。
+// key     是要上传的文件访问路径。比如："foo/bar.jpg"。注意我们建议 key 不要以 '/' 开头。另外，key 为空字符串是合法的。
+// f       是文件内容的访问接口。
+// fsize   是要上传的文件大小。
+// extra   是上传的一些可选项。详细见 RputV2Extra 结构的描述。
+func (p *ResumeUploaderV2) Put(ctx context.Context, ret interface{}, upToken string, key string, f io.ReaderAt,
+	fsize int64, extra *RputV2Extra) error {
+	return p.rput(ctx, ret, upToken, key, true, f, fsize, extra)
+}
+
+// PutWithoutKey 方法用来以分片上传 v2 的方式上传一个文件，文件命名方式首先看看
+// upToken 中是否设置了 saveKey，如果设置了 saveKey，那么按 saveKey 要求的规则生成 key，否则自动以文件的 hash 做 key。
+func (p *ResumeUploaderV2) PutWithoutKey(
+	ctx context.Context, ret interface{}, upToken string, f io.ReaderAt, fsize int64, extra *RputV2Extra) error {
+	return p.rput(ctx, ret, upToken, "", false, f, fsize, extra)
+}
+
+// PutFile 用来以分片上传 v2 的方式上传一个本地文件。
+// 和 Put 不同的只是一个通过提供文件路径来访问文件内容，一个通过 io.ReaderAt 来访问。
+func (p *ResumeUploaderV2) PutFile(
+	ctx context.Context, ret interface{}, upToken, key, localFile string, extra *RputV2Extra) error {
+	return p.rputFile(ctx, ret, upToken, key, true, localFile, extra)
+}
+
+// PutFileWithoutKey 用来以分片上传 v2 的方式上传一个本地文件，不指定文件上传后保存的 key。
+// 和 PutWithoutKey 不同的只是一个通过提供文件路径来访问文件内容，一个通过 io.ReaderAt 来访问。
+func (p *ResumeUploaderV2) PutFileWithoutKey(
+	ctx context.Context, ret interface{}, upToken, localFile string, extra *RputV2Extra) error {
+	return p.rputFile(ctx, ret, upToken, "", false, localFile, extra)
+}
+
+func (p *ResumeUploaderV2) rputFile(
+	ctx context.Context, ret interface{}, upToken string,
+	key string, hasKey bool, localFile string, extra *RputV2Extra) (err error) {
+
+	f, err := os.Open(localFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return
+	}
+
+	return p.rput(ctx, ret, upToken, key, hasKey, f, fi.Size(), extra)
+}
+
+func (p *ResumeUploaderV2) rput(
+	ctx context.Context, ret interface{}, upToken string,
+	key string, hasKey bool, f io.ReaderAt, fsize int64, e *RputV2Extra) (err error) {
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = traceUpload(ctx, p.Tracer, upToken, key, hasKey)
+	done := recordUploadStart(p.Metrics, methodResumableV2)
+	defer func() { done(err) }()
+	log := p.logger(ctx)
+
+	s := settings
+	if p.Settings != nil {
+		s = p.Settings.withDefaults()
+	}
+
+	extra := copyRputV2Extra(e)
+	if extra.PartSize == 0 {
+		extra.PartSize = defaultPartSize
+	}
+	if extra.PartSize < minPartSize || extra.PartSize > maxPartSize {
+		return ErrInvalidPartSize
+	}
+	if extra.TryTimes == 0 {
+		extra.TryTimes = s.TryTimes
+	}
+	if extra.Notify == nil {
+		extra.Notify = func(partNumber int64, ret *UploadPartsRet) {}
+	}
+	if extra.NotifyErr == nil {
+		extra.NotifyErr = func(partNumber int64, err error) {}
+	}
+
+	if fsize == 0 {
+		// 分片上传 v2 至少需要一个分片，空文件使用表单上传
+		return p.putEmpty(ctx, ret, upToken, key, hasKey, extra)
+	}
+
+	partCnt := int((fsize + extra.PartSize - 1) / extra.PartSize)
+	if partCnt > maxPartCount {
+		return ErrTooManyParts
+	}
+	if extra.UploadID == "" {
+		extra.Progresses = make([]UploadPartInfo, partCnt)
+	} else if len(extra.Progresses) != partCnt {
+		return ErrInvalidPutProgress
+	}
+	defer writeBackRputV2Extra(e, extra)
+
+	ak, bucket, err := getAkBucketFromUploadToken(upToken)
+	if err != nil {
+		return
+	}
+	upHost := extra.UpHost
+	if upHost == "" {
+		if upHost, err = p.UpHost(ak, bucket); err != nil {
+			return
+		}
+	}
+
+	if extra.UploadID == "" {
+		var initRet InitPartsRet
+		if err = p.InitParts(ctx, upToken, upHost, bucket, key, hasKey, &initRet); err != nil {
+			return
+		}
+		extra.UploadID = initRet.UploadID
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, s.Workers)
+
+	for i := 0; i < partCnt; i++ {
+		if extra.Progresses[i].Etag != "" {
+			continue
+		}
+		offset := int64(i) * extra.PartSize
+		partSize := extra.PartSize
+		if offset+partSize > fsize {
+			partSize = fsize - offset
+		}
+		partNumber := int64(i + 1)
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(idx int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			section := io.NewSectionReader(f, offset, partSize)
+			partRet, pErr := p.uploadPart(ctx, upToken, upHost, bucket, key, hasKey, extra, partNumber, section)
+			if pErr != nil {
+				log.Warn("resumable.PutV2: part failed", "part", partNumber, "error", pErr)
+				extra.NotifyErr(partNumber, pErr)
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = pErr
+				}
+				mu.Unlock()
+				return
+			}
+			extra.Progresses[idx] = UploadPartInfo{Etag: partRet.Etag, PartNumber: partNumber}
+			extra.Notify(partNumber, &partRet)
+		}(i)
+	}
+
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return p.CompleteParts(ctx, upToken, upHost, ret, bucket, key, hasKey, extra.UploadID, extra)
+}
+
+// copyRputV2Extra 返回 e 的一个副本，上传过程中只修改这个副本，Progresses 也会被复制
+func copyRputV2Extra(e *RputV2Extra) (extra *RputV2Extra) {
+	extra = new(RputV2Extra)
+	if e != nil {
+		extraMu.Lock()
+		*extra = *e
+		if e.Progresses != nil {
+			extra.Progresses = append([]UploadPartInfo(nil), e.Progresses...)
+		}
+		extraMu.Unlock()
+	}
+	return
+}
+
+// writeBackRputV2Extra 在上传结束的时候将 uploadId 和各个分片的上传结果写回调用方的 e，用于之后断点续传
+func writeBackRputV2Extra(e, extra *RputV2Extra) {
+	if e == nil {
+		return
+	}
+	extraMu.Lock()
+	defer extraMu.Unlock()
+	e.UploadID = extra.UploadID
+	if len(e.Progresses) == len(extra.Progresses) {
+		copy(e.Progresses, extra.Progresses)
+	} else {
+		e.Progresses = extra.Progresses
+	}
+}
+
+// putEmpty 使用表单上传一个空文件
+func (p *ResumeUploaderV2) putEmpty(
+	ctx context.Context, ret interface{}, upToken, key string, hasKey bool, extra *RputV2Extra) error {
+
+	putExtra := PutExtra{
+		Params:   extra.CustomVars,
+		UpHost:   extra.UpHost,
+		MimeType: extra.MimeType,
+		Metadata: extra.Metadata,
+	}
+	uploader := NewFormUploaderEx(p.Cfg, p.Client)
+	if hasKey {
+		return uploader.Put(ctx, ret, upToken, key, bytes.NewReader(nil), 0, &putExtra)
+	}
+	return uploader.PutWithoutKey(ctx, ret, upToken, bytes.NewReader(nil), 0, &putExtra)
+}
+
+// uploadPart 上传一个分片并校验服务端返回的 md5，失败的时候按照 RetryPolicy 重试，最多尝试 extra.TryTimes 次
+func (p *ResumeUploaderV2) uploadPart(
+	ctx context.Context, upToken, upHost, bucket, key string, hasKey bool, extra *RputV2Extra,
+	partNumber int64, section *io.SectionReader) (ret UploadPartsRet, err error) {
+
+	ctx = withTrace(ctx, nil, AttrBlockIndex, partNumber)
+	log := p.logger(ctx)
+
+	h := md5.New()
+	if _, err = io.Copy(h, section); err != nil {
+		return
+	}
+	partMD5 := hex.EncodeToString(h.Sum(nil))
+
+	policy := retryPolicyOrDefault(p.RetryPolicy)
+	for attempt := 1; ; attempt++ {
+		if _, err = section.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+		ret = UploadPartsRet{}
+		start := time.Now()
+		err = p.UploadParts(ctx, upToken, upHost, bucket, key, hasKey, extra.UploadID,
+			partNumber, partMD5, &ret, section, int(section.Size()))
+		if err == nil && ret.MD5 != "" && ret.MD5 != partMD5 {
+			err = ErrUnmatchedPartMD5
+		}
+		recordChunk(p.Metrics, methodResumableV2, upHost, int(section.Size()), start, err)
+		if err == nil || ctx.Err() != nil || attempt >= extra.TryTimes {
+			return
+		}
+		retry, delay := policy.Retry(attempt, err)
+		if !retry || sleepContext(ctx, delay) != nil {
+			return
+		}
+		recordRetry(p.Metrics, methodResumableV2)
+		log.Info("resumable.PutV2: retrying", "part", partNumber, "reason", err)
+	}
+}
+
+// UpHost 获取空间所在机房的上传域名
+func (p *ResumeUploaderV2) UpHost(ak, bucket string) (upHost string, err error) {
+	return getUpHost(p.Cfg, p.Client, ak, bucket)
+}
+
+func (r UploadPartInfo) String() string {
+	return fmt.Sprintf("PartNumber: %d, Etag: %s", r.PartNumber, r.Etag)
+}
+
+// logger 返回输出日志的对象，优先使用 p.Logger，其次使用 Settings 中的 Logger
+func (p *ResumeUploaderV2) logger(ctx context.Context) Logger {
+	if p.Logger != nil {
+		return withReqid(ctx, p.Logger)
+	}
+	if p.Settings != nil {
+		return withReqid(ctx, p.Settings.Logger)
+	}
+	return withReqid(ctx, settings.Logger)
+}
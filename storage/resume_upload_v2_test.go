@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeUpV2Server 模拟分片上传 v2 的 initParts/uploadPart/completeParts 接口
+type fakeUpV2Server struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	parts map[int64][]byte
+	files map[string][]byte
+}
+
+func newFakeUpV2Server() *fakeUpV2Server {
+	s := &fakeUpV2Server{
+		parts: make(map[int64][]byte),
+		files: make(map[string][]byte),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *fakeUpV2Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	// /buckets/<bucket>/objects/<key>/uploads[/<uploadId>[/<partNumber>]]
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case len(parts) == 5 && req.Method == "POST":
+		fmt.Fprint(w, `{"uploadId":"fake-upload-id","expireAt":0}`)
+	case len(parts) == 7 && req.Method == "PUT":
+		partNumber, _ := strconv.ParseInt(parts[6], 10, 64)
+		s.parts[partNumber] = body
+		h := md5.Sum(body)
+		fmt.Fprintf(w, `{"etag":"etag%d","md5":%q}`, partNumber, hex.EncodeToString(h[:]))
+	case len(parts) == 6 && req.Method == "POST":
+		var complete completePartsBody
+		json.Unmarshal(body, &complete)
+		sort.Sort(byPartNumber(complete.Parts))
+		var data []byte
+		for _, part := range complete.Parts {
+			data = append(data, s.parts[part.PartNumber]...)
+		}
+		key := parts[3]
+		if key != "~" {
+			k, _ := base64.URLEncoding.DecodeString(key)
+			key = string(k)
+		}
+		s.files[key] = data
+		fmt.Fprintf(w, `{"key":%q,"hash":"fake"}`, key)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (s *fakeUpV2Server) file(key string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.files[key]
+}
+
+func TestResumeUploadV2PutFakeServer(t *testing.T) {
+	server := newFakeUpV2Server()
+	defer server.Close()
+
+	data := make([]byte, 5*1024*1024+13)
+	rand.Read(data)
+
+	putPolicy := PutPolicy{Scope: "bucket"}
+	upToken := putPolicy.UploadToken(mac)
+
+	var putRet PutRet
+	uploader := NewResumeUploaderV2(nil)
+	extra := RputV2Extra{UpHost: server.URL, PartSize: 1024 * 1024}
+	err := uploader.Put(context.Background(), &putRet, upToken, "fake", bytes.NewReader(data), int64(len(data)), &extra)
+	if err != nil {
+		t.Fatalf("ResumeUploaderV2#Put() error, %s", err)
+	}
+	if putRet.Key != "fake" || !bytes.Equal(server.file("fake"), data) {
+		t.Fatalf("ResumeUploaderV2#Put() error, uploaded data mismatch")
+	}
+	if len(extra.Progresses) != 6 {
+		t.Fatalf("ResumeUploaderV2#Put() error, unexpected part count %d", len(extra.Progresses))
+	}
+}
+
+func TestResumeUploadV2InvalidPartSize(t *testing.T) {
+	uploader := NewResumeUploaderV2(nil)
+	extra := RputV2Extra{PartSize: 1024}
+	err := uploader.Put(context.Background(), nil, "token", "key", bytes.NewReader(nil), 0, &extra)
+	if err != ErrInvalidPartSize {
+		t.Fatalf("ResumeUploaderV2#Put() expected ErrInvalidPartSize, got %v", err)
+	}
+}
+
+func TestResumeUploadV2PutEmpty(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	putPolicy := PutPolicy{Scope: "bucket"}
+	upToken := putPolicy.UploadToken(mac)
+
+	var putRet PutRet
+	uploader := NewResumeUploaderV2(nil)
+	extra := RputV2Extra{UpHost: server.URL}
+	err := uploader.Put(context.Background(), &putRet, upToken, "empty", bytes.NewReader(nil), 0, &extra)
+	if err != nil {
+		t.Fatalf("ResumeUploaderV2#Put() error, %s", err)
+	}
+	server.mu.Lock()
+	data, ok := server.files["empty"]
+	server.mu.Unlock()
+	if !ok || len(data) != 0 {
+		t.Fatalf("ResumeUploaderV2#Put() error, empty file should be uploaded with form upload")
+	}
+	if extra.PartSize != 0 || extra.TryTimes != 0 {
+		t.Fatalf("ResumeUploaderV2#Put() error, defaults should not be written into extra, got %+v", extra)
+	}
+}
+
+// byPartNumber 将分片按序号排序，sort.Slice 需要 Go 1.8
+type byPartNumber []UploadPartInfo
+
+func (b byPartNumber) Len() int           { return len(b) }
+func (b byPartNumber) Less(i, j int) bool { return b[i].PartNumber < b[j].PartNumber }
+func (b byPartNumber) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// RetryPolicy 决定请求失败之后是否重试以及重试之前等待的时间，表单上传、分片上传、下载和资源管理中查询类的请求都使用 RetryPolicy 重试。
+// 各个接口的 TryTimes 仍然限制最多尝试的次数，实现 RetryPolicy 的时候不需要再次判断
+type RetryPolicy interface {
+	// Retry 在第 attempt 次（从1开始）尝试失败之后调用，err 为这次尝试的错误，服务端返回的错误为 *ErrorInfo。
+	// 返回是否重试，以及重试之前等待的时间
+	Retry(attempt int, err error) (retry bool, delay time.Duration)
+}
+
+// DefaultRetryPolicy 为没有设置 RetryPolicy 的时候使用的重试策略，第一次重试之前等待 100 毫秒，之后每次加倍，最多等待 2 秒
+var DefaultRetryPolicy RetryPolicy = &BackoffRetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second}
+
+// BackoffRetryPolicy 只重试 IsRetryableError 返回 true 的错误，重试之前等待的时间按照指数增长
+type BackoffRetryPolicy struct {
+	MaxAttempts int           // 可选。最多尝试的次数，不设定则只受 TryTimes 的限制
+	BaseDelay   time.Duration // 可选。第一次重试之前等待的时间，之后每次重试等待的时间加倍，不设定则立即重试
+	MaxDelay    time.Duration // 可选。每次重试最多等待的时间，不设定则不限制
+}
+
+// Retry 实现 RetryPolicy 接口
+func (p *BackoffRetryPolicy) Retry(attempt int, err error) (retry bool, delay time.Duration) {
+	if !IsRetryableError(err) || (p.MaxAttempts > 0 && attempt >= p.MaxAttempts) {
+		return
+	}
+	delay = p.BaseDelay
+	for i := 1; i < attempt && delay > 0; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return true, delay
+}
+
+// IsRetryableError 判断 err 是否为重试可能成功的错误。网络错误和 5xx 错误可以重试；
+// 4xx 错误只重试 406（上传的数据校验失败）、571 和空间所在区域不正确的错误，其它的比如上传凭证无效重试也不会成功；
+// 612 文件不存在、614 文件已存在等 6xx 错误不重试；取消和超时不重试
+func IsRetryableError(err error) bool {
+	switch err {
+	case nil, context.Canceled, context.DeadlineExceeded:
+		return false
+	}
+	ei, ok := err.(*ErrorInfo)
+	if !ok {
+		return true
+	}
+	switch {
+	case ei.Code == 406 || ei.Code == 571 || isIncorrectZoneError(ei):
+		return true
+	case ei.Code/100 == 4 || ei.Code/100 == 6:
+		return false
+	}
+	return true
+}
+
+// isIncorrectZoneError 判断是否为上传或者管理请求发到了空间所在区域之外的域名，换用其它的域名重试可能成功
+func isIncorrectZoneError(ei *ErrorInfo) bool {
+	msg := strings.ToLower(ei.Err)
+	return strings.Contains(msg, "incorrect region") || strings.Contains(msg, "incorrect zone")
+}
+
+// retryPolicyOrDefault 返回 p，p 为 nil 的时候返回 DefaultRetryPolicy
+func retryPolicyOrDefault(p RetryPolicy) RetryPolicy {
+	if p == nil {
+		return DefaultRetryPolicy
+	}
+	return p
+}
+
+// sleepContext 等待 d，ctx 被取消的时候立即返回 ctx.Err()
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	cases := []struct {
+		err       error
+		retryable bool
+	}{
+		{errors.New("connection reset by peer"), true},
+		{&ChecksumError{}, true},
+		{context.Canceled, false},
+		{&ErrorInfo{Code: 503}, true},
+		{&ErrorInfo{Code: 401, Err: "bad token"}, false},
+		{&ErrorInfo{Code: 406, Err: "crc32 not match"}, true},
+		{&ErrorInfo{Code: 571}, true},
+		{&ErrorInfo{Code: 400, Err: "incorrect region, please use up-z1.qiniup.com"}, true},
+		{&ErrorInfo{Code: 612, Err: "no such file or directory"}, false},
+	}
+	for _, c := range cases {
+		if IsRetryableError(c.err) != c.retryable {
+			t.Errorf("IsRetryableError(%v) should be %v", c.err, c.retryable)
+		}
+	}
+}
+
+func TestBackoffRetryPolicy(t *testing.T) {
+	policy := &BackoffRetryPolicy{MaxAttempts: 4, BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+	for i, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond} {
+		attempt := i + 1
+		if retry, delay := policy.Retry(attempt, &ErrorInfo{Code: 599}); !retry || delay != want {
+			t.Fatalf("Retry(%d) = %v, %s, want %s", attempt, retry, delay, want)
+		}
+	}
+	if retry, _ := policy.Retry(4, &ErrorInfo{Code: 599}); retry {
+		t.Fatal("Retry() should stop after MaxAttempts")
+	}
+	if retry, _ := policy.Retry(1, &ErrorInfo{Code: 401}); retry {
+		t.Fatal("Retry() should not retry 401")
+	}
+}
+
+// newFlakyServer 前 failures 个请求返回 code，之后交给 next 处理
+func newFlakyServer(failures int32, code int, next http.Handler) (server *httptest.Server, requests *int32) {
+	requests = new(int32)
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(requests, 1) <= failures {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code)
+			fmt.Fprint(w, `{"error":"flaky"}`)
+			return
+		}
+		next.ServeHTTP(w, req)
+	}))
+	return
+}
+
+func TestFormUploadRetryPolicy(t *testing.T) {
+	upServer := newFakeUpServer()
+	defer upServer.Close()
+
+	server, requests := newFlakyServer(2, http.StatusBadGateway, http.HandlerFunc(upServer.serveHTTP))
+	defer server.Close()
+	defer upHostFreezer.freeze(server.URL, 0)
+
+	uploader := NewFormUploader(nil)
+	uploader.RetryPolicy = &BackoffRetryPolicy{}
+	data := []byte("retry form upload")
+	var putRet PutRet
+	err := uploader.Put(context.Background(), &putRet, "token", "retry", bytes.NewReader(data), int64(len(data)), &PutExtra{UpHost: server.URL})
+	if err != nil || *requests != 3 || !bytes.Equal(upServer.file("retry"), data) {
+		t.Fatalf("FormUploader#Put() = %v, requests = %d", err, *requests)
+	}
+
+	// 4xx 错误不重试
+	badServer, badRequests := newFlakyServer(10, http.StatusUnauthorized, nil)
+	defer badServer.Close()
+	err = uploader.Put(context.Background(), &putRet, "token", "retry", bytes.NewReader(data), int64(len(data)), &PutExtra{UpHost: badServer.URL})
+	if err == nil || *badRequests != 1 {
+		t.Fatalf("FormUploader#Put() should not retry 401, requests = %d", *badRequests)
+	}
+}
+
+type noRetryPolicy struct{}
+
+func (noRetryPolicy) Retry(attempt int, err error) (bool, time.Duration) { return false, 0 }
+
+func TestRetryPolicyUploadAndManage(t *testing.T) {
+	upServer := newFakeUpServer()
+	defer upServer.Close()
+	server, requests := newFlakyServer(100, http.StatusServiceUnavailable, nil)
+	defer server.Close()
+	defer upHostFreezer.freeze(server.URL, 0)
+
+	// 自定义的 RetryPolicy 不重试的时候只发送一次请求
+	uploader := NewResumeUploader(nil)
+	uploader.RetryPolicy = noRetryPolicy{}
+	var putRet PutRet
+	err := uploader.Put(context.Background(), &putRet, "token", "retry", bytes.NewReader(make([]byte, 1024)), 1024, &RputExtra{UpHost: server.URL, TryTimes: 3})
+	if err == nil || *requests != 1 {
+		t.Fatalf("ResumeUploader#Put() should not retry, requests = %d", *requests)
+	}
+
+	// 资源管理的查询类请求按照 RetryPolicy 重试
+	rsServer, rsRequests := newFlakyServer(1, 599, http.HandlerFunc(upServer.serveHTTP))
+	defer rsServer.Close()
+	bucketManager := NewBucketManager(mac, &Config{RsHost: rsServer.URL})
+	bucketManager.RetryPolicy = &BackoffRetryPolicy{}
+	if _, err = bucketManager.Stat("bucket", "missing"); err == nil || *rsRequests != 2 {
+		t.Fatalf("BucketManager#Stat() should retry 599 but not 612, error = %v, requests = %d", err, *rsRequests)
+	}
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// 上传策略的 returnBody、callbackBody 和 saveKey 中可以使用的魔法变量，七牛服务器在上传成功之后替换成实际的值
+const (
+	MagicBucket       = "$(bucket)"       // 空间名称
+	MagicKey          = "$(key)"          // 文件保存的 key
+	MagicEtag         = "$(etag)"         // 文件的 hash
+	MagicFname        = "$(fname)"        // 上传的原始文件名
+	MagicFsize        = "$(fsize)"        // 文件大小，为数字
+	MagicMimeType     = "$(mimeType)"     // 文件的 MimeType
+	MagicExt          = "$(ext)"          // 上传的原始文件名的扩展名，比如 ".jpg"
+	MagicEndUser      = "$(endUser)"      // 上传策略中的 endUser
+	MagicPersistentID = "$(persistentId)" // 持久化处理的任务 ID
+	MagicUUID         = "$(uuid)"         // 随机生成的 UUID
+	MagicImageInfo    = "$(imageInfo)"    // 图片的基本信息，为 JSON 对象，可以解码到 ImageInfo
+	MagicAvinfo       = "$(avinfo)"       // 音视频的元信息，为 JSON 对象，可以解码到 PutRetAvinfo
+	MagicExif         = "$(exif)"         // 图片的 EXIF 信息，为 JSON 对象，可以解码到 ExifInfo
+)
+
+// rawMagicVariables 为替换之后不是字符串的魔法变量，在 returnBody 模板中不能加引号
+var rawMagicVariables = map[string]bool{
+	MagicFsize:            true,
+	MagicImageInfo:        true,
+	"$(imageInfo.width)":  true,
+	"$(imageInfo.height)": true,
+	"$(imageInfo.size)":   true,
+	MagicAvinfo:           true,
+	"$(avinfo.format)":    true,
+	"$(avinfo.video)":     true,
+	"$(avinfo.audio)":     true,
+	MagicExif:             true,
+	"$(imageAve)":         true,
+}
+
+// PutRetAvinfo 为魔法变量 $(avinfo) 的内容，和 avinfo 接口返回的 AvInfo 不同，按照类型分别返回视频流和音频流
+type PutRetAvinfo struct {
+	Format AvFormat  `json:"format"`
+	Video  *AvStream `json:"video,omitempty"` // 没有视频流的时候为 nil
+	Audio  *AvStream `json:"audio,omitempty"` // 没有音频流的时候为 nil
+}
+
+// ReturnBody 用来生成 JSON 格式的 returnBody 模板，fields 的 key 为返回内容中的字段名称，值可以使用魔法变量和自定义变量，
+// 比如 {"size": MagicFsize, "user": "$(x:user)"}。$(fsize)、$(imageInfo) 等替换之后为数字或者 JSON 对象的魔法变量不加引号，
+// 其它的值作为 JSON 字符串，字段按照名称排序
+func ReturnBody(fields map[string]string) string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	items := make([]string, 0, len(keys))
+	for _, k := range keys {
+		name, _ := json.Marshal(k)
+		value := fields[k]
+		if !rawMagicVariables[value] {
+			quoted, _ := json.Marshal(value)
+			value = string(quoted)
+		}
+		items = append(items, string(name)+":"+value)
+	}
+	return "{" + strings.Join(items, ",") + "}"
+}
+
+// PutRetReturnBody 返回可以解码到 PutRet 的 returnBody 模板，imageInfo 和 avinfo 分别表示是否返回图片和音视频的信息，比如：
+//
+//	putPolicy := storage.PutPolicy{Scope: bucket, ReturnBody: storage.PutRetReturnBody(true, false)}
+//
+// 上传的文件不是图片或者音视频的时候七牛服务器返回的相应字段为空
+func PutRetReturnBody(imageInfo, avinfo bool) string {
+	fields := map[string]string{
+		"key":          MagicKey,
+		"hash":         MagicEtag,
+		"persistentId": MagicPersistentID,
+		"fsize":        MagicFsize,
+		"bucket":       MagicBucket,
+		"name":         MagicFname,
+		"mimeType":     MagicMimeType,
+	}
+	if imageInfo {
+		fields["imageInfo"] = MagicImageInfo
+	}
+	if avinfo {
+		fields["avinfo"] = MagicAvinfo
+	}
+	return ReturnBody(fields)
+}
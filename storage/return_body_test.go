@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestReturnBody(t *testing.T) {
+	body := ReturnBody(map[string]string{"size": MagicFsize, "user": "$(x:user)", "img": MagicImageInfo, `a"b`: MagicKey})
+	if body != `{"a\"b":"$(key)","img":$(imageInfo),"size":$(fsize),"user":"$(x:user)"}` {
+		t.Fatalf("ReturnBody() = %s", body)
+	}
+
+	body = PutRetReturnBody(true, true)
+	if !strings.Contains(body, `"imageInfo":$(imageInfo)`) || !strings.Contains(body, `"avinfo":$(avinfo)`) ||
+		strings.Contains(PutRetReturnBody(false, false), "imageInfo") {
+		t.Fatalf("PutRetReturnBody() = %s", body)
+	}
+
+	// 模拟七牛服务器替换魔法变量之后的内容
+	replacer := strings.NewReplacer(
+		MagicKey, "a.jpg", MagicEtag, "Fh8xVqod2MQ1mocfI4S4KpRL6D98", MagicPersistentID, "",
+		MagicFsize, "1024", MagicBucket, "bucket", MagicFname, "photo.jpg", MagicMimeType, "image/jpeg",
+		MagicImageInfo, `{"format":"jpeg","width":640,"height":480,"colorModel":"ycbcr"}`,
+		MagicAvinfo, `{"format":{"nb_streams":1,"duration":"1.5"},"audio":{"codec_type":"audio","codec_name":"aac"}}`,
+	)
+	var ret PutRet
+	if err := json.Unmarshal([]byte(replacer.Replace(body)), &ret); err != nil {
+		t.Fatalf("decode PutRet error, %s", err)
+	}
+	if ret.Key != "a.jpg" || ret.Fsize != 1024 || ret.Bucket != "bucket" || ret.Name != "photo.jpg" || ret.MimeType != "image/jpeg" ||
+		ret.ImageInfo == nil || ret.ImageInfo.Width != 640 || ret.Avinfo == nil || ret.Avinfo.Video != nil || ret.Avinfo.Audio.CodecName != "aac" {
+		t.Fatalf("unexpected PutRet %+v", ret)
+	}
+}
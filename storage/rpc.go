@@ -19,15 +19,27 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"time"
 )
 
 var UserAgent = "Golang qiniu/rpc package"
-var DefaultClient = Client{&http.Client{Transport: http.DefaultTransport}}
+var DefaultClient = Client{Client: &http.Client{Transport: NewTransport(nil)}}
+
+// NewClient 用来构建一个通过 tr 发送请求的 Client，用于设置代理、TLS 和连接池等参数，tr 为 nil 的时候使用 DefaultClient 的 Transport
+func NewClient(tr http.RoundTripper) *Client {
+	if tr == nil {
+		tr = DefaultClient.Transport
+	}
+	return &Client{Client: &http.Client{Transport: tr}}
+}
 
 // --------------------------------------------------------------------
 
 type Client struct {
 	*http.Client
+
+	// 可选。发送每个请求前后调用的回调，不设定则不调用
+	Hooks *Hooks
 }
 
 // userApp should be [A-Za-z0-9_\ \-\.]*
@@ -54,17 +66,27 @@ func newRequest(ctx Context, method, reqUrl string, headers http.Header, body io
 	//check access token
 	mac, ok := ctx.Value("mac").(*qbox.Mac)
 	if ok {
-		token, signErr := mac.SignRequest(req)
+		authType, _ := ctx.Value("authType").(qbox.AuthType)
+		auth, signErr := mac.Authorization(req, authType)
 		if signErr != nil {
 			err = signErr
 			return
 		}
-		req.Header.Add("Authorization", "QBox "+token)
+		req.Header.Add("Authorization", auth)
 	}
 
 	return
 }
 
+// withMac 在 ctx 中设置对请求签名使用的密钥和签名方式
+func withMac(ctx Context, mac *qbox.Mac, authType qbox.AuthType) Context {
+	ctx = WithValue(ctx, "mac", mac)
+	if authType != qbox.AuthQBox {
+		ctx = WithValue(ctx, "authType", authType)
+	}
+	return ctx
+}
+
 func (r Client) DoRequest(ctx Context, method, reqUrl string, headers http.Header) (resp *http.Response, err error) {
 	req, err := newRequest(ctx, method, reqUrl, headers, nil)
 	if err != nil {
@@ -127,7 +149,9 @@ func (r Client) DoRequestWithJson(ctx Context, method, reqUrl string, headers ht
 	if headers == nil {
 		headers = http.Header{}
 	}
-	headers.Add("Content-Type", "application/json")
+	if headers.Get("Content-Type") == "" {
+		headers.Set("Content-Type", "application/json")
+	}
 	return r.DoRequestWith(ctx, method, reqUrl, headers, bytes.NewReader(reqBody), len(reqBody))
 }
 
@@ -158,6 +182,14 @@ func (r Client) Do(ctx Context, req *http.Request) (resp *http.Response, err err
 	default:
 	}
 
+	r.Hooks.beforeRequest(req)
+	span := startRequestSpan(ctx, req)
+	start := time.Now()
+	defer func() {
+		endRequestSpan(span, resp, err)
+		r.Hooks.afterResponse(req, resp, start, err)
+	}()
+
 	if tr, ok := getRequestCanceler(transport); ok {
 		// support CancelRequest
 		reqC := make(chan bool, 1)
@@ -209,6 +241,54 @@ func (r *ErrorInfo) HttpCode() int {
 	return r.Code
 }
 
+// As 使 errors.As(err, &e) 在 err 为 *ErrorInfo 的时候成立，其中 e 为 *Error 类型的变量
+func (r *ErrorInfo) As(target interface{}) bool {
+	e, ok := target.(**Error)
+	if ok {
+		*e = &Error{Code: r.Code, Reqid: r.Reqid, Message: r.Err, Err: r}
+	}
+	return ok
+}
+
+// Error 为七牛服务返回的错误，Code 为 HTTP 状态码，Reqid 为响应头中的 X-Reqid，反馈问题的时候请提供 Reqid，
+// Message 为响应内容中的错误信息，Err 为原始的错误，一般为 *ErrorInfo。
+// SDK 返回的服务端错误包括分片上传失败的 *PutError 都可以通过 AsError 或者 errors.As 得到 *Error
+type Error struct {
+	Code    int
+	Reqid   string
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s, reqid: %s", e.Code, e.Message, e.Reqid)
+}
+
+// Unwrap 返回原始的错误
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// AsError 依次展开 err 包装的错误，找到服务端返回的错误的时候返回 *Error 和 true，不依赖 Go 1.13 的 errors.As
+func AsError(err error) (e *Error, ok bool) {
+	for err != nil {
+		switch v := err.(type) {
+		case *Error:
+			return v, true
+		case interface{ As(interface{}) bool }:
+			if v.As(&e) {
+				return e, true
+			}
+		}
+		u, isWrapper := err.(interface{ Unwrap() error })
+		if !isWrapper {
+			return nil, false
+		}
+		err = u.Unwrap()
+	}
+	return nil, false
+}
+
 // --------------------------------------------------------------------
 
 func parseError(e *ErrorInfo, r io.Reader) {
@@ -253,6 +333,7 @@ func CallRetChan(ctx Context, resp *http.Response) (retCh chan listFilesRet2, er
 
 	retCh = make(chan listFilesRet2)
 	if resp.StatusCode/100 != 2 {
+		defer closeResponse(resp)
 		return nil, ResponseError(resp)
 	}
 
@@ -283,10 +364,7 @@ func CallRetChan(ctx Context, resp *http.Response) (retCh chan listFilesRet2, er
 
 func CallRet(ctx Context, ret interface{}, resp *http.Response) (err error) {
 
-	defer func() {
-		io.Copy(ioutil.Discard, resp.Body)
-		resp.Body.Close()
-	}()
+	defer closeResponse(resp)
 
 	if resp.StatusCode/100 == 2 {
 		if ret != nil && resp.ContentLength != 0 {
@@ -357,9 +435,6 @@ func (r Client) CallChan(ctx Context, method, reqUrl string, headers http.Header
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode/100 != 2 {
-		return nil, ResponseError(resp)
-	}
 	return CallRetChan(ctx, resp)
 }
 
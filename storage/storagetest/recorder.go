@@ -0,0 +1,254 @@
+package storagetest
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"unicode/utf8"
+)
+
+// Mode 为 Recorder 的工作模式
+type Mode int
+
+const (
+	ModeReplay Mode = iota // 回放 fixture 中录制的响应，不发送真实的请求
+	ModeRecord             // 发送真实的请求并录制响应，调用 Save 之后写入 fixture
+)
+
+// DefaultRedactedParams 为录制和回放的时候默认替换成 "REDACTED" 的 URL 参数，包括 AccessKey、下载凭证和过期时间
+var DefaultRedactedParams = []string{"ak", "token", "e"}
+
+// Interaction 为 fixture 中录制的一次请求和响应。请求只记录方法、URL 和 body 的 SHA1，不记录 Header 和 body 的内容，
+// 所以 fixture 中不会包含签名和上传凭证。
+// 可以修改 fixture 中的 Status 和 Body 来模拟服务端的错误，比如把一个上传域名的 mkblk 请求改成 503 来测试切换域名
+type Interaction struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	BodySHA1   string      `json:"body_sha1,omitempty"` // 请求 body 的 SHA1，用来区分并行上传的 URL 相同的块
+	Status     int         `json:"status"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 string      `json:"body_base64,omitempty"` // 不是 UTF-8 文本的响应使用 base64 编码
+}
+
+// Recorder 为录制和回放请求的 http.RoundTripper，通过 storage.NewClient(recorder) 使用。
+// 录制模式下把真实的请求和响应保存到 fixture 文件中，CI 中使用回放模式按照请求的方法、URL 和 body 返回录制的响应，
+// body 不同的请求（比如每次内容都不同的表单上传）只按照方法和 URL 匹配。
+// 相同的请求（比如重试）按照录制的顺序返回，所以区域切换和错误重试的流程可以确定地重现
+type Recorder struct {
+	// 可选。录制模式下发送请求的 RoundTripper，不设定则使用 http.DefaultTransport
+	Transport http.RoundTripper
+
+	// 可选。替换成 "REDACTED" 的 URL 参数，不设定则为 DefaultRedactedParams
+	RedactedParams []string
+
+	// 可选。保存 fixture 之前处理每个录制的请求和响应，用来去掉响应中的敏感信息，不设定则不处理
+	Sanitize func(i *Interaction)
+
+	mode         Mode
+	path         string
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// NewRecorder 用来构建一个录制或者回放 path 中 fixture 的 Recorder，回放模式下 path 不存在的时候返回错误
+func NewRecorder(path string, mode Mode) (r *Recorder, err error) {
+	r = &Recorder{mode: mode, path: path}
+	if mode == ModeRecord {
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &r.interactions); err != nil {
+		return nil, fmt.Errorf("storagetest: invalid fixture %s, %s", path, err)
+	}
+	r.used = make([]bool, len(r.interactions))
+	return
+}
+
+// RoundTrip 实现 http.RoundTripper 接口
+func (r *Recorder) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	if r.mode == ModeRecord {
+		return r.record(req)
+	}
+	bodySHA1, err := readBodySHA1(req)
+	if err != nil {
+		return
+	}
+	reqURL := r.redact(req.URL)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// 优先使用 body 相同的录制，没有的时候使用方法和 URL 相同的第一个录制
+	matched := -1
+	for i, in := range r.interactions {
+		if r.used[i] || in.Method != req.Method || in.URL != reqURL {
+			continue
+		}
+		if in.BodySHA1 == bodySHA1 {
+			matched = i
+			break
+		}
+		if matched < 0 {
+			matched = i
+		}
+	}
+	if matched < 0 {
+		return nil, fmt.Errorf("storagetest: no recorded interaction for %s %s", req.Method, reqURL)
+	}
+	r.used[matched] = true
+	return r.interactions[matched].response(req)
+}
+
+// record 发送真实的请求，读取响应的全部内容之后录制
+func (r *Recorder) record(req *http.Request) (resp *http.Response, err error) {
+	tr := r.Transport
+	if tr == nil {
+		tr = http.DefaultTransport
+	}
+	bodySHA1, err := readBodySHA1(req)
+	if err != nil {
+		return
+	}
+	resp, err = tr.RoundTrip(req)
+	if err != nil {
+		return
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	in := Interaction{Method: req.Method, URL: r.redact(req.URL), BodySHA1: bodySHA1, Status: resp.StatusCode, Header: resp.Header}
+	if utf8.Valid(body) {
+		in.Body = string(body)
+	} else {
+		in.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+	r.mu.Lock()
+	r.interactions = append(r.interactions, in)
+	r.mu.Unlock()
+	return
+}
+
+// Save 在录制模式下把录制的请求和响应写入 fixture，回放模式下返回错误
+func (r *Recorder) Save() (err error) {
+	if r.mode != ModeRecord {
+		return errors.New("storagetest: Save() is only available in record mode")
+	}
+	r.mu.Lock()
+	interactions := make([]Interaction, len(r.interactions))
+	copy(interactions, r.interactions)
+	r.mu.Unlock()
+	for i := range interactions {
+		interactions[i].Header = sanitizeHeader(interactions[i].Header)
+		if r.Sanitize != nil {
+			r.Sanitize(&interactions[i])
+		}
+	}
+	data, err := json.MarshalIndent(interactions, "", "  ")
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(r.path, data, os.FileMode(0644))
+}
+
+// Unused 返回回放模式下还没有被请求过的录制，用来检查测试是否发送了全部预期的请求
+func (r *Recorder) Unused() (unused []Interaction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, in := range r.interactions {
+		if i < len(r.used) && !r.used[i] {
+			unused = append(unused, in)
+		}
+	}
+	return
+}
+
+// readBodySHA1 读取 req 的 body 并计算 SHA1，之后把 req.Body 替换成读取的内容
+func readBodySHA1(req *http.Request) (sum string, err error) {
+	if req.Body == nil {
+		return
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if len(body) > 0 {
+		sum = fmt.Sprintf("%x", sha1.Sum(body))
+	}
+	return
+}
+
+// redact 把 u 中需要隐藏的参数替换成 "REDACTED"，录制和回放的时候使用相同的规则，所以使用不同的密钥也可以匹配
+func (r *Recorder) redact(u *url.URL) string {
+	params := r.RedactedParams
+	if params == nil {
+		params = DefaultRedactedParams
+	}
+	redacted := *u
+	query := redacted.Query()
+	changed := false
+	for _, p := range params {
+		if _, ok := query[p]; ok {
+			query.Set(p, "REDACTED")
+			changed = true
+		}
+	}
+	if changed {
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.String()
+}
+
+// response 使用录制的内容构建 req 的响应
+func (in *Interaction) response(req *http.Request) (resp *http.Response, err error) {
+	body := []byte(in.Body)
+	if in.BodyBase64 != "" {
+		if body, err = base64.StdEncoding.DecodeString(in.BodyBase64); err != nil {
+			return nil, err
+		}
+	}
+	header := make(http.Header)
+	for k, v := range in.Header {
+		header[k] = v
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+		StatusCode:    in.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// sanitizeHeader 去掉响应中和连接相关或者可能包含敏感信息的 Header
+func sanitizeHeader(h http.Header) http.Header {
+	clean := make(http.Header)
+	for k, v := range h {
+		switch k {
+		case "Set-Cookie", "Date", "Connection", "Keep-Alive":
+			continue
+		}
+		clean[k] = v
+	}
+	return clean
+}
@@ -0,0 +1,79 @@
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qiniu/api.v7/auth/qbox"
+	"github.com/qiniu/api.v7/storage"
+)
+
+func TestRecorderRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storagetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fixture := filepath.Join(dir, "upload.json")
+
+	mac := qbox.NewMac("ak", "sk")
+	token := (&storage.PutPolicy{Scope: "bucket"}).UploadToken(mac)
+	data := bytes.Repeat([]byte("recorder"), 1024*1024)
+	upload := func(cfg *storage.Config, recorder *Recorder) (ret storage.PutRet, err error) {
+		uploader := storage.NewResumeUploaderEx(cfg, storage.NewClient(recorder))
+		uploader.RetryPolicy = &storage.BackoffRetryPolicy{}
+		err = uploader.Put(context.Background(), &ret, token, "recorded", bytes.NewReader(data), int64(len(data)), nil)
+		return
+	}
+
+	// 录制一次第一个块失败之后重试的上传
+	server := NewServer()
+	cfg := server.Config()
+	server.Fail("mkblk", 1, 503)
+	recorder, err := NewRecorder(fixture, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := upload(cfg, recorder)
+	server.Close()
+	if err != nil {
+		t.Fatalf("ResumeUploader#Put() error, %s", err)
+	}
+	if err = recorder.Save(); err != nil {
+		t.Fatalf("Recorder#Save() error, %s", err)
+	}
+	content, _ := ioutil.ReadFile(fixture)
+	if strings.Contains(string(content), token) || !strings.Contains(string(content), `"status": 503`) {
+		t.Fatalf("unexpected fixture %s", content)
+	}
+
+	// 服务器关闭之后按照录制的顺序回放
+	replayer, err := NewRecorder(fixture, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := upload(cfg, replayer)
+	if err != nil || replayed != recorded {
+		t.Fatalf("replayed %+v, %v, recorded %+v", replayed, err, recorded)
+	}
+	if unused := replayer.Unused(); len(unused) != 0 {
+		t.Fatalf("Recorder#Unused() = %v", unused)
+	}
+	if _, err = upload(cfg, replayer); err == nil {
+		t.Fatal("replay should fail without recorded interactions")
+	}
+	if err = replayer.Save(); err == nil {
+		t.Fatal("Recorder#Save() should fail in replay mode")
+	}
+
+	u, _ := url.Parse("http://io.example.com/key?e=1&token=ak:sign")
+	if redacted := (&Recorder{}).redact(u); redacted != "http://io.example.com/key?e=REDACTED&token=REDACTED" {
+		t.Fatalf("redact() = %s", redacted)
+	}
+}
@@ -0,0 +1,378 @@
+// Package storagetest 提供在内存中模拟七牛对象存储上传和资源管理接口的服务器，用来在单元测试中测试上传的流程，
+// 不需要访问七牛的服务，也不需要自己实现模拟的接口。
+//
+//	server := storagetest.NewServer()
+//	defer server.Close()
+//	uploader := storage.NewUploader(server.Config())
+//	bucketManager := storage.NewBucketManager(mac, server.Config())
+//
+// Server 支持表单上传、分片上传的 mkblk/bput/mkfile 接口以及资源管理的 stat/delete 接口，
+// 按照上传凭证中的 scope、insertOnly、fsizeLimit 检查上传的请求，返回和七牛服务端相同的错误码
+package storagetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qiniu/api.v7/auth/qbox"
+	"github.com/qiniu/api.v7/storage"
+)
+
+// Object 为 Server 中保存的一个文件
+type Object struct {
+	Data     []byte
+	Hash     string
+	MimeType string
+	PutTime  int64 // 上传时间，单位为 100 纳秒
+}
+
+// Server 为在内存中模拟上传和资源管理接口的 HTTP 服务器，可以被多个 goroutine 同时使用
+type Server struct {
+	*httptest.Server
+
+	// 可选。设置之后检查上传凭证的签名，签名无效的时候返回 401，不设定则不检查签名
+	Mac *qbox.Mac
+
+	mu       sync.Mutex
+	buckets  map[string]map[string]*Object
+	blocks   map[string][]byte
+	failures map[string][]int
+	reqs     int
+}
+
+// NewServer 用来构建并启动一个模拟上传和资源管理接口的服务器，使用完毕之后需要调用 Close
+func NewServer() *Server {
+	s := &Server{
+		buckets:  make(map[string]map[string]*Object),
+		blocks:   make(map[string][]byte),
+		failures: make(map[string][]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Config 返回上传和资源管理的请求都发送到 Server 的配置，用于 storage.NewUploader、storage.NewBucketManager 等
+func (s *Server) Config() *storage.Config {
+	return &storage.Config{
+		Zone: &storage.Zone{
+			SrcUpHosts: []string{s.URL},
+			RsHost:     s.URL,
+			RsfHost:    s.URL,
+			ApiHost:    s.URL,
+			IovipHost:  s.URL,
+		},
+		RsHost:  s.URL,
+		RsfHost: s.URL,
+		ApiHost: s.URL,
+		IoHost:  s.URL,
+		UcHost:  s.URL,
+	}
+}
+
+// PutObject 直接在空间中保存一个文件，用来准备测试数据
+func (s *Server) PutObject(bucket, key string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.putObject(bucket, key, data, "")
+}
+
+// Object 返回空间中的文件，文件不存在的时候 ok 为 false
+func (s *Server) Object(bucket, key string) (obj Object, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.buckets[bucket][key]
+	if ok {
+		obj = *o
+	}
+	return
+}
+
+// Keys 返回空间中全部文件的 key，按照字典序排列
+func (s *Server) Keys(bucket string) (keys []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// Fail 让接下来的 n 个 op 请求返回状态码为 code 的错误，用来测试重试和切换域名的流程。
+// op 为 "upload"（表单上传）、"mkblk"、"bput"、"mkfile"、"stat" 或者 "delete"
+func (s *Server) Fail(op string, n, code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures[op] = append(s.failures[op], code)
+	}
+}
+
+// Requests 返回 Server 收到的请求数量
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reqs
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "read body failed")
+		return
+	}
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	op := parts[0]
+	if op == "" {
+		op = "upload"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reqs++
+	w.Header().Set("X-Reqid", fmt.Sprintf("storagetest-%d", s.reqs))
+	if codes := s.failures[op]; len(codes) > 0 {
+		s.failures[op] = codes[1:]
+		writeError(w, codes[0], "storagetest: injected failure")
+		return
+	}
+
+	switch op {
+	case "upload":
+		s.servePut(w, req, body)
+	case "mkblk":
+		s.serveMkblk(w, req, body)
+	case "bput":
+		s.serveBput(w, req, parts, body)
+	case "mkfile":
+		s.serveMkfile(w, req, parts, body)
+	case "stat", "delete":
+		s.serveManage(w, req, op, parts)
+	default:
+		writeError(w, http.StatusNotFound, "storagetest: unsupported api "+req.URL.Path)
+	}
+}
+
+// servePut 处理表单上传
+func (s *Server) servePut(w http.ResponseWriter, req *http.Request, body []byte) {
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err := req.ParseMultipartForm(int64(len(body)) + 1024); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid multipart form")
+		return
+	}
+	file, _, err := req.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "file is not specified in multipart")
+		return
+	}
+	data, _ := ioutil.ReadAll(file)
+	if crc := req.FormValue("crc32"); crc != "" {
+		if v, pErr := strconv.ParseUint(crc, 10, 32); pErr != nil || uint32(v) != crc32.ChecksumIEEE(data) {
+			writeError(w, 406, "crc32 not match")
+			return
+		}
+	}
+	_, hasKey := req.MultipartForm.Value["key"]
+	s.put(w, req.FormValue("token"), req.FormValue("key"), hasKey, data, "")
+}
+
+// serveMkblk 创建块并保存第一个片的数据
+func (s *Server) serveMkblk(w http.ResponseWriter, req *http.Request, body []byte) {
+	if _, ok := s.checkToken(w, upToken(req)); !ok {
+		return
+	}
+	ctx := fmt.Sprintf("ctx-%d", len(s.blocks))
+	s.blocks[ctx] = body
+	s.writeBlkputRet(w, ctx, body)
+}
+
+// serveBput 在已经创建的块中追加一个片，路径为 /bput/<ctx>/<offset>
+func (s *Server) serveBput(w http.ResponseWriter, req *http.Request, parts []string, body []byte) {
+	if _, ok := s.checkToken(w, upToken(req)); !ok {
+		return
+	}
+	if len(parts) < 3 {
+		writeError(w, http.StatusBadRequest, "invalid bput path")
+		return
+	}
+	ctx := parts[1]
+	block, ok := s.blocks[ctx]
+	if !ok {
+		writeError(w, storage.InvalidCtx, "invalid ctx")
+		return
+	}
+	if parts[2] != strconv.Itoa(len(block)) {
+		writeError(w, http.StatusBadRequest, "invalid offset")
+		return
+	}
+	s.blocks[ctx] = append(block, body...)
+	s.writeBlkputRet(w, ctx, body)
+}
+
+// serveMkfile 合并 body 中的块创建文件，路径为 /mkfile/<fsize>/key/<encodedKey>/mimeType/<encodedMimeType>/...
+func (s *Server) serveMkfile(w http.ResponseWriter, req *http.Request, parts []string, body []byte) {
+	var data []byte
+	if len(body) > 0 {
+		for _, ctx := range strings.Split(string(body), ",") {
+			block, ok := s.blocks[ctx]
+			if !ok {
+				writeError(w, storage.InvalidCtx, "invalid ctx")
+				return
+			}
+			data = append(data, block...)
+		}
+	}
+	if len(parts) < 2 || parts[1] != strconv.Itoa(len(data)) {
+		writeError(w, http.StatusBadRequest, "fsize not match")
+		return
+	}
+	var key, mimeType string
+	hasKey := false
+	for i := 2; i+1 < len(parts); i += 2 {
+		value, _ := storage.DecodeKey(parts[i+1])
+		switch parts[i] {
+		case "key":
+			key, hasKey = value, true
+		case "mimeType":
+			mimeType = value
+		}
+	}
+	s.put(w, upToken(req), key, hasKey, data, mimeType)
+}
+
+// put 检查上传凭证之后保存文件，返回 PutRet
+func (s *Server) put(w http.ResponseWriter, token, key string, hasKey bool, data []byte, mimeType string) {
+	info, ok := s.checkToken(w, token)
+	if !ok {
+		return
+	}
+	policy := info.Policy
+	if policy.FsizeLimit > 0 && int64(len(data)) > policy.FsizeLimit {
+		writeError(w, 413, "file exceeds the size limit")
+		return
+	}
+	if policy.FsizeMin > 0 && int64(len(data)) < policy.FsizeMin {
+		writeError(w, 403, "file is too small")
+		return
+	}
+	etag, _ := storage.Etag(bytes.NewReader(data), int64(len(data)))
+	if !hasKey {
+		key = info.Key
+		if key == "" || policy.IsPrefixalScope != 0 {
+			key = etag
+		}
+	}
+	if !info.AllowKey(key) {
+		writeError(w, http.StatusForbidden, "key doesn't match with scope")
+		return
+	}
+	// scope 中没有指定 key 或者设置了 insertOnly 的时候不能覆盖内容不同的文件
+	overwrite := info.Key != "" && policy.InsertOnly == 0
+	if old, exists := s.buckets[info.Bucket][key]; exists && !overwrite && old.Hash != etag {
+		writeError(w, 614, "file exists")
+		return
+	}
+	s.putObject(info.Bucket, key, data, mimeType)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"key": key, "hash": etag, "fsize": len(data), "bucket": info.Bucket,
+	})
+}
+
+func (s *Server) putObject(bucket, key string, data []byte, mimeType string) {
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	etag, _ := storage.Etag(bytes.NewReader(data), int64(len(data)))
+	if s.buckets[bucket] == nil {
+		s.buckets[bucket] = make(map[string]*Object)
+	}
+	s.buckets[bucket][key] = &Object{
+		Data:     append([]byte(nil), data...),
+		Hash:     etag,
+		MimeType: mimeType,
+		PutTime:  time.Now().UnixNano() / 100,
+	}
+}
+
+// serveManage 处理 /stat/<EncodedEntry> 和 /delete/<EncodedEntry>
+func (s *Server) serveManage(w http.ResponseWriter, req *http.Request, op string, parts []string) {
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "QBox ") && !strings.HasPrefix(auth, "Qiniu ") {
+		writeError(w, http.StatusUnauthorized, "bad token")
+		return
+	}
+	var bucket, key string
+	hasKey := false
+	if len(parts) >= 2 {
+		bucket, key, hasKey, _ = storage.DecodeEntry(parts[1])
+	}
+	if !hasKey {
+		writeError(w, http.StatusBadRequest, "invalid entry")
+		return
+	}
+	obj, ok := s.buckets[bucket][key]
+	if !ok {
+		writeError(w, 612, "no such file or directory")
+		return
+	}
+	if op == "delete" {
+		delete(s.buckets[bucket], key)
+		writeJSON(w, http.StatusOK, struct{}{})
+		return
+	}
+	writeJSON(w, http.StatusOK, storage.FileInfo{
+		Hash: obj.Hash, Fsize: int64(len(obj.Data)), PutTime: obj.PutTime, MimeType: obj.MimeType,
+	})
+}
+
+// checkToken 解析上传凭证，凭证无效或者过期的时候返回 401
+func (s *Server) checkToken(w http.ResponseWriter, token string) (info *storage.UploadTokenInfo, ok bool) {
+	info, err := storage.ParseUploadToken(token)
+	switch {
+	case err != nil:
+		writeError(w, http.StatusUnauthorized, "bad token")
+	case info.Policy.Expires != 0 && info.Expired():
+		writeError(w, http.StatusUnauthorized, "token out of date")
+	case s.Mac != nil && !info.Verify(s.Mac):
+		writeError(w, http.StatusUnauthorized, "bad token")
+	default:
+		ok = true
+	}
+	return
+}
+
+func (s *Server) writeBlkputRet(w http.ResponseWriter, ctx string, chunk []byte) {
+	writeJSON(w, http.StatusOK, storage.BlkputRet{
+		Ctx:       ctx,
+		Checksum:  ctx,
+		Crc32:     crc32.ChecksumIEEE(chunk),
+		Offset:    uint32(len(s.blocks[ctx])),
+		Host:      s.URL,
+		ExpiredAt: time.Now().Add(7 * 24 * time.Hour).Unix(),
+	})
+}
+
+// upToken 返回分片上传请求 Authorization 中的上传凭证
+func upToken(req *http.Request) string {
+	return strings.TrimPrefix(req.Header.Get("Authorization"), "UpToken ")
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
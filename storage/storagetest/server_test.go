@@ -0,0 +1,71 @@
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/qiniu/api.v7/auth/qbox"
+	"github.com/qiniu/api.v7/storage"
+)
+
+func TestServerUploadAndManage(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	mac := qbox.NewMac("ak", "sk")
+	server.Mac = mac
+
+	uploader := storage.NewUploader(server.Config())
+	token := (&storage.PutPolicy{Scope: "bucket"}).UploadToken(mac)
+	data := bytes.Repeat([]byte("storagetest"), 1024*1024)
+	var ret storage.PutRet
+	for _, key := range []string{"small", "large"} {
+		var err error
+		size := int64(1024)
+		if key == "large" {
+			size = int64(len(data))
+			err = uploader.Resume.Put(context.Background(), &ret, token, key, bytes.NewReader(data), size, nil)
+		} else {
+			err = uploader.Form.Put(context.Background(), &ret, token, key, bytes.NewReader(data[:size]), size, nil)
+		}
+		if err != nil || ret.Key != key {
+			t.Fatalf("Put(%s) = %+v, %v", key, ret, err)
+		}
+		if obj, ok := server.Object("bucket", key); !ok || !bytes.Equal(obj.Data, data[:size]) || obj.Hash != ret.Hash {
+			t.Fatalf("Server#Object(%s) = %v", key, ok)
+		}
+	}
+
+	// 失败的分片按照 RetryPolicy 重试
+	server.Fail("bput", 1, 503)
+	err := uploader.Resume.Put(context.Background(), &ret, token, "retried", bytes.NewReader(data), int64(len(data)),
+		&storage.RputExtra{ChunkSize: 1024 * 1024})
+	if err != nil {
+		t.Fatalf("ResumeUploader#Put() error, %s", err)
+	}
+
+	// scope 中没有 key 的时候不能覆盖内容不同的文件
+	err = uploader.Form.Put(context.Background(), &ret, token, "small", bytes.NewReader([]byte("other")), 5, nil)
+	if ei, ok := err.(*storage.ErrorInfo); !ok || ei.Code != 614 {
+		t.Fatalf("FormUploader#Put() should fail with 614, got %v", err)
+	}
+	err = uploader.Form.Put(context.Background(), &ret, "ak:sign:e30=", "bad", bytes.NewReader(nil), 0, nil)
+	if ei, ok := err.(*storage.ErrorInfo); !ok || ei.Code != 401 {
+		t.Fatalf("FormUploader#Put() should fail with 401, got %v", err)
+	}
+
+	bucketManager := storage.NewBucketManager(mac, server.Config())
+	info, err := bucketManager.Stat("bucket", "large")
+	if err != nil || info.Fsize != int64(len(data)) {
+		t.Fatalf("BucketManager#Stat() = %+v, %v", info, err)
+	}
+	if err = bucketManager.Delete("bucket", "large"); err != nil {
+		t.Fatalf("BucketManager#Delete() error, %s", err)
+	}
+	if _, err = bucketManager.Stat("bucket", "large"); err == nil {
+		t.Fatal("BucketManager#Stat() should fail after Delete()")
+	}
+	if keys := server.Keys("bucket"); len(keys) != 2 || keys[0] != "retried" || keys[1] != "small" {
+		t.Fatalf("Server#Keys() = %v", keys)
+	}
+}
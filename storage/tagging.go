@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 文件标签的限制
+const (
+	MaxObjectTags        = 10  // 每个文件最多的标签数
+	MaxObjectTagKeyLen   = 128 // 标签名的最大长度，按照字符计算
+	MaxObjectTagValueLen = 256 // 标签值的最大长度，按照字符计算
+)
+
+// 标签名和标签值中除了字母、数字和空格之外允许的字符
+const objectTagSymbols = "+-=._:/@"
+
+type objectTag struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+type objectTagging struct {
+	Tags []objectTag `json:"Tags"`
+}
+
+// ValidateObjectTags 检查文件标签的数量、长度和字符是否合法，
+// 标签名和标签值只能包含字母、数字、空格以及 + - = . _ : / @
+func ValidateObjectTags(tags map[string]string) error {
+	if len(tags) > MaxObjectTags {
+		return errors.New("object tagging: too many tags")
+	}
+	for k, v := range tags {
+		if k == "" || utf8.RuneCountInString(k) > MaxObjectTagKeyLen {
+			return errors.New("object tagging: invalid tag key length: " + k)
+		}
+		if utf8.RuneCountInString(v) > MaxObjectTagValueLen {
+			return errors.New("object tagging: invalid tag value length for key: " + k)
+		}
+		if !validObjectTagChars(k) || !validObjectTagChars(v) {
+			return errors.New("object tagging: invalid character in tag: " + k)
+		}
+	}
+	return nil
+}
+
+func validObjectTagChars(s string) bool {
+	for _, r := range s {
+		if r == utf8.RuneError {
+			return false
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != ' ' && !strings.ContainsRune(objectTagSymbols, r) {
+			return false
+		}
+	}
+	return true
+}
+
+func objectTaggingURL(host, bucket, key string) string {
+	query := url.Values{}
+	query.Set("bucket", bucket)
+	query.Set("key", key)
+	return host + "/objectTagging?" + query.Encode()
+}
+
+// SetTags 用来设置文件的标签，会覆盖文件原有的全部标签
+func (m *BucketManager) SetTags(bucket, key string, tags map[string]string) (err error) {
+	if err = ValidateObjectTags(tags); err != nil {
+		return
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tagging := objectTagging{Tags: make([]objectTag, 0, len(keys))}
+	for _, k := range keys {
+		tagging.Tags = append(tagging.Tags, objectTag{Key: k, Value: tags[k]})
+	}
+
+	ctx := m.withMac(context.TODO())
+	reqURL := objectTaggingURL(m.Cfg.UcReqHost(), bucket, key)
+	err = m.Client.CallWithJson(ctx, nil, "PUT", reqURL, nil, &tagging)
+	return
+}
+
+// GetTags 用来获取文件的标签，文件没有标签的时候返回空的 map
+func (m *BucketManager) GetTags(bucket, key string) (tags map[string]string, err error) {
+	ctx := m.withMac(context.TODO())
+	reqURL := objectTaggingURL(m.Cfg.UcReqHost(), bucket, key)
+	var tagging objectTagging
+	if err = m.Client.Call(ctx, &tagging, "GET", reqURL, nil); err != nil {
+		return
+	}
+	tags = make(map[string]string, len(tagging.Tags))
+	for _, tag := range tagging.Tags {
+		tags[tag.Key] = tag.Value
+	}
+	return
+}
+
+// DeleteTags 用来删除文件的全部标签
+func (m *BucketManager) DeleteTags(bucket, key string) (err error) {
+	ctx := m.withMac(context.TODO())
+	reqURL := objectTaggingURL(m.Cfg.UcReqHost(), bucket, key)
+	err = m.Client.Call(ctx, nil, "DELETE", reqURL, nil)
+	return
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateObjectTags(t *testing.T) {
+	valid := map[string]string{"env": "prod", "owner": "team a@example.com", "路径": "a/b:c"}
+	if err := ValidateObjectTags(valid); err != nil {
+		t.Fatalf("ValidateObjectTags() error, %s", err)
+	}
+
+	tooMany := map[string]string{}
+	for i := 0; i <= MaxObjectTags; i++ {
+		tooMany[string(rune('a'+i))] = "v"
+	}
+	invalids := []map[string]string{
+		tooMany,
+		{"": "v"},
+		{strings.Repeat("k", MaxObjectTagKeyLen+1): "v"},
+		{"k": strings.Repeat("v", MaxObjectTagValueLen+1)},
+		{"k": "a&b"},
+		{"k#": "v"},
+	}
+	for i, tags := range invalids {
+		if err := ValidateObjectTags(tags); err == nil {
+			t.Fatalf("ValidateObjectTags() should fail for case %d", i)
+		}
+	}
+}
+
+func TestObjectTagging(t *testing.T) {
+	var stored []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		if req.URL.Path != "/objectTagging" || query.Get("bucket") != "bucket" || query.Get("key") != "a b" {
+			http.NotFound(w, req)
+			return
+		}
+		switch req.Method {
+		case "PUT":
+			stored, _ = ioutil.ReadAll(req.Body)
+		case "GET":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(stored)
+		case "DELETE":
+			stored = []byte(`{"Tags":[]}`)
+		}
+	}))
+	defer server.Close()
+
+	bucketManager := NewBucketManager(mac, &Config{UcHost: server.URL})
+	tags := map[string]string{"env": "prod", "owner": "ops"}
+	if err := bucketManager.SetTags("bucket", "a b", tags); err != nil {
+		t.Fatalf("BucketManager#SetTags() error, %s", err)
+	}
+	if string(stored) != `{"Tags":[{"Key":"env","Value":"prod"},{"Key":"owner","Value":"ops"}]}` {
+		t.Fatalf("BucketManager#SetTags() error, unexpected body %s", stored)
+	}
+	got, err := bucketManager.GetTags("bucket", "a b")
+	if err != nil || !reflect.DeepEqual(got, tags) {
+		t.Fatalf("BucketManager#GetTags() error, %v, tags %v", err, got)
+	}
+	if err = bucketManager.DeleteTags("bucket", "a b"); err != nil {
+		t.Fatalf("BucketManager#DeleteTags() error, %s", err)
+	}
+	if got, err = bucketManager.GetTags("bucket", "a b"); err != nil || len(got) != 0 {
+		t.Fatalf("BucketManager#GetTags() error, %v, tags %v", err, got)
+	}
+}
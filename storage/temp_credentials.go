@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/qiniu/api.v7/auth/qbox"
+)
+
+// TempCredentialsRequest 描述要颁发给客户端的临时凭证的权限范围
+type TempCredentialsRequest struct {
+	// 必须。允许访问的空间
+	Bucket string
+
+	// 可选。只允许访问以 KeyPrefix 开头的文件，为空表示可以访问空间中的全部文件
+	KeyPrefix string
+
+	// 可选。临时凭证的有效时间，小于等于 0 的时候为 15 分钟
+	TTL time.Duration
+
+	// 可选。是否允许上传文件，InsertOnly 为 true 的时候只能新增文件，不能覆盖已经存在的文件
+	AllowUpload bool
+	InsertOnly  bool
+
+	// 可选。允许上传的文件的最大大小和 MimeType，见 PutPolicy 中的 FsizeLimit 和 MimeLimit
+	FsizeLimit int64
+	MimeLimit  string
+
+	// 可选。允许下载的文件，必须以 KeyPrefix 开头，设置之后 Domain 为必须
+	DownloadKeys []string
+	Domain       string
+}
+
+// TempCredentials 为颁发给浏览器或者移动端的临时凭证，客户端不需要知道 SecretKey，
+// 只能在有效期内上传以 KeyPrefix 开头的 key，以及下载 DownloadURLs 中的文件
+type TempCredentials struct {
+	Bucket       string            `json:"bucket"`
+	KeyPrefix    string            `json:"keyPrefix,omitempty"`
+	UploadToken  string            `json:"uploadToken,omitempty"`
+	DownloadURLs map[string]string `json:"downloadUrls,omitempty"` // key 到下载链接
+	Expiration   time.Time         `json:"expiration"`
+}
+
+// 临时凭证的默认有效时间
+const defaultTempCredentialsTTL = 15 * time.Minute
+
+// IssueTempCredentials 用来在业务服务器上颁发临时凭证，七牛没有单独的 STS 服务，
+// 上传权限通过限定了 scope 和有效期的上传凭证实现，下载权限通过私有空间的下载链接实现。
+func IssueTempCredentials(mac *qbox.Mac, req *TempCredentialsRequest) (creds *TempCredentials, err error) {
+	if req.Bucket == "" {
+		err = errors.New("temp credentials: bucket is required")
+		return
+	}
+	if len(req.DownloadKeys) > 0 && req.Domain == "" {
+		err = errors.New("temp credentials: domain is required to download files")
+		return
+	}
+	if !req.AllowUpload && len(req.DownloadKeys) == 0 {
+		err = errors.New("temp credentials: no permission to grant")
+		return
+	}
+	ttl := req.TTL
+	if ttl <= 0 {
+		ttl = defaultTempCredentialsTTL
+	}
+
+	creds = &TempCredentials{
+		Bucket:     req.Bucket,
+		KeyPrefix:  req.KeyPrefix,
+		Expiration: time.Now().Add(ttl),
+	}
+	if req.AllowUpload {
+		policy := PutPolicy{FsizeLimit: req.FsizeLimit, MimeLimit: req.MimeLimit}
+		if req.InsertOnly {
+			policy.InsertOnly = 1
+		}
+		creds.UploadToken, err = MakeUploadToken(mac, req.Bucket, req.KeyPrefix, ttl, &policy)
+		if err != nil {
+			creds = nil
+			return
+		}
+	}
+	if len(req.DownloadKeys) > 0 {
+		creds.DownloadURLs = make(map[string]string, len(req.DownloadKeys))
+		for _, key := range req.DownloadKeys {
+			if !strings.HasPrefix(key, req.KeyPrefix) {
+				err = errors.New("temp credentials: key " + key + " is out of the key prefix")
+				creds = nil
+				return
+			}
+			creds.DownloadURLs[key] = MakePrivateURLWithQuery(mac, req.Domain, key, ttl, nil)
+		}
+	}
+	return
+}
+
+// Expired 返回临时凭证是否已经过期，margin 用来提前一段时间认为过期，避免使用的时候刚好过期
+func (c *TempCredentials) Expired(margin time.Duration) bool {
+	return !time.Now().Add(margin).Before(c.Expiration)
+}
+
+// CanUpload 返回临时凭证是否可以上传 key
+func (c *TempCredentials) CanUpload(key string) bool {
+	return c.UploadToken != "" && strings.HasPrefix(key, c.KeyPrefix)
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIssueTempCredentials(t *testing.T) {
+	creds, err := IssueTempCredentials(mac, &TempCredentialsRequest{
+		Bucket:       "bucket",
+		KeyPrefix:    "users/1/",
+		AllowUpload:  true,
+		DownloadKeys: []string{"users/1/avatar.jpg"},
+		Domain:       "http://example.com",
+	})
+	if err != nil {
+		t.Fatalf("IssueTempCredentials() error, %s", err)
+	}
+	if _, bucket, err := getAkBucketFromUploadToken(creds.UploadToken); err != nil || bucket != "bucket" {
+		t.Fatalf("IssueTempCredentials() error, invalid upload token %s", creds.UploadToken)
+	}
+	if !creds.CanUpload("users/1/a.txt") || creds.CanUpload("users/2/a.txt") {
+		t.Fatalf("TempCredentials#CanUpload() error")
+	}
+	if !strings.HasPrefix(creds.DownloadURLs["users/1/avatar.jpg"], "http://example.com/users/1/avatar.jpg?e=") {
+		t.Fatalf("IssueTempCredentials() error, unexpected download urls %v", creds.DownloadURLs)
+	}
+	if creds.Expired(time.Minute) || !creds.Expired(time.Hour) {
+		t.Fatalf("TempCredentials#Expired() error, expiration %s", creds.Expiration)
+	}
+
+	_, err = IssueTempCredentials(mac, &TempCredentialsRequest{
+		Bucket:       "bucket",
+		KeyPrefix:    "users/1/",
+		DownloadKeys: []string{"users/2/avatar.jpg"},
+		Domain:       "http://example.com",
+	})
+	if err == nil {
+		t.Fatalf("IssueTempCredentials() should fail for keys out of the key prefix")
+	}
+}
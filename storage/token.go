@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"crypto/hmac"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -17,9 +18,11 @@ type PutPolicy struct {
 	IsPrefixalScope     int    `json:"isPrefixalScope,omitempty"`
 	InsertOnly          uint16 `json:"insertOnly,omitempty"` // 若非0, 即使Scope为 Bucket:Key 的形式也是insert only
 	DetectMime          uint8  `json:"detectMime,omitempty"` // 若非0, 则服务端根据内容自动确定 MimeType
+	FsizeMin            int64  `json:"fsizeMin,omitempty"`
 	FsizeLimit          int64  `json:"fsizeLimit,omitempty"`
 	MimeLimit           string `json:"mimeLimit,omitempty"`
 	SaveKey             string `json:"saveKey,omitempty"`
+	ForceSaveKey        bool   `json:"forceSaveKey,omitempty"` // 若为 true, 即使上传时指定了 key 也按照 SaveKey 保存文件
 	CallbackFetchKey    uint8  `json:"callbackFetchKey,omitempty"`
 	CallbackURL         string `json:"callbackUrl,omitempty"`
 	CallbackHost        string `json:"callbackHost,omitempty"`
@@ -35,6 +38,127 @@ type PutPolicy struct {
 	FileType            int    `json:"fileType,omitempty"`
 }
 
+// NewPutPolicy 用来构建一个上传到 bucket 中任意 key 的上传策略，可以通过 WithXXX 方法继续设置其他字段，比如：
+//
+//	putPolicy := storage.NewPutPolicy("bucket").WithKeyPrefix("photos/").WithExpires(time.Hour).WithFsizeRange(0, 10<<20)
+func NewPutPolicy(bucket string) *PutPolicy {
+	return &PutPolicy{Scope: bucket}
+}
+
+// WithKey 限定只能上传指定的 key，已经存在的时候覆盖
+func (p *PutPolicy) WithKey(key string) *PutPolicy {
+	p.Scope = p.bucket() + ":" + key
+	p.IsPrefixalScope = 0
+	return p
+}
+
+// WithKeyPrefix 限定只能上传以 prefix 开头的 key
+func (p *PutPolicy) WithKeyPrefix(prefix string) *PutPolicy {
+	p.Scope = p.bucket() + ":" + prefix
+	p.IsPrefixalScope = 1
+	return p
+}
+
+// WithExpires 设置上传凭证的有效时间，不足一秒的部分忽略
+func (p *PutPolicy) WithExpires(ttl time.Duration) *PutPolicy {
+	p.Expires = uint32(ttl / time.Second)
+	return p
+}
+
+// WithInsertOnly 设置为只能新增文件，即使 Scope 为 bucket:key 的形式也不能覆盖已经存在的文件
+func (p *PutPolicy) WithInsertOnly() *PutPolicy {
+	p.InsertOnly = 1
+	return p
+}
+
+// WithEndUser 设置上传的终端用户标识
+func (p *PutPolicy) WithEndUser(endUser string) *PutPolicy {
+	p.EndUser = endUser
+	return p
+}
+
+// WithFsizeRange 限定上传文件的大小范围，单位为字节，为 0 表示不限定
+func (p *PutPolicy) WithFsizeRange(min, limit int64) *PutPolicy {
+	p.FsizeMin = min
+	p.FsizeLimit = limit
+	return p
+}
+
+// WithDetectMime 设置由服务端根据文件内容自动确定 MimeType
+func (p *PutPolicy) WithDetectMime() *PutPolicy {
+	p.DetectMime = 1
+	return p
+}
+
+// WithMimeLimit 限定上传文件的 MimeType，比如 "image/*" 或者 "!application/json;text/plain"
+func (p *PutPolicy) WithMimeLimit(mimeLimit string) *PutPolicy {
+	p.MimeLimit = mimeLimit
+	return p
+}
+
+// WithSaveKey 设置文件保存的 key 的格式，force 为 true 的时候即使上传时指定了 key 也使用 saveKey
+func (p *PutPolicy) WithSaveKey(saveKey string, force bool) *PutPolicy {
+	p.SaveKey = saveKey
+	p.ForceSaveKey = force
+	return p
+}
+
+// WithReturnBody 设置上传成功之后返回给客户端的内容
+func (p *PutPolicy) WithReturnBody(returnBody string) *PutPolicy {
+	p.ReturnBody = returnBody
+	return p
+}
+
+// WithPersistentOps 设置上传成功之后触发的持久化处理，notifyURL 和 pipeline 可以为空
+func (p *PutPolicy) WithPersistentOps(ops, notifyURL, pipeline string) *PutPolicy {
+	p.PersistentOps = ops
+	p.PersistentNotifyURL = notifyURL
+	p.PersistentPipeline = pipeline
+	return p
+}
+
+// WithDeleteAfterDays 设置文件在上传多少天之后自动删除
+func (p *PutPolicy) WithDeleteAfterDays(days int) *PutPolicy {
+	p.DeleteAfterDays = days
+	return p
+}
+
+// WithFileType 设置文件的存储类型，见 FileTypeStandard、FileTypeIA、FileTypeArchive 和 FileTypeDeepArchive
+func (p *PutPolicy) WithFileType(fileType int) *PutPolicy {
+	p.FileType = fileType
+	return p
+}
+
+// Validate 检查上传策略中的字段是否合法，发现问题的时候返回描述该问题的错误
+func (p *PutPolicy) Validate() (err error) {
+	switch {
+	case p.bucket() == "":
+		err = errors.New("put policy: scope is required")
+	case p.IsPrefixalScope != 0 && !strings.Contains(p.Scope, ":"):
+		err = errors.New("put policy: isPrefixalScope requires scope in the form of bucket:keyPrefix")
+	case p.FsizeMin < 0 || p.FsizeLimit < 0:
+		err = errors.New("put policy: fsizeMin and fsizeLimit must not be negative")
+	case p.FsizeLimit > 0 && p.FsizeMin > p.FsizeLimit:
+		err = errors.New("put policy: fsizeMin is greater than fsizeLimit")
+	case p.ForceSaveKey && p.SaveKey == "":
+		err = errors.New("put policy: forceSaveKey requires saveKey")
+	case (p.CallbackURL == "") != (p.CallbackBody == ""):
+		err = errors.New("put policy: callbackUrl and callbackBody must be set together")
+	case p.PersistentOps == "" && (p.PersistentNotifyURL != "" || p.PersistentPipeline != ""):
+		err = errors.New("put policy: persistentNotifyUrl and persistentPipeline require persistentOps")
+	case p.DeleteAfterDays < 0:
+		err = errors.New("put policy: deleteAfterDays must not be negative")
+	case p.FileType < FileTypeStandard || p.FileType > FileTypeDeepArchive:
+		err = errors.New("put policy: fileType must be between 0 and 3")
+	}
+	return
+}
+
+// bucket 返回上传策略的 Scope 中的 bucket 部分
+func (p *PutPolicy) bucket() string {
+	return strings.SplitN(p.Scope, ":", 2)[0]
+}
+
 // UploadToken 方法用来进行上传凭证的生成
 func (p *PutPolicy) UploadToken(mac *qbox.Mac) (token string) {
 	if p.Expires == 0 {
@@ -47,27 +171,115 @@ func (p *PutPolicy) UploadToken(mac *qbox.Mac) (token string) {
 	return
 }
 
-func getAkBucketFromUploadToken(token string) (ak, bucket string, err error) {
+// MakeUploadToken 用来生成上传到 bucket 的上传凭证。
+//
+// keyPrefix 不为空的时候只能上传以 keyPrefix 开头的 key，为空的时候可以上传 bucket 中任意的 key。
+// ttl       为上传凭证的有效时间，小于等于 0 的时候为 1 小时。
+// policy    为上传策略中的其他字段，可以为 nil，其中的 Scope、IsPrefixalScope 和 Expires 会被忽略，policy 本身不会被修改。
+//
+// 生成凭证之前会使用 PutPolicy.Validate 检查上传策略。
+func MakeUploadToken(mac *qbox.Mac, bucket, keyPrefix string, ttl time.Duration, policy *PutPolicy) (token string, err error) {
+	var p PutPolicy
+	if policy != nil {
+		p = *policy
+	}
+	p.Scope = bucket
+	p.IsPrefixalScope = 0
+	if keyPrefix != "" {
+		p.WithKeyPrefix(keyPrefix)
+	}
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	p.Expires = uint32(time.Now().Add(ttl).Unix())
+
+	if err = p.Validate(); err != nil {
+		return
+	}
+	putPolicyJSON, err := json.Marshal(&p)
+	if err != nil {
+		return
+	}
+	token = mac.SignWithData(putPolicyJSON)
+	return
+}
+
+// UploadTokenInfo 为解析上传凭证得到的信息
+type UploadTokenInfo struct {
+	AccessKey string
+	Sign      string    // 上传凭证中的签名部分
+	Policy    PutPolicy // 上传策略，其中的 Expires 为截止时间的 Unix 时间戳
+	Bucket    string
+	Key       string // scope 中的 key 部分，IsPrefixalScope 不为 0 的时候为 key 的前缀，为空表示可以上传任意的 key
+
+	encodedPolicy string
+}
+
+// ParseUploadToken 用来解析上传凭证，可以用来排查上传凭证过期、scope 不匹配之类的上传错误。
+// 只解析上传凭证的内容，不检查签名，检查签名请使用 UploadTokenInfo.Verify。
+func ParseUploadToken(token string) (info *UploadTokenInfo, err error) {
 	items := strings.Split(token, ":")
 	if len(items) != 3 {
 		err = errors.New("invalid upload token, format error")
 		return
 	}
 
-	ak = items[0]
 	policyBytes, dErr := base64.URLEncoding.DecodeString(items[2])
 	if dErr != nil {
 		err = errors.New("invalid upload token, invalid put policy")
 		return
 	}
 
-	putPolicy := PutPolicy{}
-	uErr := json.Unmarshal(policyBytes, &putPolicy)
-	if uErr != nil {
+	info = &UploadTokenInfo{AccessKey: items[0], Sign: items[1], encodedPolicy: items[2]}
+	if uErr := json.Unmarshal(policyBytes, &info.Policy); uErr != nil {
+		info = nil
 		err = errors.New("invalid upload token, invalid put policy")
 		return
 	}
 
-	bucket = strings.Split(putPolicy.Scope, ":")[0]
+	scope := strings.SplitN(info.Policy.Scope, ":", 2)
+	info.Bucket = scope[0]
+	if len(scope) == 2 {
+		info.Key = scope[1]
+	}
+	return
+}
+
+// Deadline 返回上传凭证的截止时间
+func (info *UploadTokenInfo) Deadline() time.Time {
+	return time.Unix(int64(info.Policy.Expires), 0)
+}
+
+// Expired 返回上传凭证是否已经过期
+func (info *UploadTokenInfo) Expired() bool {
+	return !time.Now().Before(info.Deadline())
+}
+
+// AllowKey 返回上传凭证是否允许上传 key
+func (info *UploadTokenInfo) AllowKey(key string) bool {
+	if info.Key == "" && !strings.Contains(info.Policy.Scope, ":") {
+		return true
+	}
+	if info.Policy.IsPrefixalScope != 0 {
+		return strings.HasPrefix(key, info.Key)
+	}
+	return key == info.Key
+}
+
+// Verify 使用 mac 检查上传凭证的签名是否正确
+func (info *UploadTokenInfo) Verify(mac *qbox.Mac) bool {
+	if info.AccessKey != mac.AccessKey {
+		return false
+	}
+	expected := mac.Sign([]byte(info.encodedPolicy))
+	return hmac.Equal([]byte(expected), []byte(info.AccessKey+":"+info.Sign))
+}
+
+func getAkBucketFromUploadToken(token string) (ak, bucket string, err error) {
+	info, err := ParseUploadToken(token)
+	if err != nil {
+		return
+	}
+	ak, bucket = info.AccessKey, info.Bucket
 	return
 }
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qiniu/api.v7/auth/qbox"
+)
+
+func TestPutPolicyBuilder(t *testing.T) {
+	putPolicy := NewPutPolicy("bucket").WithKeyPrefix("photos/").WithExpires(time.Hour).
+		WithFsizeRange(1, 10<<20).WithMimeLimit("image/*").WithSaveKey("$(etag)", true)
+	if putPolicy.Scope != "bucket:photos/" || putPolicy.IsPrefixalScope != 1 {
+		t.Fatalf("PutPolicy#WithKeyPrefix() error, scope = %s", putPolicy.Scope)
+	}
+	if putPolicy.Expires != 3600 || putPolicy.FsizeMin != 1 || putPolicy.FsizeLimit != 10<<20 {
+		t.Fatalf("PutPolicy builder error, unexpected policy %+v", putPolicy)
+	}
+	if err := putPolicy.Validate(); err != nil {
+		t.Fatalf("PutPolicy#Validate() error, %s", err)
+	}
+
+	putPolicy.WithKey("a.jpg")
+	if putPolicy.Scope != "bucket:a.jpg" || putPolicy.IsPrefixalScope != 0 {
+		t.Fatalf("PutPolicy#WithKey() error, scope = %s", putPolicy.Scope)
+	}
+}
+
+func TestPutPolicyValidate(t *testing.T) {
+	invalids := []PutPolicy{
+		{},
+		{Scope: "bucket", IsPrefixalScope: 1},
+		{Scope: "bucket", FsizeMin: 10, FsizeLimit: 1},
+		{Scope: "bucket", ForceSaveKey: true},
+		{Scope: "bucket", CallbackURL: "http://example.com/callback"},
+		{Scope: "bucket", PersistentPipeline: "pipeline"},
+		{Scope: "bucket", DeleteAfterDays: -1},
+		{Scope: "bucket", FileType: 4},
+	}
+	for _, putPolicy := range invalids {
+		if err := putPolicy.Validate(); err == nil {
+			t.Fatalf("PutPolicy#Validate() should fail for %+v", putPolicy)
+		}
+	}
+}
+
+func TestMakeUploadToken(t *testing.T) {
+	policy := PutPolicy{Scope: "ignored", Expires: 10, InsertOnly: 1}
+	token, err := MakeUploadToken(mac, "bucket", "photos/", 0, &policy)
+	if err != nil {
+		t.Fatalf("MakeUploadToken() error, %s", err)
+	}
+	if policy.Scope != "ignored" || policy.Expires != 10 {
+		t.Fatalf("MakeUploadToken() error, policy should not be modified")
+	}
+
+	items := strings.Split(token, ":")
+	if len(items) != 3 || items[0] != mac.AccessKey {
+		t.Fatalf("MakeUploadToken() error, invalid token %s", token)
+	}
+	data, _ := base64.URLEncoding.DecodeString(items[2])
+	var putPolicy PutPolicy
+	if err = json.Unmarshal(data, &putPolicy); err != nil {
+		t.Fatalf("MakeUploadToken() error, %s", err)
+	}
+	if putPolicy.Scope != "bucket:photos/" || putPolicy.IsPrefixalScope != 1 || putPolicy.InsertOnly != 1 {
+		t.Fatalf("MakeUploadToken() error, unexpected policy %+v", putPolicy)
+	}
+	if deadline := int64(putPolicy.Expires) - time.Now().Unix(); deadline < 3590 || deadline > 3600 {
+		t.Fatalf("MakeUploadToken() error, unexpected deadline %d", putPolicy.Expires)
+	}
+
+	if _, err = MakeUploadToken(mac, "", "", time.Minute, nil); err == nil {
+		t.Fatalf("MakeUploadToken() should fail without bucket")
+	}
+}
+
+func TestParseUploadToken(t *testing.T) {
+	token, err := MakeUploadToken(mac, "bucket", "photos/", time.Hour, nil)
+	if err != nil {
+		t.Fatalf("MakeUploadToken() error, %s", err)
+	}
+	info, err := ParseUploadToken(token)
+	if err != nil {
+		t.Fatalf("ParseUploadToken() error, %s", err)
+	}
+	if info.AccessKey != mac.AccessKey || info.Bucket != "bucket" || info.Key != "photos/" {
+		t.Fatalf("ParseUploadToken() error, unexpected info %+v", info)
+	}
+	if info.Expired() || info.Deadline().Before(time.Now().Add(59*time.Minute)) {
+		t.Fatalf("ParseUploadToken() error, unexpected deadline %s", info.Deadline())
+	}
+	if !info.AllowKey("photos/a.jpg") || info.AllowKey("videos/a.mp4") {
+		t.Fatalf("UploadTokenInfo#AllowKey() error")
+	}
+	if !info.Verify(mac) || info.Verify(qbox.NewMac(mac.AccessKey, "another")) {
+		t.Fatalf("UploadTokenInfo#Verify() error")
+	}
+
+	if _, err = ParseUploadToken("invalid"); err == nil {
+		t.Fatalf("ParseUploadToken() should fail for invalid token")
+	}
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Tracer 用来为 SDK 发送的请求创建 span，设置到上传、下载或者资源管理对象的 Tracer 之后，mkblk、bput、mkfile 等每个请求都会创建一个 span。
+// span 从调用方传入的 ctx 中的 span 派生，所以对接 OpenTelemetry 的时候只需要在 StartSpan 中调用 trace.Tracer 的 Start 方法，
+// 在 Span 中调用对应的 SetAttributes、RecordError 和 End 方法。多个 goroutine 会同时调用，实现的时候需要注意并发安全
+type Tracer interface {
+	// StartSpan 在 ctx 中的 span 之下创建一个名称为 name 的 span，比如 "qiniu.mkblk"，返回包含新的 span 的 ctx
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span 表示 Tracer 创建的一个 span
+type Span interface {
+	// SetAttribute 设置 span 的属性，key 为 AttrBucket 等常量
+	SetAttribute(key string, value interface{})
+
+	// End 结束 span，err 为请求失败的原因，服务端返回错误的时候为 *ErrorInfo
+	End(err error)
+}
+
+// span 的属性名称
+const (
+	AttrBucket     = "qiniu.bucket"      // 空间名称
+	AttrKey        = "qiniu.key"         // 文件名称
+	AttrBlockIndex = "qiniu.block_index" // 分片上传的块序号，分片上传 v2 中为分片的序号
+	AttrReqid      = "qiniu.reqid"       // 服务端返回的请求 ID
+	AttrHTTPMethod = "http.method"
+	AttrHTTPHost   = "http.host"
+	AttrHTTPStatus = "http.status_code"
+)
+
+// 无法从请求路径得到操作名称的时候使用的 span 名称
+const (
+	defaultSpanName  = "qiniu.request"
+	downloadSpanName = "qiniu.download"
+)
+
+type traceContextKey struct{}
+
+// traceContext 保存在 ctx 中，Client.Do 使用其中的 tracer 和属性为每个请求创建 span
+type traceContext struct {
+	tracer Tracer
+	name   string
+	attrs  []interface{} // 依次为属性名称和值
+}
+
+// withTrace 在 ctx 中设置创建 span 使用的 tracer 和属性，kvs 依次为属性名称和值。tracer 为 nil 的时候直接返回 ctx。
+// ctx 中已经设置过的时候保留原来的属性，tracer 不为 nil 的时候替换原来的 tracer
+func withTrace(ctx context.Context, tracer Tracer, kvs ...interface{}) context.Context {
+	tc, ok := traceFromContext(ctx)
+	if tracer == nil && !ok {
+		return ctx
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	newTc := &traceContext{tracer: tracer, attrs: kvs}
+	if ok {
+		if tracer == nil {
+			newTc.tracer = tc.tracer
+		}
+		newTc.name = tc.name
+		newTc.attrs = append(append([]interface{}{}, tc.attrs...), kvs...)
+	}
+	return context.WithValue(ctx, traceContextKey{}, newTc)
+}
+
+// withSpanName 指定 ctx 中的请求创建的 span 的名称，只在 ctx 中设置了 tracer 的时候生效
+func withSpanName(ctx context.Context, name string) context.Context {
+	tc, ok := traceFromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	newTc := *tc
+	newTc.name = name
+	return context.WithValue(ctx, traceContextKey{}, &newTc)
+}
+
+func traceFromContext(ctx context.Context) (tc *traceContext, ok bool) {
+	if ctx == nil {
+		return
+	}
+	tc, ok = ctx.Value(traceContextKey{}).(*traceContext)
+	return
+}
+
+// startRequestSpan 在 ctx 中设置了 tracer 的时候为 req 创建 span，没有设置的时候返回 nil
+func startRequestSpan(ctx context.Context, req *http.Request) Span {
+	tc, ok := traceFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	name := tc.name
+	if name == "" {
+		name = requestSpanName(req.URL.Path)
+	}
+	_, span := tc.tracer.StartSpan(ctx, name)
+	span.SetAttribute(AttrHTTPMethod, req.Method)
+	span.SetAttribute(AttrHTTPHost, req.URL.Host)
+	for i := 0; i+1 < len(tc.attrs); i += 2 {
+		span.SetAttribute(tc.attrs[i].(string), tc.attrs[i+1])
+	}
+	if bucket, key, ok := entryFromPath(req.URL.Path); ok {
+		span.SetAttribute(AttrBucket, bucket)
+		span.SetAttribute(AttrKey, key)
+	}
+	return span
+}
+
+// endRequestSpan 记录响应的状态码和请求 ID 之后结束 span，状态码不是 2xx 的时候以 *ErrorInfo 结束
+func endRequestSpan(span Span, resp *http.Response, err error) {
+	if span == nil {
+		return
+	}
+	if err == nil && resp != nil {
+		reqid := resp.Header.Get("X-Reqid")
+		span.SetAttribute(AttrHTTPStatus, resp.StatusCode)
+		span.SetAttribute(AttrReqid, reqid)
+		if resp.StatusCode/100 != 2 {
+			err = &ErrorInfo{Code: resp.StatusCode, Reqid: reqid, Err: http.StatusText(resp.StatusCode)}
+		}
+	}
+	span.End(err)
+}
+
+// requestSpanName 使用请求路径的第一段作为 span 的名称，比如 "/mkblk/4194304" 为 "qiniu.mkblk"，表单上传的 "/" 为 "qiniu.upload"
+func requestSpanName(path string) string {
+	op := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]
+	switch {
+	case op == "":
+		return "qiniu.upload"
+	case strings.ContainsAny(op, ".=?"):
+		return defaultSpanName
+	}
+	return "qiniu." + op
+}
+
+// entryOps 为路径中第二段是 EncodedEntry 的资源管理操作
+var entryOps = map[string]bool{
+	"stat": true, "delete": true, "chgm": true, "chtype": true, "chstatus": true,
+	"copy": true, "move": true, "deleteAfterDays": true, "prefetch": true, "restoreAr": true,
+}
+
+// entryFromPath 从资源管理请求的路径中解析出空间和文件名称，比如 "/stat/<EncodedEntry>"
+func entryFromPath(path string) (bucket, key string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) < 2 || !entryOps[parts[0]] {
+		return
+	}
+	bucket, key, ok, err := DecodeEntry(parts[1])
+	if err != nil {
+		ok = false
+	}
+	return
+}
+
+// traceUpload 在 tracer 不为 nil 的时候在 ctx 中设置上传使用的 tracer，以及从 upToken 中解析出的空间名称和文件名称
+func traceUpload(ctx context.Context, tracer Tracer, upToken, key string, hasKey bool) context.Context {
+	if tracer == nil {
+		return ctx
+	}
+	_, bucket, _ := getAkBucketFromUploadToken(upToken)
+	kvs := []interface{}{AttrBucket, bucket}
+	if hasKey {
+		kvs = append(kvs, AttrKey, key)
+	}
+	return withTrace(ctx, tracer, kvs...)
+}
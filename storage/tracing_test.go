@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type memSpan struct {
+	name   string
+	parent string
+	attrs  map[string]interface{}
+	err    error
+	ended  bool
+}
+
+func (s *memSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *memSpan) End(err error)                              { s.err, s.ended = err, true }
+
+type spanNameKey struct{}
+
+// memTracer 记录创建的全部 span，父 span 的名称通过 ctx 传递
+type memTracer struct {
+	mu    sync.Mutex
+	spans []*memSpan
+}
+
+func (t *memTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	parent, _ := ctx.Value(spanNameKey{}).(string)
+	span := &memSpan{name: name, parent: parent, attrs: make(map[string]interface{})}
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return context.WithValue(ctx, spanNameKey{}, name), span
+}
+
+func TestTracerSpans(t *testing.T) {
+	upServer := newFakeUpServer()
+	defer upServer.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Reqid", "reqid-"+strings.Split(strings.Trim(req.URL.Path, "/"), "/")[0])
+		upServer.serveHTTP(w, req)
+	}))
+	defer server.Close()
+
+	tracer := &memTracer{}
+	uploader := NewResumeUploader(nil)
+	uploader.Tracer = tracer
+	ctx := context.WithValue(context.Background(), spanNameKey{}, "caller")
+	token := (&PutPolicy{Scope: "bucket"}).UploadToken(mac)
+	data := make([]byte, 5*1024*1024)
+	var putRet PutRet
+	err := uploader.Put(ctx, &putRet, token, "traced", bytes.NewReader(data), int64(len(data)), &RputExtra{UpHost: server.URL, ChunkSize: 4 * 1024 * 1024})
+	if err != nil {
+		t.Fatalf("ResumeUploader#Put() error, %s", err)
+	}
+
+	var names []string
+	for _, span := range tracer.spans {
+		names = append(names, span.name)
+		if !span.ended || span.err != nil || span.parent != "caller" {
+			t.Fatalf("unexpected span %+v", span)
+		}
+		if span.attrs[AttrBucket] != "bucket" || span.attrs[AttrKey] != "traced" || span.attrs[AttrReqid] != "reqid-"+strings.TrimPrefix(span.name, "qiniu.") {
+			t.Fatalf("unexpected span attributes %s %v", span.name, span.attrs)
+		}
+		if _, ok := span.attrs[AttrBlockIndex]; ok == (span.name == "qiniu.mkfile") {
+			t.Fatalf("unexpected block index %s %v", span.name, span.attrs)
+		}
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "qiniu.mkblk,qiniu.mkblk,qiniu.mkfile" {
+		t.Fatalf("unexpected spans %v", names)
+	}
+
+	// 资源管理的请求从路径中解析出空间和文件名称，服务端返回的错误记录到 span 中
+	tracer.spans = nil
+	bucketManager := NewBucketManager(mac, &Config{RsHost: server.URL})
+	bucketManager.Tracer = tracer
+	bucketManager.RetryPolicy = noRetryPolicy{}
+	if _, err = bucketManager.Stat("bucket", "missing"); err == nil {
+		t.Fatal("BucketManager#Stat() should fail")
+	}
+	if len(tracer.spans) != 1 {
+		t.Fatalf("unexpected spans %v", tracer.spans)
+	}
+	span := tracer.spans[0]
+	if ei, ok := span.err.(*ErrorInfo); !ok || ei.Code != 612 || span.name != "qiniu.stat" ||
+		span.attrs[AttrBucket] != "bucket" || span.attrs[AttrKey] != "missing" || span.attrs[AttrHTTPStatus] != 612 {
+		t.Fatalf("unexpected span %+v", span)
+	}
+}
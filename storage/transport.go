@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// NewTransport 使用的默认连接池和建立连接的参数
+const (
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 32
+	DefaultIdleConnTimeout     = 90 * time.Second
+	DefaultDialTimeout         = 30 * time.Second
+	DefaultFallbackDelay       = 300 * time.Millisecond
+)
+
+// TransportOptions 为 NewTransport 构建的 http.Transport 的连接池和建立连接的参数，
+// 上传对象通过 NewUploaderEx(cfg, NewClient(NewTransport(opts))) 使用这些参数
+type TransportOptions struct {
+	// 可选。所有域名一共保留的空闲连接数，不设定则为 DefaultMaxIdleConns
+	MaxIdleConns int
+
+	// 可选。每个域名保留的空闲连接数，并行上传分片的时候应该不小于并行的数量，不设定则为 DefaultMaxIdleConnsPerHost。
+	// http.DefaultTransport 每个域名只保留2个空闲连接，并行上传的时候其它的连接用完就会被关闭
+	MaxIdleConnsPerHost int
+
+	// 可选。空闲连接保留的时间，不设定则为 DefaultIdleConnTimeout
+	IdleConnTimeout time.Duration
+
+	// 可选。建立 TCP 连接的超时时间，不设定则为 DefaultDialTimeout
+	DialTimeout time.Duration
+
+	// 可选。域名同时有 IPv4 和 IPv6 地址的时候先连接优先的地址，FallbackDelay 之后还没有连上就同时连接另一种地址（Happy Eyeballs），
+	// 不设定则为 DefaultFallbackDelay，小于0的时候只连接优先的地址
+	FallbackDelay time.Duration
+
+	// 可选。为 true 的时候不使用 HTTP/2，默认在服务端支持的时候使用 HTTP/2
+	DisableHTTP2 bool
+
+	// 可选。缓存域名解析结果的对象，设定之后建立连接的时候使用缓存的 IP，不设定则每次建立连接都由系统解析
+	Resolver *HostResolver
+
+	// 可选。https 连接使用的 TLS 配置，比如自定义的根证书。启用 HTTP/2 的时候 http.Transport 会修改其中的 NextProtos，不要在多个 Transport 之间共用
+	TLSClientConfig *tls.Config
+}
+
+// NewTransport 用来构建一个适合并行上传和下载的 http.Transport，opts 为 nil 的时候使用默认的连接池参数。
+// DefaultClient 使用的就是 NewTransport(nil) 构建的 Transport
+func NewTransport(opts *TransportOptions) *http.Transport {
+	var o TransportOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxIdleConns == 0 {
+		o.MaxIdleConns = DefaultMaxIdleConns
+	}
+	if o.MaxIdleConnsPerHost == 0 {
+		o.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	if o.IdleConnTimeout == 0 {
+		o.IdleConnTimeout = DefaultIdleConnTimeout
+	}
+	if o.DialTimeout == 0 {
+		o.DialTimeout = DefaultDialTimeout
+	}
+	if o.FallbackDelay == 0 {
+		o.FallbackDelay = DefaultFallbackDelay
+	}
+	dialer := &net.Dialer{
+		Timeout:       o.DialTimeout,
+		KeepAlive:     30 * time.Second,
+		DualStack:     o.FallbackDelay > 0,
+		FallbackDelay: o.FallbackDelay,
+	}
+	dial := dialer.DialContext
+	if o.Resolver != nil {
+		dial = o.Resolver.dialContext(dial)
+	}
+	tr := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dial,
+		MaxIdleConns:          o.MaxIdleConns,
+		MaxIdleConnsPerHost:   o.MaxIdleConnsPerHost,
+		IdleConnTimeout:       o.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       o.TLSClientConfig,
+	}
+	if o.DisableHTTP2 {
+		// TLSNextProto 不为 nil 的时候 http.Transport 不会启用 HTTP/2
+		tr.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	} else {
+		enableHTTP2(tr)
+	}
+	return tr
+}
+
+// closeResponse 读完剩余的内容之后关闭 resp.Body，读完的连接才能回到连接池继续使用。
+// 最多读取 maxDrainSize 字节，剩余内容更多的时候直接关闭连接
+func closeResponse(resp *http.Response) {
+	io.CopyN(ioutil.Discard, resp.Body, maxDrainSize)
+	resp.Body.Close()
+}
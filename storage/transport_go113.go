@@ -0,0 +1,11 @@
+//go:build go1.13
+// +build go1.13
+
+package storage
+
+import "net/http"
+
+// enableHTTP2 在设置了 DialContext 和 TLSClientConfig 的时候仍然尝试使用 HTTP/2
+func enableHTTP2(tr *http.Transport) {
+	tr.ForceAttemptHTTP2 = true
+}
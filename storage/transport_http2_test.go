@@ -0,0 +1,37 @@
+//go:build go1.14
+// +build go1.14
+
+package storage
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewTransportHTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.Proto))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	rootCAs := server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	for _, c := range []struct {
+		disableHTTP2 bool
+		protoMajor   int
+	}{{false, 2}, {true, 1}} {
+		tr := NewTransport(&TransportOptions{TLSClientConfig: &tls.Config{RootCAs: rootCAs}, DisableHTTP2: c.disableHTTP2})
+		resp, err := NewClient(tr).DoRequest(context.Background(), "GET", server.URL, nil)
+		if err != nil {
+			t.Fatalf("DoRequest() error, %s", err)
+		}
+		closeResponse(resp)
+		if resp.ProtoMajor != c.protoMajor {
+			t.Fatalf("DisableHTTP2 = %v, got %s", c.disableHTTP2, resp.Proto)
+		}
+	}
+}
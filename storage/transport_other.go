@@ -0,0 +1,9 @@
+//go:build !go1.13
+// +build !go1.13
+
+package storage
+
+import "net/http"
+
+// enableHTTP2 在 Go 1.13 之前设置了 TLSClientConfig 的 http.Transport 不会自动启用 HTTP/2，只有默认的 TLS 配置使用 HTTP/2
+func enableHTTP2(tr *http.Transport) {}
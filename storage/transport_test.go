@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestNewTransport(t *testing.T) {
+	tr := NewTransport(nil)
+	if tr.MaxIdleConnsPerHost != DefaultMaxIdleConnsPerHost || tr.MaxIdleConns != DefaultMaxIdleConns || tr.IdleConnTimeout != DefaultIdleConnTimeout {
+		t.Fatalf("NewTransport(nil) = %+v", tr)
+	}
+	tr = NewTransport(&TransportOptions{MaxIdleConnsPerHost: 64})
+	if tr.MaxIdleConnsPerHost != 64 || tr.MaxIdleConns != DefaultMaxIdleConns {
+		t.Fatalf("NewTransport() = %+v", tr)
+	}
+	if DefaultClient.Transport.(*http.Transport).MaxIdleConnsPerHost != DefaultMaxIdleConnsPerHost {
+		t.Fatal("DefaultClient should use the pooled transport")
+	}
+}
+
+func TestCallDrainsErrorBody(t *testing.T) {
+	var conns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// 不是 JSON 的错误响应不会被 ResponseError 读取
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(strings.Repeat("not found\n", 1024)))
+	}))
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := NewClient(NewTransport(nil))
+	for i := 0; i < 10; i++ {
+		if err := client.Call(context.Background(), nil, "GET", server.URL, nil); err == nil {
+			t.Fatal("Call() should fail with 404")
+		}
+		if _, err := client.CallChan(context.Background(), "GET", server.URL, nil); err == nil {
+			t.Fatal("CallChan() should fail with 404")
+		}
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Fatalf("error responses should be drained to reuse the connection, connections = %d", n)
+	}
+}
+
+func benchmarkResumeUpload(b *testing.B, client *Client) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	data := make([]byte, 1024*1024)
+	rand.Read(data)
+	uploader := NewResumeUploaderEx(nil, client)
+	uploader.Settings = &Settings{Workers: 16}
+	extra := RputExtra{UpHost: server.URL, BlockSize: 16 * 1024, ChunkSize: 16 * 1024}
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var putRet PutRet
+		e := extra
+		if err := uploader.Put(context.Background(), &putRet, "token", "bench", bytes.NewReader(data), int64(len(data)), &e); err != nil {
+			b.Fatalf("ResumeUploader#Put() error, %s", err)
+		}
+	}
+}
+
+// 并行上传大量小分片的时候 http.DefaultTransport 每个域名只保留2个空闲连接，多出来的连接用完就会被关闭
+func BenchmarkResumeUploadDefaultTransport(b *testing.B) {
+	benchmarkResumeUpload(b, NewClient(http.DefaultTransport))
+}
+
+func BenchmarkResumeUploadPooledTransport(b *testing.B) {
+	benchmarkResumeUpload(b, NewClient(NewTransport(nil)))
+}
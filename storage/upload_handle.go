@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// UploadHandle 用来控制一个异步进行的分片上传，可以暂停、继续或者取消上传
+type UploadHandle struct {
+	cancel context.CancelFunc
+	pause  *pauseGate
+	done   chan error
+}
+
+// PutAsync 和 Put 一样用来以分片上传的方式上传一个文件，不同的是上传在后台进行，
+// 通过返回的 UploadHandle 控制上传过程，并从 Done 中获取上传的结果。
+func (p *ResumeUploader) PutAsync(
+	ctx context.Context, ret interface{}, upToken, key string, f io.ReaderAt, fsize int64, extra *RputExtra) *UploadHandle {
+	return p.putAsync(ctx, extra, func(ctx context.Context, extra *RputExtra) error {
+		return p.rput(ctx, ret, upToken, key, true, f, fsize, extra, "", "")
+	})
+}
+
+// PutFileAsync 和 PutFile 一样用来以分片上传的方式上传一个本地文件，不同的是上传在后台进行，
+// 通过返回的 UploadHandle 控制上传过程，并从 Done 中获取上传的结果。
+func (p *ResumeUploader) PutFileAsync(
+	ctx context.Context, ret interface{}, upToken, key, localFile string, extra *RputExtra) *UploadHandle {
+	return p.putAsync(ctx, extra, func(ctx context.Context, extra *RputExtra) error {
+		return p.rputFile(ctx, ret, upToken, key, true, localFile, extra)
+	})
+}
+
+func (p *ResumeUploader) putAsync(
+	ctx context.Context, extra *RputExtra, put func(ctx context.Context, extra *RputExtra) error) *UploadHandle {
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+
+	// 在副本上设置 pause，上传结束之后将进度写回调用方的 extra，用于之后断点续传
+	var e RputExtra
+	if extra != nil {
+		extraMu.Lock()
+		e = *extra
+		if extra.Progresses != nil {
+			e.Progresses = append([]BlkputRet(nil), extra.Progresses...)
+		}
+		extraMu.Unlock()
+	}
+	e.pause = new(pauseGate)
+
+	h := &UploadHandle{
+		cancel: cancel,
+		pause:  e.pause,
+		done:   make(chan error, 1),
+	}
+	go func() {
+		defer cancel()
+		err := put(ctx, &e)
+		writeBackProgresses(extra, &e)
+		h.done <- err
+	}()
+	return h
+}
+
+// Pause 暂停上传，正在上传的片会继续上传完毕，之后不再开始上传新的片，直到调用 Resume。
+// 暂停期间 RputExtra.Deadline 仍然计时。
+func (h *UploadHandle) Pause() {
+	h.pause.pause()
+}
+
+// Resume 继续一个被暂停的上传
+func (h *UploadHandle) Resume() {
+	h.pause.resume()
+}
+
+// Cancel 取消上传，取消之后 Done 返回 context.Canceled
+func (h *UploadHandle) Cancel() {
+	h.cancel()
+}
+
+// Done 返回一个 channel，上传结束之后从中可以读取到上传的结果，上传成功的时候为 nil。
+// 结果只会发送一次。
+func (h *UploadHandle) Done() <-chan error {
+	return h.done
+}
+
+// pauseGate 用来暂停分片上传，为 nil 的时候表示不支持暂停
+type pauseGate struct {
+	mu      sync.Mutex
+	resumed chan struct{} // 暂停的时候不为 nil，继续上传的时候关闭
+}
+
+func (g *pauseGate) pause() {
+	g.mu.Lock()
+	if g.resumed == nil {
+		g.resumed = make(chan struct{})
+	}
+	g.mu.Unlock()
+}
+
+func (g *pauseGate) resume() {
+	g.mu.Lock()
+	if g.resumed != nil {
+		close(g.resumed)
+		g.resumed = nil
+	}
+	g.mu.Unlock()
+}
+
+// wait 在暂停的时候等待继续上传，ctx 被取消的时候返回 ctx.Err()
+func (g *pauseGate) wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil || g == nil {
+		return err
+	}
+
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+	if resumed == nil {
+		return nil
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// 默认的分片上传阈值，大于该大小的文件使用分片上传
+const defaultPutThreshold = 4 * 1024 * 1024
+
+// 上传目录时默认同时上传的文件数量
+const defaultDirWorkers = 4
+
+// Uploader 根据文件大小自动选择表单上传或者分片上传，小文件使用表单上传，大文件使用分片上传
+type Uploader struct {
+	Form   *FormUploader
+	Resume *ResumeUploader
+
+	// 可选。使用分片上传的文件大小阈值，大于该大小的文件使用分片上传，不设定则为4M
+	PutThreshold int64
+}
+
+// NewUploader 用来构建一个自动选择上传方式的上传对象
+func NewUploader(cfg *Config) *Uploader {
+	return &Uploader{
+		Form:   NewFormUploader(cfg),
+		Resume: NewResumeUploader(cfg),
+	}
+}
+
+// NewUploaderEx 用来构建一个自动选择上传方式的上传对象
+func NewUploaderEx(cfg *Config, client *Client) *Uploader {
+	return &Uploader{
+		Form:   NewFormUploaderEx(cfg, client),
+		Resume: NewResumeUploaderEx(cfg, client),
+	}
+}
+
+// PutFileAuto 用来上传一个本地文件，文件大小不超过 PutThreshold 的时候使用表单上传，否则使用分片上传。
+//
+// ctx       是请求的上下文。
+// ret       是上传成功后返回的数据。如果 upToken 中没有设置 CallbackUrl 或 ReturnBody，那么返回的数据结构是 PutRet 结构。
+// upToken   是由业务服务器颁发的上传凭证。
+// key       是要上传的文件访问路径。比如："foo/bar.jpg"。注意我们建议 key 不要以 '/' 开头。另外，key 为空字符串是合法的。
+// localFile 是要上传的文件的本地路径。
+// extra     是上传的一些可选项，可以指定为nil。详细见 RputExtra 结构的描述。
+//
+// 使用表单上传的时候 extra 中只有 Params、Metadata、UpHost、MimeType、OnProgress、RateLimit、VerifyEtag、SkipIfExists 和 BucketManager 生效。
+func (p *Uploader) PutFileAuto(
+	ctx context.Context, ret interface{}, upToken, key, localFile string, extra *RputExtra) (err error) {
+	return p.putFileAuto(ctx, ret, upToken, key, true, localFile, extra)
+}
+
+// PutFileAutoWithoutKey 用来上传一个本地文件，不指定文件上传后保存的 key，根据文件大小自动选择上传方式。
+// 文件命名方式首先看看 upToken 中是否设置了 saveKey，如果设置了 saveKey，那么按 saveKey 要求的规则生成 key，
+// 否则自动以文件的 hash 做 key。
+func (p *Uploader) PutFileAutoWithoutKey(
+	ctx context.Context, ret interface{}, upToken, localFile string, extra *RputExtra) (err error) {
+	return p.putFileAuto(ctx, ret, upToken, "", false, localFile, extra)
+}
+
+func (p *Uploader) putFileAuto(
+	ctx context.Context, ret interface{}, upToken string,
+	key string, hasKey bool, localFile string, extra *RputExtra) (err error) {
+
+	fi, err := os.Stat(localFile)
+	if err != nil {
+		return
+	}
+
+	if fi.Size() > p.putThreshold() {
+		return p.Resume.rputFile(ctx, ret, upToken, key, hasKey, localFile, extra)
+	}
+	return p.Form.putFile(ctx, ret, upToken, key, hasKey, localFile, formPutExtra(extra))
+}
+
+func (p *Uploader) putThreshold() int64 {
+	if p.PutThreshold > 0 {
+		return p.PutThreshold
+	}
+	return defaultPutThreshold
+}
+
+// formPutExtra 将分片上传的可选项转换为表单上传的可选项
+func formPutExtra(extra *RputExtra) *PutExtra {
+	if extra == nil {
+		return nil
+	}
+	return &PutExtra{
+		Params:     extra.Params,
+		Metadata:   extra.Metadata,
+		UpHost:     extra.UpHost,
+		MimeType:   extra.MimeType,
+		OnProgress: extra.OnProgress,
+		RateLimit:  extra.RateLimit,
+		VerifyEtag: extra.VerifyEtag,
+
+		SkipIfExists:  extra.SkipIfExists,
+		BucketManager: extra.BucketManager,
+	}
+}
+
+// DirPutOptions 为上传目录的可选项
+type DirPutOptions struct {
+	// 可选。同时上传的文件数量，不设定则为4。每个文件使用分片上传的时候仍然按照 Settings.Workers 并行上传块
+	Workers int
+
+	// 可选。根据文件相对于上传目录的路径（以 '/' 分隔）生成文件的 key，不设定则为 keyPrefix 加上相对路径
+	KeyFunc func(keyPrefix, relPath string) string
+
+	// 可选。设置之后上传前先查询文件是否已经存在，已经存在而且 hash 和本地文件的 etag 一致的时候跳过该文件
+	BucketManager *BucketManager
+
+	// 可选。每个文件的上传可选项，会为每个文件复制一份，其中的 Progresses 和 Recorder 不生效
+	Extra *RputExtra
+
+	// 可选。每个文件上传完毕（或者跳过、失败）之后的回调，多个文件并行上传的时候会被并发调用
+	OnResult func(result DirPutResult)
+}
+
+// DirPutResult 表示上传目录时单个文件的上传结果
+type DirPutResult struct {
+	LocalFile string
+	Key       string
+	Skipped   bool // 文件已经存在并且内容一致，没有上传
+	Err       error
+	PutRet    PutRet
+}
+
+// RputDir 用来上传一个本地目录下的全部文件（包括子目录），文件的 key 默认为 keyPrefix 加上文件相对于 localDir 的路径。
+// 每个文件根据大小自动选择表单上传或者分片上传，upToken 的 scope 需要允许上传所有的 key，比如只指定 bucket。
+// 全部文件都尝试上传之后返回第一个上传失败的文件的错误，每个文件的上传结果通过 opts.OnResult 回调获取。
+func (p *Uploader) RputDir(ctx context.Context, upToken, keyPrefix, localDir string, opts *DirPutOptions) (err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if opts == nil {
+		opts = &DirPutOptions{}
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = defaultDirWorkers
+	}
+	keyFunc := opts.KeyFunc
+	if keyFunc == nil {
+		keyFunc = func(keyPrefix, relPath string) string {
+			return keyPrefix + relPath
+		}
+	}
+	_, bucket, err := getAkBucketFromUploadToken(upToken)
+	if err != nil {
+		return
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, workers)
+
+	walkErr := filepath.Walk(localDir, func(localFile string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(localDir, localFile)
+		if err != nil {
+			return err
+		}
+		key := keyFunc(keyPrefix, filepath.ToSlash(relPath))
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			result := p.putDirFile(ctx, upToken, bucket, key, localFile, fi, opts)
+			if result.Err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = result.Err
+				}
+				mu.Unlock()
+			}
+			if opts.OnResult != nil {
+				opts.OnResult(result)
+			}
+		}()
+		return nil
+	})
+
+	wg.Wait()
+	if walkErr != nil {
+		return walkErr
+	}
+	return firstErr
+}
+
+// putDirFile 上传目录中的一个文件，设置了 opts.BucketManager 的时候跳过已经存在而且内容一致的文件
+func (p *Uploader) putDirFile(
+	ctx context.Context, upToken, bucket, key, localFile string, fi os.FileInfo, opts *DirPutOptions) (result DirPutResult) {
+
+	result.LocalFile = localFile
+	result.Key = key
+
+	if opts.BucketManager != nil {
+		if info, sErr := opts.BucketManager.Stat(bucket, key); sErr == nil && info.Fsize == fi.Size() {
+			if etag, eErr := fileEtag(localFile); eErr == nil && etag == info.Hash {
+				result.Skipped = true
+				result.PutRet = PutRet{Key: key, Hash: etag}
+				return
+			}
+		}
+	}
+
+	var extra RputExtra
+	if opts.Extra != nil {
+		extra = *opts.Extra
+		extra.Progresses = nil
+		extra.Recorder = nil
+	}
+	result.Err = p.putFileAuto(ctx, &result.PutRet, upToken, key, true, localFile, &extra)
+	return
+}
+
+// fileEtag 计算本地文件的 etag
+func fileEtag(localFile string) (etag string, err error) {
+	f, err := os.Open(localFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return
+	}
+	return Etag(f, fi.Size())
+}
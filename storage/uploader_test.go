@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestUploaderPutFileAuto(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	uploader := NewUploader(nil)
+	uploader.PutThreshold = 1024 * 1024
+
+	for _, size := range []int{1024, 5*1024*1024 + 1} {
+		data := make([]byte, size)
+		rand.Read(data)
+
+		f, err := ioutil.TempFile("", "uploader")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+		f.Write(data)
+		f.Close()
+
+		forms := server.forms
+		var putRet PutRet
+		extra := RputExtra{UpHost: server.URL, VerifyEtag: true}
+		err = uploader.PutFileAuto(context.Background(), &putRet, "token", "auto", f.Name(), &extra)
+		if err != nil {
+			t.Fatalf("Uploader#PutFileAuto() error, %s", err)
+		}
+		if !bytes.Equal(server.file("auto"), data) {
+			t.Fatalf("Uploader#PutFileAuto() error, uploaded data mismatch")
+		}
+		if useForm := server.forms > forms; useForm != (int64(size) <= uploader.PutThreshold) {
+			t.Fatalf("Uploader#PutFileAuto() error, size %d uploaded by form: %v", size, useForm)
+		}
+	}
+}
+
+func TestUploaderRputDir(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "uploader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string][]byte{
+		"a.txt":       []byte("a"),
+		"sub/b.txt":   []byte("bb"),
+		"sub/c/d.bin": make([]byte, 5*1024*1024),
+	}
+	for name, data := range files {
+		localFile := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(localFile), 0755)
+		if err = ioutil.WriteFile(localFile, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	putPolicy := PutPolicy{Scope: "bucket"}
+	upToken := putPolicy.UploadToken(mac)
+	uploader := NewUploader(nil)
+
+	var mu sync.Mutex
+	results := make(map[string]DirPutResult)
+	opts := DirPutOptions{
+		Extra:         &RputExtra{UpHost: server.URL},
+		BucketManager: NewBucketManager(mac, &Config{RsHost: server.URL}),
+		OnResult: func(result DirPutResult) {
+			mu.Lock()
+			results[result.Key] = result
+			mu.Unlock()
+		},
+	}
+	if err = uploader.RputDir(context.Background(), upToken, "dir/", dir, &opts); err != nil {
+		t.Fatalf("Uploader#RputDir() error, %s", err)
+	}
+	for name, data := range files {
+		if !bytes.Equal(server.file("dir/"+name), data) {
+			t.Fatalf("Uploader#RputDir() error, %s uploaded data mismatch", name)
+		}
+		if results["dir/"+name].Skipped {
+			t.Fatalf("Uploader#RputDir() error, %s should not be skipped", name)
+		}
+	}
+
+	// 再次上传同一个目录，内容没有变化的文件全部跳过
+	if err = uploader.RputDir(context.Background(), upToken, "dir/", dir, &opts); err != nil {
+		t.Fatalf("Uploader#RputDir() error, %s", err)
+	}
+	for name := range files {
+		if !results["dir/"+name].Skipped {
+			t.Fatalf("Uploader#RputDir() error, %s should be skipped", name)
+		}
+	}
+}
+
+func TestUploaderPutFileAutoSkipIfExists(t *testing.T) {
+	server := newFakeUpServer()
+	defer server.Close()
+
+	putPolicy := PutPolicy{Scope: "bucket"}
+	upToken := putPolicy.UploadToken(mac)
+	uploader := NewUploader(nil)
+	uploader.PutThreshold = 1024 * 1024
+
+	for _, size := range []int{1024, 5*1024*1024 + 1} {
+		data := make([]byte, size)
+		rand.Read(data)
+
+		f, err := ioutil.TempFile("", "uploader")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+		f.Write(data)
+		f.Close()
+
+		extra := RputExtra{
+			UpHost:        server.URL,
+			SkipIfExists:  true,
+			BucketManager: NewBucketManager(mac, &Config{RsHost: server.URL}),
+		}
+		var putRet PutRet
+		if err = uploader.PutFileAuto(context.Background(), &putRet, upToken, "skip", f.Name(), &extra); err != nil {
+			t.Fatalf("Uploader#PutFileAuto() error, %s", err)
+		}
+
+		forms, blocks := server.forms, len(server.blocks)
+		putRet = PutRet{}
+		if err = uploader.PutFileAuto(context.Background(), &putRet, upToken, "skip", f.Name(), &extra); err != nil {
+			t.Fatalf("Uploader#PutFileAuto() error, %s", err)
+		}
+		if server.forms != forms || len(server.blocks) != blocks {
+			t.Fatalf("Uploader#PutFileAuto() error, size %d should be skipped", size)
+		}
+		if etag, _ := Etag(bytes.NewReader(data), int64(size)); putRet.Key != "skip" || putRet.Hash != etag {
+			t.Fatalf("Uploader#PutFileAuto() error, unexpected PutRet %+v", putRet)
+		}
+	}
+}
@@ -1,15 +1,34 @@
 package storage
 
 import (
+	"strings"
 	"time"
 )
 
+// 用户自定义的文件元数据的前缀
+const metadataPrefix = "x-qn-meta-"
+
+// metadataKey 为没有 "x-qn-meta-" 前缀的元数据 key 加上前缀
+func metadataKey(key string) string {
+	if strings.HasPrefix(key, metadataPrefix) {
+		return key
+	}
+	return metadataPrefix + key
+}
+
 // ParsePutTime 提供了将PutTime转换为 time.Time 的功能
 func ParsePutTime(putTime int64) (t time.Time) {
 	t = time.Unix(0, putTime*100)
 	return
 }
 
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 // IsContextExpired 检查分片上传的ctx是否过期，提前一天让它过期
 // 因为我们认为如果断点继续上传的话，最长需要1天时间
 func IsContextExpired(blkPut BlkputRet) bool {
@@ -3,8 +3,10 @@ package storage
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Zone 为空间对应的机房属性，主要包括了上传，资源管理等操作的域名
@@ -28,44 +30,31 @@ func (z *Zone) String() string {
 	return str
 }
 
-func (z *Zone) GetRsfHost(useHttps bool) string {
-
-	scheme := "http://"
+// withScheme 为域名加上协议，已经指定了协议的域名保持不变，用于私有云等需要单独指定协议的场景
+func withScheme(host string, useHttps bool) string {
+	if strings.HasPrefix(host, "http://") || strings.HasPrefix(host, "https://") {
+		return host
+	}
 	if useHttps {
-		scheme = "https://"
+		return "https://" + host
 	}
+	return "http://" + host
+}
 
-	return fmt.Sprintf("%s%s", scheme, z.RsfHost)
+func (z *Zone) GetRsfHost(useHttps bool) string {
+	return withScheme(z.RsfHost, useHttps)
 }
 
 func (z *Zone) GetIoHost(useHttps bool) string {
-
-	scheme := "http://"
-	if useHttps {
-		scheme = "https://"
-	}
-
-	return fmt.Sprintf("%s%s", scheme, z.IovipHost)
+	return withScheme(z.IovipHost, useHttps)
 }
 
 func (z *Zone) GetRsHost(useHttps bool) string {
-
-	scheme := "http://"
-	if useHttps {
-		scheme = "https://"
-	}
-
-	return fmt.Sprintf("%s%s", scheme, z.RsHost)
+	return withScheme(z.RsHost, useHttps)
 }
 
 func (z *Zone) GetApiHost(useHttps bool) string {
-
-	scheme := "http://"
-	if useHttps {
-		scheme = "https://"
-	}
-
-	return fmt.Sprintf("%s%s", scheme, z.ApiHost)
+	return withScheme(z.ApiHost, useHttps)
 }
 
 // ZoneHuadong 表示华东机房
@@ -153,6 +142,55 @@ var Zone_z2 = ZoneHuanan
 var Zone_na0 = ZoneBeimei
 var Zone_as0 = ZoneXinjiapo
 
+// 机房的区域 ID，用于创建空间
+const (
+	RIDHuadong  = "z0"
+	RIDHuabei   = "z1"
+	RIDHuanan   = "z2"
+	RIDBeimei   = "na0"
+	RIDXinjiapo = "as0"
+)
+
+// getUpHost 根据配置获取空间所在机房的上传域名，被冻结的域名不会优先使用
+func getUpHost(cfg *Config, client *Client, ak, bucket string) (upHost string, err error) {
+	upHosts, err := getUpHosts(cfg, client, ak, bucket)
+	if err != nil {
+		return
+	}
+
+	upHost = orderUpHosts(upHosts, nil)[0]
+	return
+}
+
+// getUpHosts 根据配置获取空间所在机房的全部上传域名，优先使用的域名排在前面，其它的域名作为备用。
+// 没有设置 cfg.Zone 的时候使用 client 查询机房信息
+func getUpHosts(cfg *Config, client *Client, ak, bucket string) (upHosts []string, err error) {
+	var zone *Zone
+	if cfg.Zone != nil {
+		zone = cfg.Zone
+	} else {
+		if v, zoneErr := getZone(context.TODO(), client, cfg.UcReqHost(), ak, bucket); zoneErr != nil {
+			err = zoneErr
+			return
+		} else {
+			zone = v
+		}
+	}
+
+	hosts, backupHosts := zone.SrcUpHosts, zone.CdnUpHosts
+	if cfg.UseCdnDomains {
+		hosts, backupHosts = zone.CdnUpHosts, zone.SrcUpHosts
+	}
+
+	for _, host := range hosts {
+		upHosts = append(upHosts, withScheme(host, cfg.useHTTPS()))
+	}
+	for _, host := range backupHosts {
+		upHosts = append(upHosts, withScheme(host, cfg.useHTTPS()))
+	}
+	return
+}
+
 // UcHost 为查询空间相关域名的API服务地址
 const UcHost = "https://uc.qbox.me"
 
@@ -170,18 +208,31 @@ type UcQueryUp struct {
 	Info   string   `json:"info,omitempty"`
 }
 
+// defaultZoneTTL 为查询结果中没有 ttl 的时候机房信息的缓存时间
+const defaultZoneTTL = 24 * time.Hour
+
+type zoneCacheEntry struct {
+	zone      *Zone
+	expiresAt time.Time
+}
+
 var (
 	zoneMutext sync.RWMutex
-	zoneCache  = make(map[string]*Zone)
+	zoneCache  = make(map[string]zoneCacheEntry)
 )
 
-// GetZone 用来根据ak和bucket来获取空间相关的机房信息
+// GetZone 用来根据ak和bucket来获取空间相关的机房信息，查询结果按照服务端返回的 ttl 缓存
 func GetZone(ak, bucket string) (zone *Zone, err error) {
-	zoneID := fmt.Sprintf("%s:%s", ak, bucket)
+	return getZone(context.TODO(), nil, UcHost, ak, bucket)
+}
+
+// getZone 查询空间所在的机房，client 为 nil 的时候使用 DefaultClient
+func getZone(ctx context.Context, client *Client, ucHost, ak, bucket string) (zone *Zone, err error) {
+	zoneID := fmt.Sprintf("%s:%s:%s", ucHost, ak, bucket)
 	//check from cache
 	zoneMutext.RLock()
-	if v, ok := zoneCache[zoneID]; ok {
-		zone = v
+	if v, ok := zoneCache[zoneID]; ok && time.Now().Before(v.expiresAt) {
+		zone = v.zone
 	}
 	zoneMutext.RUnlock()
 	if zone != nil {
@@ -189,16 +240,39 @@ func GetZone(ak, bucket string) (zone *Zone, err error) {
 	}
 
 	//query from server
-	reqURL := fmt.Sprintf("%s/v2/query?ak=%s&bucket=%s", UcHost, ak, bucket)
+	zone, ttl, err := queryZone(ctx, client, ucHost, ak, bucket)
+	if err != nil {
+		return
+	}
+
+	zoneMutext.Lock()
+	zoneCache[zoneID] = zoneCacheEntry{zone: zone, expiresAt: time.Now().Add(ttl)}
+	zoneMutext.Unlock()
+	return
+}
+
+// queryZone 调用 /v2/query 接口查询空间所在机房的域名
+func queryZone(ctx context.Context, client *Client, ucHost, ak, bucket string) (zone *Zone, ttl time.Duration, err error) {
+	if client == nil {
+		client = &DefaultClient
+	}
+	query := url.Values{}
+	query.Set("ak", ak)
+	query.Set("bucket", bucket)
+	reqURL := fmt.Sprintf("%s/v2/query?%s", strings.TrimRight(ucHost, "/"), query.Encode())
 	var ret UcQueryRet
-	ctx := context.TODO()
-	qErr := DefaultClient.CallWithForm(ctx, &ret, "GET", reqURL, nil, nil)
+	qErr := client.CallWithForm(ctx, &ret, "GET", reqURL, nil, nil)
 	if qErr != nil {
 		err = fmt.Errorf("query zone error, %s", qErr.Error())
 		return
 	}
 
-	ioHost := ret.Io["src"]["main"][0]
+	ioHosts := ret.Io["src"]["main"]
+	if len(ioHosts) == 0 {
+		err = fmt.Errorf("query zone error, no io host for bucket %s", bucket)
+		return
+	}
+	ioHost := ioHosts[0]
 	srcUpHosts := ret.Up["src"].Main
 	if ret.Up["src"].Backup != nil {
 		srcUpHosts = append(srcUpHosts, ret.Up["src"].Backup...)
@@ -220,9 +294,10 @@ func GetZone(ak, bucket string) (zone *Zone, err error) {
 	//set specific hosts if possible
 	setSpecificHosts(ioHost, zone)
 
-	zoneMutext.Lock()
-	zoneCache[zoneID] = zone
-	zoneMutext.Unlock()
+	ttl = defaultZoneTTL
+	if ret.TTL > 0 {
+		ttl = time.Duration(ret.TTL) * time.Second
+	}
 	return
 }
 